@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"aproxymate/lib"
+	log "aproxymate/lib/logger"
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench <name>",
+	Short: "Measure tunnel throughput and latency for a proxy's cluster",
+	Long: `Measure how fast traffic moves through an aproxymate tunnel.
+
+A temporary benchmark pod with discard and echo servers is created in the named
+proxy's Kubernetes cluster. Data is pushed through the local port-forward twice:
+once directly to the servers and once through a socat relay, the same hop used by
+proxy pods. The difference shows the overhead socat adds over direct forwarding.
+
+The proxy's remote host is not contacted.
+
+Examples:
+  aproxymate bench "Internal Database"
+  aproxymate bench redis-staging --size 256 --pings 50`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opCtx, _ := log.StartOperation(context.Background(), "bench", "tunnel_benchmark")
+		outputCtx := lib.NewOutputContext(opCtx)
+
+		sizeMiB, _ := cmd.Flags().GetInt("size")
+		pings, _ := cmd.Flags().GetInt("pings")
+		if sizeMiB <= 0 || pings <= 0 {
+			outputCtx.UserErrorAndExit("--size and --pings must be positive\n")
+		}
+
+		if viper.ConfigFileUsed() == "" {
+			lib.EnsureConfigLoaded()
+		}
+
+		var config lib.AppConfig
+		if err := viper.Unmarshal(&config); err != nil {
+			outputCtx.UserErrorAndExit("Error parsing configuration file: %v\n", err)
+		}
+
+		proxyConfig, _, err := lib.FindProxyConfig(config.ProxyConfigs, args[0])
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+		if proxyConfig.KubernetesCluster == "" {
+			outputCtx.UserErrorAndExit("Proxy '%s' has no Kubernetes cluster. Please run: aproxymate config fix\n", proxyConfig.Name)
+		}
+
+		fmt.Printf("⏱️  Benchmarking tunnels to cluster '%s' (%d MiB, %d pings)...\n", proxyConfig.KubernetesCluster, sizeMiB, pings)
+
+		results, err := lib.RunTunnelBenchmark(lib.BenchOptions{
+			KubernetesCluster: proxyConfig.KubernetesCluster,
+			Bytes:             int64(sizeMiB) * 1024 * 1024,
+			Pings:             pings,
+		})
+		opCtx.Complete("tunnel_benchmark", err)
+		if err != nil {
+			outputCtx.UserErrorAndExit("Benchmark failed: %v\n", err)
+		}
+
+		fmt.Printf("\n%-12s %12s %10s %10s %10s %10s\n", "PATH", "THROUGHPUT", "LAT MIN", "LAT AVG", "LAT P95", "LAT MAX")
+		for _, result := range results {
+			fmt.Printf("%-12s %7.2f MiB/s %10s %10s %10s %10s\n",
+				result.Mode,
+				result.Throughput,
+				result.LatencyMin.Round(time.Microsecond),
+				result.LatencyAvg.Round(time.Microsecond),
+				result.LatencyP95.Round(time.Microsecond),
+				result.LatencyMax.Round(time.Microsecond))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().Int("size", 64, "Amount of data to push through the tunnel, in MiB")
+	benchCmd.Flags().Int("pings", 20, "Number of round trips for the latency test")
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"aproxymate/lib"
+	log "aproxymate/lib/logger"
+)
+
+// cleanupCmd represents the cleanup command
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Find and delete leftover aproxymate pods",
+	Long: `Find aproxymate pods in Kubernetes and delete them after confirmation.
+
+By default only your own pods in the clusters and namespaces referenced by the
+configuration are considered. Platform admins can widen the search to other users,
+contexts and namespaces. Matching pods are always listed before anything is deleted.
+
+Examples:
+  aproxymate cleanup
+  aproxymate cleanup --all-users --older-than 24h --context prod
+  aproxymate cleanup --all-users --all-namespaces --context prod --yes --report cleanup.json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opCtx, _ := log.StartOperation(context.Background(), "cleanup", "admin_cleanup")
+		outputCtx := lib.NewOutputContext(opCtx)
+
+		contexts, _ := cmd.Flags().GetStringSlice("context")
+		namespaces, _ := cmd.Flags().GetStringSlice("namespace")
+		allNamespaces, _ := cmd.Flags().GetBool("all-namespaces")
+		allUsers, _ := cmd.Flags().GetBool("all-users")
+		user, _ := cmd.Flags().GetString("user")
+		olderThan, _ := cmd.Flags().GetDuration("older-than")
+		yes, _ := cmd.Flags().GetBool("yes")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		reportPath, _ := cmd.Flags().GetString("report")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		targets := cleanupTargets(contexts, namespaces, allNamespaces)
+		if len(targets) == 0 {
+			outputCtx.UserErrorAndExit("No Kubernetes contexts to search. Use --context or add proxies to the configuration.\n")
+		}
+
+		filter := lib.PodFilter{Targets: targets, User: user, AllUsers: allUsers, OlderThan: olderThan}
+		pods, errs := lib.FindManagedPods(filter, timeout)
+		for _, err := range errs {
+			outputCtx.Warn("Cleanup search failed", "⚠️  %v\n", err)
+		}
+
+		if len(pods) == 0 {
+			fmt.Println("✅ No matching aproxymate pods found.")
+			opCtx.Complete("admin_cleanup", nil)
+			return
+		}
+
+		fmt.Printf("Found %d matching aproxymate pod(s):\n\n", len(pods))
+		fmt.Printf("%-20s %-16s %-50s %-16s %-10s %s\n", "CONTEXT", "NAMESPACE", "POD", "USER", "PHASE", "AGE")
+		for _, pod := range pods {
+			fmt.Printf("%-20s %-16s %-50s %-16s %-10s %s\n",
+				pod.Cluster, pod.Namespace, pod.Name, pod.User, pod.Phase, time.Since(pod.CreatedAt).Round(time.Minute))
+		}
+		fmt.Println()
+
+		if dryRun {
+			fmt.Println("Dry run: no pods were deleted.")
+			opCtx.Complete("admin_cleanup", nil)
+			return
+		}
+
+		if !yes {
+			confirmed, cancelled, err := lib.PromptPodCleanupConfirmation(pods)
+			if err != nil {
+				outputCtx.UserErrorAndExit("%v\nUse --yes to delete without confirmation.\n", err)
+			}
+			if cancelled || !confirmed {
+				fmt.Println("Cleanup cancelled.")
+				opCtx.Complete("admin_cleanup", nil)
+				return
+			}
+		}
+
+		report := lib.DeleteManagedPods(pods, timeout)
+		fmt.Printf("🧹 Deleted %d pod(s)", len(report.Deleted))
+		if len(report.Failed) > 0 {
+			fmt.Printf(", %d failed:\n", len(report.Failed))
+			for _, failure := range report.Failed {
+				fmt.Printf("  • %s/%s: %s\n", failure.Pod.Cluster, failure.Pod.Name, failure.Error)
+			}
+		} else {
+			fmt.Println()
+		}
+
+		if reportPath != "" {
+			if err := writeCleanupReport(reportPath, report); err != nil {
+				outputCtx.UserError("Failed to write report: %v\n", err)
+			} else if reportPath != "-" {
+				fmt.Printf("📄 Report written to %s\n", reportPath)
+			}
+		}
+
+		opCtx.Complete("admin_cleanup", nil)
+		if len(report.Failed) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// cleanupTargets builds the contexts and namespaces to search from the flags, falling back to
+// the clusters and namespaces referenced by the configuration
+func cleanupTargets(contexts, namespaces []string, allNamespaces bool) lib.CleanupTargets {
+	configTargets := lib.CleanupTargets{}
+	if len(contexts) == 0 || (len(namespaces) == 0 && !allNamespaces) {
+		if viper.ConfigFileUsed() == "" {
+			lib.EnsureConfigLoaded()
+		}
+		var config lib.AppConfig
+		if err := viper.Unmarshal(&config); err == nil {
+			configTargets = lib.CleanupTargetsForConfigs(config.ProxyConfigs)
+		}
+	}
+
+	if len(contexts) == 0 {
+		for cluster := range configTargets {
+			contexts = append(contexts, cluster)
+		}
+	}
+
+	targets := lib.CleanupTargets{}
+	for _, cluster := range contexts {
+		switch {
+		case allNamespaces:
+			targets[cluster] = []string{""}
+		case len(namespaces) > 0:
+			targets[cluster] = namespaces
+		case len(configTargets[cluster]) > 0:
+			targets[cluster] = configTargets[cluster]
+		default:
+			targets[cluster] = []string{lib.DefaultNamespace()}
+		}
+	}
+	return targets
+}
+
+// writeCleanupReport writes the report as JSON to a file, or to stdout for "-"
+func writeCleanupReport(path string, report lib.CleanupReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func init() {
+	rootCmd.AddCommand(cleanupCmd)
+
+	cleanupCmd.Flags().StringSlice("context", nil, "Kubernetes contexts to search (default: clusters in the configuration)")
+	cleanupCmd.Flags().StringSliceP("namespace", "n", nil, "Namespaces to search (default: namespaces in the configuration)")
+	cleanupCmd.Flags().Bool("all-namespaces", false, "Search all namespaces")
+	cleanupCmd.Flags().Bool("all-users", false, "Include pods created by all users (admin)")
+	cleanupCmd.Flags().String("user", "", "Only include pods created by this user (default: you)")
+	cleanupCmd.Flags().Duration("older-than", 0, "Only include pods older than this, e.g. 24h")
+	cleanupCmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation")
+	cleanupCmd.Flags().Bool("dry-run", false, "Only list matching pods")
+	cleanupCmd.Flags().String("report", "", "Write a JSON report of deleted pods to this file ('-' for stdout)")
+	cleanupCmd.Flags().Duration("timeout", 30*time.Second, "Timeout for each Kubernetes request")
+}
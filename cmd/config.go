@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,8 +38,8 @@ var configCmd = &cobra.Command{
 	Long: `Generate a sample configuration file that can be used to pre-populate proxy configurations.
 
 The config file will be created in YAML format and can be customized to include your 
-specific proxy configurations. By default, it will be created as 'aproxymate.yaml' 
-in your home directory.`,
+specific proxy configurations. By default, it will be created as 'aproxymate/config.yaml'
+in your user config directory.`,
 }
 
 // initCmd represents the config init command
@@ -46,8 +48,10 @@ var initCmd = &cobra.Command{
 	Short: "Initialize a sample configuration file",
 	Long: `Create a sample configuration file with example proxy configurations.
 
-This command will create a 'aproxymate.yaml' file in your home directory (or the path 
-specified with --output) with sample proxy configurations that you can customize.`,
+This command will create a 'config.yaml' file in the aproxymate directory of your user
+config directory ($XDG_CONFIG_HOME/aproxymate/config.yaml, ~/.config/aproxymate/config.yaml
+or ~/Library/Application Support/aproxymate/config.yaml on macOS), or at the path
+specified with --output, with sample proxy configurations that you can customize.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		output, _ := cmd.Flags().GetString("output")
 		force, _ := cmd.Flags().GetBool("force")
@@ -64,6 +68,17 @@ specified with --output) with sample proxy configurations that you can customize
 				outputCtx := lib.NewSimpleOutputContext()
 				outputCtx.UserErrorAndExit("Error getting default config path: %v\n", err)
 			}
+
+			// A config in the home directory keeps working, but a new default one would hide it
+			for _, legacy := range []func() (string, error){lib.GetHomeConfigPath, lib.GetHomeHiddenConfigPath} {
+				if path, err := legacy(); err == nil && !force {
+					if _, err := os.Stat(path); err == nil {
+						outputCtx := lib.NewOutputContext(opCtx)
+						outputCtx.Warn("Configuration file already exists in the home directory, not creating another", "Config file already exists at %s and is still used. Move it to %s to use the new location, or use --force to create a new file there that takes precedence.\n", path, output)
+						os.Exit(1)
+					}
+				}
+			}
 		}
 
 		// Check if file exists and force flag is not set
@@ -107,6 +122,10 @@ specified with --output) with sample proxy configurations that you can customize
 			outputCtx.UserErrorAndExit("Error marshaling config: %v\n", err)
 		}
 
+		if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			outputCtx := lib.NewSimpleOutputContext()
+			outputCtx.UserErrorAndExit("Error creating config directory: %v\n", err)
+		}
 		if err := os.WriteFile(output, data, 0644); err != nil {
 			outputCtx := lib.NewSimpleOutputContext()
 			outputCtx.UserErrorAndExit("Error writing config file: %v\n", err)
@@ -247,17 +266,25 @@ var showCmd = &cobra.Command{
 // configFixCmd represents the config fix command
 var configFixCmd = &cobra.Command{
 	Use:   "fix",
-	Short: "Fix configuration issues like missing Kubernetes clusters",
+	Short: "Fix configuration issues like missing Kubernetes clusters and port conflicts",
 	Long: `Check the configuration file for common issues and fix them interactively.
 
 This command will:
-- Check for proxy configurations missing kubernetes_cluster fields
-- Prompt you to select a cluster for configurations that need one
-- Update and save the configuration file with the fixes
+- Group proxy configurations missing kubernetes_cluster by the domain of their
+  remote host, and ask for the cluster of each group or of each entry, unless
+  it was given with --cluster
+- Ask for remote ports outside 1-65535, again until the answer is valid
+- Move local ports that are invalid or used by an earlier entry to a free port
+- Save the fixes that were made, even when some entries were skipped
+
+Issues that were skipped are listed, and the command exits with status 1 until
+they are fixed.
 
 Example:
   aproxymate config fix
-  aproxymate config fix --config ./my-config.yaml`,
+  aproxymate config fix --config ./my-config.yaml
+  aproxymate config fix --cluster orders-db=eks-prod --cluster billing-db=eks-billing
+  aproxymate config fix --cluster eks-dev   # every entry without a cluster`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Ensure viper is properly initialized and attempts to read config
 		if viper.ConfigFileUsed() == "" {
@@ -289,6 +316,13 @@ Example:
 
 		fmt.Printf("Checking configuration file: %s\n", absPath)
 
+		// Remember what was read so changes made while prompting are not overwritten
+		configVersion, err := lib.ConfigFileVersion(configFile)
+		if err != nil {
+			outputCtx := lib.NewSimpleOutputContext()
+			outputCtx.UserErrorAndExit("Error reading config file: %v\n", err)
+		}
+
 		// Try to load and parse the config
 		var config lib.AppConfig
 		if err := viper.Unmarshal(&config); err != nil {
@@ -304,57 +338,191 @@ Example:
 
 		fmt.Printf("Found %d proxy configuration(s)\n", len(config.ProxyConfigs))
 
-		// Check for missing clusters
-		missingClusterConfigs := lib.FindConfigsWithMissingClusters(config.ProxyConfigs)
-
-		if len(missingClusterConfigs) == 0 {
-			fmt.Println("✅ All configurations have Kubernetes clusters specified. No fixes needed.")
-			return
+		policy, err := config.PortPolicy()
+		if err != nil {
+			outputCtx := lib.NewSimpleOutputContext()
+			outputCtx.UserErrorAndExit("%v\n", err)
 		}
 
-		fmt.Printf("\n⚠️  Found %d configuration(s) missing Kubernetes cluster:\n", len(missingClusterConfigs))
-		for i, proxyConfig := range missingClusterConfigs {
-			fmt.Printf("  %d. %s (%s:%d)\n", i+1, proxyConfig.Name, proxyConfig.RemoteHost, proxyConfig.RemotePort)
+		clusterValues, _ := cmd.Flags().GetStringArray("cluster")
+		assignments, err := lib.ParseClusterAssignments(clusterValues)
+		if err != nil {
+			outputCtx := lib.NewSimpleOutputContext()
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+		for _, cluster := range assignments.Clusters() {
+			if valid, err := lib.ValidateKubernetesCluster(cluster); err != nil || !valid {
+				outputCtx := lib.NewSimpleOutputContext()
+				outputCtx.UserErrorAndExit("Cluster '%s' not found in your kubeconfig\n", cluster)
+			}
 		}
 
-		// Prompt for cluster selection
-		selectedCluster, err := lib.SelectKubernetesClusterTUI("")
+		// Local port problems and clusters given with --cluster are fixed without asking; the
+		// other clusters and remote ports need answers
+		remotePorts := lib.FindInvalidRemotePorts(config.ProxyConfigs)
+		updated, changes := lib.FixLocalPorts(config.ProxyConfigs, policy)
+		assigned, err := lib.AssignClusters(updated, assignments)
 		if err != nil {
 			outputCtx := lib.NewSimpleOutputContext()
-			outputCtx.UserErrorAndExit("Error selecting cluster: %v\n", err)
+			outputCtx.UserErrorAndExit("%v\n", err)
 		}
+		groups := lib.GroupMissingClusters(updated)
 
-		// Update configurations with the selected cluster
-		updatedConfigs := lib.UpdateConfigsWithCluster(config.ProxyConfigs, selectedCluster)
+		if len(groups) == 0 && len(remotePorts) == 0 && len(changes) == 0 && len(assigned) == 0 {
+			fmt.Println("✅ All configurations have a Kubernetes cluster and valid, unique ports. No fixes needed.")
+			return
+		}
+		printFixProblems(config.ProxyConfigs, groups, remotePorts, changes)
+		for _, index := range assigned {
+			changes = append(changes, fmt.Sprintf("%s: set kubernetes_cluster to '%s'", updated[index].Name, updated[index].KubernetesCluster))
+		}
 
-		// Save the updated configuration
-		finalConfig := lib.AppConfig{
-			ProxyConfigs: updatedConfigs,
+		// A step that is skipped or fails leaves its entries for the next run; the rest is still saved
+		var unresolved []string
+		var promptErr error
+		// askCluster skips the remaining entries once a prompt failed, e.g. without a terminal
+		askCluster := func(title string, perEntry bool) lib.ClusterChoice {
+			if promptErr != nil {
+				return lib.ClusterChoice{Skip: true}
+			}
+			choice, err := lib.SelectClusterForEntriesTUI(title, perEntry)
+			if err != nil {
+				promptErr = err
+				return lib.ClusterChoice{Skip: true}
+			}
+			return choice
+		}
+		for _, group := range groups {
+			choice := askCluster(clusterGroupTitle(updated, group), len(group.Indexes) > 1)
+			for _, index := range group.Indexes {
+				entry := &updated[index]
+				entryChoice := choice
+				if choice.PerEntry {
+					entryChoice = askCluster(fmt.Sprintf("Select the Kubernetes cluster of '%s' (%s):", entry.Name, entry.RemoteHost), false)
+				}
+				if entryChoice.Skip {
+					unresolved = append(unresolved, fmt.Sprintf("%s: missing kubernetes_cluster", entry.Name))
+					continue
+				}
+				entry.KubernetesCluster = entryChoice.Cluster
+				changes = append(changes, fmt.Sprintf("%s: set kubernetes_cluster to '%s'", entry.Name, entryChoice.Cluster))
+			}
 		}
 
-		data, err := yaml.Marshal(&finalConfig)
-		if err != nil {
-			outputCtx := lib.NewSimpleOutputContext()
-			outputCtx.UserErrorAndExit("Error marshaling config: %v\n", err)
+		// Invalid remote ports are asked for until a valid port is entered or the entry is skipped
+		for _, problem := range remotePorts {
+			name := updated[problem.Index].Name
+			port := 0
+			for promptErr == nil && port == 0 {
+				title := fmt.Sprintf("Remote port of '%s' (%s is %d):", name, problem.Setting(), problem.Port)
+				input, cancelled, err := lib.PromptTextInput(title, "e.g. 5432")
+				if err != nil {
+					promptErr = err
+					break
+				}
+				if cancelled {
+					break
+				}
+				value, err := strconv.Atoi(strings.TrimSpace(input))
+				if err != nil || value < 1 || value > 65535 {
+					fmt.Printf("❌ %q is not a port between 1 and 65535, try again (Esc skips this entry)\n", input)
+					continue
+				}
+				port = value
+			}
+			if port == 0 {
+				unresolved = append(unresolved, fmt.Sprintf("%s: %s is %d", name, problem.Setting(), problem.Port))
+				continue
+			}
+			problem.Apply(updated, port)
+			changes = append(changes, fmt.Sprintf("%s: set %s to %d", name, problem.Setting(), port))
 		}
 
-		if err := os.WriteFile(configFile, data, 0644); err != nil {
+		if promptErr != nil {
 			outputCtx := lib.NewSimpleOutputContext()
-			outputCtx.UserErrorAndExit("Error writing config file: %v\n", err)
+			outputCtx.Warn("Stopped asking for fixes", "⚠️  Could not ask for the remaining fixes: %v\n", promptErr)
 		}
 
-		log.Debug("Configuration fixed successfully",
-			"file", absPath,
-			"cluster", selectedCluster,
-			"fixed_configs", len(missingClusterConfigs))
+		if len(changes) > 0 {
+			// Save the updated entries, keeping the rest of the file as written
+			if _, err := lib.SaveProxyConfigs(configFile, updated, configVersion); err != nil {
+				writeConfigFileError(err)
+			}
+
+			log.Debug("Configuration fixed",
+				"file", absPath,
+				"fixed", len(changes),
+				"unresolved", len(unresolved))
+
+			fmt.Printf("\n✅ Fixed %d issue(s):\n", len(changes))
+			for _, change := range changes {
+				fmt.Printf("  - %s\n", change)
+			}
+			fmt.Printf("Configuration saved to: %s\n", absPath)
+		}
+
+		if len(unresolved) > 0 {
+			fmt.Printf("\n⚠️  %d issue(s) still need attention:\n", len(unresolved))
+			for _, problem := range unresolved {
+				fmt.Printf("  - %s\n", problem)
+			}
+			fmt.Println("\nRun 'aproxymate config fix' again to fix them.")
+			os.Exit(1)
+		}
 
-		fmt.Printf("\n✅ Configuration fixed successfully!\n")
-		fmt.Printf("Updated %d configuration(s) with cluster: %s\n", len(missingClusterConfigs), selectedCluster)
-		fmt.Printf("Configuration saved to: %s\n", absPath)
 		fmt.Println("\nTo start the GUI with the fixed configuration:")
 		fmt.Printf("  aproxymate gui --config %s\n", absPath)
 	},
 }
+
+// printFixProblems lists what 'config fix' found: entries without a cluster by group, invalid
+// remote ports and the local port problems it fixes by itself
+func printFixProblems(configs []lib.ProxyConfig, groups []lib.ClusterGroup, remotePorts []lib.RemotePortProblem, portChanges []string) {
+	if len(groups) > 0 {
+		missing := 0
+		for _, group := range groups {
+			missing += len(group.Indexes)
+		}
+		fmt.Printf("\n⚠️  Found %d configuration(s) missing Kubernetes cluster, in %d group(s):\n", missing, len(groups))
+		for _, group := range groups {
+			fmt.Printf("  %s:\n", clusterGroupName(group))
+			for _, index := range group.Indexes {
+				fmt.Printf("    - %s (%s:%d)\n", configs[index].Name, configs[index].RemoteHost, configs[index].RemotePort)
+			}
+		}
+	}
+	if len(remotePorts) > 0 {
+		fmt.Printf("\n⚠️  Found %d invalid remote port(s):\n", len(remotePorts))
+		for _, problem := range remotePorts {
+			fmt.Printf("  - %s: %s is %d\n", configs[problem.Index].Name, problem.Setting(), problem.Port)
+		}
+	}
+	if len(portChanges) > 0 {
+		fmt.Printf("\n⚠️  Found %d invalid or duplicate local port(s), which get a free port:\n", len(portChanges))
+		for _, change := range portChanges {
+			fmt.Printf("  - %s\n", change)
+		}
+	}
+	fmt.Println()
+}
+
+// clusterGroupName describes the hosts of a group of entries without a cluster
+func clusterGroupName(group lib.ClusterGroup) string {
+	if group.Domain == "" {
+		return "Hosts without a domain"
+	}
+	return "Hosts in " + group.Domain
+}
+
+// clusterGroupTitle is the title of the cluster selection for a group of entries
+func clusterGroupTitle(configs []lib.ProxyConfig, group lib.ClusterGroup) string {
+	var names []string
+	for _, index := range group.Indexes {
+		names = append(names, configs[index].Name)
+	}
+	return fmt.Sprintf("Select the Kubernetes cluster of %s (%s):", clusterGroupName(group), strings.Join(names, ", "))
+}
+
 var configListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all proxy configurations from the config file",
@@ -364,8 +532,47 @@ This command shows detailed information about each proxy configuration including
 - Name and description
 - Kubernetes cluster
 - Remote host and port
-- Local port mapping`,
+- Local port mapping
+
+When the GUI is running, its proxies are listed with their connection state instead,
+filtered by the GUI with the same rules as its search box.
+
+With --verbose, each proxy also shows the file and line its entry is written at.
+
+Examples:
+  # Proxies whose name, cluster, host, port, namespace, description or owner contains "orders"
+  aproxymate config list --query orders
+
+  # Where each proxy is defined
+  aproxymate config list --verbose
+
+  # Connected proxies of one cluster (needs a running GUI)
+  aproxymate config list --cluster eks-prod --connected`,
 	Run: func(cmd *cobra.Command, args []string) {
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		filter := lib.ProxyFilter{}
+		filter.Query, _ = cmd.Flags().GetString("query")
+		filter.Cluster, _ = cmd.Flags().GetString("cluster")
+		if cmd.Flags().Changed("connected") {
+			connected, _ := cmd.Flags().GetBool("connected")
+			filter.Connected = &connected
+		}
+
+		running, err := lib.FindRunningGUI()
+		if err != nil {
+			log.Debug("Could not look for a running GUI", "error", err)
+		}
+		if running != nil {
+			proxies, total, err := running.Proxies(filter)
+			if err != nil {
+				outputCtx := lib.NewSimpleOutputContext()
+				outputCtx.UserErrorAndExit("%v\n", err)
+			}
+			fmt.Printf("Found %d of %d proxy configuration(s) in the GUI running at %s:\n\n", len(proxies), total, running.URL)
+			printProxyRows(proxies, true, verbose)
+			return
+		}
+
 		// Ensure viper is properly initialized and attempts to read config
 		if viper.ConfigFileUsed() == "" {
 			// Try to find and read config file using shared utility
@@ -389,6 +596,10 @@ This command shows detailed information about each proxy configuration including
 			return
 		}
 
+		if err := config.AnnotateSources(configFile); err != nil {
+			log.Debug("Could not record where the proxy entries are written", "file", configFile, "error", err)
+		}
+
 		if len(config.ProxyConfigs) == 0 {
 			fmt.Println("No proxy configurations found in the config file.")
 			fmt.Println("\nTo add configurations, you can:")
@@ -398,24 +609,465 @@ This command shows detailed information about each proxy configuration including
 			return
 		}
 
-		fmt.Printf("Found %d proxy configuration(s) in %s:\n\n", len(config.ProxyConfigs), configFile)
-
-		for i, proxy := range config.ProxyConfigs {
-			fmt.Printf("%d. %s\n", i+1, proxy.Name)
-			fmt.Printf("   Cluster: %s\n", proxy.KubernetesCluster)
-			fmt.Printf("   Remote:  %s:%d\n", proxy.RemoteHost, proxy.RemotePort)
-			fmt.Printf("   Local:   localhost:%d\n", proxy.LocalPort)
-
-			if i < len(config.ProxyConfigs)-1 {
-				fmt.Println()
+		// Without a running GUI no proxy is connected
+		var proxies []lib.ProxyRow
+		for _, proxy := range config.ProxyConfigs {
+			if filter.Matches(proxy, false) {
+				row := lib.ProxyRow{
+					Name:              proxy.Name,
+					KubernetesCluster: proxy.KubernetesCluster,
+					RemoteHost:        proxy.RemoteHost,
+					RemotePort:        proxy.RemotePort,
+					Local:             proxy.LocalEndpoint(),
+					Description:       proxy.Description,
+					Owner:             proxy.Owner,
+					DocsURL:           proxy.DocsURL,
+				}
+				if proxy.Source != nil {
+					row.Source = proxy.Source.String()
+				}
+				proxies = append(proxies, row)
 			}
 		}
 
+		if len(proxies) == len(config.ProxyConfigs) {
+			fmt.Printf("Found %d proxy configuration(s) in %s:\n\n", len(proxies), configFile)
+		} else {
+			fmt.Printf("Found %d of %d proxy configuration(s) in %s:\n\n", len(proxies), len(config.ProxyConfigs), configFile)
+		}
+		printProxyRows(proxies, false, verbose)
+
 		fmt.Printf("\nTo start the GUI with these configurations, run:\n")
 		fmt.Printf("  aproxymate gui --config %s\n", configFile)
 	},
 }
 
+// printProxyRows prints the proxies listed by 'config list', with their state when they come
+// from a running GUI and where they are written in the config file when verbose
+func printProxyRows(proxies []lib.ProxyRow, withState, verbose bool) {
+	for i, proxy := range proxies {
+		fmt.Printf("%d. %s\n", i+1, proxy.Name)
+		fmt.Printf("   Cluster: %s\n", proxy.KubernetesCluster)
+		fmt.Printf("   Remote:  %s:%d\n", proxy.RemoteHost, proxy.RemotePort)
+		fmt.Printf("   Local:   %s\n", proxy.Local)
+		if withState {
+			fmt.Printf("   State:   %s\n", proxy.State)
+		}
+		if proxy.Description != "" {
+			fmt.Printf("   About:   %s\n", proxy.Description)
+		}
+		if proxy.Owner != "" {
+			fmt.Printf("   Owner:   %s\n", proxy.Owner)
+		}
+		if proxy.DocsURL != "" {
+			fmt.Printf("   Docs:    %s\n", proxy.DocsURL)
+		}
+		if verbose && proxy.Source != "" {
+			fmt.Printf("   Source:  %s\n", proxy.Source)
+		}
+
+		if i < len(proxies)-1 {
+			fmt.Println()
+		}
+	}
+}
+
+// configLintCmd represents the config lint command
+var configLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Warn about config entries that work but are likely mistakes",
+	Long: `Check the configuration file for best-practice issues that validation lets through:
+
+- duplicate-endpoint: two entries relay to the same host and port through the same cluster
+- suspicious-port: privileged local ports, ports outside port_range, default database ports
+  and ports in the range used for outgoing connections
+- missing-namespace: relay pods would run in the "default" namespace
+- long-name: the name is shortened in relay pod names
+- unreachable-cluster: the cluster's API server is unreachable or rejects your credentials
+  (skipped with --offline)
+
+With --fix, privileged local ports and ports outside port_range are moved to the next free
+port, and entries without a namespace get the one the other entries of their cluster use.
+The command exits with status 1 while warnings remain, so it can run in CI.
+
+Examples:
+  aproxymate config lint
+  aproxymate config lint --offline
+  aproxymate config lint --fix`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outputCtx := lib.NewSimpleOutputContext()
+		fix, _ := cmd.Flags().GetBool("fix")
+		offline, _ := cmd.Flags().GetBool("offline")
+
+		if viper.ConfigFileUsed() == "" {
+			lib.EnsureConfigLoaded()
+		}
+		configFile := viper.ConfigFileUsed()
+		if configFile == "" {
+			fmt.Println("No configuration file is currently loaded.")
+			fmt.Println("\nTo create a sample configuration file, run:")
+			fmt.Println("  aproxymate config init")
+			return
+		}
+		absPath := lib.GetAbsolutePathForDisplay(configFile)
+
+		// Remember what was read so changes made in the meantime are not overwritten by --fix
+		configVersion, err := lib.ConfigFileVersion(configFile)
+		if err != nil {
+			outputCtx.UserErrorAndExit("Error reading config file: %v\n", err)
+		}
+		yamlData, err := os.ReadFile(configFile)
+		if err != nil {
+			outputCtx.UserErrorAndExit("Error reading config file: %v\n", err)
+		}
+		if err := lib.ValidateConfigYAML(yamlData); err != nil {
+			outputCtx.UserErrorAndExit("Configuration is invalid: %v\nFix this error before linting.\n", err)
+		}
+
+		var config lib.AppConfig
+		if err := viper.Unmarshal(&config); err != nil {
+			outputCtx.UserErrorAndExit("Error parsing configuration file: %v\n", err)
+		}
+		policy, err := config.PortPolicy()
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+
+		fmt.Printf("Linting %d proxy configuration(s) in %s\n", len(config.ProxyConfigs), absPath)
+
+		configs := config.ProxyConfigs
+		if fix {
+			fixed, changes := lib.FixProxyConfigs(configs, policy)
+			if len(changes) > 0 {
+				if _, err := lib.SaveProxyConfigs(configFile, fixed, configVersion); err != nil {
+					writeConfigFileError(err)
+				}
+				fmt.Printf("\n🔧 Fixed %d issue(s):\n", len(changes))
+				for _, change := range changes {
+					fmt.Printf("  %s\n", change)
+				}
+				configs = fixed
+			}
+		}
+
+		findings := lib.LintProxyConfigs(configs, policy)
+		if !offline {
+			findings = append(findings, lib.LintClusters(context.Background(), configs)...)
+		}
+
+		if len(findings) == 0 {
+			fmt.Println("\n✅ No warnings.")
+			return
+		}
+
+		fixable := 0
+		fmt.Printf("\n⚠️  %d warning(s):\n", len(findings))
+		for _, finding := range findings {
+			subject := finding.Message
+			if finding.Proxy != "" {
+				subject = fmt.Sprintf("%s %s", finding.Proxy, finding.Message)
+			}
+			marker := ""
+			if finding.Fixable {
+				marker = " (fixable)"
+				fixable++
+			}
+			fmt.Printf("  [%s] %s%s\n", finding.Check, subject, marker)
+		}
+		if fixable > 0 {
+			fmt.Printf("\nRun 'aproxymate config lint --fix' to fix %d of them.\n", fixable)
+		}
+		os.Exit(1)
+	},
+}
+
+// configAddCmd represents the config add command
+var configAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a proxy configuration to the config file",
+	Long: `Add a new proxy configuration to the config file.
+
+Fields not given as flags are prompted for interactively. Without --local-port, the
+next free local port is assigned, honoring port_range and reserved_ports.
+
+Examples:
+  # Prompt for everything
+  aproxymate config add
+
+  # Fully flag-driven
+  aproxymate config add --name "Orders DB" --cluster eks-prod --host orders.db.internal --remote-port 5432
+
+  # Pick the local port yourself
+  aproxymate config add --name redis --cluster eks-dev --host redis.internal --remote-port 6379 --local-port 16379`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outputCtx := lib.NewSimpleOutputContext()
+
+		name, _ := cmd.Flags().GetString("name")
+		cluster, _ := cmd.Flags().GetString("cluster")
+		host, _ := cmd.Flags().GetString("host")
+		remotePort, _ := cmd.Flags().GetInt("remote-port")
+		localPort, _ := cmd.Flags().GetInt("local-port")
+
+		var err error
+		if name == "" {
+			if name, err = promptRequired("Name of the proxy:", "Orders DB"); err != nil {
+				outputCtx.UserErrorAndExit("%v\n", err)
+			}
+		}
+		if cluster == "" {
+			if cluster, err = lib.SelectKubernetesClusterTUI(""); err != nil {
+				outputCtx.UserErrorAndExit("Error selecting cluster: %v\n", err)
+			}
+		}
+		if host == "" {
+			if host, err = promptRequired("Remote host (as seen from the cluster):", "orders.db.internal"); err != nil {
+				outputCtx.UserErrorAndExit("%v\n", err)
+			}
+		}
+		if remotePort == 0 {
+			input, err := promptRequired("Remote port:", "5432")
+			if err != nil {
+				outputCtx.UserErrorAndExit("%v\n", err)
+			}
+			if remotePort, err = strconv.Atoi(input); err != nil {
+				outputCtx.UserErrorAndExit("Invalid remote port %q: must be a number\n", input)
+			}
+		}
+
+		configFile := cfgFile
+		if configFile == "" {
+			configFile = viper.ConfigFileUsed()
+		}
+		if configFile == "" {
+			if configFile, err = lib.GetDefaultConfigPath(); err != nil {
+				outputCtx.UserErrorAndExit("Error getting default config path: %v\n", err)
+			}
+		}
+
+		var existingConfig lib.AppConfig
+		existingVersion := ""
+		if yamlData, err := os.ReadFile(configFile); err == nil {
+			existingVersion = lib.ConfigVersion(yamlData)
+			if err := yaml.Unmarshal(yamlData, &existingConfig); err != nil {
+				outputCtx.UserErrorAndExit("Error parsing existing config file: %v\n", err)
+			}
+		} else if !os.IsNotExist(err) {
+			outputCtx.UserErrorAndExit("Error reading existing config file: %v\n", err)
+		}
+
+		portPolicy, err := existingConfig.PortPolicy()
+		if err != nil {
+			outputCtx.UserErrorAndExit("Error in existing config file: %v\n", err)
+		}
+
+		configs, err := lib.AddProxyConfig(existingConfig.ProxyConfigs, lib.ProxyConfig{
+			Name:              name,
+			KubernetesCluster: cluster,
+			RemoteHost:        host,
+			RemotePort:        remotePort,
+			LocalPort:         localPort,
+		}, portPolicy)
+		if err != nil {
+			outputCtx.UserErrorAndExit("Cannot add proxy configuration: %v\n", err)
+		}
+		added := configs[len(configs)-1]
+
+		if _, err := lib.SaveProxyConfigs(configFile, configs, existingVersion); err != nil {
+			writeConfigFileError(err)
+		}
+
+		absPath := lib.GetAbsolutePathForDisplay(configFile)
+		log.Debug("Proxy configuration added", "file", absPath, "name", added.Name, "local_port", added.LocalPort)
+
+		fmt.Printf("✅ Added %s to %s\n", added.Name, absPath)
+		fmt.Printf("   Cluster: %s\n", added.KubernetesCluster)
+		fmt.Printf("   Remote:  %s:%d\n", added.RemoteHost, added.RemotePort)
+		fmt.Printf("   Local:   %s\n", added.LocalEndpoint())
+	},
+}
+
+// kubectlImportCmd represents the config kubectl-import command
+var kubectlImportCmd = &cobra.Command{
+	Use:   "kubectl-import [file...]",
+	Short: "Import kubectl port-forward commands from shell history or scripts",
+	Long: `Convert 'kubectl port-forward' commands into proxy configurations, easing the move
+from hand-rolled port-forward scripts.
+
+The commands are read from the given files ("-" for standard input), such as scripts or
+a list of commands. Without files, your shell history is searched ($HISTFILE, ~/.zsh_history,
+~/.bash_history and the fish history).
+
+Each Service port-forward becomes one proxy relaying to <service>.<namespace>.svc.cluster.local
+through the command's --context, with its relay pod in the Service's namespace. Additional
+ports become 'ports' mappings, and ":<port>" gets the next free local port. Pods and
+deployments are skipped since they have no stable address; port-forward to their Service.
+Endpoints that are already configured are skipped as well.
+
+Examples:
+  # Import from your shell history
+  aproxymate config kubectl-import
+
+  # Import from a script, using eks-dev for commands without --context
+  aproxymate config kubectl-import --cluster eks-dev ./scripts/tunnels.sh
+
+  # Preview the result
+  echo "kubectl --context eks-prod -n shop port-forward svc/orders 15432:5432" | aproxymate config kubectl-import - --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outputCtx := lib.NewSimpleOutputContext()
+		cluster, _ := cmd.Flags().GetString("cluster")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		sources := args
+		if len(sources) == 0 {
+			sources = shellHistoryFiles()
+			if len(sources) == 0 {
+				outputCtx.UserErrorAndExit("No shell history found. Pass a file with kubectl port-forward commands, or - for standard input.\n")
+			}
+		}
+
+		configFile := cfgFile
+		if configFile == "" {
+			configFile = viper.ConfigFileUsed()
+		}
+		if configFile == "" {
+			var err error
+			if configFile, err = lib.GetDefaultConfigPath(); err != nil {
+				outputCtx.UserErrorAndExit("Error getting default config path: %v\n", err)
+			}
+		}
+
+		var existingConfig lib.AppConfig
+		existingVersion := ""
+		if yamlData, err := os.ReadFile(configFile); err == nil {
+			existingVersion = lib.ConfigVersion(yamlData)
+			if err := yaml.Unmarshal(yamlData, &existingConfig); err != nil {
+				outputCtx.UserErrorAndExit("Error parsing existing config file: %v\n", err)
+			}
+		} else if !os.IsNotExist(err) {
+			outputCtx.UserErrorAndExit("Error reading existing config file: %v\n", err)
+		}
+
+		portPolicy, err := existingConfig.PortPolicy()
+		if err != nil {
+			outputCtx.UserErrorAndExit("Error in existing config file: %v\n", err)
+		}
+
+		var imported []lib.ProxyConfig
+		var skipped []lib.PortForwardSkip
+		for _, source := range sources {
+			file := os.Stdin
+			if source != "-" {
+				if file, err = os.Open(source); err != nil {
+					outputCtx.UserErrorAndExit("Error reading %s: %v\n", source, err)
+				}
+			}
+			configs, skips, err := lib.ParsePortForwardCommands(file, cluster, append(existingConfig.ProxyConfigs, imported...))
+			file.Close()
+			if err != nil {
+				outputCtx.UserErrorAndExit("Error reading %s: %v\n", source, err)
+			}
+			imported = append(imported, configs...)
+			skipped = append(skipped, skips...)
+		}
+
+		for _, skip := range skipped {
+			fmt.Printf("Skipped: kubectl %s\n  %s\n", skip.Command, skip.Reason)
+		}
+		if len(imported) == 0 {
+			fmt.Println("No kubectl port-forward commands to import were found.")
+			return
+		}
+
+		// Assign local ports to ":<port>" forwards, then skip configured endpoints and
+		// resolve local port clashes like the RDS import
+		assigned := append([]lib.ProxyConfig{}, existingConfig.ProxyConfigs...)
+		for i := range imported {
+			if imported[i].LocalPort == 0 {
+				imported[i].LocalPort = lib.FreeLocalPort(append(assigned, imported...), portPolicy)
+			}
+			for j := range imported[i].Ports {
+				if imported[i].Ports[j].LocalPort == 0 {
+					imported[i].Ports[j].LocalPort = lib.FreeLocalPort(append(assigned, imported...), portPolicy)
+				}
+			}
+		}
+		mergedConfigs := lib.MergeProxyConfigs(existingConfig.ProxyConfigs, imported, portPolicy)
+		if err := lib.ValidateUniqueLocalPorts(mergedConfigs); err != nil {
+			outputCtx.UserErrorAndExit("Cannot import the commands: %v\n", err)
+		}
+
+		added := mergedConfigs[len(existingConfig.ProxyConfigs):]
+		if len(added) == 0 {
+			fmt.Println("No new configurations to add - all port-forwards are already configured")
+			return
+		}
+
+		fmt.Printf("\nConfigurations to add:\n")
+		for i, config := range added {
+			fmt.Printf("  %d. %s\n", i+1, config.Name)
+			fmt.Printf("     Cluster: %s\n", config.KubernetesCluster)
+			fmt.Printf("     Remote:  %s:%d\n", config.RemoteHost, config.RemotePort)
+			fmt.Printf("     Local:   %s\n", config.LocalEndpoint())
+		}
+
+		if dryRun {
+			fmt.Println("\nDry run completed. Run without --dry-run to save changes.")
+			return
+		}
+
+		if _, err := lib.SaveProxyConfigs(configFile, mergedConfigs, existingVersion); err != nil {
+			writeConfigFileError(err)
+		}
+
+		absPath := lib.GetAbsolutePathForDisplay(configFile)
+		log.Debug("kubectl port-forward import completed", "file", absPath, "new_configs", len(added), "skipped", len(skipped))
+
+		fmt.Printf("\nConfiguration saved to: %s\n", absPath)
+		fmt.Printf("Total configurations: %d (%d new)\n", len(mergedConfigs), len(added))
+		if lib.HasConfigsWithMissingClusters(added) {
+			fmt.Println("\nSome commands had no --context. Set their cluster with:")
+			fmt.Println("  aproxymate config fix")
+		}
+	},
+}
+
+// shellHistoryFiles returns the shell history files of the current user that exist
+func shellHistoryFiles() []string {
+	var candidates []string
+	if histFile := os.Getenv("HISTFILE"); histFile != "" {
+		candidates = append(candidates, histFile)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates,
+			filepath.Join(home, ".zsh_history"),
+			filepath.Join(home, ".bash_history"),
+			filepath.Join(home, ".local", "share", "fish", "fish_history"))
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil && !seen[candidate] {
+			seen[candidate] = true
+			files = append(files, candidate)
+		}
+	}
+	return files
+}
+
+// promptRequired asks for a value that must not be empty
+func promptRequired(title, placeholder string) (string, error) {
+	value, cancelled, err := lib.PromptTextInput(title, placeholder)
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimSpace(value)
+	if cancelled || value == "" {
+		return "", fmt.Errorf("no value entered for %q; cancelled", strings.TrimSuffix(title, ":"))
+	}
+	return value, nil
+}
+
 // rdsImportCmd represents the config rds-import command
 var rdsImportCmd = &cobra.Command{
 	Use:   "rds-import",
@@ -698,12 +1350,14 @@ Examples:
 		}
 
 		// Try to load existing configuration
+		existingVersion := ""
 		if _, err := os.Stat(configFile); err == nil {
 			yamlData, err := os.ReadFile(configFile)
 			if err != nil {
 				outputCtx := lib.NewSimpleOutputContext()
 				outputCtx.UserErrorAndExit("Error reading existing config file: %v\n", err)
 			}
+			existingVersion = lib.ConfigVersion(yamlData)
 
 			if err := yaml.Unmarshal(yamlData, &existingConfig); err != nil {
 				outputCtx := lib.NewSimpleOutputContext()
@@ -715,9 +1369,15 @@ Examples:
 			fmt.Println("No existing configuration found, creating new one")
 		}
 
+		portPolicy, err := existingConfig.PortPolicy()
+		if err != nil {
+			outputCtx := lib.NewSimpleOutputContext()
+			outputCtx.UserErrorAndExit("Error in existing config file: %v\n", err)
+		}
+
 		// Determine starting port
 		if startingPort == 0 {
-			startingPort = lib.GetStartingPortForAWSConfigs(existingConfig.ProxyConfigs)
+			startingPort = lib.GetStartingPortForAWSConfigs(existingConfig.ProxyConfigs, portPolicy)
 		}
 
 		// Convert RDS endpoints to proxy configs
@@ -725,7 +1385,7 @@ Examples:
 		fmt.Printf("Generated %d proxy configurations\n", len(newConfigs))
 
 		// Merge configurations
-		mergedConfigs := lib.MergeProxyConfigs(existingConfig.ProxyConfigs, newConfigs)
+		mergedConfigs := lib.MergeProxyConfigs(existingConfig.ProxyConfigs, newConfigs, portPolicy)
 		newConfigsAdded := len(mergedConfigs) - len(existingConfig.ProxyConfigs)
 
 		if dryRun {
@@ -795,20 +1455,9 @@ Examples:
 
 		fmt.Println("Proceeding with RDS import...")
 
-		// Save the merged configuration
-		finalConfig := lib.AppConfig{
-			ProxyConfigs: mergedConfigs,
-		}
-
-		data, err := yaml.Marshal(&finalConfig)
-		if err != nil {
-			outputCtx := lib.NewSimpleOutputContext()
-			outputCtx.UserErrorAndExit("Error marshaling config: %v\n", err)
-		}
-
-		if err := os.WriteFile(configFile, data, 0644); err != nil {
-			outputCtx := lib.NewSimpleOutputContext()
-			outputCtx.UserErrorAndExit("Error writing config file: %v\n", err)
+		// Save the merged entries, keeping the rest of the file as written
+		if _, err := lib.SaveProxyConfigs(configFile, mergedConfigs, existingVersion); err != nil {
+			writeConfigFileError(err)
 		}
 
 		// Convert to absolute path for display
@@ -831,13 +1480,40 @@ func init() {
 	configCmd.AddCommand(showCmd)
 	configCmd.AddCommand(configListCmd)
 	configCmd.AddCommand(configFixCmd)
+	configCmd.AddCommand(configLintCmd)
+	configCmd.AddCommand(configAddCmd)
 	configCmd.AddCommand(rdsImportCmd)
+	configCmd.AddCommand(kubectlImportCmd)
 	rootCmd.AddCommand(configCmd)
 
 	// Add flags for the config init command
-	initCmd.Flags().StringP("output", "o", "", "Output path for the config file (default: $HOME/aproxymate.yaml)")
+	initCmd.Flags().StringP("output", "o", "", "Output path for the config file (default: $XDG_CONFIG_HOME/aproxymate/config.yaml)")
 	initCmd.Flags().BoolP("force", "f", false, "Force overwrite existing config file")
 
+	// Add flags for the config list command
+	configListCmd.Flags().StringP("query", "q", "", "Only list proxies whose name, cluster, host, port, namespace, description or owner contains this text")
+	configListCmd.Flags().StringP("cluster", "c", "", "Only list proxies of this Kubernetes cluster")
+	configListCmd.Flags().BoolP("verbose", "v", false, "Also show the file and line each proxy is written at")
+	configListCmd.Flags().Bool("connected", false, "Only list connected proxies, or disconnected ones with --connected=false (needs a running GUI to see connections)")
+
+	// Add flags for the config fix command
+	configFixCmd.Flags().StringArrayP("cluster", "c", nil, "Cluster of an entry without one, as name=cluster; a cluster without a name is used for the other entries (repeatable)")
+
+	// Add flags for the config lint command
+	configLintCmd.Flags().Bool("fix", false, "Fix the warnings that can be corrected automatically and save the config file")
+	configLintCmd.Flags().Bool("offline", false, "Don't check whether the clusters are reachable")
+
+	// Add flags for the config add command
+	configAddCmd.Flags().String("name", "", "Name of the proxy (prompted if not provided)")
+	configAddCmd.Flags().StringP("cluster", "c", "", "Kubernetes cluster to connect through (prompted if not provided)")
+	configAddCmd.Flags().String("host", "", "Remote host as seen from the cluster (prompted if not provided)")
+	configAddCmd.Flags().Int("remote-port", 0, "Remote port (prompted if not provided)")
+	configAddCmd.Flags().Int("local-port", 0, "Local port (defaults to the next free port)")
+
+	// Add flags for the config kubectl-import command
+	kubectlImportCmd.Flags().StringP("cluster", "c", "", "Kubernetes cluster for commands without --context")
+	kubectlImportCmd.Flags().Bool("dry-run", false, "Show what would be imported without making changes")
+
 	// Add flags for the config rds-import command
 	rdsImportCmd.Flags().StringP("cluster", "c", "", "Kubernetes cluster name to associate with RDS endpoints (optional - will prompt via TUI if not provided)")
 	rdsImportCmd.Flags().StringP("region", "r", "", "AWS region (optional - will prompt via TUI if not provided)")
@@ -847,3 +1523,12 @@ func init() {
 	rdsImportCmd.Flags().StringP("names", "n", "", "Comma-separated list of RDS instance/cluster names to filter by (supports partial matching)")
 	rdsImportCmd.Flags().Bool("dry-run", false, "Show what would be imported without making changes")
 }
+
+// writeConfigFileError reports a failed config file write and exits
+func writeConfigFileError(err error) {
+	outputCtx := lib.NewSimpleOutputContext()
+	if errors.Is(err, lib.ErrConfigConflict) {
+		outputCtx.UserErrorAndExit("Error writing config file: %v\nRun the command again to apply your changes on top of the new content.\n", err)
+	}
+	outputCtx.UserErrorAndExit("Error writing config file: %v\n", err)
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"aproxymate/lib"
+)
+
+// debugCmd groups the commands for investigating proxies
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "Investigate proxy issues",
+}
+
+// debugShellCmd represents the debug shell command
+var debugShellCmd = &cobra.Command{
+	Use:   "shell <name> [-- command...]",
+	Short: "Open a shell or run a command in a proxy's relay pod",
+	Long: `Open an interactive shell in the relay pod of a proxy the running GUI has connected,
+or run a single command there, to investigate network issues from the pod's point of
+view: DNS resolution, reachability of the remote host, or a firewall in between.
+
+The default relay image ships busybox, so sh, nc, ping and nslookup are available.
+A custom relay_image may not include a shell. ping needs the NET_RAW capability,
+which some clusters drop from pods.
+
+The command's exit status is returned, so it can be used in scripts.
+
+Examples:
+  aproxymate debug shell "Internal Database"
+  aproxymate debug shell orders-db -- nc -zv orders.abc.us-east-1.rds.amazonaws.com 5432
+  aproxymate debug shell orders-db -- nslookup orders.abc.us-east-1.rds.amazonaws.com`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		outputCtx := lib.NewSimpleOutputContext()
+		container, _ := cmd.Flags().GetString("container")
+
+		running, err := lib.FindRunningGUI()
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+		if running == nil {
+			outputCtx.UserErrorAndExit("No aproxymate GUI is running. Start it with 'aproxymate gui' and connect the proxy first.\n")
+		}
+		rows, _, err := running.Proxies(lib.ProxyFilter{})
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+		row, err := findProxyRow(rows, args[0])
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+		if !row.Connected || row.PodName == "" {
+			outputCtx.UserErrorAndExit("'%s' is not connected, so it has no relay pod. Connect it in the GUI first.\n", row.Name)
+		}
+
+		exec := lib.RelayPodExec{
+			Cluster:   row.KubernetesCluster,
+			Namespace: row.Namespace,
+			PodName:   row.PodName,
+			Container: container,
+			Command:   args[1:],
+			Stdin:     os.Stdin,
+			Stdout:    os.Stdout,
+			Stderr:    os.Stderr,
+		}
+
+		// A shell gets a terminal when we have one; commands run like in a pipe
+		restore := func() {}
+		fd := int(os.Stdin.Fd())
+		if len(exec.Command) == 0 && term.IsTerminal(fd) {
+			state, err := term.MakeRaw(fd)
+			if err != nil {
+				outputCtx.UserErrorAndExit("Failed to set up the terminal: %v\n", err)
+			}
+			restore = func() { term.Restore(fd, state) }
+			exec.TTY = true
+			exec.TerminalSizes = &terminalSizes{fd: fd}
+			fmt.Fprintf(os.Stderr, "Connected to %s/%s in %s. Type 'exit' to leave.\r\n", row.Namespace, row.PodName, row.KubernetesCluster)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = exec.Run(ctx)
+		stop()
+		restore()
+		if code, exited := lib.RelayExitCode(err); exited {
+			os.Exit(code)
+		}
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+	},
+}
+
+// findProxyRow returns the row of the running GUI named name, or with it as ID
+func findProxyRow(rows []lib.ProxyRow, name string) (lib.ProxyRow, error) {
+	names := make([]string, len(rows))
+	for i, row := range rows {
+		if strings.EqualFold(row.Name, name) || row.ID == name {
+			return row, nil
+		}
+		names[i] = row.Name
+	}
+	return lib.ProxyRow{}, fmt.Errorf("the running GUI has no proxy named '%s'. Available: %s", name, strings.Join(names, ", "))
+}
+
+// terminalSizes reports the size of the local terminal to the relay pod's terminal, polling for
+// changes since resize signals don't exist on every platform
+type terminalSizes struct {
+	fd   int
+	last remotecommand.TerminalSize
+}
+
+// Next blocks until the terminal has a new size, or returns nil once it can't be read anymore
+func (t *terminalSizes) Next() *remotecommand.TerminalSize {
+	for {
+		width, height, err := term.GetSize(t.fd)
+		if err != nil {
+			return nil
+		}
+		size := remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+		if size != t.last {
+			t.last = size
+			return &size
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(debugCmd)
+	debugCmd.AddCommand(debugShellCmd)
+
+	debugShellCmd.Flags().StringP("container", "c", "", "Container of the relay pod, e.g. socat-10001 for an additional port (default socat)")
+}
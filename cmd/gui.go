@@ -6,8 +6,11 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"aproxymate/lib"
 	log "aproxymate/lib/logger"
@@ -63,8 +66,39 @@ Use --no-open flag to disable automatic browser opening.`,
 			}
 		}()
 
-		port, _ := cmd.Flags().GetInt("port")
+		// Flags override APROXYMATE_GUI_* variables, which override the config file's 'gui' section.
+		// Without any of them, named instances default to their own port.
+		port, err := strconv.Atoi(viper.GetString("gui.port"))
+		if err != nil || port < 0 || port > 65535 {
+			lib.NewOutputContext(opCtx).UserErrorAndExit("❌ Invalid GUI port '%s'\n", viper.GetString("gui.port"))
+		}
+		if !viper.IsSet("gui.port") {
+			port = lib.InstanceDefaultPort(port)
+		}
+		bindAddress := viper.GetString("gui.bind_address")
 		noBrowser, _ := cmd.Flags().GetBool("no-open")
+		if !cmd.Flags().Changed("no-open") && viper.IsSet("gui.open_browser") {
+			noBrowser = !viper.GetBool("gui.open_browser")
+		}
+		readOnly := viper.GetBool("gui.read_only")
+		authTokenPath := viper.GetString("gui.auth_token_path")
+		debug, _ := cmd.Flags().GetBool("debug")
+		noNotify, _ := cmd.Flags().GetBool("no-notify")
+		tray, _ := cmd.Flags().GetBool("tray")
+		basePath, _ := cmd.Flags().GetString("base-path")
+		environment, _ := cmd.Flags().GetString("env")
+		force, _ := cmd.Flags().GetBool("force")
+		portFallback, _ := cmd.Flags().GetInt("port-fallback")
+		shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+		adoptMode, _ := cmd.Flags().GetString("adopt")
+		allowAdminDelete, _ := cmd.Flags().GetBool("allow-admin-delete")
+		skipCleanup, _ := cmd.Flags().GetBool("skip-cleanup")
+		strictConnect, _ := cmd.Flags().GetBool("strict-connect")
+
+		if tray && !lib.TraySupported {
+			outputCtx := lib.NewOutputContext(opCtx)
+			outputCtx.UserErrorAndExit("❌ This build does not include system tray support. Rebuild with: go build -tags tray\n")
+		}
 
 		opCtx.Debug("Starting GUI command", "port", port, "auto_launch", !noBrowser)
 		log.LogUserAction("start_gui", "gui_server", map[string]any{
@@ -72,7 +106,61 @@ Use --no-open flag to disable automatic browser opening.`,
 			"auto_browser": !noBrowser,
 		})
 
+		// Only one GUI per user and instance manages proxies; reuse or take over a running one
+		running, err := lib.FindRunningGUI()
+		if err != nil {
+			opCtx.Warn("Could not check for a running GUI", "error", err.Error())
+		}
+		if running != nil {
+			if !force {
+				fmt.Printf("aproxymate GUI is already running at %s (pid %d)\n", running.URL, running.PID)
+				fmt.Println("Use --force to stop it and start a new one.")
+				if !noBrowser {
+					if err := openBrowser(running.URL); err != nil {
+						opCtx.Debug("Failed to open browser", "url", running.URL, "error", err.Error())
+					}
+				}
+				opCtx.Complete("gui_start", nil)
+				return
+			}
+
+			fmt.Printf("Stopping the running GUI (pid %d) and disconnecting its proxies...\n", running.PID)
+			if err := lib.StopRunningGUI(running, 2*time.Minute); err != nil {
+				opCtx.Complete("gui_start", err)
+				lib.NewOutputContext(opCtx).UserErrorAndExit("❌ %v\n", err)
+			}
+		}
+
 		gui := lib.NewGUI()
+		if err := gui.SetBindAddress(bindAddress); err != nil {
+			lib.NewOutputContext(opCtx).UserErrorAndExit("❌ %v\n", err)
+		}
+		gui.SetAuthTokenPath(authTokenPath)
+		gui.SetBasePath(basePath)
+		gui.SetEnvironment(environment)
+		gui.SetPortFallback(portFallback)
+		gui.SetShutdownTimeout(shutdownTimeout)
+		if err := gui.SetAdoptMode(adoptMode); err != nil {
+			lib.NewOutputContext(opCtx).UserErrorAndExit("❌ %v\n", err)
+		}
+		if debug {
+			gui.EnableDebugEndpoints()
+		}
+		if !noNotify {
+			gui.EnableDesktopNotifications()
+		}
+		if allowAdminDelete {
+			gui.EnableAdminPodDeletion()
+		}
+		if skipCleanup {
+			gui.DisableStartupCleanup()
+		}
+		if strictConnect {
+			gui.EnableStrictConnect()
+		}
+		if readOnly {
+			gui.EnableReadOnly()
+		}
 
 		// Load configurations from Viper if available
 		timer := log.StartTimer("config_load")
@@ -80,17 +168,9 @@ Use --no-open flag to disable automatic browser opening.`,
 		timer.Stop()
 
 		if err != nil {
-			// Check if this is a missing cluster error
-			if numConfigs > 0 {
-				outputCtx := lib.NewSimpleOutputContext()
-				outputCtx.UserError("❌ Failed to load configuration: %v\n", err)
-				fmt.Println("\nYour configuration has proxy entries but some are missing Kubernetes cluster specifications.")
-				fmt.Println("Please fix this by running:")
-				fmt.Println("  aproxymate config fix")
-				fmt.Println("\nThen start the GUI again:")
-				fmt.Printf("  aproxymate gui --port %d\n", port)
+			if environment != "" {
 				opCtx.Complete("gui_start", err)
-				os.Exit(1)
+				lib.NewSimpleOutputContext().UserErrorAndExit("❌ Failed to load configuration: %v\n", err)
 			} else {
 				opCtx.Warn("Failed to load configuration from viper", "error", err.Error())
 			}
@@ -102,12 +182,12 @@ Use --no-open flag to disable automatic browser opening.`,
 		serverErr := make(chan error, 1)
 		serverReady := make(chan bool, 1)
 
+		// Start returns once the server has shut down and the proxies are cleaned up
 		go func() {
 			log.LogGUIStart(port)
-			if err := gui.Start(port, serverReady); err != nil {
-				log.LogGUIStop(port, err)
-				serverErr <- err
-			}
+			err := gui.Start(port, serverReady)
+			log.LogGUIStop(port, err)
+			serverErr <- err
 		}()
 
 		// Wait for server to be ready, then open browser if requested
@@ -116,7 +196,7 @@ Use --no-open flag to disable automatic browser opening.`,
 				// Wait for server to be ready
 				<-serverReady
 
-				url := fmt.Sprintf("http://localhost:%d", port)
+				url := gui.URL()
 
 				opCtx.Debug("Attempting to open browser", "url", url)
 				if err := openBrowser(url); err != nil {
@@ -135,15 +215,36 @@ Use --no-open flag to disable automatic browser opening.`,
 			// to avoid exiting before the server starts
 			go func() {
 				<-serverReady
-				opCtx.Debug("GUI server is ready", "port", port)
+				opCtx.Debug("GUI server is ready", "url", gui.URL())
+			}()
+		}
+
+		// The tray owns the main goroutine until the user quits from its menu
+		if tray {
+			go func() {
+				if err := <-serverErr; err != nil {
+					opCtx.Error("GUI server failed", err, "port", port)
+					opCtx.Complete("gui_start", err)
+					lib.NewOutputContext(opCtx).UserErrorAndExit("❌ %v\n", err)
+				}
+				opCtx.Complete("gui_start", nil)
+				os.Exit(0)
 			}()
+
+			<-serverReady
+			if err := lib.RunTray(gui, gui.URL(), openBrowser); err != nil {
+				opCtx.Complete("gui_start", err)
+				lib.NewOutputContext(opCtx).UserErrorAndExit("❌ %v\n", err)
+			}
+			opCtx.Complete("gui_start", nil)
+			return
 		}
 
-		// Wait for server error or block indefinitely
+		// Wait until the server fails to start or has shut down
 		if err := <-serverErr; err != nil {
-			opCtx.Error("Failed to start GUI server", err, "port", port)
+			opCtx.Error("GUI server failed", err, "port", port)
 			opCtx.Complete("gui_start", err)
-			os.Exit(1)
+			lib.NewOutputContext(opCtx).UserErrorAndExit("❌ %v\n", err)
 		}
 
 		opCtx.Complete("gui_start", nil)
@@ -154,6 +255,26 @@ func init() {
 	rootCmd.AddCommand(guiCmd)
 
 	// Add flags for the gui command
-	guiCmd.Flags().IntP("port", "p", 8080, "Port to run the GUI web server on")
+	guiCmd.Flags().IntP("port", "p", 8080, "Port to run the GUI web server on (0 picks a free port)")
+	guiCmd.Flags().String("bind-address", "", "Address to serve the GUI on, e.g. 127.0.0.1 (default all interfaces)")
+	guiCmd.Flags().Int("port-fallback", 0, "If the port is busy, try up to this many following ports")
 	guiCmd.Flags().Bool("no-open", false, "Disable automatic browser opening")
+	guiCmd.Flags().Bool("no-notify", false, "Disable desktop notifications for dropped tunnels")
+	guiCmd.Flags().String("base-path", "", "Serve the GUI under a sub-path (e.g. /aproxymate) when behind a reverse proxy")
+	guiCmd.Flags().String("env", "", "Load the proxies of this environment from the config file's 'environments'")
+	guiCmd.Flags().Bool("force", false, "Stop an already running GUI and take over")
+	guiCmd.Flags().String("adopt", "ask", "Proxy pods still running from an earlier session: ask, always (re-attach) or never (delete)")
+	guiCmd.Flags().Bool("allow-admin-delete", false, "Allow deleting other users' pods from the cluster view")
+	guiCmd.Flags().Bool("skip-cleanup", false, "Don't delete leftover proxy pods of earlier sessions after startup")
+	guiCmd.Flags().Bool("read-only", false, "Show the proxies without allowing to connect, disconnect or change them")
+	guiCmd.Flags().String("auth-token-path", "", "File with the token that authorizes control requests; created with a random token if missing")
+	guiCmd.Flags().Bool("strict-connect", false, "Only allow connecting the proxies of the config file, as configured")
+	guiCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "How long to wait for relay pods to be deleted on shutdown")
+	guiCmd.Flags().Bool("tray", false, "Show a system tray icon with shortcuts for favorite proxies (experimental)")
+	guiCmd.Flags().Bool("debug", false, "Expose pprof profiling endpoints under /debug/pprof/ and relay pod commands under /api/debug/exec/ (requires a loopback --bind-address)")
+
+	viper.BindPFlag("gui.port", guiCmd.Flags().Lookup("port"))
+	viper.BindPFlag("gui.bind_address", guiCmd.Flags().Lookup("bind-address"))
+	viper.BindPFlag("gui.read_only", guiCmd.Flags().Lookup("read-only"))
+	viper.BindPFlag("gui.auth_token_path", guiCmd.Flags().Lookup("auth-token-path"))
 }
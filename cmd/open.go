@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"aproxymate/lib"
+	log "aproxymate/lib/logger"
+)
+
+// openCmd represents the open command
+var openCmd = &cobra.Command{
+	Use:   "open <name> [-- client arguments]",
+	Short: "Connect a proxy and launch a database client against it",
+	Long: `Connect the named proxy (unless its local port is already accepting connections,
+for example because the GUI has it connected) and launch the matching client.
+
+The client is chosen from the proxy's engine (psql, mysql or redis-cli) or from the
+'client_command' template in the configuration, for example:
+
+  client_command: "pgcli {{.URL}}"
+
+Available template fields: .Host, .Port, .Socket, .URL, .User, .Database
+
+The proxy is disconnected again when the client exits. Arguments after -- are passed
+to the client.
+
+Examples:
+  aproxymate open "Internal Database" --user app --database orders
+  aproxymate open redis-staging -- --raw`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opCtx, _ := log.StartOperation(context.Background(), "open", "open_client")
+		outputCtx := lib.NewOutputContext(opCtx)
+
+		user, _ := cmd.Flags().GetString("user")
+		database, _ := cmd.Flags().GetString("database")
+		environment, _ := cmd.Flags().GetString("env")
+
+		name := args[0]
+		clientArgs := args[1:]
+
+		if viper.ConfigFileUsed() == "" {
+			lib.EnsureConfigLoaded()
+		}
+
+		var config lib.AppConfig
+		if err := viper.Unmarshal(&config); err != nil {
+			outputCtx.UserErrorAndExit("Error parsing configuration file: %v\n", err)
+		}
+		config, err := config.ForEnvironment(environment)
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+
+		proxyConfig, index, err := lib.FindProxyConfig(config.ProxyConfigs, name)
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+
+		command, err := lib.BuildClientCommand(proxyConfig, lib.ConnectionStringOptions{User: user, Database: database})
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+		command = append(command, clientArgs...)
+
+		if _, err := exec.LookPath(command[0]); err != nil {
+			outputCtx.UserErrorAndExit("Client '%s' not found in PATH. Install it or set 'client_command' for this proxy.\n", command[0])
+		}
+
+		disconnect := func() {}
+		var env []string
+		if lib.IsLocalEndpointListening(proxyConfig) {
+			fmt.Printf("🔗 %s is already reachable at %s\n", proxyConfig.Name, proxyConfig.LocalEndpoint())
+		} else {
+			if proxyConfig.KubernetesCluster == "" {
+				outputCtx.UserErrorAndExit("Proxy '%s' has no Kubernetes cluster. Please run: aproxymate config fix\n", proxyConfig.Name)
+			}
+
+			manager := lib.NewProxyManager()
+			manager.ApplyConfig(config)
+			stopUsage := manager.RecordUsage()
+
+			id := strconv.Itoa(index + 1)
+			fmt.Printf("🚀 Connecting %s via cluster '%s'...\n", proxyConfig.Name, proxyConfig.KubernetesCluster)
+			if err := manager.Connect(lib.NewProxySpec(id, proxyConfig)); err != nil {
+				stopUsage()
+				opCtx.Complete("open_client", err)
+				outputCtx.UserErrorAndExit("Failed to connect proxy: %v\n", err)
+			}
+			disconnect = func() {
+				manager.DisconnectAll()
+				stopUsage()
+			}
+
+			fmt.Printf("✅ Connected at %s\n", proxyConfig.LocalEndpoint())
+
+			// Log in with the credentials leased from Vault for this session
+			creds, err := manager.Credentials(id)
+			if err != nil {
+				outputCtx.Warn("No database credentials from Vault", "⚠️  %v\n", err)
+			}
+			if creds != nil && user == "" {
+				fmt.Printf("🔑 Using database user %s from Vault (expires %s)\n", creds.Username, creds.ExpiresAt.Format("15:04"))
+				command, err = lib.BuildClientCommand(proxyConfig, lib.ConnectionStringOptions{User: creds.Username, Password: creds.Password, Database: database})
+				if err != nil {
+					disconnect()
+					outputCtx.UserErrorAndExit("%v\n", err)
+				}
+				command = append(command, clientArgs...)
+				env = lib.ClientPasswordEnv(proxyConfig, creds.Password)
+			}
+		}
+
+		exitCode := runClient(command, env)
+		disconnect()
+		opCtx.Complete("open_client", nil)
+
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	},
+}
+
+// runClient runs the client attached to the terminal with env added to its environment and
+// returns its exit code. Interrupts go to the client; aproxymate keeps forwarding until the client exits.
+func runClient(command, env []string) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	client := exec.Command(command[0], command[1:]...)
+	client.Stdin = os.Stdin
+	client.Stdout = os.Stdout
+	client.Stderr = os.Stderr
+	if len(env) > 0 {
+		client.Env = append(os.Environ(), env...)
+	}
+
+	log.Debug("Launching client", "command", command)
+	if err := client.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		outputCtx := lib.NewSimpleOutputContext()
+		outputCtx.UserError("Failed to run client: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func init() {
+	rootCmd.AddCommand(openCmd)
+
+	openCmd.Flags().StringP("user", "u", "", "Database user passed to the client")
+	openCmd.Flags().StringP("database", "d", "", "Database name passed to the client")
+	openCmd.Flags().String("env", "", "Use the proxies of this environment from the config file's 'environments'")
+}
@@ -4,10 +4,12 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -39,13 +41,43 @@ Key features:
 		}
 
 		// Get the full command path for context
-		commandName := cmd.Use
-		if cmd.Parent() != nil && cmd.Parent().Use != "aproxymate" {
-			commandName = cmd.Parent().Use + " " + cmd.Use
+		commandName := cmd.Name()
+		if cmd.Parent() != nil && cmd.Parent() != cmd.Root() {
+			commandName = cmd.Parent().Name() + " " + cmd.Name()
+		}
+
+		// A named instance keeps its own pods, state files and GUI, apart from the default instance
+		if err := lib.SetInstanceName(viper.GetString("instance-name")); err != nil {
+			return err
+		}
+		// --kubeconfig replaces ~/.kube/config, also for tsh and kubectl run by aproxymate
+		if kubeconfig := viper.GetString("kubeconfig"); kubeconfig != "" {
+			lib.SetKubeconfigPath(kubeconfig)
+			os.Setenv("KUBECONFIG", kubeconfig)
 		}
 
 		// Ensure we have a config or prompt to create one for all commands
-		return ensureConfigWithPrompt(commandName)
+		if err := ensureConfigWithPrompt(commandName); err != nil {
+			return err
+		}
+
+		lib.SetDefaultNamespace(viper.GetString("default_namespace"))
+
+		// Every command's Kubernetes clients use the configured rate limit, retries and API proxies
+		var kubernetesAPI lib.KubernetesAPIConfig
+		if err := viper.UnmarshalKey("kubernetes_api", &kubernetesAPI); err == nil {
+			var proxies []lib.ProxyConfig
+			if err := viper.UnmarshalKey("proxy_configs", &proxies); err == nil {
+				kubernetesAPI = kubernetesAPI.WithProxyURLs(proxies)
+			}
+			lib.SetKubernetesAPIConfig(kubernetesAPI)
+		}
+		return nil
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		if cmd.Name() != "upgrade" {
+			printUpdateNotice()
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// Show overview of configuration and suggest next steps
@@ -131,7 +163,7 @@ Key features:
 						fmt.Printf("   Cluster: %s\n", proxy.KubernetesCluster)
 					}
 					fmt.Printf("   Remote:  %s:%d\n", proxy.RemoteHost, proxy.RemotePort)
-					fmt.Printf("   Local:   localhost:%d\n", proxy.LocalPort)
+					fmt.Printf("   Local:   %s\n", proxy.LocalEndpoint())
 					if i < len(config.ProxyConfigs)-1 {
 						fmt.Println()
 					}
@@ -189,43 +221,113 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/aproxymate.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $XDG_CONFIG_HOME/aproxymate/config.yaml, then $HOME/aproxymate.yaml)")
 	rootCmd.PersistentFlags().String("log-level", "info", "log level (debug, info, warn, error)")
 	rootCmd.PersistentFlags().String("log-format", "text", "log format (text, json)")
+	rootCmd.PersistentFlags().String("kubeconfig", "", "kubeconfig file to use (default is $HOME/.kube/config)")
+	rootCmd.PersistentFlags().String("instance-name", "", "run as a named instance with its own pods, state files and default GUI port")
 
 	// Bind flags to viper
 	viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level"))
 	viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format"))
+	viper.BindPFlag("instance-name", rootCmd.PersistentFlags().Lookup("instance-name"))
+	viper.BindPFlag("kubeconfig", rootCmd.PersistentFlags().Lookup("kubeconfig"))
+
+	bindEnvSettings()
+}
+
+// envSettings are the settings that can come from APROXYMATE_* environment variables even when
+// the config file doesn't mention them, for containers and team servers configured through
+// their environment. Each maps to its variable name; an empty name stands for the key in upper
+// case with '.' and '-' replaced by '_', e.g. APROXYMATE_GUI_PORT. A name must not match another
+// key that way, or that variable replaces the whole section, e.g. APROXYMATE_RELAY_IMAGE.
+var envSettings = map[string]string{
+	"log-level":           "",
+	"log-format":          "",
+	"instance-name":       "",
+	"kubeconfig":          "",
+	"gui.port":            "",
+	"gui.bind_address":    "",
+	"gui.open_browser":    "",
+	"gui.read_only":       "",
+	"gui.auth_token_path": "",
+	"default_namespace":   "",
+	"relay_image.image":   "APROXYMATE_SOCAT_IMAGE",
+	"strict_connect":      "",
+	"update_check":        "",
+	"logging.file":        "",
+	"logging.audit_file":  "",
+}
+
+// bindEnvSettings makes APROXYMATE_* environment variables override the config file; flags
+// given on the command line still take precedence over them
+func bindEnvSettings() {
+	viper.SetEnvPrefix("APROXYMATE")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	// Settings of the config file not listed in envSettings can be overridden as well
+	viper.AutomaticEnv()
+
+	for key, name := range envSettings {
+		if name == "" {
+			viper.BindEnv(key)
+		} else {
+			viper.BindEnv(key, name)
+		}
+	}
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
-	// Initialize logger based on flags first
-	logLevel := viper.GetString("log-level")
-	logFormat := viper.GetString("log-format")
-
-	var level log.LogLevel
-	switch strings.ToLower(logLevel) {
-	case "debug":
-		level = log.LevelDebug
-	case "info":
-		level = log.LevelInfo
-	case "warn", "warning":
-		level = log.LevelWarn
-	case "error":
-		level = log.LevelError
-	default:
-		level = log.LevelInfo
+	// Log according to the flags while the config file is looked up
+	initLogging(lib.LoggingConfig{})
+	readConfig()
+
+	var logging lib.LoggingConfig
+	if err := viper.UnmarshalKey("logging", &logging); err != nil {
+		log.Warn("Ignoring invalid logging settings", "error", err)
+	}
+	// UnmarshalKey doesn't see environment variables of keys missing from the file
+	logging.File = viper.GetString("logging.file")
+	logging.AuditFile = viper.GetString("logging.audit_file")
+	if logging != (lib.LoggingConfig{}) {
+		initLogging(logging)
 	}
 
-	var format log.LogFormat
-	switch strings.ToLower(logFormat) {
-	case "json":
-		format = log.FormatJSON
-	case "text":
-		format = log.FormatText
-	default:
-		format = log.FormatText
+	// Log system information
+	level, format := logSettings(logging)
+	log.LogSystemEvent("application_start", "initialization", map[string]any{
+		"log_level":  level,
+		"log_format": format,
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+	})
+}
+
+// logSettings returns the log level and format: --log-level and --log-format or their
+// environment variables win over the logging section, which wins over the defaults
+func logSettings(logging lib.LoggingConfig) (log.LogLevel, log.LogFormat) {
+	logLevel, logFormat := logging.Level, logging.Format
+	if logLevel == "" || viper.IsSet("log-level") {
+		logLevel = viper.GetString("log-level")
+	}
+	if logFormat == "" || viper.IsSet("log-format") {
+		logFormat = viper.GetString("log-format")
+	}
+
+	// Unknown values fall back to info and text
+	level, _ := lib.ParseLogLevel(logLevel)
+	format, _ := lib.ParseLogFormat(logFormat)
+	return level, format
+}
+
+// initLogging sets up the logger from the logging section of the config file and the flags.
+// Log files that can't be opened leave the log on stderr.
+func initLogging(logging lib.LoggingConfig) {
+	level, format := logSettings(logging)
+
+	output, audit, err := logging.Outputs()
+	if err != nil {
+		output, audit = os.Stderr, nil
 	}
 
 	// Use development settings if debug level is enabled
@@ -233,7 +335,8 @@ func initConfig() {
 		log.InitLogger(log.LoggerConfig{
 			Level:         level,
 			Format:        format,
-			Output:        os.Stderr,
+			Output:        output,
+			AuditOutput:   audit,
 			AddSource:     true,
 			IncludeStack:  true,
 			MaxStackDepth: 10,
@@ -242,21 +345,21 @@ func initConfig() {
 		log.InitLogger(log.LoggerConfig{
 			Level:         level,
 			Format:        format,
-			Output:        os.Stderr,
+			Output:        output,
+			AuditOutput:   audit,
 			AddSource:     false,
 			IncludeStack:  false,
 			MaxStackDepth: 5,
 		})
 	}
 
-	// Log system information
-	log.LogSystemEvent("application_start", "initialization", map[string]any{
-		"log_level":  level,
-		"log_format": format,
-		"os":         runtime.GOOS,
-		"arch":       runtime.GOARCH,
-	})
+	if err != nil {
+		log.Warn("Logging to stderr instead", "error", err)
+	}
+}
 
+// readConfig finds and reads the config file
+func readConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
@@ -270,6 +373,19 @@ func initConfig() {
 		viper.AddConfigPath(".") // Current directory
 		viper.SetConfigType("yaml")
 
+		// A project config comes first, then the user config directory, then the home
+		// directory files of older versions
+		if projectConfig := lib.FindProjectConfigPath(); projectConfig != "" {
+			readDiscoveredConfig(projectConfig, "project directory")
+			return
+		}
+		if userConfig, err := lib.GetUserConfigPath(); err == nil {
+			if _, err := os.Stat(userConfig); err == nil {
+				readDiscoveredConfig(userConfig, "user config directory")
+				return
+			}
+		}
+
 		// Try multiple config file names in order
 		configNames := []string{"aproxymate", ".aproxymate"}
 		var configFound bool
@@ -289,8 +405,6 @@ func initConfig() {
 		}
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
-
 	// If a config file is found, read it in.
 	if cfgFile != "" {
 		if err := viper.ReadInConfig(); err == nil {
@@ -322,6 +436,39 @@ func initConfig() {
 	}
 }
 
+// readDiscoveredConfig reads a config file found outside viper's search paths; where names the
+// location for the debug log
+func readDiscoveredConfig(path, where string) {
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		log.Error("Failed to read configuration file", "file", path, "error", err)
+		fmt.Fprintf(os.Stderr, "Error reading config file %s: %v\n", path, err)
+		return
+	}
+	log.Debug("Configuration file loaded from "+where, "file", path)
+	fmt.Fprintln(os.Stderr, "Using config file:", path)
+}
+
+// printUpdateNotice mentions a newer release on stderr when update_check is enabled
+func printUpdateNotice() {
+	if !viper.GetBool("update_check") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	status, err := lib.CheckForUpdate(ctx)
+	if err != nil {
+		log.Debug("Update check failed", "error", err)
+		return
+	}
+	if status.Available {
+		fmt.Fprintf(os.Stderr, "\n💡 aproxymate %s is available (you have %s). Run 'aproxymate upgrade' to install it.\n", status.Latest, status.Current)
+		fmt.Fprintf(os.Stderr, "   Release notes: %s\n", status.URL)
+	}
+}
+
 // ensureConfigWithPrompt ensures a config file exists or prompts to create one
 // This should be called by commands that need a configuration file
 func ensureConfigWithPrompt(commandName string) error {
@@ -332,6 +479,10 @@ func ensureConfigWithPrompt(commandName string) error {
 		"--help":            true,
 		"-h":                true,
 		"completion":        true,
+		"version":           true,
+		"upgrade":           true,
+		"status":            true,  // status only talks to the running GUI
+		"debug shell":       true,  // debug shell finds the relay pod through the running GUI
 		"config":            false, // Let config subcommands handle individually
 		"config show":       false, // Show should prompt to create
 		"config list":       false, // List should prompt to create
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"aproxymate/lib"
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show how often each proxy has been used",
+	Long: `Show the recorded usage of each proxy: how often it was connected, for how long
+and how much traffic went through it, per day and in total.
+
+Usage is recorded by 'aproxymate gui' and 'aproxymate open' and kept for 90 days.
+Proxies from the config file that were not used in the period are listed too, so
+tunnels that are configured but never used stand out.
+
+The cost column estimates what the relay pods cost, using the pod-hour rates of the
+'cost' section of the config file (0.005 per pod-hour by default).
+
+Examples:
+  aproxymate stats
+  aproxymate stats --days 7 --unused
+  aproxymate stats -o json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outputCtx := lib.NewSimpleOutputContext()
+
+		days, _ := cmd.Flags().GetInt("days")
+		unused, _ := cmd.Flags().GetBool("unused")
+		output, _ := cmd.Flags().GetString("output")
+		if days < 1 || days > 90 {
+			outputCtx.UserErrorAndExit("--days must be between 1 and 90\n")
+		}
+		if output != "text" && output != "json" {
+			outputCtx.UserErrorAndExit("Unknown output format '%s'. Use 'text' or 'json'.\n", output)
+		}
+
+		if viper.ConfigFileUsed() == "" {
+			lib.EnsureConfigLoaded()
+		}
+
+		var config lib.AppConfig
+		if err := viper.Unmarshal(&config); err != nil {
+			outputCtx.UserErrorAndExit("Error parsing configuration file: %v\n", err)
+		}
+		names := make([]string, 0, len(config.ProxyConfigs))
+		for _, proxyConfig := range config.ProxyConfigs {
+			names = append(names, proxyConfig.Name)
+		}
+
+		history, err := lib.LoadUsageHistory()
+		if err != nil {
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+
+		summary := history.Summarize(names, days, time.Now())
+		estimate := config.Cost.EstimateCost(summary, nil)
+		if unused {
+			filtered := summary[:0]
+			for _, usage := range summary {
+				if usage.Configured && usage.Connects == 0 && usage.ConnectedSeconds == 0 {
+					filtered = append(filtered, usage)
+				}
+			}
+			summary = filtered
+		}
+
+		if output == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(summary)
+			return
+		}
+
+		if len(summary) == 0 {
+			if unused {
+				fmt.Printf("Every configured proxy was used in the last %d day(s).\n", days)
+			} else {
+				fmt.Println("No usage recorded and no proxies configured.")
+			}
+			return
+		}
+
+		fmt.Printf("Proxy usage in the last %d day(s):\n\n", days)
+		fmt.Printf("%-30s %8s %12s %10s %10s %10s  %s\n", "NAME", "CONNECTS", "CONNECTED", "IN", "OUT", "COST", "LAST USED")
+		for _, usage := range summary {
+			name := usage.Name
+			if !usage.Configured {
+				name += " (not configured)"
+			}
+			lastUsed := usage.LastUsed
+			if lastUsed == "" {
+				lastUsed = "never"
+			}
+			fmt.Printf("%-30s %8d %12s %10s %10s %10.2f  %s\n",
+				name,
+				usage.Connects,
+				time.Duration(usage.ConnectedSeconds)*time.Second,
+				formatBytes(usage.BytesIn),
+				formatBytes(usage.BytesOut),
+				usage.Cost,
+				lastUsed)
+		}
+
+		fmt.Printf("\nEstimated relay pod cost: %.1f pod-hours, %.2f %s\n", estimate.PodHours, estimate.Cost, estimate.Currency)
+		for _, cluster := range estimate.Clusters {
+			name := cluster.Cluster
+			if name == "" {
+				name = "(unknown cluster)"
+			}
+			fmt.Printf("  %-28s %8.1f pod-hours x %.4f = %.2f\n", name, cluster.PodHours, cluster.PodHourRate, cluster.Cost)
+		}
+	},
+}
+
+// formatBytes renders a byte count as e.g. "1.5 MiB"
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value := float64(bytes)
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	for i := range units {
+		value /= unit
+		if value < unit || i == len(units)-1 {
+			return fmt.Sprintf("%.1f %s", value, units[i])
+		}
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().Int("days", 30, "Number of days to show, today included (1-90)")
+	statsCmd.Flags().Bool("unused", false, "Only list configured proxies that were not used in the period")
+	statsCmd.Flags().StringP("output", "o", "text", "Output format (text, json)")
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"aproxymate/lib"
+	log "aproxymate/lib/logger"
+)
+
+// statusSnapshot is the state of the running GUI's proxies at one point in time. The totals and
+// per-proxy counters carry the same values as the StatsD gauges and counters.
+type statusSnapshot struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Running is false when no GUI is running, and then all other fields are empty
+	Running bool   `json:"running"`
+	URL     string `json:"url,omitempty"`
+	// ProxiesConnected and ConnectionsActive match aproxymate.proxies.connected and aproxymate.connections.active
+	ProxiesConnected  int             `json:"proxiesConnected"`
+	ConnectionsActive int             `json:"connectionsActive"`
+	Proxies           []proxySnapshot `json:"proxies"`
+}
+
+// proxySnapshot is one proxy of a statusSnapshot
+type proxySnapshot struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Cluster   string         `json:"cluster"`
+	State     lib.ProxyState `json:"state"`
+	Connected bool           `json:"connected"`
+	// ConnectionsActive, BytesIn and BytesOut match the aproxymate.proxy.* metrics; the byte
+	// counts are totals since the proxy connected
+	ConnectionsActive int    `json:"connectionsActive"`
+	BytesIn           int64  `json:"bytesIn"`
+	BytesOut          int64  `json:"bytesOut"`
+	UptimeSeconds     int64  `json:"uptimeSeconds"`
+	Restarts          int32  `json:"restarts"`
+	LastError         string `json:"lastError,omitempty"`
+}
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of the running GUI's proxies",
+	Long: `Show the state, client connections and traffic of each proxy of the running GUI.
+
+With --watch a new snapshot is printed every --interval until interrupted. With
+--output json each snapshot is one line of JSON, ready to be piped into telegraf
+or a script; its counters match the StatsD metrics (see the 'statsd' section of
+the config file). While no GUI is running, snapshots report "running": false.
+
+Examples:
+  aproxymate status
+  aproxymate status --output json --watch --interval 10s`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outputCtx := lib.NewSimpleOutputContext()
+
+		output, _ := cmd.Flags().GetString("output")
+		watch, _ := cmd.Flags().GetBool("watch")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if output != "text" && output != "json" {
+			outputCtx.UserErrorAndExit("Unknown output format '%s'. Use 'text' or 'json'.\n", output)
+		}
+		if interval < time.Second {
+			outputCtx.UserErrorAndExit("--interval must be at least 1s\n")
+		}
+
+		var running *lib.GUIInstance
+		for {
+			var snapshot statusSnapshot
+			snapshot, running = takeStatusSnapshot(running)
+			if output == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				if !watch {
+					encoder.SetIndent("", "  ")
+				}
+				encoder.Encode(snapshot)
+			} else {
+				printStatusSnapshot(snapshot, watch)
+			}
+
+			if !watch {
+				return
+			}
+			time.Sleep(interval)
+		}
+	},
+}
+
+// takeStatusSnapshot reads the proxies of the running GUI. The instance found for the previous
+// snapshot is reused while it answers, so the OS keychain isn't read on every snapshot.
+func takeStatusSnapshot(running *lib.GUIInstance) (statusSnapshot, *lib.GUIInstance) {
+	snapshot := statusSnapshot{Timestamp: time.Now().UTC(), Proxies: []proxySnapshot{}}
+
+	var rows []lib.ProxyRow
+	var err error
+	if running != nil {
+		rows, _, err = running.Proxies(lib.ProxyFilter{})
+	}
+	if running == nil || err != nil {
+		found, findErr := lib.FindRunningGUI()
+		if findErr != nil {
+			log.Debug("Could not look for a running GUI", "error", findErr)
+		}
+		running = found
+		if running == nil {
+			return snapshot, nil
+		}
+		if rows, _, err = running.Proxies(lib.ProxyFilter{}); err != nil {
+			log.Warn("Failed to read the running GUI's proxies", "error", err)
+			return snapshot, nil
+		}
+	}
+
+	snapshot.Running = true
+	snapshot.URL = running.URL
+	for _, row := range rows {
+		proxy := proxySnapshot{
+			ID:            row.ID,
+			Name:          row.Name,
+			Cluster:       row.KubernetesCluster,
+			State:         row.State,
+			Connected:     row.Connected,
+			UptimeSeconds: row.UptimeSeconds,
+			Restarts:      row.Restarts,
+			LastError:     row.LastError,
+		}
+		if row.Stats != nil {
+			proxy.ConnectionsActive = row.Stats.ActiveConnections
+			proxy.BytesIn = row.Stats.BytesIn
+			proxy.BytesOut = row.Stats.BytesOut
+		}
+		if proxy.Connected {
+			snapshot.ProxiesConnected++
+		}
+		snapshot.ConnectionsActive += proxy.ConnectionsActive
+		snapshot.Proxies = append(snapshot.Proxies, proxy)
+	}
+	return snapshot, running
+}
+
+// printStatusSnapshot prints a snapshot as a table, headed by its time when watching
+func printStatusSnapshot(snapshot statusSnapshot, watch bool) {
+	if watch {
+		fmt.Printf("--- %s\n", snapshot.Timestamp.Local().Format(time.DateTime))
+	}
+	if !snapshot.Running {
+		fmt.Println("No aproxymate GUI is running.")
+		if !watch {
+			fmt.Println("\nTo start it, run:")
+			fmt.Println("  aproxymate gui")
+		}
+		return
+	}
+
+	fmt.Printf("%d of %d proxies connected, %d client connection(s), GUI at %s\n\n",
+		snapshot.ProxiesConnected, len(snapshot.Proxies), snapshot.ConnectionsActive, snapshot.URL)
+	fmt.Printf("%-30s %-11s %6s %10s %10s %10s  %s\n", "NAME", "STATE", "CONNS", "IN", "OUT", "UPTIME", "CLUSTER")
+	for _, proxy := range snapshot.Proxies {
+		uptime := "-"
+		if proxy.Connected {
+			uptime = (time.Duration(proxy.UptimeSeconds) * time.Second).String()
+		}
+		fmt.Printf("%-30s %-11s %6d %10s %10s %10s  %s\n",
+			proxy.Name,
+			proxy.State,
+			proxy.ConnectionsActive,
+			formatBytes(proxy.BytesIn),
+			formatBytes(proxy.BytesOut),
+			uptime,
+			proxy.Cluster)
+		if proxy.LastError != "" {
+			fmt.Printf("  ⚠️  %s\n", proxy.LastError)
+		}
+	}
+	if watch {
+		fmt.Println()
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().StringP("output", "o", "text", "Output format (text, json)")
+	statusCmd.Flags().BoolP("watch", "w", false, "Print a new snapshot every --interval until interrupted")
+	statusCmd.Flags().Duration("interval", 5*time.Second, "Time between snapshots with --watch")
+}
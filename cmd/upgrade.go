@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"aproxymate/lib"
+	log "aproxymate/lib/logger"
+)
+
+// upgradeCmd represents the upgrade command
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Download and install the latest aproxymate release",
+	Long: `Check GitHub for the latest aproxymate release and replace the running binary
+with the build for this platform. The download is verified against the release's
+checksums file; releases without one are only installed with --skip-verify.
+
+Use --check to only report whether a newer version exists.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opCtx, _ := log.StartOperation(context.Background(), "upgrade", "upgrade_binary")
+		outputCtx := lib.NewOutputContext(opCtx)
+
+		checkOnly, _ := cmd.Flags().GetBool("check")
+		force, _ := cmd.Flags().GetBool("force")
+		skipVerify, _ := cmd.Flags().GetBool("skip-verify")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		release, err := lib.FetchLatestRelease(ctx)
+		if err != nil {
+			opCtx.Complete("upgrade_binary", err)
+			outputCtx.UserErrorAndExit("%v\n", err)
+		}
+
+		newer := lib.IsNewerVersion(release.Version, lib.Version)
+		fmt.Printf("Current version: %s\n", lib.Version)
+		fmt.Printf("Latest release:  %s (%s)\n", release.Version, release.URL)
+
+		if !newer && !force {
+			if lib.Version == "dev" {
+				fmt.Println("\nThis is a development build. Use --force to install the latest release anyway.")
+			} else {
+				fmt.Println("\n✅ aproxymate is up to date.")
+			}
+			opCtx.Complete("upgrade_binary", nil)
+			return
+		}
+
+		if release.Notes != "" {
+			fmt.Printf("\nRelease notes:\n%s\n", release.Notes)
+		}
+
+		if checkOnly {
+			fmt.Println("\nRun 'aproxymate upgrade' to install it.")
+			opCtx.Complete("upgrade_binary", nil)
+			return
+		}
+
+		fmt.Printf("\n⬇️  Downloading %s...\n", release.Version)
+		path, err := lib.UpgradeBinary(ctx, release, skipVerify)
+		if err != nil {
+			opCtx.Complete("upgrade_binary", err)
+			if errors.Is(err, lib.ErrReleaseUnverifiable) {
+				outputCtx.UserErrorAndExit("Upgrade failed: %v\nUse --skip-verify to install it without verification.\n", err)
+			}
+			outputCtx.UserErrorAndExit("Upgrade failed: %v\n", err)
+		}
+
+		fmt.Printf("✅ Installed aproxymate %s at %s\n", release.Version, path)
+		opCtx.Complete("upgrade_binary", nil)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+
+	upgradeCmd.Flags().Bool("check", false, "Only report whether a newer version is available")
+	upgradeCmd.Flags().Bool("force", false, "Install the latest release even if it is not newer")
+	upgradeCmd.Flags().Bool("skip-verify", false, "Install a release that has no checksums file without verifying the download")
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"aproxymate/lib"
+)
+
+// versionCmd represents the version command
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the aproxymate version",
+	Long: `Print the version, commit and build date of this aproxymate binary.
+
+Use --output json for machine-readable output.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		info := lib.GetBuildInfo()
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(info)
+		case "", "text":
+			fmt.Printf("aproxymate %s\n", info.Version)
+			fmt.Printf("  Commit:     %s\n", info.Commit)
+			fmt.Printf("  Built:      %s\n", info.BuildDate)
+			fmt.Printf("  Go version: %s\n", info.GoVersion)
+			fmt.Printf("  Platform:   %s\n", info.Platform)
+		default:
+			outputCtx := lib.NewSimpleOutputContext()
+			outputCtx.UserErrorAndExit("Unknown output format '%s'. Use 'text' or 'json'.\n", output)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+
+	versionCmd.Flags().StringP("output", "o", "text", "Output format (text, json)")
+}
@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// AccessLogAudit sends access log entries to the audit log instead of a file
+const AccessLogAudit = "audit"
+
+// AccessLogEntry is one finished client connection in a proxy's access log
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Proxy      string    `json:"proxy"`
+	ProxyID    string    `json:"proxy_id"`
+	Client     string    `json:"client"`
+	RemoteHost string    `json:"remote_host"`
+	RemotePort int       `json:"remote_port"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// accessLogMu serializes writes, since several proxies may share one access log file
+var accessLogMu sync.Mutex
+
+// newAccessLogger returns the OnConnectionClosed callback that records connections of the spec
+// to target, which is "audit" or a file path. It returns nil when target is empty.
+func newAccessLogger(target string, spec ProxySpec) func(ConnectionRecord) {
+	if target == "" {
+		return nil
+	}
+
+	return func(record ConnectionRecord) {
+		entry := AccessLogEntry{
+			Time:       record.EndedAt,
+			Proxy:      spec.Name,
+			ProxyID:    spec.ID,
+			Client:     record.ClientAddr,
+			RemoteHost: spec.RemoteHost,
+			RemotePort: record.RemotePort,
+			StartedAt:  record.StartedAt,
+			DurationMs: record.Duration().Milliseconds(),
+			BytesIn:    record.BytesIn,
+			BytesOut:   record.BytesOut,
+			Error:      record.Error,
+		}
+
+		if target == AccessLogAudit {
+			outcome := "success"
+			if entry.Error != "" {
+				outcome = "failure"
+			}
+			log.LogAuditEvent("tunnel_connection", outcome, map[string]any{
+				"proxy_id":    entry.ProxyID,
+				"proxy":       entry.Proxy,
+				"client":      entry.Client,
+				"remote_host": entry.RemoteHost,
+				"remote_port": entry.RemotePort,
+				"started_at":  entry.StartedAt.Format(time.RFC3339),
+				"duration_ms": entry.DurationMs,
+				"bytes_in":    entry.BytesIn,
+				"bytes_out":   entry.BytesOut,
+				"error":       entry.Error,
+			})
+			return
+		}
+
+		if err := appendAccessLog(target, entry); err != nil {
+			log.Warn("Failed to write access log", "path", target, "proxy_id", spec.ID, "error", err)
+		}
+	}
+}
+
+// appendAccessLog appends an entry as a JSON line to the access log file
+func appendAccessLog(path string, entry AccessLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create access log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,245 @@
+package lib
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "aproxymate/lib/logger"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Startup handling of relay pods that survived an earlier session
+const (
+	AdoptModeAsk    = "ask"
+	AdoptModeAlways = "always"
+	AdoptModeNever  = "never"
+)
+
+// AdoptablePod is a running relay pod from an earlier session that matches a configured proxy
+type AdoptablePod struct {
+	ProxyID   string    `json:"proxyId"`
+	ProxyName string    `json:"proxyName"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	PodName   string    `json:"podName"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ListenPorts are the pod's ports for the proxy's ports, the main port first
+	ListenPorts []int `json:"listenPorts"`
+	// relayCertificate is the certificate and key of a relay that terminates TLS
+	relayCertificate []byte
+}
+
+// key identifies the pod across clusters
+func (p AdoptablePod) key() string {
+	return podKey(p.Cluster, p.Namespace, p.PodName)
+}
+
+// podKey identifies a pod across clusters
+func podKey(cluster, namespace, podName string) string {
+	return cluster + "/" + namespace + "/" + podName
+}
+
+// FindAdoptablePods looks for the current user's running relay pods that relay to the same
+// targets as the given proxies. Each proxy is matched with at most one pod, the newest.
+func FindAdoptablePods(specs []ProxySpec, timeout time.Duration) []AdoptablePod {
+	type scope struct{ cluster, namespace string }
+	byScope := make(map[scope][]ProxySpec)
+	for _, spec := range specs {
+		if spec.KubernetesCluster == "" || spec.RemoteHost == "" {
+			continue
+		}
+		namespace := spec.Namespace
+		if namespace == "" {
+			namespace = DefaultNamespace()
+		}
+		key := scope{spec.KubernetesCluster, namespace}
+		byScope[key] = append(byScope[key], spec)
+	}
+
+	var (
+		mu    sync.Mutex
+		found []AdoptablePod
+		wg    sync.WaitGroup
+	)
+	history := loadClusterScanHistory()
+	for key, scopeSpecs := range byScope {
+		// Clusters that were unreachable at recent startups would only delay this one
+		if _, skipped := history.skipUntil(key.cluster, time.Now()); skipped {
+			continue
+		}
+		wg.Add(1)
+		go func(cluster, namespace string, scopeSpecs []ProxySpec) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			kubeClient, err := GetKubernetesClient(KubeConfig{Context: cluster})
+			if err != nil {
+				log.Debug("Could not create Kubernetes client to look for running pods", "context", cluster, "error", err)
+				return
+			}
+
+			pods, err := listOwnPods(ctx, kubeClient, namespace, ",component=socat-proxy")
+			if err != nil {
+				log.Debug("Failed to list running pods", "context", cluster, "namespace", namespace, "error", err)
+				return
+			}
+
+			matches := matchAdoptablePods(cluster, namespace, scopeSpecs, pods)
+			mu.Lock()
+			found = append(found, matches...)
+			mu.Unlock()
+		}(key.cluster, key.namespace, scopeSpecs)
+	}
+	wg.Wait()
+
+	sort.Slice(found, func(i, j int) bool { return found[i].ProxyName < found[j].ProxyName })
+	return found
+}
+
+// matchAdoptablePods pairs proxies with healthy pods relaying to the same targets
+func matchAdoptablePods(cluster, namespace string, specs []ProxySpec, pods []corev1.Pod) []AdoptablePod {
+	// Prefer the newest pod when a proxy matches several
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+	})
+
+	used := make(map[string]bool)
+	var matches []AdoptablePod
+	for _, spec := range specs {
+		want := specRelayTargets(spec)
+		for _, pod := range pods {
+			certificate := podRelayCertificate(&pod)
+			if used[pod.Name] || !podReady(&pod) || spec.RelayTLS != (certificate != nil) {
+				continue
+			}
+			listenPorts, ok := relayListenPorts(want, podRelayTargets(&pod))
+			if !ok {
+				continue
+			}
+			used[pod.Name] = true
+			matches = append(matches, AdoptablePod{
+				ProxyID:     spec.ID,
+				ProxyName:   spec.Name,
+				Cluster:     cluster,
+				Namespace:   namespace,
+				PodName:     pod.Name,
+				CreatedAt:   pod.CreationTimestamp.Time,
+				ListenPorts: listenPorts,
+
+				relayCertificate: certificate,
+			})
+			break
+		}
+	}
+	return matches
+}
+
+// specRelayTargets returns the targets a relay pod needs for the spec, the main port first
+func specRelayTargets(spec ProxySpec) []string {
+	hosts := spec.RemoteHosts
+	if len(hosts) == 0 {
+		hosts = []string{spec.RemoteHost}
+	}
+	targets := []string{relayTarget(hosts, spec.RemotePort)}
+	for _, mapping := range spec.Ports {
+		targets = append(targets, relayTarget(hosts, mapping.RemotePort))
+	}
+	return targets
+}
+
+// podRelayTargets reads the listen port to target mapping from a pod's socat containers
+func podRelayTargets(pod *corev1.Pod) map[int]string {
+	targets := make(map[int]string)
+	for _, container := range pod.Spec.Containers {
+		if port, target, ok := failoverRelayTarget(container); ok {
+			targets[port] = target
+			continue
+		}
+		if len(container.Args) != 2 {
+			continue
+		}
+		listen, ok := strings.CutPrefix(container.Args[0], "TCP-LISTEN:")
+		if !ok {
+			if listen, ok = strings.CutPrefix(container.Args[0], "OPENSSL-LISTEN:"); !ok {
+				continue
+			}
+		}
+		listen, _, _ = strings.Cut(listen, ",")
+		port, err := strconv.Atoi(listen)
+		if err != nil {
+			continue
+		}
+		if target, ok := strings.CutPrefix(container.Args[1], "TCP:"); ok {
+			target, _, _ = strings.Cut(target, ",")
+			targets[port] = target
+		}
+	}
+	return targets
+}
+
+// describeRelayTargets renders relay targets as "host:port" strings ordered by listen port
+func describeRelayTargets(targets map[int]string) string {
+	ports := make([]int, 0, len(targets))
+	for port := range targets {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+
+	described := make([]string, len(ports))
+	for i, port := range ports {
+		described[i] = targets[port]
+	}
+	return strings.Join(described, ", ")
+}
+
+// relayListenPorts finds the listen ports of a pod for the wanted targets, in their order. It
+// fails unless the pod relays to exactly these targets. Pods of older versions listen on the
+// remote ports, so the listen ports are read from the pod rather than assumed.
+func relayListenPorts(want []string, targets map[int]string) ([]int, bool) {
+	if len(want) != len(targets) {
+		return nil, false
+	}
+	ports := make([]int, 0, len(targets))
+	for port := range targets {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+
+	used := make(map[int]bool, len(ports))
+	listenPorts := make([]int, 0, len(want))
+	for _, target := range want {
+		found := false
+		for _, port := range ports {
+			if !used[port] && targets[port] == target {
+				used[port] = true
+				listenPorts = append(listenPorts, port)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return listenPorts, true
+}
+
+// podReady reports whether a pod is running with all containers ready
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if !status.Ready {
+			return false
+		}
+	}
+	return true
+}
@@ -22,13 +22,13 @@ type AWSConfig struct {
 
 // RDSEndpoint represents an RDS endpoint discovered from AWS
 type RDSEndpoint struct {
-	Identifier  string
-	Endpoint    string
-	Port        int32
-	Engine      string
-	Status      string
-	IsCluster   bool
-	ClusterRole string // primary, reader, writer, etc.
+	Identifier  string `json:"identifier"`
+	Endpoint    string `json:"endpoint"`
+	Port        int32  `json:"port"`
+	Engine      string `json:"engine"`
+	Status      string `json:"status"`
+	IsCluster   bool   `json:"isCluster"`
+	ClusterRole string `json:"clusterRole,omitempty"` // primary, reader, writer, etc.
 }
 
 // GetAWSRDSEndpoints fetches all RDS endpoints from the specified AWS account/region
@@ -202,6 +202,7 @@ func ConvertRDSEndpointsToProxyConfigs(endpoints []RDSEndpoint, kubernetesCluste
 			RemoteHost:        endpoint.Endpoint,
 			LocalPort:         currentPort,
 			RemotePort:        int(endpoint.Port),
+			Engine:            NormalizeEngine(endpoint.Engine),
 		}
 
 		configs = append(configs, config)
@@ -239,7 +240,7 @@ func generateProxyConfigName(endpoint RDSEndpoint) string {
 }
 
 // MergeProxyConfigs merges new proxy configs with existing ones, ensuring unique local ports
-func MergeProxyConfigs(existingConfigs []ProxyConfig, newConfigs []ProxyConfig) []ProxyConfig {
+func MergeProxyConfigs(existingConfigs []ProxyConfig, newConfigs []ProxyConfig, policy PortPolicy) []ProxyConfig {
 	log.Debug("Merging proxy configurations",
 		"existing_count", len(existingConfigs),
 		"new_count", len(newConfigs))
@@ -252,7 +253,9 @@ func MergeProxyConfigs(existingConfigs []ProxyConfig, newConfigs []ProxyConfig)
 	for _, config := range existingConfigs {
 		key := fmt.Sprintf("%s:%d", config.RemoteHost, config.RemotePort)
 		existingByHost[key] = config
-		usedPorts[config.LocalPort] = true
+		for _, port := range config.LocalPorts() {
+			usedPorts[port] = true
+		}
 	}
 
 	var mergedConfigs []ProxyConfig
@@ -271,7 +274,7 @@ func MergeProxyConfigs(existingConfigs []ProxyConfig, newConfigs []ProxyConfig)
 		}
 
 		// Ensure unique local port
-		newConfig.LocalPort = findNextAvailablePort(usedPorts, newConfig.LocalPort)
+		newConfig.LocalPort = policy.NextAvailable(usedPorts, newConfig.LocalPort)
 		usedPorts[newConfig.LocalPort] = true
 
 		mergedConfigs = append(mergedConfigs, newConfig)
@@ -286,39 +289,6 @@ func MergeProxyConfigs(existingConfigs []ProxyConfig, newConfigs []ProxyConfig)
 	return mergedConfigs
 }
 
-// findNextAvailablePort finds the next available port starting from the preferred port
-func findNextAvailablePort(usedPorts map[int]bool, preferredPort int) int {
-	// Start from the preferred port and find the next available one
-	port := preferredPort
-	for {
-		if !usedPorts[port] && port >= 1024 && port <= 65535 {
-			return port
-		}
-		port++
-
-		// If we've gone beyond the valid range, start from a reasonable default
-		if port > 65535 {
-			port = 3000 // Start from 3000 as a reasonable default for databases
-		}
-
-		// Prevent infinite loop
-		if port == preferredPort {
-			break
-		}
-	}
-
-	// Fallback: find any available port in the range 3000-9999
-	for port := 3000; port <= 9999; port++ {
-		if !usedPorts[port] {
-			return port
-		}
-	}
-
-	// Final fallback: use the preferred port even if it might conflict
-	log.Warn("Could not find available port, using preferred port", "port", preferredPort)
-	return preferredPort
-}
-
 // ValidateAWSCredentials checks if AWS credentials are properly configured
 func ValidateAWSCredentials(ctx context.Context, awsConfig AWSConfig) error {
 	log.Debug("Validating AWS credentials", "region", awsConfig.Region, "profile", awsConfig.Profile)
@@ -365,32 +335,9 @@ func maskAccessKey(accessKey string) string {
 	return accessKey[:4] + strings.Repeat("*", len(accessKey)-4)
 }
 
-// getNextPortFromConfig finds the next available port by examining existing configurations
-func getNextPortFromConfig(configs []ProxyConfig) int {
-	if len(configs) == 0 {
-		return 3001 // Start from 3001 as a reasonable default for first RDS endpoint
-	}
-
-	// Find the highest used port
-	maxPort := 0
-	for _, config := range configs {
-		if config.LocalPort > maxPort {
-			maxPort = config.LocalPort
-		}
-	}
-
-	// Return next port, but ensure it's at least 3000
-	nextPort := maxPort + 1
-	if nextPort < 3000 {
-		nextPort = 3001
-	}
-
-	return nextPort
-}
-
 // GetStartingPortForAWSConfigs determines the starting port for new AWS configurations
-func GetStartingPortForAWSConfigs(existingConfigs []ProxyConfig) int {
-	return getNextPortFromConfig(existingConfigs)
+func GetStartingPortForAWSConfigs(existingConfigs []ProxyConfig, policy PortPolicy) int {
+	return policy.StartingPort(existingConfigs)
 }
 
 // FilterRDSEndpointsByEngine filters RDS endpoints by engine type
@@ -125,6 +125,11 @@ func ValidateAWSProfile(profileName string) (bool, error) {
 	return false, nil
 }
 
+// AWSRegions returns the regions RDS endpoints can be imported from
+func AWSRegions() []string {
+	return append([]string(nil), standardUSRegions...)
+}
+
 // ValidateAWSRegion checks if the specified region is one of the standard US regions
 func ValidateAWSRegion(region string) bool {
 	if region == "" {
@@ -0,0 +1,268 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	log "aproxymate/lib/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Ports used inside the benchmark pod. The relay ports go through an extra socat hop
+// to the discard/echo servers, matching the path traffic takes through a proxy pod.
+const (
+	benchDiscardPort      = 9009
+	benchEchoPort         = 9007
+	benchRelayDiscardPort = 10009
+	benchRelayEchoPort    = 10007
+)
+
+// BenchOptions configures a tunnel benchmark
+type BenchOptions struct {
+	KubernetesCluster string
+	Namespace         string
+	// Bytes is the amount of data pushed through the tunnel for the throughput test
+	Bytes int64
+	// Pings is the number of round trips used for the latency test
+	Pings int
+}
+
+// BenchResult holds the measurements for one forwarding path
+type BenchResult struct {
+	Mode       string
+	Bytes      int64
+	Duration   time.Duration
+	Throughput float64 // MiB per second
+	LatencyMin time.Duration
+	LatencyAvg time.Duration
+	LatencyP50 time.Duration
+	LatencyP95 time.Duration
+	LatencyMax time.Duration
+}
+
+// RunTunnelBenchmark creates a benchmark pod with discard and echo servers, forwards to it
+// directly and through a socat relay, and measures throughput and round-trip latency for both
+func RunTunnelBenchmark(opts BenchOptions) ([]BenchResult, error) {
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	kubeConfig := KubeConfig{Context: opts.KubernetesCluster}
+	kubeClient, err := GetKubernetesClient(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot connect to Kubernetes cluster '%s': %v", opts.KubernetesCluster, err)
+	}
+	restConfig, err := GetKubernetesClientConfig(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot connect to Kubernetes cluster '%s': %v", opts.KubernetesCluster, err)
+	}
+
+	// Bind ephemeral local ports for every path before creating the pod
+	forwarder, err := NewLocalForwarder("", 0, benchDiscardPort)
+	if err != nil {
+		return nil, err
+	}
+	defer forwarder.Close()
+	for _, port := range []int{benchEchoPort, benchRelayDiscardPort, benchRelayEchoPort} {
+		if err := forwarder.AddListener("", 0, port); err != nil {
+			return nil, err
+		}
+	}
+	addrs := forwarder.Addrs()
+
+	podName := fmt.Sprintf("aproxymate-%s-bench-%d", getSafeUsername(), time.Now().Unix())
+	if err := createBenchPod(kubeClient, namespace, podName); err != nil {
+		return nil, err
+	}
+	defer DeleteSocatProxyPod(kubeClient, namespace, podName)
+
+	if err := WaitForPodRunning(kubeClient, namespace, podName, 60*time.Second); err != nil {
+		return nil, fmt.Errorf("benchmark pod failed to start: %w", err)
+	}
+
+	if err := forwarder.Start(kubeClient, restConfig, namespace, podName); err != nil {
+		return nil, err
+	}
+
+	paths := []struct {
+		mode    string
+		discard string
+		echo    string
+	}{
+		{"direct", addrs[0].String(), addrs[1].String()},
+		{"socat relay", addrs[2].String(), addrs[3].String()},
+	}
+
+	var results []BenchResult
+	for _, path := range paths {
+		log.Debug("Running tunnel benchmark", "mode", path.mode, "bytes", opts.Bytes, "pings", opts.Pings)
+
+		// The servers may need a moment to start listening after the pod reports running
+		latencies, err := retryBench(func() ([]time.Duration, error) { return measureLatency(path.echo, opts.Pings) })
+		if err != nil {
+			return nil, fmt.Errorf("%s latency test failed: %w", path.mode, err)
+		}
+
+		duration, err := measureThroughput(path.discard, opts.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s throughput test failed: %w", path.mode, err)
+		}
+
+		result := BenchResult{
+			Mode:       path.mode,
+			Bytes:      opts.Bytes,
+			Duration:   duration,
+			Throughput: float64(opts.Bytes) / (1024 * 1024) / duration.Seconds(),
+		}
+		summarizeLatencies(&result, latencies)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// createBenchPod creates the pod running the discard/echo servers and the socat relays in front of them
+func createBenchPod(clientset *kubernetes.Clientset, namespace, podName string) error {
+	script := fmt.Sprintf(`socat -u TCP-LISTEN:%[1]d,fork,reuseaddr OPEN:/dev/null &
+socat TCP-LISTEN:%[2]d,fork,reuseaddr EXEC:cat &
+socat TCP-LISTEN:%[3]d,fork,reuseaddr TCP:127.0.0.1:%[1]d &
+socat TCP-LISTEN:%[4]d,fork,reuseaddr TCP:127.0.0.1:%[2]d &
+wait`, benchDiscardPort, benchEchoPort, benchRelayDiscardPort, benchRelayEchoPort)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: namespace,
+			Labels:    managedPodLabels("bench", ""),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "bench",
+					Image:   "alpine/socat",
+					Command: []string{"sh", "-c", script},
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("500m"),
+							corev1.ResourceMemory: resource.MustParse("128Mi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("100m"),
+							corev1.ResourceMemory: resource.MustParse("64Mi"),
+						},
+					},
+				},
+			},
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	}
+
+	if _, err := clientset.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create benchmark pod: %w", err)
+	}
+	return nil
+}
+
+// retryBench retries a measurement a few times while the benchmark servers start up
+func retryBench(measure func() ([]time.Duration, error)) ([]time.Duration, error) {
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		var latencies []time.Duration
+		if latencies, err = measure(); err == nil {
+			return latencies, nil
+		}
+		time.Sleep(time.Second)
+	}
+	return nil, err
+}
+
+// measureLatency sends small payloads to the echo server and times each round trip
+func measureLatency(addr string, pings int) ([]time.Duration, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	payload := make([]byte, 64)
+	reply := make([]byte, len(payload))
+	latencies := make([]time.Duration, 0, pings)
+
+	// One warm-up round trip opens the stream to the pod
+	for i := 0; i <= pings; i++ {
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		start := time.Now()
+		if _, err := conn.Write(payload); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			latencies = append(latencies, time.Since(start))
+		}
+	}
+	return latencies, nil
+}
+
+// measureThroughput writes the given amount of data to the discard server and waits until
+// the server has consumed all of it and closed the connection
+func measureThroughput(addr string, size int64) (time.Duration, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Minute))
+
+	buf := make([]byte, 32*1024)
+	start := time.Now()
+	for remaining := size; remaining > 0; {
+		n := int64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := conn.Write(buf[:n]); err != nil {
+			return 0, err
+		}
+		remaining -= n
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// summarizeLatencies fills the latency statistics of a result
+func summarizeLatencies(result *BenchResult, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, latency := range sorted {
+		total += latency
+	}
+
+	result.LatencyMin = sorted[0]
+	result.LatencyMax = sorted[len(sorted)-1]
+	result.LatencyAvg = total / time.Duration(len(sorted))
+	result.LatencyP50 = sorted[len(sorted)/2]
+	result.LatencyP95 = sorted[(len(sorted)*95)/100]
+}
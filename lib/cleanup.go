@@ -0,0 +1,416 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	log "aproxymate/lib/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CleanupTargets maps each Kubernetes context to the namespaces where aproxymate pods may live
+type CleanupTargets map[string][]string
+
+// CleanupTargetsForConfigs returns the clusters and namespaces referenced by the proxy configs
+func CleanupTargetsForConfigs(configs []ProxyConfig) CleanupTargets {
+	seen := make(map[string]map[string]bool)
+	for _, config := range configs {
+		if config.KubernetesCluster == "" {
+			continue
+		}
+		if seen[config.KubernetesCluster] == nil {
+			seen[config.KubernetesCluster] = make(map[string]bool)
+		}
+		seen[config.KubernetesCluster][config.PodNamespace()] = true
+	}
+
+	targets := make(CleanupTargets, len(seen))
+	for cluster, namespaces := range seen {
+		for namespace := range namespaces {
+			targets[cluster] = append(targets[cluster], namespace)
+		}
+		sort.Strings(targets[cluster])
+	}
+	return targets
+}
+
+// CleanupOrphanedPods deletes the current user's leftover aproxymate pods in the given clusters and
+// namespaces, except the pods keep returns true for. Clusters are scanned concurrently and each one is
+// bounded by the timeout, so an unreachable cluster doesn't hold up startup. An unreachable
+// cluster is retried a few times with short timeouts; clusters that failed at several startups
+// in a row are skipped for a while. Failures are logged.
+func CleanupOrphanedPods(targets CleanupTargets, keep func(cluster string, pod *corev1.Pod) bool, timeout time.Duration) {
+	if len(targets) == 0 {
+		log.Debug("No clusters referenced by the configuration, skipping orphaned pod cleanup")
+		return
+	}
+
+	history := loadClusterScanHistory()
+	defer history.save()
+
+	var wg sync.WaitGroup
+	for cluster, namespaces := range targets {
+		if until, skipped := history.skipUntil(cluster, time.Now()); skipped {
+			log.Info("Skipping orphaned pod cleanup in a cluster that was unreachable at recent startups",
+				"context", cluster, "retry_after", until.Format(time.RFC3339))
+			continue
+		}
+
+		wg.Add(1)
+		go func(cluster string, namespaces []string) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			skip := func(pod *corev1.Pod) bool { return keep != nil && keep(cluster, pod) }
+			err := cleanupClusterWithRetries(ctx, cluster, namespaces, skip)
+			if err != nil {
+				log.Warn("Failed to cleanup orphaned pods", "context", cluster, "error", err)
+			}
+			history.record(cluster, err, time.Now())
+		}(cluster, namespaces)
+	}
+	wg.Wait()
+}
+
+const (
+	// cleanupAttemptTimeout bounds each request of a cleanup scan, so an unreachable API server
+	// fails fast instead of waiting for the dial timeout
+	cleanupAttemptTimeout = 5 * time.Second
+	// cleanupAttempts is how often an unreachable cluster is tried per scan
+	cleanupAttempts = 3
+	// cleanupRetryBackoff is the wait before the second attempt; it doubles after that
+	cleanupRetryBackoff = time.Second
+)
+
+// cleanupClusterWithRetries scans a cluster, trying again with jittered exponential backoff while
+// it is unreachable and ctx allows
+func cleanupClusterWithRetries(ctx context.Context, cluster string, namespaces []string, skip func(pod *corev1.Pod) bool) error {
+	backoff := cleanupRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := cleanupCluster(ctx, cluster, namespaces, skip)
+		if err == nil || !clusterUnreachable(err) || attempt == cleanupAttempts {
+			return err
+		}
+
+		wait := backoff/2 + rand.N(backoff)
+		log.Debug("Cluster unreachable for cleanup, retrying", "context", cluster, "attempt", attempt, "wait", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// cleanupCluster deletes the orphaned pods in the namespaces of one cluster. It stops at the
+// first namespace when the cluster can't be reached; other failures are logged and the
+// remaining namespaces are still cleaned up.
+func cleanupCluster(ctx context.Context, cluster string, namespaces []string, skip func(pod *corev1.Pod) bool) error {
+	restConfig, err := GetKubernetesClientConfig(KubeConfig{Context: cluster})
+	if err != nil {
+		return err
+	}
+	restConfig.Timeout = cleanupAttemptTimeout
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range namespaces {
+		if err := cleanupOrphanedPods(ctx, kubeClient, namespace, skip); err != nil {
+			if clusterUnreachable(err) {
+				return err
+			}
+			log.Warn("Failed to cleanup orphaned pods", "context", cluster, "namespace", namespace, "error", err)
+		}
+	}
+	return nil
+}
+
+// ownPodSelectors returns the label selectors of the pods created by aproxymate processes of the
+// current OS user and instance, including those a shared server created for logged-in users. Pods
+// from versions without the host user label are matched by their user label.
+func ownPodSelectors(extra string) []string {
+	currentUser := podLabelUser()
+	extra += "," + instanceSelector()
+	return []string{
+		fmt.Sprintf("aproxymate.managed=true%s,%s=%s", extra, hostUserLabel, currentUser),
+		fmt.Sprintf("aproxymate.managed=true%s,user=%s,!%s", extra, currentUser, hostUserLabel),
+	}
+}
+
+// listOwnPods lists the pods of ownPodSelectors in one namespace
+func listOwnPods(ctx context.Context, clientset *kubernetes.Clientset, namespace, extra string) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	for _, selector := range ownPodSelectors(extra) {
+		list, err := listPods(ctx, clientset, namespace, selector)
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, list.Items...)
+	}
+	return pods, nil
+}
+
+// listPods lists the pods matching a label selector, retrying when the API server is busy
+func listPods(ctx context.Context, clientset *kubernetes.Clientset, namespace, selector string) (*corev1.PodList, error) {
+	var pods *corev1.PodList
+	err := retryKubernetesCall(ctx, "list_pods", func(bool) error {
+		var err error
+		pods, err = clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		return err
+	})
+	return pods, err
+}
+
+// cleanupOrphanedPods deletes the current user's aproxymate pods in one namespace, except skipped ones
+func cleanupOrphanedPods(ctx context.Context, clientset *kubernetes.Clientset, namespace string, skip func(pod *corev1.Pod) bool) error {
+	currentUser := podLabelUser()
+	pods, err := listOwnPods(ctx, clientset, namespace, "")
+	if err != nil {
+		return fmt.Errorf("failed to list aproxymate pods: %w", err)
+	}
+
+	cleaned := 0
+	for _, pod := range pods {
+		if skip != nil && skip(&pod) {
+			log.Debug("Keeping pod in use or offered for re-attach", "pod", pod.Name, "namespace", namespace)
+			continue
+		}
+		cleaned++
+		log.LogPodCleanup("delete_orphaned", pod.Name, namespace, nil)
+		if err := deleteSocatProxyPod(ctx, clientset, namespace, pod.Name); err != nil {
+			log.LogPodCleanup("delete_orphaned", pod.Name, namespace, err)
+			log.Warn("Failed to delete orphaned pod", "pod", pod.Name, "namespace", namespace, "error", err)
+		}
+	}
+
+	if cleaned > 0 {
+		log.Info("Completed cleanup of orphaned pods", "namespace", namespace, "cleaned_count", cleaned, "user", currentUser)
+	}
+	return nil
+}
+
+// PodFilter selects aproxymate pods for admin cleanup
+type PodFilter struct {
+	// Targets maps contexts to namespaces; an empty namespace means all namespaces
+	Targets CleanupTargets
+	// User limits matches to pods created by this user; ignored when AllUsers is set
+	User     string
+	AllUsers bool
+	// OlderThan limits matches to pods created at least this long ago
+	OlderThan time.Duration
+}
+
+// ManagedPod is an aproxymate pod found in a cluster
+type ManagedPod struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	User      string `json:"user"`
+	Component string `json:"component"`
+	Version   string `json:"version,omitempty"`
+	// Instance is the named instance that created the pod, empty for the default instance
+	Instance string `json:"instance,omitempty"`
+	Phase    string `json:"phase"`
+	Node     string `json:"node,omitempty"`
+	// Target is the host and port the pod relays to
+	Target    string    `json:"target,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CleanupFailure records a pod that could not be deleted
+type CleanupFailure struct {
+	Pod   ManagedPod `json:"pod"`
+	Error string     `json:"error"`
+}
+
+// CleanupReport summarizes an admin cleanup run
+type CleanupReport struct {
+	StartedAt  time.Time        `json:"startedAt"`
+	FinishedAt time.Time        `json:"finishedAt"`
+	Operator   string           `json:"operator"`
+	Deleted    []ManagedPod     `json:"deleted"`
+	Failed     []CleanupFailure `json:"failed"`
+}
+
+// FindManagedPods lists the aproxymate pods matching the filter. Contexts are queried concurrently,
+// each bounded by the timeout; contexts that fail are reported in the returned errors.
+func FindManagedPods(filter PodFilter, timeout time.Duration) ([]ManagedPod, []error) {
+	selector := "aproxymate.managed=true"
+	if !filter.AllUsers {
+		user := filter.User
+		if user == "" {
+			user = podLabelUser()
+		}
+		selector += ",user=" + userLabelValue(user)
+	}
+	cutoff := time.Now().Add(-filter.OlderThan)
+
+	var (
+		mu    sync.Mutex
+		found []ManagedPod
+		errs  []error
+		wg    sync.WaitGroup
+	)
+	for cluster, namespaces := range filter.Targets {
+		wg.Add(1)
+		go func(cluster string, namespaces []string) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			kubeClient, err := GetKubernetesClient(KubeConfig{Context: cluster})
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("context %s: %w", cluster, err))
+				mu.Unlock()
+				return
+			}
+
+			for _, namespace := range namespaces {
+				pods, err := listPods(ctx, kubeClient, namespace, selector)
+
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("context %s: failed to list pods: %w", cluster, err))
+				} else {
+					for _, pod := range pods.Items {
+						if filter.OlderThan > 0 && pod.CreationTimestamp.Time.After(cutoff) {
+							continue
+						}
+						found = append(found, ManagedPod{
+							Cluster:   cluster,
+							Namespace: pod.Namespace,
+							Name:      pod.Name,
+							User:      pod.Labels["user"],
+							Component: pod.Labels["component"],
+							Version:   pod.Labels["aproxymate.version"],
+							Instance:  pod.Labels[instanceLabel],
+							Phase:     string(pod.Status.Phase),
+							Node:      pod.Spec.NodeName,
+							Target:    describeRelayTargets(podRelayTargets(&pod)),
+							CreatedAt: pod.CreationTimestamp.Time,
+						})
+					}
+				}
+				mu.Unlock()
+			}
+		}(cluster, namespaces)
+	}
+	wg.Wait()
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Cluster != found[j].Cluster {
+			return found[i].Cluster < found[j].Cluster
+		}
+		return found[i].CreatedAt.Before(found[j].CreatedAt)
+	})
+	return found, errs
+}
+
+// DeleteManagedPods deletes the pods and reports which ones were removed
+func DeleteManagedPods(pods []ManagedPod, timeout time.Duration) CleanupReport {
+	report := CleanupReport{
+		StartedAt: time.Now(),
+		Operator:  podLabelUser(),
+		Deleted:   []ManagedPod{},
+		Failed:    []CleanupFailure{},
+	}
+
+	clients := make(map[string]*kubernetes.Clientset)
+	for _, pod := range pods {
+		kubeClient, ok := clients[pod.Cluster]
+		if !ok {
+			var err error
+			if kubeClient, err = GetKubernetesClient(KubeConfig{Context: pod.Cluster}); err != nil {
+				report.Failed = append(report.Failed, CleanupFailure{Pod: pod, Error: err.Error()})
+				continue
+			}
+			clients[pod.Cluster] = kubeClient
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := deleteSocatProxyPod(ctx, kubeClient, pod.Namespace, pod.Name)
+		cancel()
+
+		log.LogPodCleanup("admin_cleanup", pod.Name, pod.Namespace, err)
+		log.LogAuditEvent("pod_deleted", outcome(err), map[string]any{
+			"cluster":   pod.Cluster,
+			"namespace": pod.Namespace,
+			"pod":       pod.Name,
+			"pod_user":  pod.User,
+		})
+		if err != nil {
+			report.Failed = append(report.Failed, CleanupFailure{Pod: pod, Error: err.Error()})
+		} else {
+			report.Deleted = append(report.Deleted, pod)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report
+}
+
+// outcome returns the audit outcome for an error
+func outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// ErrNotPodOwner is returned when deleting another user's pod without admin rights
+var ErrNotPodOwner = errors.New("pod belongs to another user")
+
+// DeleteManagedPod deletes a single aproxymate pod on behalf of user, the logged-in user or the
+// OS user when empty. Pods of other users are only deleted when allowOthers is set, and pods
+// not managed by aproxymate are never deleted.
+func DeleteManagedPod(cluster, namespace, name, user string, allowOthers bool) error {
+	kubeClient, err := GetKubernetesClient(KubeConfig{Context: cluster})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pod, err := kubeClient.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if pod.Labels["aproxymate.managed"] != "true" {
+		return fmt.Errorf("pod %s is not managed by aproxymate", name)
+	}
+
+	owner := pod.Labels["user"]
+	if owner != requestLabelUser(user) && !allowOthers {
+		return ErrNotPodOwner
+	}
+
+	err = deleteSocatProxyPod(ctx, kubeClient, namespace, name)
+	log.LogPodCleanup("cluster_view_delete", name, namespace, err)
+	details := map[string]any{
+		"cluster":   cluster,
+		"namespace": namespace,
+		"pod":       name,
+		"pod_user":  owner,
+	}
+	if user != "" {
+		details["session_user"] = user
+	}
+	log.LogAuditEvent("pod_deleted", outcome(err), details)
+	return err
+}
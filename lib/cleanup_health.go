@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "aproxymate/lib/logger"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// cleanupSkipAfterFailures is how many startup scans of a cluster must fail in a row
+	// before the cluster is skipped
+	cleanupSkipAfterFailures = 3
+	// cleanupSkipBase is how long a cluster is skipped at first; each further failure doubles it
+	cleanupSkipBase = time.Hour
+	// cleanupSkipMax caps how long a cluster is skipped
+	cleanupSkipMax = 24 * time.Hour
+)
+
+// clusterScanRecord tracks the failed startup scans of a cluster
+type clusterScanRecord struct {
+	Failures  int       `json:"failures"`
+	LastError string    `json:"lastError,omitempty"`
+	SkipUntil time.Time `json:"skipUntil,omitempty"`
+}
+
+// clusterScanHistory holds the clusters whose last startup scans failed, by context. It is kept
+// across runs, so a cluster that is only reachable over a VPN doesn't delay every GUI start.
+type clusterScanHistory struct {
+	mu      sync.Mutex
+	records map[string]clusterScanRecord
+	changed bool
+}
+
+// clusterScanHistoryPath returns the file keeping the failed cluster scans
+func clusterScanHistoryPath() string {
+	return filepath.Join(stateDir(), "cluster-scans.json")
+}
+
+// loadClusterScanHistory reads the failed cluster scans. A missing or unreadable file is an
+// empty history: the worst outcome is one more slow scan.
+func loadClusterScanHistory() *clusterScanHistory {
+	history := &clusterScanHistory{records: make(map[string]clusterScanRecord)}
+	data, err := os.ReadFile(clusterScanHistoryPath())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Debug("Failed to read cluster scan history", "error", err)
+		}
+		return history
+	}
+	if err := json.Unmarshal(data, &history.records); err != nil {
+		log.Debug("Failed to parse cluster scan history", "error", err)
+		history.records = make(map[string]clusterScanRecord)
+	}
+	return history
+}
+
+// skipUntil returns until when the cluster is skipped, if it is
+func (h *clusterScanHistory) skipUntil(cluster string, now time.Time) (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	record := h.records[cluster]
+	return record.SkipUntil, now.Before(record.SkipUntil)
+}
+
+// record notes the outcome of a scan. Only unreachable clusters count as failures; a success
+// or an answer of the API server clears the cluster's record.
+func (h *clusterScanHistory) record(cluster string, err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err == nil || !clusterUnreachable(err) {
+		if _, exists := h.records[cluster]; exists {
+			delete(h.records, cluster)
+			h.changed = true
+		}
+		return
+	}
+
+	record := h.records[cluster]
+	record.Failures++
+	record.LastError = err.Error()
+	if record.Failures >= cleanupSkipAfterFailures {
+		skip := cleanupSkipBase << min(record.Failures-cleanupSkipAfterFailures, 5)
+		record.SkipUntil = now.Add(min(skip, cleanupSkipMax))
+	}
+	h.records[cluster] = record
+	h.changed = true
+}
+
+// save writes the history if it changed
+func (h *clusterScanHistory) save() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.changed {
+		return
+	}
+
+	data, err := json.MarshalIndent(h.records, "", "  ")
+	if err != nil {
+		return
+	}
+	path := clusterScanHistoryPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Debug("Failed to create cluster scan history directory", "error", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		log.Debug("Failed to write cluster scan history", "error", err)
+		return
+	}
+	h.changed = false
+}
+
+// forgetClusterScanFailures clears the failed scans of a cluster that was just reached, so
+// the next startup scans it again
+func forgetClusterScanFailures(cluster string) {
+	history := loadClusterScanHistory()
+	history.record(cluster, nil, time.Now())
+	history.save()
+}
+
+// clusterUnreachable reports whether an error means the API server could not be reached or
+// was temporarily unable to answer, as opposed to a definite answer such as Forbidden
+func clusterUnreachable(err error) bool {
+	var status apierrors.APIStatus
+	return !errors.As(err, &status) || retryableAPIError(err)
+}
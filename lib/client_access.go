@@ -0,0 +1,140 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ClientAccessConfig lists client addresses (CIDRs or single IPs) allowed or denied on local listeners
+type ClientAccessConfig struct {
+	Allow []string `json:"allow,omitempty" mapstructure:"allow" yaml:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty" mapstructure:"deny" yaml:"deny,omitempty"`
+}
+
+// Validate checks that all entries are valid CIDRs or IP addresses
+func (c ClientAccessConfig) Validate() error {
+	if _, err := parseClientCIDRs(c.Allow); err != nil {
+		return fmt.Errorf("invalid allow entry: %w", err)
+	}
+	if _, err := parseClientCIDRs(c.Deny); err != nil {
+		return fmt.Errorf("invalid deny entry: %w", err)
+	}
+	return nil
+}
+
+// ClientAccessPolicy decides whether a client may connect to a local listener.
+// Deny entries always win. When an allow list is present, clients must match it.
+type ClientAccessPolicy struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewClientAccessPolicy combines the global and per-proxy access lists into a policy.
+// Deny lists are merged; a per-proxy allow list replaces the global allow list.
+// Returns nil when no restrictions are configured.
+func NewClientAccessPolicy(global, proxy ClientAccessConfig) (*ClientAccessPolicy, error) {
+	allowEntries := global.Allow
+	if len(proxy.Allow) > 0 {
+		allowEntries = proxy.Allow
+	}
+	denyEntries := append(append([]string{}, global.Deny...), proxy.Deny...)
+
+	if len(allowEntries) == 0 && len(denyEntries) == 0 {
+		return nil, nil
+	}
+
+	allow, err := parseClientCIDRs(allowEntries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client allow list: %w", err)
+	}
+	deny, err := parseClientCIDRs(denyEntries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client deny list: %w", err)
+	}
+
+	return &ClientAccessPolicy{allow: allow, deny: deny}, nil
+}
+
+// Allows reports whether the client address may connect, with a reason when it may not
+func (p *ClientAccessPolicy) Allows(addr net.Addr) (bool, string) {
+	if p == nil {
+		return true, ""
+	}
+
+	// Unix socket clients are governed by file permissions, not addresses
+	if _, ok := addr.(*net.UnixAddr); ok {
+		return true, ""
+	}
+
+	ip := addrIP(addr)
+	if ip == nil {
+		return false, fmt.Sprintf("unable to determine client IP from %s", addr.String())
+	}
+
+	for _, network := range p.deny {
+		if network.Contains(ip) {
+			return false, fmt.Sprintf("client %s matches denied network %s", ip, network)
+		}
+	}
+
+	if len(p.allow) == 0 {
+		return true, ""
+	}
+
+	for _, network := range p.allow {
+		if network.Contains(ip) {
+			return true, ""
+		}
+	}
+
+	return false, fmt.Sprintf("client %s is not in the allow list", ip)
+}
+
+// addrIP extracts the IP address from a network address
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// parseClientCIDRs parses CIDR strings, treating bare IP addresses as single-host networks
+func parseClientCIDRs(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not a valid IP address or CIDR", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid IP address or CIDR", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultClientCommands are the client command templates used when a proxy has no client_command
+var defaultClientCommands = map[string]string{
+	EnginePostgres: "psql {{.URL}}",
+	EngineMySQL:    "mysql -h {{.Host}} -P {{.Port}}{{if .User}} -u {{.User}}{{if not .Password}} -p{{end}}{{end}}{{if .Database}} {{.Database}}{{end}}",
+	EngineRedis:    "redis-cli{{if .Socket}} -s {{.Socket}}{{else}} -h {{.Host}} -p {{.Port}}{{end}}{{if .User}} --user {{.User}}{{end}}",
+}
+
+// ClientCommandData is the data available to client command templates
+type ClientCommandData struct {
+	Host     string
+	Port     int
+	Socket   string
+	URL      string
+	User     string
+	Database string
+	// Password is set for credentials leased from Vault; default clients get it from ClientPasswordEnv
+	Password string
+}
+
+// clientPasswordEnvVars are the environment variables the default clients read a password from
+var clientPasswordEnvVars = map[string]string{
+	EnginePostgres: "PGPASSWORD",
+	EngineMySQL:    "MYSQL_PWD",
+	EngineRedis:    "REDISCLI_AUTH",
+}
+
+// ClientPasswordEnv returns the environment entry that passes a password to the proxy's
+// default client without putting it on the command line, or nil for unknown engines
+func ClientPasswordEnv(config ProxyConfig, password string) []string {
+	name := clientPasswordEnvVars[config.ResolvedEngine()]
+	if name == "" || password == "" {
+		return nil
+	}
+	return []string{name + "=" + password}
+}
+
+// FindProxyConfig returns the proxy config with the given name (case-insensitive) and its index
+func FindProxyConfig(configs []ProxyConfig, name string) (ProxyConfig, int, error) {
+	for i, config := range configs {
+		if strings.EqualFold(config.Name, name) {
+			return config, i, nil
+		}
+	}
+
+	names := make([]string, len(configs))
+	for i, config := range configs {
+		names[i] = config.Name
+	}
+	return ProxyConfig{}, -1, fmt.Errorf("no proxy configuration named '%s'. Available: %s", name, strings.Join(names, ", "))
+}
+
+// BuildClientCommand renders the client command for a proxy into program arguments.
+// The template is split on whitespace; it is not run through a shell.
+func BuildClientCommand(config ProxyConfig, opts ConnectionStringOptions) ([]string, error) {
+	commandTemplate := config.ClientCommand
+	if commandTemplate == "" {
+		engine := config.ResolvedEngine()
+		commandTemplate = defaultClientCommands[engine]
+		if commandTemplate == "" {
+			return nil, fmt.Errorf("no default client for '%s'; set 'client_command' or 'engine' in the configuration", config.Name)
+		}
+	}
+
+	tmpl, err := template.New("client_command").Parse(commandTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client_command for '%s': %w", config.Name, err)
+	}
+
+	host, port, _ := net.SplitHostPort(connectionHost(config))
+	data := ClientCommandData{
+		Host:     host,
+		Socket:   config.LocalSocket,
+		User:     opts.User,
+		Database: opts.Database,
+		Password: opts.Password,
+	}
+	data.Port, _ = strconv.Atoi(port)
+	// The URL is optional in custom templates, so an engine without one is not an error here
+	data.URL, _ = BuildConnectionString(config, ConnectionStringOptions{User: opts.User, Database: opts.Database})
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, fmt.Errorf("failed to render client_command for '%s': %w", config.Name, err)
+	}
+
+	args := strings.Fields(rendered.String())
+	if len(args) == 0 {
+		return nil, fmt.Errorf("client_command for '%s' is empty", config.Name)
+	}
+	return args, nil
+}
+
+// IsLocalEndpointListening reports whether something already accepts connections on the proxy's local endpoint
+func IsLocalEndpointListening(config ProxyConfig) bool {
+	network, address := "tcp", connectionHost(config)
+	if config.LocalSocket != "" {
+		network, address = "unix", config.LocalSocket
+	}
+
+	conn, err := net.DialTimeout(network, address, 500*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
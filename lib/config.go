@@ -2,9 +2,13 @@ package lib
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -17,11 +21,126 @@ type ProxyConfig struct {
 	RemoteHost        string `json:"remote_host" mapstructure:"remote_host" yaml:"remote_host"`
 	LocalPort         int    `json:"local_port" mapstructure:"local_port" yaml:"local_port"`
 	RemotePort        int    `json:"remote_port" mapstructure:"remote_port" yaml:"remote_port"`
+	// RemoteHosts are tried in order after remote_host when it doesn't accept connections
+	RemoteHosts []string `json:"remote_hosts,omitempty" mapstructure:"remote_hosts" yaml:"remote_hosts,omitempty"`
+	// Namespace is the Kubernetes namespace the relay pod runs in (default default_namespace)
+	Namespace string `json:"namespace,omitempty" mapstructure:"namespace" yaml:"namespace,omitempty"`
+	// Engine is the database engine behind the proxy (postgres, mysql, redis); inferred from remote_port when empty
+	Engine string `json:"engine,omitempty" mapstructure:"engine" yaml:"engine,omitempty"`
+	// Favorite proxies get shortcuts in the tray menu
+	Favorite bool `json:"favorite,omitempty" mapstructure:"favorite" yaml:"favorite,omitempty"`
+	// Protected entries are only deleted in the GUI, or removed by a save, after an explicit confirmation
+	Protected bool `json:"protected,omitempty" mapstructure:"protected" yaml:"protected,omitempty"`
+	// ClientCommand is a template for the client launched by `aproxymate open`
+	ClientCommand string `json:"client_command,omitempty" mapstructure:"client_command" yaml:"client_command,omitempty"`
+	// Ports lists additional port mappings relayed through the same pod
+	Ports []PortMapping `json:"ports,omitempty" mapstructure:"ports" yaml:"ports,omitempty"`
+	// LocalSocket is a Unix socket path to listen on instead of a TCP port
+	LocalSocket string `json:"local_socket,omitempty" mapstructure:"local_socket" yaml:"local_socket,omitempty"`
+	// LocalBindAddress is the local address to listen on (default 127.0.0.1)
+	LocalBindAddress string `json:"local_bind_address,omitempty" mapstructure:"local_bind_address" yaml:"local_bind_address,omitempty"`
+	// ClientAccess restricts which clients may use this proxy's local listener
+	ClientAccess ClientAccessConfig `json:"client_access,omitempty" mapstructure:"client_access" yaml:"client_access,omitempty"`
+	// Vault issues short-lived database credentials for this proxy while it is connected
+	Vault VaultCredentialsConfig `json:"vault,omitempty" mapstructure:"vault" yaml:"vault,omitempty"`
+	// PriorityClassName is the PriorityClass of the relay pod, overriding the global setting
+	PriorityClassName string `json:"priority_class_name,omitempty" mapstructure:"priority_class_name" yaml:"priority_class_name,omitempty"`
+	// PodAnnotations are added to the relay pod, overriding global and mesh opt-out annotations with the same key
+	PodAnnotations map[string]string `json:"pod_annotations,omitempty" mapstructure:"pod_annotations" yaml:"pod_annotations,omitempty"`
+	// SNI shares local_port with other SNI proxies, routing TLS connections by their server name
+	SNI bool `json:"sni,omitempty" mapstructure:"sni" yaml:"sni,omitempty"`
+	// SNIHostnames are the server names routed to this proxy (default remote_host); "*.domain" matches one label
+	SNIHostnames []string `json:"sni_hostnames,omitempty" mapstructure:"sni_hostnames" yaml:"sni_hostnames,omitempty"`
+	// HTTPPath serves the proxy below this path of an HTTP gateway on local_port, shared with other HTTP proxies
+	HTTPPath string `json:"http_path,omitempty" mapstructure:"http_path" yaml:"http_path,omitempty"`
+	// HTTPBackendTLS makes the HTTP gateway talk HTTPS to the remote host
+	HTTPBackendTLS bool `json:"http_backend_tls,omitempty" mapstructure:"http_backend_tls" yaml:"http_backend_tls,omitempty"`
+	// AccessLog records every client connection to a file path or "audit", overriding the global setting
+	AccessLog string `json:"access_log,omitempty" mapstructure:"access_log" yaml:"access_log,omitempty"`
+	// Description explains what the proxy is for
+	Description string `json:"description,omitempty" mapstructure:"description" yaml:"description,omitempty"`
+	// Owner is the team or person to ask about the remote service
+	Owner string `json:"owner,omitempty" mapstructure:"owner" yaml:"owner,omitempty"`
+	// DocsURL links to documentation or a runbook for the remote service
+	DocsURL string `json:"docs_url,omitempty" mapstructure:"docs_url" yaml:"docs_url,omitempty"`
+	// Vars fill in placeholders like {{ .Env }} in remote_host and remote_hosts
+	Vars map[string]string `json:"vars,omitempty" mapstructure:"vars" yaml:"vars,omitempty"`
+	// Keepalive overrides individual global TCP keepalive settings for this proxy
+	Keepalive KeepaliveConfig `json:"keepalive,omitempty" mapstructure:"keepalive" yaml:"keepalive,omitempty"`
+	// RelayTLS encrypts the traffic between the local forwarder and the relay pod with TLS
+	RelayTLS bool `json:"relay_tls,omitempty" mapstructure:"relay_tls" yaml:"relay_tls,omitempty"`
+	// Reconnect overrides individual global reconnect policy settings for this proxy
+	Reconnect ReconnectPolicy `json:"reconnect,omitempty" mapstructure:"reconnect" yaml:"reconnect,omitempty"`
+	// APIProxyURL is the HTTP(S) or SOCKS5 proxy the API server of kubernetes_cluster is reached
+	// through; it applies to every connection to that cluster
+	APIProxyURL string `json:"api_proxy_url,omitempty" mapstructure:"api_proxy_url" yaml:"api_proxy_url,omitempty"`
+	// Source is where the entry is written in the config file, set by AppConfig.AnnotateSources
+	Source *ConfigSource `json:"source,omitempty" mapstructure:"-" yaml:"-"`
+}
+
+// PortMapping maps an additional local port to a remote port
+type PortMapping struct {
+	LocalPort  int `json:"local_port" mapstructure:"local_port" yaml:"local_port"`
+	RemotePort int `json:"remote_port" mapstructure:"remote_port" yaml:"remote_port"`
 }
 
 // AppConfig represents the main application configuration
 type AppConfig struct {
 	ProxyConfigs []ProxyConfig `json:"proxy_configs" mapstructure:"proxy_configs" yaml:"proxy_configs"`
+	// ClientAccess applies to every proxy's local listener
+	ClientAccess ClientAccessConfig `json:"client_access,omitempty" mapstructure:"client_access" yaml:"client_access,omitempty"`
+	// DefaultNamespace is where relay pods of proxies without a namespace run (default "default")
+	DefaultNamespace string `json:"default_namespace,omitempty" mapstructure:"default_namespace" yaml:"default_namespace,omitempty"`
+	// PortRange limits automatic local port assignment, e.g. "15000-15999"
+	PortRange string `json:"port_range,omitempty" mapstructure:"port_range" yaml:"port_range,omitempty"`
+	// ReservedPorts are never picked by automatic local port assignment
+	ReservedPorts []int `json:"reserved_ports,omitempty" mapstructure:"reserved_ports" yaml:"reserved_ports,omitempty"`
+	// Webhooks are notified about proxy lifecycle events
+	Webhooks []WebhookConfig `json:"webhooks,omitempty" mapstructure:"webhooks" yaml:"webhooks,omitempty"`
+	// StatsD sends proxy lifecycle metrics to a StatsD or DogStatsD agent
+	StatsD StatsDConfig `json:"statsd,omitempty" mapstructure:"statsd" yaml:"statsd,omitempty"`
+	// StrictConnect only lets the GUI connect the proxies of the config file, with their configured
+	// cluster, host and ports, and keeps the config from being changed in the GUI
+	StrictConnect bool `json:"strict_connect,omitempty" mapstructure:"strict_connect" yaml:"strict_connect,omitempty"`
+	// UpdateCheck enables the daily check for new aproxymate releases
+	UpdateCheck bool `json:"update_check,omitempty" mapstructure:"update_check" yaml:"update_check,omitempty"`
+	// Vault is the server that proxies with a vault role get database credentials from
+	Vault VaultConfig `json:"vault,omitempty" mapstructure:"vault" yaml:"vault,omitempty"`
+	// PriorityClassName is the PriorityClass of relay pods, so they are evicted later (or earlier) under node pressure
+	PriorityClassName string `json:"priority_class_name,omitempty" mapstructure:"priority_class_name" yaml:"priority_class_name,omitempty"`
+	// PodAnnotations are added to every relay pod
+	PodAnnotations map[string]string `json:"pod_annotations,omitempty" mapstructure:"pod_annotations" yaml:"pod_annotations,omitempty"`
+	// SidecarInjection lets service meshes inject their sidecar into relay pods, for meshes that
+	// only allow traffic from meshed pods. By default relay pods opt out of injection.
+	SidecarInjection bool `json:"sidecar_injection,omitempty" mapstructure:"sidecar_injection" yaml:"sidecar_injection,omitempty"`
+	// NetworkPolicy creates a NetworkPolicy with each relay pod that limits its traffic to the remote host
+	NetworkPolicy bool `json:"network_policy,omitempty" mapstructure:"network_policy" yaml:"network_policy,omitempty"`
+	// RelayImage selects the socat image of relay pods, optionally pinned by digest and signature-checked
+	RelayImage RelayImageConfig `json:"relay_image,omitempty" mapstructure:"relay_image" yaml:"relay_image,omitempty"`
+	// PodSpread spreads relay pods over nodes or zones
+	PodSpread PodSpreadConfig `json:"pod_spread,omitempty" mapstructure:"pod_spread" yaml:"pod_spread,omitempty"`
+	// DNS runs a local DNS server that resolves the proxies' remote hosts to their local listeners
+	DNS DNSConfig `json:"dns,omitempty" mapstructure:"dns" yaml:"dns,omitempty"`
+	// AccessLog records every client connection of every proxy to a file path or "audit"
+	AccessLog string `json:"access_log,omitempty" mapstructure:"access_log" yaml:"access_log,omitempty"`
+	// Keepalive enables TCP keepalive probes on client and relay connections, so idle tunnels survive NAT timeouts
+	Keepalive KeepaliveConfig `json:"keepalive,omitempty" mapstructure:"keepalive" yaml:"keepalive,omitempty"`
+	// Reconnect sets how dropped proxies are reconnected
+	Reconnect ReconnectPolicy `json:"reconnect,omitempty" mapstructure:"reconnect" yaml:"reconnect,omitempty"`
+	// Environments are named sets of clusters, variables and proxies selected with --env
+	Environments map[string]EnvironmentConfig `json:"environments,omitempty" mapstructure:"environments" yaml:"environments,omitempty"`
+	// Cost prices relay pods for the cost estimates of `aproxymate stats` and /api/stats
+	Cost CostConfig `json:"cost,omitempty" mapstructure:"cost" yaml:"cost,omitempty"`
+	// KubernetesAPI sets the client-side rate limit and the retries of Kubernetes API calls
+	KubernetesAPI KubernetesAPIConfig `json:"kubernetes_api,omitempty" mapstructure:"kubernetes_api" yaml:"kubernetes_api,omitempty"`
+	// PodOperations limits the relay pods created and deleted at the same time per cluster
+	PodOperations PodOperationsConfig `json:"pod_operations,omitempty" mapstructure:"pod_operations" yaml:"pod_operations,omitempty"`
+	// GUI holds the defaults of `aproxymate gui`
+	GUI GUIConfig `json:"gui,omitempty" mapstructure:"gui" yaml:"gui,omitempty"`
+	// Logging sets the log level, format and files
+	Logging LoggingConfig `json:"logging,omitempty" mapstructure:"logging" yaml:"logging,omitempty"`
+	// OIDC requires a single sign-on login for the GUI and its API
+	OIDC OIDCConfig `json:"oidc,omitempty" mapstructure:"oidc" yaml:"oidc,omitempty"`
 }
 
 // ValidateConfigYAML attempts to unmarshal YAML data to our config struct and returns any errors
@@ -32,12 +151,81 @@ func ValidateConfigYAML(yamlData []byte) error {
 	}
 
 	// Basic validation after successful unmarshal
-	if len(config.ProxyConfigs) == 0 {
+	if len(config.ProxyConfigs) == 0 && !config.hasEnvironmentProxies() {
 		return fmt.Errorf("no proxy configurations found in config file")
 	}
 
-	// Validate each proxy config
-	for i, proxy := range config.ProxyConfigs {
+	if err := config.ClientAccess.Validate(); err != nil {
+		return fmt.Errorf("global client_access is invalid: %w", err)
+	}
+	if _, err := config.PortPolicy(); err != nil {
+		return err
+	}
+	if err := config.RelayImage.Validate(); err != nil {
+		return fmt.Errorf("relay_image is invalid: %w", err)
+	}
+	if err := config.PodSpread.Validate(); err != nil {
+		return fmt.Errorf("pod_spread is invalid: %w", err)
+	}
+	if err := config.DNS.Validate(); err != nil {
+		return fmt.Errorf("dns is invalid: %w", err)
+	}
+	if err := config.Keepalive.Validate(); err != nil {
+		return fmt.Errorf("keepalive is invalid: %w", err)
+	}
+	if err := config.Reconnect.Validate(); err != nil {
+		return fmt.Errorf("reconnect is invalid: %w", err)
+	}
+	if err := config.Cost.Validate(); err != nil {
+		return fmt.Errorf("cost is invalid: %w", err)
+	}
+	if err := config.KubernetesAPI.Validate(); err != nil {
+		return fmt.Errorf("kubernetes_api is invalid: %w", err)
+	}
+	if err := config.PodOperations.Validate(); err != nil {
+		return fmt.Errorf("pod_operations is invalid: %w", err)
+	}
+	if err := config.GUI.Validate(); err != nil {
+		return fmt.Errorf("gui is invalid: %w", err)
+	}
+	if err := config.Logging.Validate(); err != nil {
+		return fmt.Errorf("logging is invalid: %w", err)
+	}
+	if err := config.OIDC.Validate(); err != nil {
+		return fmt.Errorf("oidc is invalid: %w", err)
+	}
+	for i, webhook := range config.Webhooks {
+		if err := webhook.Validate(); err != nil {
+			return fmt.Errorf("webhook #%d has %w", i+1, err)
+		}
+	}
+	if err := config.StatsD.Validate(); err != nil {
+		return fmt.Errorf("statsd is invalid: %w", err)
+	}
+
+	// With environments, the shared entries are checked as each environment completes them
+	if len(config.Environments) == 0 {
+		if err := validateProxyConfigs(config.ProxyConfigs); err != nil {
+			return err
+		}
+	}
+	for _, name := range config.EnvironmentNames() {
+		envConfig, err := config.ForEnvironment(name)
+		if err != nil {
+			return err
+		}
+		if err := validateProxyConfigs(envConfig.ProxyConfigs); err != nil {
+			return fmt.Errorf("environment %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateProxyConfigs checks each proxy config entry
+func validateProxyConfigs(configs []ProxyConfig) error {
+	apiProxyURLs := make(map[string]string)
+	for i, proxy := range configs {
 		if proxy.Name == "" {
 			return fmt.Errorf("proxy config #%d is missing 'name' field", i+1)
 		}
@@ -45,19 +233,170 @@ func ValidateConfigYAML(yamlData []byte) error {
 		if proxy.RemoteHost == "" {
 			return fmt.Errorf("proxy config #%d (%s) is missing 'remote_host' field", i+1, proxy.Name)
 		}
-		if proxy.LocalPort <= 0 || proxy.LocalPort > 65535 {
+		if proxy.LocalSocket != "" {
+			if proxy.LocalPort != 0 {
+				return fmt.Errorf("proxy config #%d (%s) sets both 'local_port' and 'local_socket'; use only one", i+1, proxy.Name)
+			}
+		} else if proxy.LocalPort <= 0 || proxy.LocalPort > 65535 {
 			return fmt.Errorf("proxy config #%d (%s) has invalid 'local_port': %d (must be 1-65535)", i+1, proxy.Name, proxy.LocalPort)
 		}
 		if proxy.RemotePort <= 0 || proxy.RemotePort > 65535 {
 			return fmt.Errorf("proxy config #%d (%s) has invalid 'remote_port': %d (must be 1-65535)", i+1, proxy.Name, proxy.RemotePort)
 		}
+		if proxy.LocalBindAddress != "" && net.ParseIP(proxy.LocalBindAddress) == nil && proxy.LocalBindAddress != "localhost" {
+			return fmt.Errorf("proxy config #%d (%s) has invalid 'local_bind_address': %q (must be an IP address)", i+1, proxy.Name, proxy.LocalBindAddress)
+		}
+		if err := validatePortMappings(proxy); err != nil {
+			return fmt.Errorf("proxy config #%d (%s) %w", i+1, proxy.Name, err)
+		}
+		expanded, err := proxy.expandRemoteHosts()
+		if err != nil {
+			return fmt.Errorf("proxy config #%d (%s) has %w", i+1, proxy.Name, err)
+		}
+		if err := validateRemoteHosts(expanded); err != nil {
+			return fmt.Errorf("proxy config #%d (%s) %w", i+1, proxy.Name, err)
+		}
+		if proxy.DocsURL != "" {
+			if u, err := url.Parse(proxy.DocsURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("proxy config #%d (%s) has invalid 'docs_url' %q (must be an http or https URL)", i+1, proxy.Name, proxy.DocsURL)
+			}
+		}
+		if err := proxy.Keepalive.Validate(); err != nil {
+			return fmt.Errorf("proxy config #%d (%s) has invalid 'keepalive': %w", i+1, proxy.Name, err)
+		}
+		if err := proxy.Reconnect.Validate(); err != nil {
+			return fmt.Errorf("proxy config #%d (%s) has invalid 'reconnect': %w", i+1, proxy.Name, err)
+		}
+		if proxy.SNI && (proxy.LocalSocket != "" || len(proxy.Ports) > 0) {
+			return fmt.Errorf("proxy config #%d (%s) sets 'sni', which can't be combined with 'local_socket' or 'ports'", i+1, proxy.Name)
+		}
+		if proxy.HTTPPath != "" {
+			if !strings.HasPrefix(proxy.HTTPPath, "/") {
+				return fmt.Errorf("proxy config #%d (%s) has invalid 'http_path' %q (must start with /)", i+1, proxy.Name, proxy.HTTPPath)
+			}
+			if proxy.SNI || proxy.LocalSocket != "" || len(proxy.Ports) > 0 {
+				return fmt.Errorf("proxy config #%d (%s) sets 'http_path', which can't be combined with 'sni', 'local_socket' or 'ports'", i+1, proxy.Name)
+			}
+		}
+		if err := proxy.ClientAccess.Validate(); err != nil {
+			return fmt.Errorf("proxy config #%d (%s) has invalid 'client_access': %w", i+1, proxy.Name, err)
+		}
+		if err := validateAPIProxyURL(proxy.APIProxyURL); err != nil {
+			return fmt.Errorf("proxy config #%d (%s) 'api_proxy_url' %w", i+1, proxy.Name, err)
+		}
+		if proxy.APIProxyURL != "" {
+			// The proxy URL applies to the whole cluster, so entries must agree on it
+			if other, exists := apiProxyURLs[proxy.KubernetesCluster]; exists && other != proxy.APIProxyURL {
+				return fmt.Errorf("proxy config #%d (%s) has 'api_proxy_url' %q, but another entry uses %q for cluster '%s'", i+1, proxy.Name, proxy.APIProxyURL, other, proxy.KubernetesCluster)
+			}
+			apiProxyURLs[proxy.KubernetesCluster] = proxy.APIProxyURL
+		}
 	}
 
 	return nil
 }
 
+// validatePortMappings checks the additional port mappings of a proxy config
+func validatePortMappings(proxy ProxyConfig) error {
+	if len(proxy.Ports) == 0 {
+		return nil
+	}
+	if proxy.LocalSocket != "" {
+		return fmt.Errorf("sets both 'ports' and 'local_socket'; additional ports require TCP listeners")
+	}
+
+	localPorts := map[int]bool{proxy.LocalPort: true}
+	remotePorts := map[int]bool{proxy.RemotePort: true}
+	for _, mapping := range proxy.Ports {
+		if mapping.LocalPort <= 0 || mapping.LocalPort > 65535 {
+			return fmt.Errorf("has invalid 'ports' entry local_port: %d (must be 1-65535)", mapping.LocalPort)
+		}
+		if mapping.RemotePort <= 0 || mapping.RemotePort > 65535 {
+			return fmt.Errorf("has invalid 'ports' entry remote_port: %d (must be 1-65535)", mapping.RemotePort)
+		}
+		if localPorts[mapping.LocalPort] {
+			return fmt.Errorf("uses local port %d more than once", mapping.LocalPort)
+		}
+		if remotePorts[mapping.RemotePort] {
+			return fmt.Errorf("uses remote port %d more than once", mapping.RemotePort)
+		}
+		localPorts[mapping.LocalPort] = true
+		remotePorts[mapping.RemotePort] = true
+	}
+	return nil
+}
+
+// DefaultPodNamespace is where relay pods are created when neither the proxy nor
+// default_namespace sets a namespace
+const DefaultPodNamespace = "default"
+
+// defaultNamespace is the namespace set with SetDefaultNamespace
+var defaultNamespace = DefaultPodNamespace
+
+// SetDefaultNamespace sets where the relay pods of proxies without a namespace are created; an
+// empty namespace restores "default"
+func SetDefaultNamespace(namespace string) {
+	if namespace == "" {
+		namespace = DefaultPodNamespace
+	}
+	defaultNamespace = namespace
+}
+
+// DefaultNamespace returns where the relay pods of proxies without a namespace are created
+func DefaultNamespace() string {
+	return defaultNamespace
+}
+
+// PodNamespace returns the namespace the proxy's relay pod runs in
+func (p ProxyConfig) PodNamespace() string {
+	if p.Namespace == "" {
+		return DefaultNamespace()
+	}
+	return p.Namespace
+}
+
+// LocalEndpoint returns a display string for the proxy's local listeners
+func (p ProxyConfig) LocalEndpoint() string {
+	if p.LocalSocket != "" {
+		return "unix:" + p.LocalSocket
+	}
+	host := p.LocalBindAddress
+	if host == "" {
+		host = "localhost"
+	}
+
+	endpoints := []string{net.JoinHostPort(host, strconv.Itoa(p.LocalPort))}
+	for _, mapping := range p.Ports {
+		endpoints = append(endpoints, net.JoinHostPort(host, strconv.Itoa(mapping.LocalPort)))
+	}
+	return strings.Join(endpoints, ", ")
+}
+
+// SharedPortMode returns "sni" or "http" for proxies that share their local port with others
+func (p ProxyConfig) SharedPortMode() string {
+	switch {
+	case p.SNI:
+		return "sni"
+	case p.HTTPPath != "":
+		return "http"
+	}
+	return ""
+}
+
+// LocalPorts returns every local TCP port used by the proxy config
+func (p ProxyConfig) LocalPorts() []int {
+	if p.LocalSocket != "" {
+		return nil
+	}
+	ports := []int{p.LocalPort}
+	for _, mapping := range p.Ports {
+		ports = append(ports, mapping.LocalPort)
+	}
+	return ports
+}
+
 // EnsureUniqueLocalPorts ensures all proxy configurations have unique local ports
-func EnsureUniqueLocalPorts(configs []ProxyConfig) []ProxyConfig {
+func EnsureUniqueLocalPorts(configs []ProxyConfig, policy PortPolicy) []ProxyConfig {
 	if len(configs) <= 1 {
 		return configs
 	}
@@ -76,9 +415,14 @@ func EnsureUniqueLocalPorts(configs []ProxyConfig) []ProxyConfig {
 	for i := range result {
 		originalPort := result[i].LocalPort
 
+		// Unix socket endpoints don't use a local port, and SNI and HTTP gateway proxies share theirs
+		if result[i].LocalSocket != "" || result[i].SharedPortMode() != "" {
+			continue
+		}
+
 		// Find next available port if current port is already used
 		if usedPorts[originalPort] {
-			result[i].LocalPort = findNextAvailablePortFromSet(usedPorts, originalPort)
+			result[i].LocalPort = policy.NextAvailable(usedPorts, originalPort)
 		}
 
 		usedPorts[result[i].LocalPort] = true
@@ -87,64 +431,46 @@ func EnsureUniqueLocalPorts(configs []ProxyConfig) []ProxyConfig {
 	return result
 }
 
-// findNextAvailablePortFromSet finds the next available port from a set of used ports
-func findNextAvailablePortFromSet(usedPorts map[int]bool, startPort int) int {
-	// Start from the provided port
-	port := startPort
-	for {
-		if !usedPorts[port] && port >= 1024 && port <= 65535 {
-			return port
-		}
-		port++
-
-		// If we've gone beyond the valid range, start from a reasonable default
-		if port > 65535 {
-			port = 3000
-		}
-
-		// Prevent infinite loop - check if we've circled back
-		if port == startPort {
-			break
-		}
-	}
-
-	// Fallback: find any available port in the range 3000-9999
-	for port := 3000; port <= 9999; port++ {
-		if !usedPorts[port] {
-			return port
-		}
-	}
-
-	// Final fallback: use the original port
-	return startPort
-}
-
 // GetUsedLocalPorts returns a set of all local ports currently in use
 func GetUsedLocalPorts(configs []ProxyConfig) map[int]bool {
 	usedPorts := make(map[int]bool)
 	for _, config := range configs {
-		usedPorts[config.LocalPort] = true
+		for _, port := range config.LocalPorts() {
+			usedPorts[port] = true
+		}
 	}
 	return usedPorts
 }
 
 // GetNextAvailablePort finds the next available local port starting from the given port
-func GetNextAvailablePort(configs []ProxyConfig, startPort int) int {
+func GetNextAvailablePort(configs []ProxyConfig, startPort int, policy PortPolicy) int {
 	usedPorts := GetUsedLocalPorts(configs)
-	return findNextAvailablePortFromSet(usedPorts, startPort)
+	return policy.NextAvailable(usedPorts, startPort)
 }
 
-// ValidateUniqueLocalPorts checks if all local ports in the configuration are unique
+// ValidateUniqueLocalPorts checks if all local ports in the configuration are unique.
+// SNI proxies may share a port with each other, and so may HTTP gateway proxies.
 func ValidateUniqueLocalPorts(configs []ProxyConfig) error {
 	portCounts := make(map[int][]string)
+	sharedCounts := make(map[int]map[string]int)
 
 	for _, config := range configs {
-		portCounts[config.LocalPort] = append(portCounts[config.LocalPort], config.Name)
+		for _, port := range config.LocalPorts() {
+			portCounts[port] = append(portCounts[port], config.Name)
+		}
+		if mode := config.SharedPortMode(); mode != "" {
+			if sharedCounts[config.LocalPort] == nil {
+				sharedCounts[config.LocalPort] = make(map[string]int)
+			}
+			sharedCounts[config.LocalPort][mode]++
+		}
 	}
 
 	var conflicts []string
 	for port, names := range portCounts {
-		if len(names) > 1 {
+		modes := sharedCounts[port]
+		shared := len(modes) == 1 && (modes["sni"] == len(names) || modes["http"] == len(names))
+		if len(names) > 1 && !shared {
 			conflicts = append(conflicts, fmt.Sprintf("port %d used by: %v", port, names))
 		}
 	}
@@ -169,20 +495,6 @@ func FindConfigsWithMissingClusters(configs []ProxyConfig) []ProxyConfig {
 	return missingClusterConfigs
 }
 
-// UpdateConfigsWithCluster updates all configurations with missing clusters to use the specified cluster
-func UpdateConfigsWithCluster(configs []ProxyConfig, clusterName string) []ProxyConfig {
-	updatedConfigs := make([]ProxyConfig, len(configs))
-	copy(updatedConfigs, configs)
-
-	for i := range updatedConfigs {
-		if updatedConfigs[i].KubernetesCluster == "" {
-			updatedConfigs[i].KubernetesCluster = clusterName
-		}
-	}
-
-	return updatedConfigs
-}
-
 // HasConfigsWithMissingClusters checks if any proxy configs are missing cluster specifications
 func HasConfigsWithMissingClusters(configs []ProxyConfig) bool {
 	for _, config := range configs {
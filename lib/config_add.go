@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// AddProxyConfig validates a new entry and appends it to configs. An entry without a local port
+// gets the next port that is allowed by the policy, unused by other entries and free on this machine.
+func AddProxyConfig(configs []ProxyConfig, config ProxyConfig, policy PortPolicy) ([]ProxyConfig, error) {
+	for _, existing := range configs {
+		if strings.EqualFold(existing.Name, config.Name) {
+			return nil, fmt.Errorf("a proxy configuration named '%s' already exists", existing.Name)
+		}
+	}
+
+	if config.LocalPort == 0 && config.LocalSocket == "" {
+		config.LocalPort = FreeLocalPort(configs, policy)
+	}
+
+	if err := validateProxyConfigs([]ProxyConfig{config}); err != nil {
+		return nil, err
+	}
+	result := append(append([]ProxyConfig{}, configs...), config)
+	if err := ValidateUniqueLocalPorts(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FreeLocalPort returns the first port after those of the existing entries that the policy
+// allows and that can currently be bound on the loopback address
+func FreeLocalPort(configs []ProxyConfig, policy PortPolicy) int {
+	usedPorts := GetUsedLocalPorts(configs)
+	port := policy.StartingPort(configs)
+	minPort, maxPort := policy.bounds()
+	for range maxPort - minPort + 1 {
+		if localPortFree(port) {
+			return port
+		}
+		usedPorts[port] = true
+		next := policy.NextAvailable(usedPorts, port)
+		if next == port {
+			break
+		}
+		port = next
+	}
+	return port
+}
+
+// localPortFree reports whether a local TCP port can be bound right now
+func localPortFree(port int) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort(DefaultLocalBindAddress, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
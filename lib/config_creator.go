@@ -9,6 +9,8 @@ import (
 // GetConfigLocations returns the available configuration file locations
 func GetConfigLocations() []ConfigLocation {
 	home, _ := os.UserHomeDir()
+	userConfigPath, _ := GetUserConfigPath()
+	projectConfigPath := FindProjectConfigPath()
 
 	// Use shared config paths but convert to ConfigLocation format
 	configPaths := GetDefaultConfigPaths()
@@ -25,6 +27,12 @@ func GetConfigLocations() []ConfigLocation {
 				displayName = "Current directory (hidden)"
 			}
 			description = path
+		} else if path == projectConfigPath {
+			displayName = "Project directory"
+			description = path
+		} else if path == userConfigPath {
+			displayName = "User config directory"
+			description = path
 		} else {
 			// Home directory
 			if filepath.Base(path) == "aproxymate.yaml" {
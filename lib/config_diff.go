@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigDiff describes how a set of proxy configs differs from another
+type ConfigDiff struct {
+	Added   []string            `json:"added"`
+	Removed []string            `json:"removed"`
+	Changed []ConfigEntryChange `json:"changed"`
+	// RemovedProtected are the removed entries marked protected, which saving only removes
+	// when they are confirmed
+	RemovedProtected []string `json:"removedProtected"`
+	// Reordered is set when entries present in both sets appear in a different order
+	Reordered bool `json:"reordered"`
+}
+
+// ConfigEntryChange lists the fields that differ for an entry present in both sets
+type ConfigEntryChange struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// Empty reports whether there are no differences
+func (d ConfigDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && !d.Reordered
+}
+
+// Summary renders the diff as a short sentence, e.g. "adds 1 entry, removes 2 entries"
+func (d ConfigDiff) Summary() string {
+	if d.Empty() {
+		return "no changes"
+	}
+
+	var parts []string
+	if n := len(d.Added); n > 0 {
+		parts = append(parts, "adds "+pluralEntries(n))
+	}
+	if n := len(d.Removed); n > 0 {
+		parts = append(parts, "removes "+pluralEntries(n))
+	}
+	if n := len(d.Changed); n > 0 {
+		parts = append(parts, "changes "+pluralEntries(n))
+	}
+	if d.Reordered {
+		parts = append(parts, "reorders entries")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pluralEntries renders "1 entry" or "n entries"
+func pluralEntries(n int) string {
+	if n == 1 {
+		return "1 entry"
+	}
+	return fmt.Sprintf("%d entries", n)
+}
+
+// ReadProxyConfigsFile reads the proxy configs from a config file; a missing file has none
+func ReadProxyConfigsFile(path string) ([]ProxyConfig, error) {
+	data, _, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config AppConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return config.ProxyConfigs, nil
+}
+
+// DiffProxyConfigs compares the current proxy configs with proposed ones. Entries are matched
+// by name first, then by cluster, remote host and remote port so renamed entries show as changes.
+func DiffProxyConfigs(current, proposed []ProxyConfig) ConfigDiff {
+	diff := ConfigDiff{Added: []string{}, Removed: []string{}, Changed: []ConfigEntryChange{}, RemovedProtected: []string{}}
+
+	match := matchProxyConfigs(current, proposed)
+	used := make([]bool, len(current))
+	for _, j := range match {
+		if j >= 0 {
+			used[j] = true
+		}
+	}
+
+	lastMatched := -1
+	for i, config := range proposed {
+		j := match[i]
+		if j < 0 {
+			diff.Added = append(diff.Added, config.Name)
+			continue
+		}
+		if j < lastMatched {
+			diff.Reordered = true
+		}
+		lastMatched = j
+
+		if fields := changedConfigFields(current[j], config); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, ConfigEntryChange{Name: config.Name, Fields: fields})
+		}
+	}
+	for j, existing := range current {
+		if !used[j] {
+			diff.Removed = append(diff.Removed, existing.Name)
+			if existing.Protected {
+				diff.RemovedProtected = append(diff.RemovedProtected, existing.Name)
+			}
+		}
+	}
+	return diff
+}
+
+// matchProxyConfigs pairs proposed entries with current ones: match[i] is the index in current
+// matched by proposed[i], or -1. Entries are matched by name first, then by cluster, remote
+// host and remote port.
+func matchProxyConfigs(current, proposed []ProxyConfig) []int {
+	match := make([]int, len(proposed))
+	used := make([]bool, len(current))
+	for i := range match {
+		match[i] = -1
+	}
+
+	sameName := func(a, b ProxyConfig) bool { return a.Name != "" && a.Name == b.Name }
+	sameTarget := func(a, b ProxyConfig) bool {
+		return a.KubernetesCluster == b.KubernetesCluster && a.RemoteHost == b.RemoteHost && a.RemotePort == b.RemotePort
+	}
+	for _, same := range []func(a, b ProxyConfig) bool{sameName, sameTarget} {
+		for i, config := range proposed {
+			if match[i] >= 0 {
+				continue
+			}
+			for j, existing := range current {
+				if !used[j] && same(existing, config) {
+					match[i] = j
+					used[j] = true
+					break
+				}
+			}
+		}
+	}
+	return match
+}
+
+// changedConfigFields returns the YAML keys whose values differ between two entries
+func changedConfigFields(a, b ProxyConfig) []string {
+	fieldsA, fieldsB := configFields(a), configFields(b)
+
+	var changed []string
+	for key, value := range fieldsA {
+		if !reflect.DeepEqual(value, fieldsB[key]) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range fieldsB {
+		if _, exists := fieldsA[key]; !exists {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// configFields returns an entry as the key/value map it is written as
+func configFields(config ProxyConfig) map[string]any {
+	fields := make(map[string]any)
+	data, err := yaml.Marshal(config)
+	if err == nil {
+		yaml.Unmarshal(data, &fields)
+	}
+	return fields
+}
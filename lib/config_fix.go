@@ -0,0 +1,227 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// ClusterGroup is a set of entries without a cluster whose remote hosts share a domain, so
+// they likely belong to the same cluster
+type ClusterGroup struct {
+	// Domain is what the remote hosts share, e.g. "us-east-1.rds.amazonaws.com"; empty for IP
+	// addresses and hosts without a domain
+	Domain string
+	// Indexes are the positions of the entries in the config
+	Indexes []int
+}
+
+// GroupMissingClusters groups the entries without a cluster by the domain of their remote host,
+// in the order the groups first appear
+func GroupMissingClusters(configs []ProxyConfig) []ClusterGroup {
+	var groups []ClusterGroup
+	positions := make(map[string]int)
+	for i, config := range configs {
+		if config.KubernetesCluster != "" {
+			continue
+		}
+		domain := hostDomain(config.RemoteHost)
+		position, exists := positions[domain]
+		if !exists {
+			position = len(groups)
+			positions[domain] = position
+			groups = append(groups, ClusterGroup{Domain: domain})
+		}
+		groups[position].Indexes = append(groups[position].Indexes, i)
+	}
+	return groups
+}
+
+// hostDomain returns a host name without its first label, or "" for IP addresses and names
+// without a domain
+func hostDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	if _, domain, found := strings.Cut(host, "."); found {
+		return domain
+	}
+	return ""
+}
+
+// ClusterAssignments are the clusters given for entries without one, e.g. with
+// `config fix --cluster orders-db=eks-prod`
+type ClusterAssignments struct {
+	// ByName maps entry names to their cluster
+	ByName map[string]string
+	// Default is the cluster of the entries not in ByName; empty leaves them without one
+	Default string
+}
+
+// ParseClusterAssignments parses "name=cluster" values, and a bare "cluster" as the default
+func ParseClusterAssignments(values []string) (ClusterAssignments, error) {
+	assignments := ClusterAssignments{ByName: make(map[string]string)}
+	for _, value := range values {
+		name, cluster, found := strings.Cut(value, "=")
+		if !found {
+			cluster = strings.TrimSpace(value)
+			if assignments.Default != "" && assignments.Default != cluster {
+				return assignments, fmt.Errorf("only one cluster can be given without an entry name, got %q and %q", assignments.Default, cluster)
+			}
+			assignments.Default = cluster
+			continue
+		}
+		name, cluster = strings.TrimSpace(name), strings.TrimSpace(cluster)
+		if name == "" || cluster == "" {
+			return assignments, fmt.Errorf("invalid cluster assignment %q: use name=cluster", value)
+		}
+		assignments.ByName[name] = cluster
+	}
+	return assignments, nil
+}
+
+// Clusters returns the clusters the assignments use, sorted
+func (a ClusterAssignments) Clusters() []string {
+	var clusters []string
+	for _, cluster := range a.ByName {
+		clusters = append(clusters, cluster)
+	}
+	if a.Default != "" {
+		clusters = append(clusters, a.Default)
+	}
+	slices.Sort(clusters)
+	return slices.Compact(clusters)
+}
+
+// AssignClusters sets the cluster of the entries without one from the assignments and returns
+// the positions of the entries it set. Names that are not an entry without a cluster are an
+// error, and nothing is changed then.
+func AssignClusters(configs []ProxyConfig, assignments ClusterAssignments) ([]int, error) {
+	for name := range assignments.ByName {
+		if !slices.ContainsFunc(configs, func(config ProxyConfig) bool {
+			return config.Name == name && config.KubernetesCluster == ""
+		}) {
+			return nil, fmt.Errorf("'%s' is not an entry without a kubernetes_cluster", name)
+		}
+	}
+
+	var assigned []int
+	for i := range configs {
+		config := &configs[i]
+		if config.KubernetesCluster != "" {
+			continue
+		}
+		cluster, found := assignments.ByName[config.Name]
+		if !found {
+			cluster = assignments.Default
+		}
+		if cluster != "" {
+			config.KubernetesCluster = cluster
+			assigned = append(assigned, i)
+		}
+	}
+	return assigned, nil
+}
+
+// RemotePortProblem is an invalid remote port of an entry, which can't be fixed automatically
+type RemotePortProblem struct {
+	// Index is the position of the entry in the config
+	Index int
+	// Mapping is the position of the invalid entry in 'ports', or -1 for 'remote_port'
+	Mapping int
+	Port    int
+}
+
+// Setting names the invalid setting, e.g. "remote_port" or "remote_port of ports entry #2"
+func (p RemotePortProblem) Setting() string {
+	if p.Mapping < 0 {
+		return "remote_port"
+	}
+	return fmt.Sprintf("remote_port of ports entry #%d", p.Mapping+1)
+}
+
+// Apply sets the remote port the problem is about
+func (p RemotePortProblem) Apply(configs []ProxyConfig, port int) {
+	config := &configs[p.Index]
+	if p.Mapping < 0 {
+		config.RemotePort = port
+		return
+	}
+	config.Ports = append([]PortMapping(nil), config.Ports...)
+	config.Ports[p.Mapping].RemotePort = port
+}
+
+// FindInvalidRemotePorts returns the remote ports outside 1-65535, in entry order
+func FindInvalidRemotePorts(configs []ProxyConfig) []RemotePortProblem {
+	var problems []RemotePortProblem
+	for i, config := range configs {
+		if !validPort(config.RemotePort) {
+			problems = append(problems, RemotePortProblem{Index: i, Mapping: -1, Port: config.RemotePort})
+		}
+		for j, mapping := range config.Ports {
+			if !validPort(mapping.RemotePort) {
+				problems = append(problems, RemotePortProblem{Index: i, Mapping: j, Port: mapping.RemotePort})
+			}
+		}
+	}
+	return problems
+}
+
+// FixLocalPorts gives every local port that is outside 1-65535 or already used by an earlier
+// entry (or earlier in the same entry) a free port. SNI and HTTP gateway entries share their
+// port on purpose, so only other entries are moved off it. It returns the corrected entries
+// and what was changed.
+func FixLocalPorts(configs []ProxyConfig, policy PortPolicy) ([]ProxyConfig, []string) {
+	result := make([]ProxyConfig, len(configs))
+	copy(result, configs)
+
+	used := make(map[int]bool)
+	for _, config := range result {
+		if config.LocalSocket == "" && config.SharedPortMode() != "" {
+			used[config.LocalPort] = true
+		}
+	}
+
+	var changes []string
+	// fix returns a free port for a port that is invalid or used; what names it, e.g. "local_port 0"
+	fix := func(config *ProxyConfig, port int, what string) int {
+		if validPort(port) && !used[port] {
+			used[port] = true
+			return port
+		}
+		// Every used port is a port of the entries, so the free port is not among them
+		free := lintedFreePort(result, policy)
+		used[free] = true
+
+		reason := "is already used"
+		if !validPort(port) {
+			reason = "is invalid"
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s %s, moved to %d", config.Name, what, reason, free))
+		return free
+	}
+
+	for i := range result {
+		config := &result[i]
+		if config.LocalSocket != "" {
+			continue
+		}
+		if config.SharedPortMode() == "" {
+			config.LocalPort = fix(config, config.LocalPort, fmt.Sprintf("local_port %d", config.LocalPort))
+		}
+		// The mappings are shared with the caller's entries
+		config.Ports = append([]PortMapping(nil), config.Ports...)
+		for j := range config.Ports {
+			mapping := &config.Ports[j]
+			mapping.LocalPort = fix(config, mapping.LocalPort, fmt.Sprintf("local port %d of remote port %d", mapping.LocalPort, mapping.RemotePort))
+		}
+	}
+	return result, changes
+}
+
+// validPort reports whether a port number is within 1-65535
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
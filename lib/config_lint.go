@@ -0,0 +1,227 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lint checks reported by 'aproxymate config lint'
+const (
+	LintDuplicateEndpoint  = "duplicate-endpoint"
+	LintSuspiciousPort     = "suspicious-port"
+	LintMissingNamespace   = "missing-namespace"
+	LintLongName           = "long-name"
+	LintUnreachableCluster = "unreachable-cluster"
+)
+
+// ephemeralPortStart is where operating systems start handing out ports for outgoing
+// connections (32768 on Linux, 49152 elsewhere)
+const ephemeralPortStart = 32768
+
+// lintPingTimeout bounds the reachability check of each cluster
+const lintPingTimeout = 10 * time.Second
+
+// LintFinding is a best-practice warning about a config entry. Unlike validation errors,
+// findings don't stop aproxymate from using the config.
+type LintFinding struct {
+	Check string `json:"check"`
+	// Proxy is the name of the entry, empty for findings about a cluster
+	Proxy   string `json:"proxy,omitempty"`
+	Message string `json:"message"`
+	// Fixable findings are corrected by FixProxyConfigs
+	Fixable bool `json:"fixable"`
+}
+
+// LintProxyConfigs returns best-practice warnings about the proxy config entries, in entry order.
+// It doesn't contact any cluster; see LintClusters.
+func LintProxyConfigs(configs []ProxyConfig, policy PortPolicy) []LintFinding {
+	var findings []LintFinding
+	endpoints := make(map[string]string)
+	namespaces := clusterNamespaces(configs)
+	username := getSafeUsername()
+	ids := configRowIDs(configs)
+
+	for i, config := range configs {
+		endpoint := fmt.Sprintf("%s/%s:%d", config.KubernetesCluster, config.RemoteHost, config.RemotePort)
+		if other, exists := endpoints[endpoint]; exists {
+			findings = append(findings, LintFinding{
+				Check:   LintDuplicateEndpoint,
+				Proxy:   config.Name,
+				Message: fmt.Sprintf("relays to %s:%d through cluster '%s' like '%s'; one relay pod can serve both", config.RemoteHost, config.RemotePort, config.KubernetesCluster, other),
+			})
+		} else {
+			endpoints[endpoint] = config.Name
+		}
+
+		for _, port := range config.LocalPorts() {
+			if message, fixable := suspiciousLocalPort(config, port, policy); message != "" {
+				findings = append(findings, LintFinding{Check: LintSuspiciousPort, Proxy: config.Name, Message: message, Fixable: fixable})
+			}
+		}
+
+		if config.Namespace == "" {
+			finding := LintFinding{
+				Check:   LintMissingNamespace,
+				Proxy:   config.Name,
+				Message: fmt.Sprintf("has no 'namespace', so its relay pods run in '%s'", DefaultNamespace()),
+			}
+			if namespace := namespaces[config.KubernetesCluster]; namespace != "" {
+				finding.Message += fmt.Sprintf("; the other entries of cluster '%s' use '%s'", config.KubernetesCluster, namespace)
+				finding.Fixable = true
+			}
+			findings = append(findings, finding)
+		}
+
+		// Relay pods are named after the row ID, which is derived from the name
+		podName := relayPodName(username, ids[i], time.Now())
+		if slug := nameSlug(config.Name); slug != "" && !strings.Contains(podName, slug) {
+			findings = append(findings, LintFinding{
+				Check:   LintLongName,
+				Proxy:   config.Name,
+				Message: fmt.Sprintf("is too long for relay pod names, which are shortened to e.g. '%s'", podName),
+			})
+		}
+	}
+	return findings
+}
+
+// suspiciousLocalPort describes what is wrong with a local port, and whether another port can
+// be picked for it automatically
+func suspiciousLocalPort(config ProxyConfig, port int, policy PortPolicy) (string, bool) {
+	// SNI and HTTP gateway proxies share their port with other entries
+	shared := config.SharedPortMode() != "" && port == config.LocalPort
+	switch {
+	case port < 1024:
+		return fmt.Sprintf("uses privileged local port %d, which needs administrator rights", port), !shared
+	case policy.Min != 0 && !policy.Allows(port):
+		return fmt.Sprintf("uses local port %d, which is outside port_range or reserved", port), !shared
+	case enginesByPort[port] != "":
+		return fmt.Sprintf("uses local port %d, the default %s port, which a database running on this machine would already use", port, enginesByPort[port]), false
+	case port >= ephemeralPortStart && policy.Min == 0:
+		return fmt.Sprintf("uses local port %d, in the range the operating system hands out for outgoing connections", port), false
+	}
+	return "", false
+}
+
+// clusterNamespaces returns the namespace all entries of a cluster that set one agree on
+func clusterNamespaces(configs []ProxyConfig) map[string]string {
+	namespaces := make(map[string]string)
+	conflicting := make(map[string]bool)
+	for _, config := range configs {
+		if config.Namespace == "" {
+			continue
+		}
+		if other, exists := namespaces[config.KubernetesCluster]; exists && other != config.Namespace {
+			conflicting[config.KubernetesCluster] = true
+		}
+		namespaces[config.KubernetesCluster] = config.Namespace
+	}
+	for cluster := range conflicting {
+		delete(namespaces, cluster)
+	}
+	return namespaces
+}
+
+// FixProxyConfigs corrects the fixable findings of LintProxyConfigs: privileged local ports and
+// ports outside port_range get the next free port, and entries without a namespace get the
+// one the other entries of their cluster use. It returns the corrected entries and what was changed.
+func FixProxyConfigs(configs []ProxyConfig, policy PortPolicy) ([]ProxyConfig, []string) {
+	result := make([]ProxyConfig, len(configs))
+	copy(result, configs)
+	namespaces := clusterNamespaces(configs)
+
+	var changes []string
+	for i := range result {
+		config := &result[i]
+		if config.Namespace == "" && namespaces[config.KubernetesCluster] != "" {
+			config.Namespace = namespaces[config.KubernetesCluster]
+			changes = append(changes, fmt.Sprintf("%s: set namespace to '%s'", config.Name, config.Namespace))
+		}
+
+		if config.LocalSocket != "" {
+			continue
+		}
+		if _, fixable := suspiciousLocalPort(*config, config.LocalPort, policy); fixable {
+			port := lintedFreePort(result, policy)
+			changes = append(changes, fmt.Sprintf("%s: moved local_port %d to %d", config.Name, config.LocalPort, port))
+			config.LocalPort = port
+		}
+		// The mappings are shared with the caller's entries
+		config.Ports = append([]PortMapping(nil), config.Ports...)
+		for j := range config.Ports {
+			mapping := &config.Ports[j]
+			if _, fixable := suspiciousLocalPort(*config, mapping.LocalPort, policy); fixable {
+				port := lintedFreePort(result, policy)
+				changes = append(changes, fmt.Sprintf("%s: moved local port %d of remote port %d to %d", config.Name, mapping.LocalPort, mapping.RemotePort, port))
+				mapping.LocalPort = port
+			}
+		}
+	}
+	return result, changes
+}
+
+// lintedFreePort returns the first free local port allowed by the policy that lint doesn't warn
+// about, falling back to FreeLocalPort
+func lintedFreePort(configs []ProxyConfig, policy PortPolicy) int {
+	usedPorts := GetUsedLocalPorts(configs)
+	minPort, maxPort := policy.bounds()
+	if policy.Min == 0 {
+		minPort = defaultStartingPort
+	}
+	for port := minPort; port <= maxPort; port++ {
+		if usedPorts[port] || !policy.Allows(port) {
+			continue
+		}
+		if message, _ := suspiciousLocalPort(ProxyConfig{}, port, policy); message == "" && localPortFree(port) {
+			return port
+		}
+	}
+	return FreeLocalPort(configs, policy)
+}
+
+// LintClusters checks that the API server of every cluster used by the entries is reachable
+// and accepts the user's credentials
+func LintClusters(ctx context.Context, configs []ProxyConfig) []LintFinding {
+	proxies := make(map[string][]string)
+	for _, config := range configs {
+		if config.KubernetesCluster != "" {
+			proxies[config.KubernetesCluster] = append(proxies[config.KubernetesCluster], config.Name)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		findings []LintFinding
+	)
+	for cluster, names := range proxies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, lintPingTimeout)
+			defer cancel()
+			health := PingKubernetesContext(pingCtx, cluster)
+			if health.Reachable && health.Authenticated {
+				return
+			}
+			problem := "is unreachable"
+			if health.Reachable {
+				problem = "rejected your credentials"
+			}
+			mu.Lock()
+			findings = append(findings, LintFinding{
+				Check:   LintUnreachableCluster,
+				Message: fmt.Sprintf("cluster '%s' (used by %s) %s: %s", cluster, strings.Join(names, ", "), problem, health.Error),
+			})
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Message < findings[j].Message })
+	return findings
+}
@@ -8,38 +8,91 @@ import (
 const (
 	ConfigFilename       = "aproxymate.yaml"
 	HiddenConfigFilename = ".aproxymate.yaml"
+	// UserConfigFilename is the config file name inside the aproxymate directory of the user
+	// config directory
+	UserConfigFilename = "config.yaml"
 )
 
 // GetConfigSearchPaths returns the standard list of paths to search for config files,
 // in priority order (highest to lowest priority)
 func GetConfigSearchPaths() []string {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		// If we can't get home directory, just return local paths
-		return []string{
-			"./" + ConfigFilename,
-			"./" + HiddenConfigFilename,
+	var paths []string
+	// A project config found in a parent directory first (highest priority)
+	if path := FindProjectConfigPath(); path != "" && filepath.Dir(path) != currentDir() {
+		paths = append(paths, path)
+	}
+	// Then the current directory
+	paths = append(paths,
+		"./"+ConfigFilename,
+		"./"+HiddenConfigFilename,
+	)
+	// Then the user config directory
+	if path, err := GetUserConfigPath(); err == nil {
+		paths = append(paths, path)
+	}
+	// Then the home directory, where older versions created the config
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths,
+			filepath.Join(home, ConfigFilename),
+			filepath.Join(home, HiddenConfigFilename),
+		)
+	}
+	return paths
+}
+
+// FindProjectConfigPath walks up from the current directory to the first directory with a
+// .aproxymate.yaml, the way git finds its repository, so each project can carry its own proxies.
+// The search stops below the home directory, whose .aproxymate.yaml is the user's own config.
+// Returns an empty string if there is none.
+func FindProjectConfigPath() string {
+	dir := currentDir()
+	if dir == "" {
+		return ""
+	}
+	home, _ := os.UserHomeDir()
+	for dir != home {
+		path := filepath.Join(dir, HiddenConfigFilename)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
 		}
+		dir = parent
 	}
+	return ""
+}
 
-	return []string{
-		// Current directory first (highest priority)
-		"./" + ConfigFilename,
-		"./" + HiddenConfigFilename,
-		// Then home directory
-		filepath.Join(home, ConfigFilename),
-		filepath.Join(home, HiddenConfigFilename),
+// currentDir returns the absolute current directory, or "" if it can't be determined
+func currentDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
 	}
+	return dir
 }
 
 // GetDefaultConfigPath returns the default path for creating new config files
-// (in the user's home directory)
+// (in the user config directory)
 func GetDefaultConfigPath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
+	return GetUserConfigPath()
+}
+
+// GetUserConfigPath returns the config path in the user config directory:
+// $XDG_CONFIG_HOME/aproxymate/config.yaml when XDG_CONFIG_HOME is set, otherwise
+// ~/.config/aproxymate/config.yaml on Linux, ~/Library/Application Support/aproxymate/config.yaml
+// on macOS and %AppData%\aproxymate\config.yaml on Windows
+func GetUserConfigPath() (string, error) {
+	// os.UserConfigDir ignores XDG_CONFIG_HOME outside Linux and the BSDs
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(dir) {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return "", err
+		}
 	}
-	return filepath.Join(home, ConfigFilename), nil
+	return filepath.Join(dir, "aproxymate", UserConfigFilename), nil
 }
 
 // GetLocalConfigPath returns the local config path (in current directory)
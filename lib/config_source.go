@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigSource is where a proxy entry is written in the config files
+type ConfigSource struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// String returns the source as file:line
+func (s ConfigSource) String() string {
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// AnnotateSources records in the Source of the proxy entries, including those of environments,
+// where they are written in the config file at path. Entries keep it when an environment is
+// selected, so an entry replaced by an environment points at the environment's entry.
+func (c *AppConfig) AnnotateSources(path string) error {
+	data, _, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	file := GetAbsolutePathForDisplay(path)
+	root := doc.Content[0]
+	annotate(c.ProxyConfigs, mappingValue(root, proxyConfigsKey), file)
+	environments := mappingValue(root, "environments")
+	for name, env := range c.Environments {
+		annotate(env.ProxyConfigs, mappingValue(mappingValue(environments, name), proxyConfigsKey), file)
+	}
+	return nil
+}
+
+// annotate sets the Source of the entries decoded from the sequence node entries. Entries are
+// left as they are when they don't line up with the node, e.g. when an environment variable
+// replaced them.
+func annotate(configs []ProxyConfig, entries *yaml.Node, file string) {
+	if entries == nil || entries.Kind != yaml.SequenceNode || len(entries.Content) != len(configs) {
+		return
+	}
+	for i, item := range entries.Content {
+		configs[i].Source = &ConfigSource{File: file, Line: item.Line}
+	}
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ConfigValidationIssue is one kind of problem and the proxy entries that have it
+type ConfigValidationIssue struct {
+	Issue   string   `json:"issue"`
+	Field   string   `json:"field"`
+	Count   int      `json:"count"`
+	Entries []string `json:"entries"`
+}
+
+// ConfigValidationReport collects the problems found in the proxy entries of a config file,
+// grouped by issue so a large config yields one line per kind of problem instead of one per entry
+type ConfigValidationReport struct {
+	File      string                  `json:"file"`
+	CheckedAt time.Time               `json:"checkedAt"`
+	Proxies   int                     `json:"proxies"`
+	Total     int                     `json:"total"`
+	Issues    []ConfigValidationIssue `json:"issues"`
+}
+
+// proxyChecks are the checks run on every proxy entry, in report order
+var proxyChecks = []struct {
+	field string
+	issue string
+	fails func(ProxyConfig) bool
+}{
+	{"name", "missing name", func(p ProxyConfig) bool { return p.Name == "" }},
+	{"kubernetes_cluster", "missing kubernetes_cluster", func(p ProxyConfig) bool { return p.KubernetesCluster == "" }},
+	{"remote_host", "missing remote_host", func(p ProxyConfig) bool { return p.RemoteHost == "" }},
+	{"local_port", "invalid local_port", func(p ProxyConfig) bool { return p.LocalPort == 0 }},
+	{"remote_port", "invalid remote_port", func(p ProxyConfig) bool { return p.RemotePort == 0 }},
+}
+
+// ValidateProxyConfigs checks the proxy entries of file for missing required fields. Entries are
+// named by their name, or "#<position>" when they have none.
+func ValidateProxyConfigs(file string, configs []ProxyConfig) ConfigValidationReport {
+	report := ConfigValidationReport{
+		File:      file,
+		CheckedAt: time.Now(),
+		Proxies:   len(configs),
+		Issues:    []ConfigValidationIssue{},
+	}
+	for _, check := range proxyChecks {
+		issue := ConfigValidationIssue{Issue: check.issue, Field: check.field, Entries: []string{}}
+		for i, proxy := range configs {
+			if !check.fails(proxy) {
+				continue
+			}
+			entry := proxy.Name
+			if entry == "" {
+				entry = fmt.Sprintf("#%d", i+1)
+			}
+			issue.Entries = append(issue.Entries, entry)
+		}
+		if issue.Count = len(issue.Entries); issue.Count > 0 {
+			report.Issues = append(report.Issues, issue)
+			report.Total += issue.Count
+		}
+	}
+	return report
+}
+
+// Summary describes the issues in one line, e.g. "missing kubernetes_cluster (3), invalid local_port (1)"
+func (r ConfigValidationReport) Summary() string {
+	parts := make([]string, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		parts = append(parts, fmt.Sprintf("%s (%d)", issue.Issue, issue.Count))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sameFindings reports whether r found the same issues in the same file as other
+func (r ConfigValidationReport) sameFindings(other ConfigValidationReport) bool {
+	return r.File == other.File && slices.EqualFunc(r.Issues, other.Issues, func(a, b ConfigValidationIssue) bool {
+		return a.Field == b.Field && slices.Equal(a.Entries, b.Entries)
+	})
+}
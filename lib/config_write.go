@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// ErrConfigConflict is returned when the config file changed since it was read
+var ErrConfigConflict = errors.New("the config file was changed by another process since it was loaded")
+
+const (
+	// configLockTimeout is how long a writer waits for another writer's lock
+	configLockTimeout = 5 * time.Second
+	// configLockStale is the age after which a lock file is assumed to be left over from a crash
+	configLockStale = 30 * time.Second
+)
+
+// ConfigVersion identifies a config file's content, used as an ETag for conflict detection
+func ConfigVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ConfigFileVersion returns the version of the file at path, or "" if it does not exist
+func ConfigFileVersion(path string) (string, error) {
+	data, exists, err := readConfigFile(path)
+	if err != nil || !exists {
+		return "", err
+	}
+	return ConfigVersion(data), nil
+}
+
+// readConfigFile reads a config file, reporting whether it exists
+func readConfigFile(path string) ([]byte, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	return data, true, nil
+}
+
+// SaveProxyConfigs replaces the proxy entries of a config file, keeping its other settings,
+// key order and comments (see RenderProxyConfigs). The file is replaced atomically while
+// holding an advisory lock, so concurrent writers (GUI tabs, CLI commands) never leave a
+// half-written file. When expectedVersion is set and the file's current version differs,
+// ErrConfigConflict is returned and nothing is written. It returns the version of the written file.
+func SaveProxyConfigs(path string, configs []ProxyConfig, expectedVersion string) (string, error) {
+	return updateConfigFile(path, expectedVersion, func(current []byte) ([]byte, error) {
+		return RenderProxyConfigs(current, configs)
+	})
+}
+
+// updateConfigFile renders the new content of a config file from its current content and
+// writes it atomically, holding the lock from reading to replacing the file. A symlinked config
+// file is updated at its target, so the link stays in place.
+func updateConfigFile(path, expectedVersion string, render func(current []byte) ([]byte, error)) (string, error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to resolve config file %s: %w", path, err)
+	}
+
+	unlock, err := lockConfigFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	current, exists, err := readConfigFile(path)
+	if err != nil {
+		return "", err
+	}
+	if expectedVersion != "" && (!exists || ConfigVersion(current) != expectedVersion) {
+		return "", ErrConfigConflict
+	}
+
+	data, err := render(current)
+	if err != nil {
+		return "", err
+	}
+
+	// Keep the permissions of an existing file
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create config directory %s: %w", dir, err)
+	}
+
+	// Write to a temporary file in the same directory so the rename is atomic
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to write config file %s: %w", path, err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write config file %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write config file %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write config file %s: %w", path, err)
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return "", fmt.Errorf("failed to write config file %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", fmt.Errorf("failed to replace config file %s: %w", path, err)
+	}
+
+	return ConfigVersion(data), nil
+}
+
+// lockConfigFile takes the advisory lock for a config file by creating path.lock exclusively.
+// Locks older than configLockStale are removed, since their owner most likely crashed.
+func lockConfigFile(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(configLockTimeout)
+
+	for {
+		lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(lock, "%d\n", os.Getpid())
+			lock.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock config file %s: %w", path, err)
+		}
+
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > configLockStale {
+			log.Warn("Removing stale config lock", "path", lockPath, "age", time.Since(info.ModTime()).Round(time.Second))
+			os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("config file %s is locked by another aproxymate process (remove %s if no other process is running)", path, lockPath)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
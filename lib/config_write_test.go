@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveProxyConfigsThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", ConfigFilename)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("# managed in dotfiles\nproxy_configs: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, ConfigFilename)
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	configs := []ProxyConfig{{Name: "orders", KubernetesCluster: "prod", RemoteHost: "orders.internal", LocalPort: 15432, RemotePort: 5432}}
+	if _, err := SaveProxyConfigs(link, configs, ""); err != nil {
+		t.Fatalf("SaveProxyConfigs: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("%s was replaced by a regular file", link)
+	}
+	saved, err := ReadProxyConfigsFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Name != "orders" {
+		t.Errorf("link target holds %+v, want the saved entry", saved)
+	}
+	if info, err := os.Stat(target); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("link target mode = %v, want 0600", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temporary or lock files left next to the link: %v", entries)
+	}
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// proxyConfigsKey is the top-level key holding the proxy entries
+const proxyConfigsKey = "proxy_configs"
+
+// RenderProxyConfigs returns the config file content with its proxy entries replaced by configs.
+// Everything else in the file is kept as written: other settings, key order and comments. Entries
+// matching an existing one (by name, then by cluster, remote host and remote port) keep their
+// key order, quoting and comments for the values that did not change.
+func RenderProxyConfigs(existing []byte, configs []ProxyConfig) ([]byte, error) {
+	var doc yaml.Node
+	if len(bytes.TrimSpace(existing)) > 0 {
+		if err := yaml.Unmarshal(existing, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		// Empty file, or one holding only comments
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the config file must contain a mapping of settings at the top level")
+	}
+
+	// Find the existing entries so they can be updated in place
+	var (
+		current  []ProxyConfig
+		oldItems []*yaml.Node
+		oldValue *yaml.Node
+	)
+	valueIndex := -1
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == proxyConfigsKey {
+			valueIndex = i + 1
+			oldValue = root.Content[valueIndex]
+			break
+		}
+	}
+	if oldValue != nil && oldValue.Kind == yaml.SequenceNode {
+		if err := oldValue.Decode(&current); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", proxyConfigsKey, err)
+		}
+		oldItems = oldValue.Content
+	}
+
+	entries := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	match := matchProxyConfigs(current, configs)
+	for i, config := range configs {
+		var item yaml.Node
+		if err := item.Encode(config); err != nil {
+			return nil, fmt.Errorf("failed to render proxy config %q: %w", config.Name, err)
+		}
+		if j := match[i]; j >= 0 {
+			entries.Content = append(entries.Content, mergeYAMLNode(oldItems[j], &item))
+		} else {
+			entries.Content = append(entries.Content, &item)
+		}
+	}
+
+	if oldValue != nil {
+		copyYAMLComments(entries, oldValue)
+		root.Content[valueIndex] = entries
+	} else {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: proxyConfigsKey}
+		root.Content = append([]*yaml.Node{key, entries}, root.Content...)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to render config file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to render config file: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeYAMLNode returns updated with the layout of old: mapping keys keep their order and
+// comments, and values that did not change keep their original quoting
+func mergeYAMLNode(old, updated *yaml.Node) *yaml.Node {
+	switch {
+	case old.Kind == yaml.MappingNode && updated.Kind == yaml.MappingNode:
+		merged := *old
+		merged.Content = nil
+
+		updatedValues := make(map[string]*yaml.Node)
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			updatedValues[updated.Content[i].Value] = updated.Content[i+1]
+		}
+
+		// Existing keys first, in their original order; keys no longer set are dropped
+		kept := make(map[string]bool)
+		for i := 0; i+1 < len(old.Content); i += 2 {
+			key := old.Content[i]
+			if value, ok := updatedValues[key.Value]; ok {
+				merged.Content = append(merged.Content, key, mergeYAMLNode(old.Content[i+1], value))
+				kept[key.Value] = true
+			}
+		}
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			if !kept[updated.Content[i].Value] {
+				merged.Content = append(merged.Content, updated.Content[i], updated.Content[i+1])
+			}
+		}
+		return &merged
+
+	case old.Kind == yaml.SequenceNode && updated.Kind == yaml.SequenceNode:
+		merged := *old
+		merged.Content = nil
+		for i, item := range updated.Content {
+			if i < len(old.Content) {
+				item = mergeYAMLNode(old.Content[i], item)
+			}
+			merged.Content = append(merged.Content, item)
+		}
+		return &merged
+
+	case old.Kind == yaml.ScalarNode && updated.Kind == yaml.ScalarNode &&
+		old.Value == updated.Value && old.ShortTag() == updated.ShortTag():
+		return old
+	}
+
+	merged := *updated
+	copyYAMLComments(&merged, old)
+	return &merged
+}
+
+// copyYAMLComments carries the comments of a replaced node over to its replacement
+func copyYAMLComments(to, from *yaml.Node) {
+	to.HeadComment = from.HeadComment
+	to.LineComment = from.LineComment
+	to.FootComment = from.FootComment
+}
@@ -0,0 +1,179 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Engines that connection strings can be generated for
+const (
+	EnginePostgres = "postgres"
+	EngineMySQL    = "mysql"
+	EngineRedis    = "redis"
+)
+
+// Connection string formats
+const (
+	ConnectionFormatPsql  = "psql"
+	ConnectionFormatMySQL = "mysql"
+	ConnectionFormatRedis = "redis"
+	ConnectionFormatJDBC  = "jdbc"
+)
+
+// enginesByPort maps well-known remote ports to engines when no engine is configured
+var enginesByPort = map[int]string{
+	5432: EnginePostgres,
+	3306: EngineMySQL,
+	6379: EngineRedis,
+}
+
+// ConnectionStringOptions holds optional parts of a generated connection string
+type ConnectionStringOptions struct {
+	// Format is one of psql, mysql, redis or jdbc; empty selects the engine's native format
+	Format   string
+	User     string
+	Database string
+	// Password is included in the connection string when set, e.g. for credentials leased from Vault
+	Password string
+}
+
+// NormalizeEngine maps engine names, including RDS engine identifiers such as
+// "aurora-postgresql", to a known engine. Unknown engines are returned lowercased.
+func NormalizeEngine(engine string) string {
+	engine = strings.ToLower(strings.TrimSpace(engine))
+	switch {
+	case strings.Contains(engine, "postgres"):
+		return EnginePostgres
+	case strings.Contains(engine, "mysql"), engine == "mariadb":
+		return EngineMySQL
+	case strings.Contains(engine, "redis"), strings.Contains(engine, "valkey"):
+		return EngineRedis
+	}
+	return engine
+}
+
+// ResolvedEngine returns the configured engine, or infers it from the remote port
+func (p ProxyConfig) ResolvedEngine() string {
+	if p.Engine != "" {
+		return NormalizeEngine(p.Engine)
+	}
+	return enginesByPort[p.RemotePort]
+}
+
+// BuildConnectionString renders a connection string or URL pointing at the proxy's local endpoint
+func BuildConnectionString(config ProxyConfig, opts ConnectionStringOptions) (string, error) {
+	engine := config.ResolvedEngine()
+	if engine == "" {
+		return "", fmt.Errorf("unable to determine the database engine for '%s'; set the 'engine' field in the configuration", config.Name)
+	}
+
+	format := opts.Format
+	if format == "" {
+		switch engine {
+		case EnginePostgres:
+			format = ConnectionFormatPsql
+		case EngineMySQL:
+			format = ConnectionFormatMySQL
+		case EngineRedis:
+			format = ConnectionFormatRedis
+		default:
+			return "", fmt.Errorf("connection strings are not supported for engine '%s'", engine)
+		}
+	}
+
+	switch format {
+	case ConnectionFormatPsql:
+		if engine != EnginePostgres {
+			return "", fmt.Errorf("format 'psql' requires a postgres engine, got '%s'", engine)
+		}
+		return postgresURL(config, opts), nil
+	case ConnectionFormatMySQL:
+		if engine != EngineMySQL {
+			return "", fmt.Errorf("format 'mysql' requires a mysql engine, got '%s'", engine)
+		}
+		if config.LocalSocket != "" {
+			return "", fmt.Errorf("format 'mysql' is not supported for Unix socket endpoints")
+		}
+		return buildURL("mysql", connectionHost(config), opts.User, opts.Password, opts.Database, nil), nil
+	case ConnectionFormatRedis:
+		if engine != EngineRedis {
+			return "", fmt.Errorf("format 'redis' requires a redis engine, got '%s'", engine)
+		}
+		if config.LocalSocket != "" {
+			return "unix://" + config.LocalSocket, nil
+		}
+		return buildURL("redis", connectionHost(config), opts.User, opts.Password, opts.Database, nil), nil
+	case ConnectionFormatJDBC:
+		if config.LocalSocket != "" {
+			return "", fmt.Errorf("format 'jdbc' is not supported for Unix socket endpoints")
+		}
+		var scheme string
+		switch engine {
+		case EnginePostgres:
+			scheme = "postgresql"
+		case EngineMySQL:
+			scheme = "mysql"
+		default:
+			return "", fmt.Errorf("format 'jdbc' is not supported for engine '%s'", engine)
+		}
+		query := url.Values{}
+		if opts.User != "" {
+			query.Set("user", opts.User)
+		}
+		if opts.Password != "" {
+			query.Set("password", opts.Password)
+		}
+		return "jdbc:" + buildURL(scheme, connectionHost(config), "", "", opts.Database, query), nil
+	default:
+		return "", fmt.Errorf("unknown connection string format '%s' (supported: psql, mysql, redis, jdbc)", format)
+	}
+}
+
+// postgresURL builds a libpq connection URI, using the socket directory for Unix socket endpoints
+func postgresURL(config ProxyConfig, opts ConnectionStringOptions) string {
+	if config.LocalSocket == "" {
+		return buildURL("postgresql", connectionHost(config), opts.User, opts.Password, opts.Database, nil)
+	}
+
+	// libpq expects the socket directory and derives the file name from the port
+	query := url.Values{}
+	query.Set("host", filepath.Dir(config.LocalSocket))
+	if port, ok := strings.CutPrefix(filepath.Base(config.LocalSocket), ".s.PGSQL."); ok {
+		query.Set("port", port)
+	}
+	if opts.User != "" {
+		query.Set("user", opts.User)
+	}
+	if opts.Password != "" {
+		query.Set("password", opts.Password)
+	}
+	return "postgresql:///" + url.PathEscape(opts.Database) + "?" + query.Encode()
+}
+
+// connectionHost returns the host:port clients should connect to.
+// 127.0.0.1 is used rather than "localhost" so that MySQL clients don't switch to their default socket.
+func connectionHost(config ProxyConfig) string {
+	host := config.LocalBindAddress
+	if host == "" || host == "localhost" || net.ParseIP(host).IsUnspecified() {
+		host = DefaultLocalBindAddress
+	}
+	return net.JoinHostPort(host, strconv.Itoa(config.LocalPort))
+}
+
+// buildURL assembles a URL from its parts
+func buildURL(scheme, host, user, password, database string, query url.Values) string {
+	u := url.URL{Scheme: scheme, Host: host, Path: "/" + database}
+	if user != "" && password != "" {
+		u.User = url.UserPassword(user, password)
+	} else if user != "" {
+		u.User = url.User(user)
+	}
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// contextHealthTTL is how long a ping result is reused before the context is checked again
+const contextHealthTTL = 30 * time.Second
+
+// ContextHealth is the result of checking that a context's API server is reachable and accepts
+// the user's credentials
+type ContextHealth struct {
+	Context       string    `json:"context"`
+	Reachable     bool      `json:"reachable"`
+	Authenticated bool      `json:"authenticated"`
+	Version       string    `json:"version,omitempty"`
+	LatencyMs     int64     `json:"latencyMs"`
+	Error         string    `json:"error,omitempty"`
+	CheckedAt     time.Time `json:"checkedAt"`
+	// Cached is set when the result comes from an earlier check
+	Cached bool `json:"cached"`
+}
+
+// PingKubernetesContext asks the context's API server for its version and checks that the
+// user's credentials are accepted, without changing anything in the cluster
+func PingKubernetesContext(ctx context.Context, contextName string) (health ContextHealth) {
+	health = ContextHealth{Context: contextName, CheckedAt: time.Now()}
+	defer func() {
+		health.LatencyMs = time.Since(health.CheckedAt).Milliseconds()
+	}()
+
+	if err := CheckTeleportSession("", contextName); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	restConfig, err := GetKubernetesClientConfig(KubeConfig{Context: contextName})
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		restConfig.Timeout = time.Until(deadline)
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		// An API server rejecting anonymous requests is still reachable
+		if apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err) {
+			health.Reachable = true
+		}
+		health.Error = err.Error()
+		return health
+	}
+	health.Reachable = true
+	health.Version = version.GitVersion
+
+	// Any authenticated user may create a SelfSubjectAccessReview
+	_, err = clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: "get", Resource: "pods"},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		health.Error = "credentials were rejected: " + err.Error()
+		return health
+	}
+	health.Authenticated = true
+	return health
+}
+
+// contextHealthCache keeps recent ping results so that every open GUI tab doesn't hit the
+// API servers, and shares a running check between concurrent requests for the same context
+type contextHealthCache struct {
+	mu       sync.Mutex
+	results  map[string]ContextHealth
+	inflight map[string]chan struct{}
+}
+
+func newContextHealthCache() *contextHealthCache {
+	return &contextHealthCache{
+		results:  make(map[string]ContextHealth),
+		inflight: make(map[string]chan struct{}),
+	}
+}
+
+// reset drops all results, so the next request checks again
+func (c *contextHealthCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.results)
+}
+
+// get returns the cached health of a context, or checks it when the result is older than
+// contextHealthTTL or refresh is set
+func (c *contextHealthCache) get(ctx context.Context, contextName string, refresh bool) ContextHealth {
+	c.mu.Lock()
+	for {
+		if result, ok := c.results[contextName]; ok && !refresh && time.Since(result.CheckedAt) < contextHealthTTL {
+			c.mu.Unlock()
+			result.Cached = true
+			return result
+		}
+		done, running := c.inflight[contextName]
+		if !running {
+			break
+		}
+		// Wait for the running check and use its result
+		c.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ContextHealth{Context: contextName, CheckedAt: time.Now(), Error: ctx.Err().Error()}
+		}
+		refresh = false
+		c.mu.Lock()
+	}
+	done := make(chan struct{})
+	c.inflight[contextName] = done
+	c.mu.Unlock()
+
+	// Don't let one caller's cancellation spoil the result shared with the others
+	pingCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 15*time.Second)
+	defer cancel()
+	result := PingKubernetesContext(pingCtx, contextName)
+
+	c.mu.Lock()
+	c.results[contextName] = result
+	delete(c.inflight, contextName)
+	close(done)
+	c.mu.Unlock()
+	return result
+}
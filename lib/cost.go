@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// DefaultPodHourRate is the estimated price of a relay pod running for an hour, roughly what
+// its 50m CPU and 64Mi memory requests cost on common cloud node types
+const DefaultPodHourRate = 0.005
+
+// CostConfig prices relay pods for the cost estimates of the stats
+type CostConfig struct {
+	// Currency labels the estimates (default USD)
+	Currency string `json:"currency,omitempty" mapstructure:"currency" yaml:"currency,omitempty"`
+	// PodHourRate is the price of a relay pod running for an hour (default DefaultPodHourRate)
+	PodHourRate float64 `json:"pod_hour_rate,omitempty" mapstructure:"pod_hour_rate" yaml:"pod_hour_rate,omitempty"`
+	// Clusters overrides PodHourRate by Kubernetes context
+	Clusters map[string]float64 `json:"clusters,omitempty" mapstructure:"clusters" yaml:"clusters,omitempty"`
+}
+
+// Validate checks that no rate is negative
+func (c CostConfig) Validate() error {
+	if c.PodHourRate < 0 {
+		return fmt.Errorf("pod_hour_rate must not be negative")
+	}
+	for cluster, rate := range c.Clusters {
+		if rate < 0 {
+			return fmt.Errorf("rate of cluster '%s' must not be negative", cluster)
+		}
+	}
+	return nil
+}
+
+// Rate returns the price of a relay pod hour in the cluster
+func (c CostConfig) Rate(cluster string) float64 {
+	if rate, ok := c.Clusters[cluster]; ok {
+		return rate
+	}
+	if c.PodHourRate > 0 {
+		return c.PodHourRate
+	}
+	return DefaultPodHourRate
+}
+
+// currency returns the configured currency or USD
+func (c CostConfig) currency() string {
+	if c.Currency != "" {
+		return c.Currency
+	}
+	return "USD"
+}
+
+// ClusterCost is the estimated relay pod cost in one cluster
+type ClusterCost struct {
+	Cluster     string  `json:"cluster"`
+	PodHourRate float64 `json:"podHourRate"`
+	RunningPods int     `json:"runningPods"`
+	PodHours    float64 `json:"podHours"`
+	Cost        float64 `json:"cost"`
+}
+
+// CostEstimate is the estimated cost of the running relay pods and of the recorded pod-hours
+type CostEstimate struct {
+	Currency string `json:"currency"`
+	// RunningPods is the number of relay pods running now, and HourlyCost what they cost per hour
+	RunningPods int     `json:"runningPods"`
+	HourlyCost  float64 `json:"hourlyCost"`
+	// RunningCost is what the running relay pods have cost since they started
+	RunningCost float64 `json:"runningCost"`
+	// PodHours and Cost cover the recorded usage of the period
+	PodHours float64       `json:"podHours"`
+	Cost     float64       `json:"cost"`
+	Clusters []ClusterCost `json:"clusters"`
+}
+
+// EstimateCost prices the recorded usage, filling in the PodHours and Cost of each proxy, and
+// the relay pods of the running proxies. Days recorded without a cluster use the default rate.
+func (c CostConfig) EstimateCost(usage []ProxyUsage, running map[string]ProxyStatus) CostEstimate {
+	estimate := CostEstimate{Currency: c.currency()}
+	clusters := make(map[string]*ClusterCost)
+	cluster := func(name string) *ClusterCost {
+		if clusters[name] == nil {
+			clusters[name] = &ClusterCost{Cluster: name, PodHourRate: c.Rate(name)}
+		}
+		return clusters[name]
+	}
+
+	for i := range usage {
+		for _, day := range usage[i].Days {
+			hours := float64(day.ConnectedSeconds) / time.Hour.Seconds()
+			total := cluster(day.Cluster)
+			total.PodHours += hours
+			total.Cost += hours * total.PodHourRate
+			usage[i].PodHours += hours
+			usage[i].Cost += hours * total.PodHourRate
+		}
+	}
+
+	for _, status := range running {
+		total := cluster(status.Cluster)
+		total.RunningPods++
+		estimate.RunningPods++
+		estimate.HourlyCost += total.PodHourRate
+		estimate.RunningCost += float64(status.UptimeSeconds) / time.Hour.Seconds() * total.PodHourRate
+	}
+
+	estimate.Clusters = make([]ClusterCost, 0, len(clusters))
+	for _, name := range slices.Sorted(maps.Keys(clusters)) {
+		total := clusters[name]
+		estimate.PodHours += total.PodHours
+		estimate.Cost += total.Cost
+		estimate.Clusters = append(estimate.Clusters, *total)
+	}
+	return estimate
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	log "aproxymate/lib/logger"
+)
+
+// SendDesktopNotification shows a native desktop notification using the platform's notifier
+func SendDesktopNotification(title, message string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(10000, %s, %s, [System.Windows.Forms.ToolTipIcon]::Warning)
+Start-Sleep -Seconds 10
+$n.Dispose()`, powerShellString(title), powerShellString(message))
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	default: // "linux", "freebsd", "openbsd", "netbsd"
+		cmd = exec.Command("notify-send", "--app-name=aproxymate", title, message)
+	}
+
+	// Don't wait for the notifier; the Windows balloon keeps its process alive while shown
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to show desktop notification: %w", err)
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// StartDesktopNotifier shows desktop notifications for dropped and reconnected proxies
+// until the returned stop function is called
+func StartDesktopNotifier(manager *ProxyManager) func() {
+	events, unsubscribe := manager.Subscribe()
+
+	go func() {
+		for event := range events {
+			name := event.ProxyName
+			if name == "" {
+				name = "Proxy " + event.ProxyID
+			}
+
+			var title, message string
+			switch event.Type {
+			case ProxyEventDropped:
+				title, message = "Tunnel dropped", fmt.Sprintf("%s disconnected unexpectedly", name)
+			case ProxyEventReconnectExhausted:
+				title, message = "Tunnel down", fmt.Sprintf("%s could not be reconnected", name)
+			case ProxyEventReconnected:
+				title, message = "Tunnel restored", fmt.Sprintf("%s reconnected", name)
+			default:
+				continue
+			}
+
+			if err := SendDesktopNotification("aproxymate: "+title, message); err != nil {
+				log.Debug("Desktop notification failed", "event", event.Type, "proxy_id", event.ProxyID, "error", err)
+			}
+		}
+	}()
+
+	return unsubscribe
+}
+
+// appleScriptString quotes a string for use in AppleScript
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// powerShellString quotes a string as a PowerShell single-quoted literal
+func powerShellString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	log "aproxymate/lib/logger"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultDNSPort is the port of the local DNS server when dns.port is not set. It stays clear
+// of 5353, which mDNS responders such as mDNSResponder and Avahi hold.
+const DefaultDNSPort = 15353
+
+// dnsTTL keeps answers short-lived so that edits to the proxy list take effect quickly
+const dnsTTL = 5
+
+// DNSConfig configures the local DNS server that resolves tunneled hostnames to local listeners
+type DNSConfig struct {
+	// Enabled starts the DNS server with the GUI
+	Enabled bool `json:"enabled,omitempty" mapstructure:"enabled" yaml:"enabled,omitempty"`
+	// Port is the UDP port to listen on (default 15353)
+	Port int `json:"port,omitempty" mapstructure:"port" yaml:"port,omitempty"`
+	// BindAddress is the address to listen on (default 127.0.0.1)
+	BindAddress string `json:"bind_address,omitempty" mapstructure:"bind_address" yaml:"bind_address,omitempty"`
+	// Upstream is a DNS server (host:port) other names are forwarded to; they are refused when empty
+	Upstream string `json:"upstream,omitempty" mapstructure:"upstream" yaml:"upstream,omitempty"`
+}
+
+// Validate checks the port and upstream address
+func (c DNSConfig) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port %d must be 1-65535", c.Port)
+	}
+	if c.BindAddress != "" && net.ParseIP(c.BindAddress) == nil {
+		return fmt.Errorf("bind_address %q must be an IP address", c.BindAddress)
+	}
+	if c.Upstream != "" {
+		if _, _, err := net.SplitHostPort(c.Upstream); err != nil {
+			return fmt.Errorf("upstream %q must be host:port", c.Upstream)
+		}
+	}
+	return nil
+}
+
+// dnsServer answers queries for the remote hosts of the configured proxies with their local address
+type dnsServer struct {
+	conn     net.PacketConn
+	upstream string
+	proxies  func() []ProxyConfig
+}
+
+// StartDNSServer serves DNS on the configured port until the returned stop function is called.
+// proxies is consulted for every query, so proxies added or edited later resolve too.
+func StartDNSServer(config DNSConfig, proxies func() []ProxyConfig) (func(), error) {
+	if !config.Enabled {
+		return func() {}, nil
+	}
+
+	bindAddress := config.BindAddress
+	if bindAddress == "" {
+		bindAddress = DefaultLocalBindAddress
+	}
+	port := config.Port
+	if port == 0 {
+		port = DefaultDNSPort
+	}
+
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(bindAddress, strconv.Itoa(port)))
+	if err != nil {
+		return nil, describeListenError(bindAddress, port, err)
+	}
+
+	server := &dnsServer{conn: conn, upstream: config.Upstream, proxies: proxies}
+	go server.serve()
+
+	log.Info("DNS server started", "addr", conn.LocalAddr().String(), "upstream", config.Upstream)
+	return func() { conn.Close() }, nil
+}
+
+// serve reads queries until the connection is closed
+func (s *dnsServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error("DNS server stopped", "error", err)
+			}
+			return
+		}
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go s.handle(query, addr)
+	}
+}
+
+// handle answers a single query, forwarding it upstream when the name is not a tunneled host
+func (s *dnsServer) handle(query []byte, addr net.Addr) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	ip, ok := s.lookup(name)
+	if !ok {
+		s.forward(query, header, question, addr)
+		return
+	}
+
+	response := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 header.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   header.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: []dnsmessage.Question{question},
+	}
+	resource := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: dnsTTL}
+	// Only the matching address family is answered; the other gets an empty answer so clients fall back
+	if ip4 := ip.To4(); ip4 != nil && question.Type == dnsmessage.TypeA {
+		response.Answers = append(response.Answers, dnsmessage.Resource{Header: resource, Body: &dnsmessage.AResource{A: [4]byte(ip4)}})
+	} else if ip4 == nil && question.Type == dnsmessage.TypeAAAA {
+		response.Answers = append(response.Answers, dnsmessage.Resource{Header: resource, Body: &dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}})
+	}
+	s.reply(response, addr)
+	log.Debug("Answered DNS query for tunneled host", "name", name, "type", question.Type.String(), "answer", ip.String())
+}
+
+// lookup returns the local address of the proxy serving a host name. SNI server names are
+// matched too, including "*.domain" wildcards.
+func (s *dnsServer) lookup(name string) (net.IP, bool) {
+	_, domain, _ := strings.Cut(name, ".")
+	for _, proxy := range s.proxies() {
+		if expanded, err := proxy.expandRemoteHosts(); err == nil {
+			proxy = expanded
+		}
+		names := append([]string{proxy.RemoteHost}, proxy.ServerNames()...)
+		for _, host := range names {
+			host = strings.ToLower(host)
+			if host == name || (domain != "" && host == "*."+domain) {
+				return proxyLocalIP(proxy), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// proxyLocalIP returns the address clients reach a proxy's local listener at
+func proxyLocalIP(proxy ProxyConfig) net.IP {
+	ip := net.ParseIP(proxy.LocalBindAddress)
+	if ip == nil || ip.IsUnspecified() {
+		return net.ParseIP(DefaultLocalBindAddress)
+	}
+	return ip
+}
+
+// forward relays a query to the upstream server, or refuses it when there is none
+func (s *dnsServer) forward(query []byte, header dnsmessage.Header, question dnsmessage.Question, addr net.Addr) {
+	if s.upstream == "" {
+		s.reply(dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:               header.ID,
+				Response:         true,
+				RecursionDesired: header.RecursionDesired,
+				RCode:            dnsmessage.RCodeRefused,
+			},
+			Questions: []dnsmessage.Question{question},
+		}, addr)
+		return
+	}
+
+	conn, err := net.DialTimeout("udp", s.upstream, 2*time.Second)
+	if err != nil {
+		log.Debug("Failed to reach upstream DNS server", "upstream", s.upstream, "error", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(query); err != nil {
+		return
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		log.Debug("No answer from upstream DNS server", "upstream", s.upstream, "name", question.Name.String(), "error", err)
+		return
+	}
+	s.conn.WriteTo(buf[:n], addr)
+}
+
+// reply sends a response to the client
+func (s *dnsServer) reply(response dnsmessage.Message, addr net.Addr) {
+	packed, err := response.Pack()
+	if err != nil {
+		log.Debug("Failed to pack DNS response", "error", err)
+		return
+	}
+	s.conn.WriteTo(packed, addr)
+}
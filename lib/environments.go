@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// EnvironmentConfig is one environment (e.g. dev, staging or prod) of a config file. Selecting it
+// applies its cluster and vars to the shared proxy_configs and adds its own entries; an entry
+// with the same name as a shared one replaces it.
+type EnvironmentConfig struct {
+	// KubernetesCluster is the cluster every proxy of the environment connects through
+	KubernetesCluster string `json:"kubernetes_cluster,omitempty" mapstructure:"kubernetes_cluster" yaml:"kubernetes_cluster,omitempty"`
+	// Vars fill in remote_host placeholders of entries that don't set the var themselves
+	Vars map[string]string `json:"vars,omitempty" mapstructure:"vars" yaml:"vars,omitempty"`
+	// ProxyConfigs are added to, or replace by name, the shared proxy_configs
+	ProxyConfigs []ProxyConfig `json:"proxy_configs,omitempty" mapstructure:"proxy_configs" yaml:"proxy_configs,omitempty"`
+}
+
+// ErrEnvironmentSelected is returned when saving proxies that were loaded for an environment,
+// which would overwrite the shared proxy_configs with the environment's entries
+var ErrEnvironmentSelected = errors.New("the configuration was loaded for an environment")
+
+// EnvironmentNames returns the names of the configured environments, sorted
+func (c AppConfig) EnvironmentNames() []string {
+	return slices.Sorted(maps.Keys(c.Environments))
+}
+
+// hasEnvironmentProxies reports whether any environment defines its own proxy entries
+func (c AppConfig) hasEnvironmentProxies() bool {
+	for _, env := range c.Environments {
+		if len(env.ProxyConfigs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ForEnvironment returns the config with the proxies of the named environment. An empty name
+// returns the config unchanged.
+func (c AppConfig) ForEnvironment(name string) (AppConfig, error) {
+	if name == "" {
+		return c, nil
+	}
+	env, ok := c.Environments[name]
+	if !ok {
+		if len(c.Environments) == 0 {
+			return c, fmt.Errorf("environment %q not found: the config file defines no environments", name)
+		}
+		return c, fmt.Errorf("environment %q not found (available: %s)", name, strings.Join(c.EnvironmentNames(), ", "))
+	}
+
+	// The environment's cluster applies to every shared entry, and to its own entries without one
+	proxies := slices.Clone(c.ProxyConfigs)
+	if env.KubernetesCluster != "" {
+		for i := range proxies {
+			proxies[i].KubernetesCluster = env.KubernetesCluster
+		}
+	}
+	for _, override := range env.ProxyConfigs {
+		if override.KubernetesCluster == "" {
+			override.KubernetesCluster = env.KubernetesCluster
+		}
+		index := slices.IndexFunc(proxies, func(p ProxyConfig) bool { return p.Name == override.Name })
+		if index >= 0 {
+			proxies[index] = override
+		} else {
+			proxies = append(proxies, override)
+		}
+	}
+
+	for i := range proxies {
+		vars := map[string]string{"Env": name}
+		maps.Copy(vars, env.Vars)
+		maps.Copy(vars, proxies[i].Vars)
+		proxies[i].Vars = vars
+	}
+
+	c.ProxyConfigs = proxies
+	return c, nil
+}
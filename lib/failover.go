@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// failoverScript runs in a relay container that has several remote hosts. socat forks a shell for
+// every client connection, which probes the hosts in order and relays to the first one that
+// accepts a connection. The probe opens and closes a connection before the client's data flows,
+// so a host that fails mid-stream is never replaced by the next one. RELAY_LISTEN replaces the
+// plain TCP listener, e.g. with a TLS one.
+const failoverScript = `cat > /tmp/failover.sh <<'EOF'
+for host in $RELAY_HOSTS; do
+  if socat -u /dev/null TCP:$host:$RELAY_PORT,connect-timeout=3 2>/dev/null; then
+    exec socat - TCP:$host:$RELAY_PORT$RELAY_TCP_OPTIONS
+  fi
+  echo "$host:$RELAY_PORT is unreachable, trying the next host" >&2
+done
+echo "none of $RELAY_HOSTS accepts connections on port $RELAY_PORT" >&2
+exit 1
+EOF
+exec socat ${RELAY_LISTEN:-TCP-LISTEN:$RELAY_LISTEN_PORT,fork} EXEC:'sh /tmp/failover.sh'`
+
+// remoteHostPattern matches host names and IP addresses that are safe to pass to the failover script
+var remoteHostPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// Hosts returns the remote hosts of the proxy in failover order: remote_host, then remote_hosts
+func (p ProxyConfig) Hosts() []string {
+	hosts := []string{}
+	for _, host := range append([]string{p.RemoteHost}, p.RemoteHosts...) {
+		if host != "" && !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// validateRemoteHosts checks the failover hosts of a proxy config
+func validateRemoteHosts(proxy ProxyConfig) error {
+	for _, host := range proxy.RemoteHosts {
+		if !remoteHostPattern.MatchString(host) {
+			return fmt.Errorf("has invalid 'remote_hosts' entry %q (must be a host name or IP address)", host)
+		}
+	}
+	if len(proxy.RemoteHosts) > 0 && !remoteHostPattern.MatchString(proxy.RemoteHost) {
+		return fmt.Errorf("has invalid 'remote_host' %q for use with 'remote_hosts'", proxy.RemoteHost)
+	}
+	return nil
+}
+
+// relayTarget describes where a relay port forwards to, e.g. "db-a|db-b:5432" for failover hosts
+func relayTarget(hosts []string, port int) string {
+	return fmt.Sprintf("%s:%d", strings.Join(hosts, "|"), port)
+}
+
+// failoverContainer builds a relay container that tries several remote hosts in order
+func failoverContainer(name, image string, hosts []string, listenPort, remotePort int, targetOptions string) corev1.Container {
+	container := socatContainer(name, image, hosts[0], listenPort, remotePort, targetOptions)
+	container.Command = []string{"sh", "-c", failoverScript}
+	container.Args = nil
+	container.Env = []corev1.EnvVar{
+		{Name: "RELAY_LISTEN_PORT", Value: strconv.Itoa(listenPort)},
+		{Name: "RELAY_HOSTS", Value: strings.Join(hosts, " ")},
+		{Name: "RELAY_PORT", Value: strconv.Itoa(remotePort)},
+		{Name: "RELAY_TCP_OPTIONS", Value: targetOptions},
+	}
+	return container
+}
+
+// failoverRelayTarget reads the listen port and target of a failover container
+func failoverRelayTarget(container corev1.Container) (int, string, bool) {
+	env := make(map[string]string)
+	for _, variable := range container.Env {
+		env[variable.Name] = variable.Value
+	}
+	listenPort, err := strconv.Atoi(env["RELAY_LISTEN_PORT"])
+	if err != nil {
+		return 0, "", false
+	}
+	remotePort, err := strconv.Atoi(env["RELAY_PORT"])
+	if err != nil || env["RELAY_HOSTS"] == "" {
+		return 0, "", false
+	}
+	return listenPort, relayTarget(strings.Fields(env["RELAY_HOSTS"]), remotePort), true
+}
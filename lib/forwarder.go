@@ -0,0 +1,645 @@
+package lib
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "aproxymate/lib/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// DefaultLocalBindAddress is used when a proxy does not configure local_bind_address
+const DefaultLocalBindAddress = "127.0.0.1"
+
+// maxConnectionRecords bounds the number of finished connections kept per forwarder
+const maxConnectionRecords = 100
+
+// ConnectionRecord describes a single client connection accepted by a local forwarder
+type ConnectionRecord struct {
+	ClientAddr string    `json:"clientAddr"`
+	RemotePort int       `json:"remotePort"`
+	StartedAt  time.Time `json:"startedAt"`
+	EndedAt    time.Time `json:"endedAt,omitempty"`
+	BytesIn    int64     `json:"bytesIn"`  // Bytes sent by the client towards the remote host
+	BytesOut   int64     `json:"bytesOut"` // Bytes sent by the remote host back to the client
+	Error      string    `json:"error,omitempty"`
+}
+
+// Duration returns how long the connection was (or has been) open
+func (c ConnectionRecord) Duration() time.Duration {
+	if c.EndedAt.IsZero() {
+		return time.Since(c.StartedAt)
+	}
+	return c.EndedAt.Sub(c.StartedAt)
+}
+
+// ForwarderStats aggregates traffic through a local forwarder
+type ForwarderStats struct {
+	ActiveConnections int       `json:"activeConnections"`
+	TotalConnections  int64     `json:"totalConnections"`
+	BytesIn           int64     `json:"bytesIn"`
+	BytesOut          int64     `json:"bytesOut"`
+	LastActivity      time.Time `json:"lastActivity,omitempty"`
+}
+
+// localListener is a bound local endpoint, the pod port its connections go to and the remote
+// port the pod relays them to
+type localListener struct {
+	listener   net.Listener
+	podPort    int
+	remotePort int
+}
+
+// relayStream is an open port-forward stream to a relay pod, with the pod ports and relay TLS
+// settings in effect when it was opened
+type relayStream struct {
+	conn      httpstream.Connection
+	namespace string
+	podName   string
+	podPorts  []int
+	tls       *tls.Config
+}
+
+// LocalForwarder accepts client connections on one or more local listeners and forwards
+// each one over a shared Kubernetes port-forward stream to a port on a pod
+type LocalForwarder struct {
+	listeners []localListener
+
+	// streamMu guards the port-forward stream, which Start replaces after the forwarder parked
+	streamMu sync.Mutex
+	stream   *relayStream
+	// ready is closed while a stream is open; connections accepted while parked wait for it
+	ready chan struct{}
+	// dropped is closed when the current stream closes and the forwarder parks
+	dropped   chan struct{}
+	accepting bool
+
+	requestID int64
+	bytesIn   int64
+	bytesOut  int64
+
+	mu           sync.Mutex
+	active       int
+	total        int64
+	lastActivity time.Time
+	records      []ConnectionRecord
+	// open holds the records of the client connections that are still open
+	open map[*ConnectionRecord]struct{}
+
+	// AccessPolicy restricts which clients may connect; nil allows everyone
+	AccessPolicy *ClientAccessPolicy
+	// KeepAlive overrides the TCP keepalive settings of accepted client connections when set
+	KeepAlive *net.KeepAliveConfig
+	// OnConnectionClosed is called for every finished client connection
+	OnConnectionClosed func(ConnectionRecord)
+	// OnConnectionRejected is called when a client is refused by the access policy
+	OnConnectionRejected func(clientAddr, reason string)
+	// RelayTLS encrypts the traffic to the pod, which must terminate TLS, when set. Start
+	// applies it to the stream it opens.
+	RelayTLS *tls.Config
+	// ParkTimeout, when set, keeps the listeners bound after the port-forward stream closes.
+	// Clients connecting meanwhile wait up to ParkTimeout for Start to open a new stream, so
+	// they see a stall rather than a refused connection. Without it a closed stream closes
+	// the forwarder.
+	ParkTimeout time.Duration
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closed    atomic.Bool
+}
+
+// NewLocalForwarder binds the local listener for a proxy. Binding happens before the relay
+// pod is created so that local port problems are reported without touching the cluster.
+func NewLocalForwarder(bindAddress string, localPort, remotePort int) (*LocalForwarder, error) {
+	listener, err := listenTCP(bindAddress, localPort)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLocalForwarder(listener, remotePort), nil
+}
+
+// AddListener binds an additional local port that forwards to another port on the same pod.
+// It must be called before Start.
+func (f *LocalForwarder) AddListener(bindAddress string, localPort, remotePort int) error {
+	listener, err := listenTCP(bindAddress, localPort)
+	if err != nil {
+		return err
+	}
+
+	f.listeners = append(f.listeners, localListener{listener: listener, podPort: remotePort, remotePort: remotePort})
+	return nil
+}
+
+// SetPodPorts sets the pod ports the listeners forward to, in the order they were added, for
+// pods that don't listen on the remote ports. It must be called before Start, or before the
+// next Start while parked.
+func (f *LocalForwarder) SetPodPorts(ports []int) error {
+	if len(ports) != len(f.listeners) {
+		return fmt.Errorf("pod listens on %d port(s), but the proxy needs %d", len(ports), len(f.listeners))
+	}
+	f.streamMu.Lock()
+	defer f.streamMu.Unlock()
+	for i, port := range ports {
+		f.listeners[i].podPort = port
+	}
+	return nil
+}
+
+// listenTCP binds a local TCP port, defaulting to the loopback address
+func listenTCP(bindAddress string, localPort int) (net.Listener, error) {
+	if bindAddress == "" {
+		bindAddress = DefaultLocalBindAddress
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddress, strconv.Itoa(localPort)))
+	if err != nil {
+		return nil, describeListenError(bindAddress, localPort, err)
+	}
+	return listener, nil
+}
+
+// NewUnixSocketForwarder listens on a Unix socket path instead of a TCP port.
+// A stale socket left behind by a previous run is removed; a socket that is still
+// accepting connections is reported as in use.
+func NewUnixSocketForwarder(socketPath string, remotePort int) (*LocalForwarder, error) {
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("Cannot use %s as a Unix socket: a file that is not a socket already exists at that path", socketPath)
+		}
+		if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("Unix socket %s is already in use by another process", socketPath)
+		}
+		log.Debug("Removing stale Unix socket", "path", socketPath)
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("failed to remove stale Unix socket %s: %w", socketPath, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for Unix socket %s: %w", socketPath, err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen on Unix socket %s: %v", socketPath, err)
+	}
+
+	// Only the current user may connect
+	if err := os.Chmod(socketPath, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set permissions on Unix socket %s: %w", socketPath, err)
+	}
+
+	return newLocalForwarder(listener, remotePort), nil
+}
+
+// newLocalForwarder wraps an already bound listener
+func newLocalForwarder(listener net.Listener, remotePort int) *LocalForwarder {
+	return &LocalForwarder{
+		listeners: []localListener{{listener: listener, podPort: remotePort, remotePort: remotePort}},
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// describeListenError converts a listener bind failure into a user-facing message
+func describeListenError(bindAddress string, localPort int, err error) error {
+	switch {
+	case errors.Is(err, syscall.EACCES):
+		if localPort <= 1023 {
+			return privilegedPortError(localPort)
+		}
+		return fmt.Errorf("Permission denied binding to port %d. Please check your system permissions", localPort)
+	case errors.Is(err, syscall.EADDRINUSE):
+		return &LocalPortError{
+			Port:    localPort,
+			Reason:  PortReasonInUse,
+			Message: fmt.Sprintf("Port %d is already in use by another service. Please choose a different local port or stop the service using port %d", localPort, localPort),
+		}
+	case errors.Is(err, syscall.EADDRNOTAVAIL):
+		return fmt.Errorf("Address %s is not available on this machine. Please check the local_bind_address setting", bindAddress)
+	default:
+		return fmt.Errorf("Failed to listen on %s: %v", net.JoinHostPort(bindAddress, strconv.Itoa(localPort)), err)
+	}
+}
+
+// Start opens the port-forward stream to the pod and begins accepting client connections. A
+// parked forwarder is resumed with a stream to the given pod, which may be a new one.
+func (f *LocalForwarder) Start(clientset *kubernetes.Clientset, restConfig *rest.Config, namespace, podName string) error {
+	transport, upgrader, err := spdy.RoundTripperFor(restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create port-forward transport: %w", err)
+	}
+
+	url := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward").
+		URL()
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	streamConn, protocol, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return fmt.Errorf("failed to open port-forward stream to pod %s: %w", podName, err)
+	}
+	if protocol != portforward.PortForwardProtocolV1Name {
+		streamConn.Close()
+		return fmt.Errorf("unable to negotiate port-forward protocol: server returned %q", protocol)
+	}
+
+	f.streamMu.Lock()
+	if f.closed.Load() || f.stream != nil {
+		f.streamMu.Unlock()
+		streamConn.Close()
+		return fmt.Errorf("local forwarder is closed or already has a port-forward stream")
+	}
+	stream := &relayStream{conn: streamConn, namespace: namespace, podName: podName, tls: f.RelayTLS}
+	for _, l := range f.listeners {
+		stream.podPorts = append(stream.podPorts, l.podPort)
+	}
+	f.stream = stream
+	f.dropped = make(chan struct{})
+	close(f.ready)
+	startAccepting := !f.accepting
+	f.accepting = true
+	f.streamMu.Unlock()
+
+	if startAccepting {
+		for i := range f.listeners {
+			go f.acceptLoop(i)
+		}
+	}
+
+	// Tear down the listener when the stream connection to the API server goes away, unless
+	// the forwarder parks until Start is called again
+	go func() {
+		select {
+		case <-streamConn.CloseChan():
+			if f.park(stream) {
+				log.Warn("Port-forward stream closed, holding new client connections", "pod", podName, "namespace", namespace, "timeout", f.ParkTimeout)
+				return
+			}
+			log.Warn("Port-forward stream closed", "pod", podName, "namespace", namespace)
+			f.Close()
+		case <-f.done:
+		}
+	}()
+
+	return nil
+}
+
+// park drops the closed stream so that new client connections wait for the next one. It
+// returns false when the forwarder doesn't park or is closing.
+func (f *LocalForwarder) park(stream *relayStream) bool {
+	f.streamMu.Lock()
+	defer f.streamMu.Unlock()
+
+	if f.ParkTimeout <= 0 || f.closed.Load() || f.stream != stream {
+		return false
+	}
+	f.stream = nil
+	f.ready = make(chan struct{})
+	close(f.dropped)
+	return true
+}
+
+// Dropped returns a channel that is closed when the current port-forward stream closes and the
+// forwarder parks; see ParkTimeout
+func (f *LocalForwarder) Dropped() <-chan struct{} {
+	f.streamMu.Lock()
+	defer f.streamMu.Unlock()
+	return f.dropped
+}
+
+// PodName returns the relay pod of the current port-forward stream, or "" while parked
+func (f *LocalForwarder) PodName() string {
+	f.streamMu.Lock()
+	defer f.streamMu.Unlock()
+	if f.stream == nil {
+		return ""
+	}
+	return f.stream.podName
+}
+
+// awaitStream returns the open port-forward stream, waiting up to ParkTimeout while parked
+func (f *LocalForwarder) awaitStream(clientAddr string) (*relayStream, error) {
+	deadline := time.Now().Add(f.ParkTimeout)
+	for {
+		f.streamMu.Lock()
+		stream, ready := f.stream, f.ready
+		f.streamMu.Unlock()
+		if stream != nil {
+			return stream, nil
+		}
+
+		log.Debug("Holding client connection until the port-forward stream is reopened", "client", clientAddr)
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-ready:
+			timer.Stop()
+		case <-timer.C:
+			return nil, fmt.Errorf("port-forward stream was not reopened within %s", f.ParkTimeout)
+		case <-f.done:
+			timer.Stop()
+			return nil, errors.New("local forwarder was closed while waiting for the port-forward stream")
+		}
+	}
+}
+
+// Addr returns the local address of the forwarder's primary listener
+func (f *LocalForwarder) Addr() net.Addr {
+	return f.listeners[0].listener.Addr()
+}
+
+// Addrs returns the local addresses of all listeners
+func (f *LocalForwarder) Addrs() []net.Addr {
+	addrs := make([]net.Addr, len(f.listeners))
+	for i, l := range f.listeners {
+		addrs[i] = l.listener.Addr()
+	}
+	return addrs
+}
+
+// Done returns a channel that is closed when the forwarder stops
+func (f *LocalForwarder) Done() <-chan struct{} {
+	return f.done
+}
+
+// Close stops accepting connections and closes the port-forward stream
+func (f *LocalForwarder) Close() error {
+	var err error
+	f.closeOnce.Do(func() {
+		f.closed.Store(true)
+		for _, l := range f.listeners {
+			if closeErr := l.listener.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+		f.streamMu.Lock()
+		if f.stream != nil {
+			f.stream.conn.Close()
+		}
+		f.streamMu.Unlock()
+		close(f.done)
+	})
+	return err
+}
+
+// Stats returns aggregated traffic statistics for the forwarder
+func (f *LocalForwarder) Stats() ForwarderStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return ForwarderStats{
+		ActiveConnections: f.active,
+		TotalConnections:  f.total,
+		BytesIn:           atomic.LoadInt64(&f.bytesIn),
+		BytesOut:          atomic.LoadInt64(&f.bytesOut),
+		LastActivity:      f.lastActivity,
+	}
+}
+
+// IdleFor returns how long the forwarder has had no open client connections
+func (f *LocalForwarder) IdleFor() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.active > 0 || f.lastActivity.IsZero() {
+		return 0
+	}
+	return time.Since(f.lastActivity)
+}
+
+// OpenConnections returns the client connections that are currently open, oldest first
+func (f *LocalForwarder) OpenConnections() []ConnectionRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records := make([]ConnectionRecord, 0, len(f.open))
+	for record := range f.open {
+		// The byte counts are updated while the connection is open
+		records = append(records, ConnectionRecord{
+			ClientAddr: record.ClientAddr,
+			RemotePort: record.RemotePort,
+			StartedAt:  record.StartedAt,
+			BytesIn:    atomic.LoadInt64(&record.BytesIn),
+			BytesOut:   atomic.LoadInt64(&record.BytesOut),
+		})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].StartedAt.Before(records[j].StartedAt) })
+	return records
+}
+
+// RecentConnections returns the most recently finished client connections, oldest first
+func (f *LocalForwarder) RecentConnections() []ConnectionRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records := make([]ConnectionRecord, len(f.records))
+	copy(records, f.records)
+	return records
+}
+
+// acceptLoop accepts client connections on a listener until it is closed
+func (f *LocalForwarder) acceptLoop(index int) {
+	l := f.listeners[index]
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if !f.closed.Load() {
+				log.Error("Local listener stopped accepting connections", "addr", l.listener.Addr().String(), "error", err)
+				f.Close()
+			}
+			return
+		}
+
+		if allowed, reason := f.AccessPolicy.Allows(conn.RemoteAddr()); !allowed {
+			log.Warn("Rejected client connection", "client", conn.RemoteAddr().String(), "pod", f.PodName(), "reason", reason)
+			if f.OnConnectionRejected != nil {
+				f.OnConnectionRejected(conn.RemoteAddr().String(), reason)
+			}
+			conn.Close()
+			continue
+		}
+
+		if f.KeepAlive != nil {
+			setKeepAlive(conn, *f.KeepAlive)
+		}
+		go f.handleConnection(conn, index)
+	}
+}
+
+// setKeepAlive applies keepalive settings to a TCP client connection, including one routed by
+// server name; other connections are left alone
+func setKeepAlive(conn net.Conn, config net.KeepAliveConfig) {
+	if peeked, ok := conn.(*peekedConn); ok {
+		conn = peeked.Conn
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := tcpConn.SetKeepAliveConfig(config); err != nil {
+			log.Debug("Failed to set TCP keepalive on client connection", "client", conn.RemoteAddr().String(), "error", err)
+		}
+	}
+}
+
+// handleConnection forwards a single client connection over a pair of port-forward streams
+func (f *LocalForwarder) handleConnection(conn net.Conn, index int) {
+	defer conn.Close()
+	l := f.listeners[index]
+
+	record := ConnectionRecord{
+		ClientAddr: conn.RemoteAddr().String(),
+		RemotePort: l.remotePort,
+		StartedAt:  time.Now(),
+	}
+
+	f.mu.Lock()
+	f.active++
+	f.total++
+	f.lastActivity = record.StartedAt
+	if f.open == nil {
+		f.open = make(map[*ConnectionRecord]struct{})
+	}
+	f.open[&record] = struct{}{}
+	f.mu.Unlock()
+
+	// Connections accepted while parked wait here for the next stream
+	podName := ""
+	stream, err := f.awaitStream(record.ClientAddr)
+	if err == nil {
+		podName = stream.podName
+		log.Debug("Accepted client connection", "client", record.ClientAddr, "pod", podName, "remote_port", l.remotePort)
+		err = f.forward(conn, stream, index, &record)
+	}
+	if err != nil {
+		record.Error = err.Error()
+		log.Warn("Client connection ended with error", "client", record.ClientAddr, "pod", podName, "error", err)
+	}
+	record.EndedAt = time.Now()
+
+	f.mu.Lock()
+	f.active--
+	delete(f.open, &record)
+	f.lastActivity = record.EndedAt
+	f.records = append(f.records, record)
+	if len(f.records) > maxConnectionRecords {
+		f.records = f.records[len(f.records)-maxConnectionRecords:]
+	}
+	onClosed := f.OnConnectionClosed
+	f.mu.Unlock()
+
+	if onClosed != nil {
+		onClosed(record)
+	}
+}
+
+// forward copies data between the client connection and the pod, counting bytes in both directions
+func (f *LocalForwarder) forward(conn net.Conn, stream *relayStream, index int, record *ConnectionRecord) error {
+	podPort := stream.podPorts[index]
+	requestID := atomic.AddInt64(&f.requestID, 1)
+
+	// Create the error stream first; the server reports forwarding failures on it
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, strconv.Itoa(podPort))
+	headers.Set(corev1.PortForwardRequestIDHeader, strconv.FormatInt(requestID, 10))
+	errorStream, err := stream.conn.CreateStream(headers)
+	if err != nil {
+		return fmt.Errorf("error creating error stream: %w", err)
+	}
+	// We're not writing to this stream
+	errorStream.Close()
+	defer stream.conn.RemoveStreams(errorStream)
+
+	errorChan := make(chan error, 1)
+	go func() {
+		message, err := io.ReadAll(errorStream)
+		switch {
+		case err != nil:
+			errorChan <- fmt.Errorf("error reading from error stream: %w", err)
+		case len(message) > 0:
+			errorChan <- fmt.Errorf("remote error forwarding to port %d: %s", podPort, string(message))
+		}
+		close(errorChan)
+	}()
+
+	headers.Set(corev1.StreamType, corev1.StreamTypeData)
+	dataStream, err := stream.conn.CreateStream(headers)
+	if err != nil {
+		return fmt.Errorf("error creating data stream: %w", err)
+	}
+	defer stream.conn.RemoveStreams(dataStream)
+
+	var remote io.ReadWriter = dataStream
+	closeRemote := dataStream.Close
+	if stream.tls != nil {
+		tlsConn := tls.Client(streamConn{dataStream}, stream.tls)
+		ctx, cancel := context.WithTimeout(context.Background(), relayTLSHandshakeTimeout)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("TLS handshake with the relay pod failed: %w", err)
+		}
+		remote = tlsConn
+		closeRemote = func() error {
+			tlsConn.CloseWrite()
+			return dataStream.Close()
+		}
+	}
+
+	remoteDone := make(chan struct{})
+	localDone := make(chan struct{})
+
+	go func() {
+		// Copy from the remote side to the local client
+		n, _ := io.Copy(conn, remote)
+		atomic.AddInt64(&record.BytesOut, n)
+		atomic.AddInt64(&f.bytesOut, n)
+		close(remoteDone)
+	}()
+
+	go func() {
+		// Inform the server we're not sending any more data after copy unblocks
+		defer closeRemote()
+
+		// Copy from the local client to the remote side
+		n, _ := io.Copy(remote, conn)
+		atomic.AddInt64(&record.BytesIn, n)
+		atomic.AddInt64(&f.bytesIn, n)
+		close(localDone)
+	}()
+
+	// Wait for either side to finish, then make sure the other copy has stopped
+	// before the byte counters are read
+	select {
+	case <-remoteDone:
+		conn.Close()
+		<-localDone
+	case <-localDone:
+		<-remoteDone
+	}
+
+	return <-errorChan
+}
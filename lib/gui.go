@@ -1,16 +1,25 @@
 package lib
 
 import (
+	"bytes"
 	"context"
-	_ "embed"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
+	"html"
+	"mime"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
 	"os"
-	"os/exec"
 	"os/signal"
 	"os/user"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -19,47 +28,236 @@ import (
 	"time"
 
 	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
 
 	log "aproxymate/lib/logger"
 )
 
-//go:embed templates/index.html
-var indexHTML string
-
 // ProxyRow represents a single proxy configuration row
 type ProxyRow struct {
-	ID                string    `json:"id"`
-	KubernetesCluster string    `json:"cluster"`
-	RemoteHost        string    `json:"host"`
-	LocalPort         int       `json:"localPort"`
-	RemotePort        int       `json:"remotePort"`
-	Connected         bool      `json:"connected"`
-	Process           *exec.Cmd `json:"-"`
-	SocatPodName      string    `json:"-"` // Name of the socat pod
-	SocatNamespace    string    `json:"-"` // Namespace for the socat pod
-	IntentionalStop   bool      `json:"-"` // Flag to track if stop was intentional
-}
-
-// GuiData holds the data for the HTML template
+	ID string `json:"id"`
+	// Name and Local are the proxy's name and local endpoint, filled in by withStatus
+	Name              string `json:"name,omitempty"`
+	Local             string `json:"local,omitempty"`
+	KubernetesCluster string `json:"cluster"`
+	RemoteHost        string `json:"host"`
+	LocalPort         int    `json:"localPort"`
+	RemotePort        int    `json:"remotePort"`
+	// Connected and the runtime fields below are only set on copies returned by withStatus
+	Connected bool `json:"connected"`
+	// State is the proxy's lifecycle state: connecting, connected, degraded or stopped
+	State ProxyState `json:"state"`
+	// Runtime details of the relay pod and connection, filled in by withStatus
+	PodName       string `json:"podName,omitempty"`
+	PodPhase      string `json:"podPhase,omitempty"`
+	Node          string `json:"node,omitempty"`
+	Restarts      int32  `json:"restarts"`
+	LastError     string `json:"lastError,omitempty"`
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+	// LastFailure is why the proxy last failed to connect or dropped, with the relay pod's events
+	LastFailure *ProxyFailure `json:"lastFailure,omitempty"`
+	// Stats holds the client connections and traffic of a connected proxy
+	Stats *ForwarderStats `json:"stats,omitempty"`
+	// LastEvent is the most recent lifecycle event, e.g. why the tunnel dropped
+	LastEvent *ProxyEvent `json:"lastEvent,omitempty"`
+	// Progress is set while the proxy is connecting
+	Progress *ConnectProgress `json:"progress,omitempty"`
+	// Credentials are the database credentials leased from Vault, without the password
+	Credentials      *VaultCredentials `json:"credentials,omitempty"`
+	CredentialsError string            `json:"credentialsError,omitempty"`
+	// Description, Owner and DocsURL are copied from the loaded config entry
+	Description string `json:"description,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	DocsURL     string `json:"docsUrl,omitempty"`
+	// Source is the file and line of the loaded config entry, e.g. "/home/alice/aproxymate.yaml:12"
+	Source string `json:"source,omitempty"`
+	// Namespace is where the relay pod runs
+	Namespace string `json:"namespace"`
+	// Config is the entry loaded from the config file, kept so that settings
+	// which are not editable in the GUI survive edits and saves
+	Config ProxyConfig `json:"-"`
+	// order is the row's position in the config file or the GUI; IDs don't say anything about it
+	order int
+	// configured is set on rows loaded from the config file
+	configured bool
+}
+
+// toProxyConfig merges the GUI-editable fields into the row's loaded config
+func (r *ProxyRow) toProxyConfig() ProxyConfig {
+	config := r.Config
+	// Keep the name of the config entry, which the row ID is derived from, unless it was
+	// generated from the host and port
+	if config.Name == "" || config.Name == fmt.Sprintf("%s:%d", config.RemoteHost, config.LocalPort) {
+		config.Name = fmt.Sprintf("%s:%d", r.RemoteHost, r.LocalPort)
+	}
+	config.KubernetesCluster = r.KubernetesCluster
+	config.RemoteHost = r.RemoteHost
+	config.LocalPort = r.LocalPort
+	config.RemotePort = r.RemotePort
+	return config
+}
+
+// statusSnapshot is the ProxyManager state needed to fill in the runtime fields of rows
+type statusSnapshot struct {
+	statuses   map[string]ProxyStatus
+	states     map[string]ProxyState
+	failures   map[string]ProxyFailure
+	lastEvents map[string]ProxyEvent
+	connecting map[string]ConnectProgress
+}
+
+// statusSnapshot collects the current proxy state from the manager
+func (g *GUI) statusSnapshot() statusSnapshot {
+	return statusSnapshot{
+		states:     g.manager.States(),
+		statuses:   g.manager.Status(),
+		failures:   g.manager.Failures(),
+		lastEvents: g.manager.LastEvents(),
+		connecting: g.manager.Connecting(),
+	}
+}
+
+// withStatus returns a copy of the row with the connection state and relay pod details filled in
+func (r *ProxyRow) withStatus(snapshot statusSnapshot) *ProxyRow {
+	row := *r
+	status, connected := snapshot.statuses[r.ID]
+	row.Connected = connected
+	row.State = ProxyStateStopped
+	if state, exists := snapshot.states[r.ID]; exists {
+		row.State = state
+	}
+	if failure, failed := snapshot.failures[r.ID]; failed {
+		row.LastError = failure.Message
+		row.LastFailure = &failure
+	}
+	row.Description = r.Config.Description
+	row.Owner = r.Config.Owner
+	row.DocsURL = r.Config.DocsURL
+	if r.Config.Source != nil {
+		row.Source = r.Config.Source.String()
+	}
+	row.Namespace = r.Config.PodNamespace()
+	config := r.toProxyConfig()
+	row.Name = config.Name
+	row.Local = config.LocalEndpoint()
+	if event, exists := snapshot.lastEvents[r.ID]; exists {
+		row.LastEvent = &event
+	}
+	if progress, exists := snapshot.connecting[r.ID]; exists {
+		row.Progress = &progress
+	}
+	if connected {
+		row.PodName = status.PodName
+		row.PodPhase = status.Pod.Phase
+		row.Node = status.Pod.Node
+		row.Restarts = status.Pod.Restarts
+		row.LastError = status.LastError
+		row.UptimeSeconds = status.UptimeSeconds
+		row.Stats = &status.Stats
+		row.Credentials = status.Credentials
+		row.CredentialsError = status.CredentialsError
+	}
+	return &row
+}
+
+// GuiData holds the data for the HTML template, also served as JSON by /api/page
 type GuiData struct {
-	ProxyRows []*ProxyRow
-	NextID    int
+	ProxyRows []*ProxyRow `json:"proxies"`
+	// Groups holds the same rows grouped by cluster, in the order the clusters first appear
+	Groups   []ProxyGroup `json:"groups"`
+	NextID   int          `json:"nextId"`
+	BasePath string       `json:"basePath"`
+	// ConfigVersion is sent back as If-Match on saves to detect changes by other tabs or processes
+	ConfigVersion string `json:"configVersion"`
+	// StrictConnect hides the controls for adding proxies and saving the config
+	StrictConnect bool `json:"strictConnect"`
+	// ReadOnly hides all controls that connect, disconnect or change proxies
+	ReadOnly bool `json:"readOnly"`
+	// Version is the aproxymate version and AssetVersion identifies its static files
+	Version      string `json:"version"`
+	AssetVersion string `json:"assetVersion"`
+}
+
+// ProxyGroup is the rows of one cluster, shown as a collapsible section
+type ProxyGroup struct {
+	Cluster string      `json:"cluster"`
+	Rows    []*ProxyRow `json:"proxies"`
+}
+
+// groupByCluster groups rows by cluster, keeping the order of the rows
+func groupByCluster(rows []*ProxyRow) []ProxyGroup {
+	var groups []ProxyGroup
+	index := make(map[string]int)
+	for _, row := range rows {
+		i, exists := index[row.KubernetesCluster]
+		if !exists {
+			i = len(groups)
+			index[row.KubernetesCluster] = i
+			groups = append(groups, ProxyGroup{Cluster: row.KubernetesCluster})
+		}
+		groups[i].Rows = append(groups[i].Rows, row)
+	}
+	return groups
 }
 
 // GUI manages the web interface and proxy connections
 type GUI struct {
+	// mu guards the fields below. Rows are never modified in place: updates store a new
+	// *ProxyRow, so a row read under the lock stays consistent after it is released.
+	// Connection state is owned by the ProxyManager and copied into rows by withStatus.
 	mu               sync.RWMutex
 	rows             map[string]*ProxyRow
 	nextID           int
 	server           *http.Server
-	configFileLoaded bool // Track if a config file was actually loaded
+	manager          *ProxyManager
+	configFileLoaded bool                   // Track if a config file was actually loaded
+	configVersion    string                 // Version of the config file when it was loaded or last saved
+	validation       ConfigValidationReport // Issues found in the proxy entries when the config file was last loaded
+	environment      string                 // Environment of the config file the proxies were loaded for
+	debug            bool                   // Expose net/http/pprof handlers
+	stopWebhooks     func()                 // Stops delivery to the configured webhooks
+	stopDNS          func()                 // Stops the local DNS server
+	stopStatsD       func()                 // Stops sending metrics to the StatsD agent
+	notify           bool                   // Show desktop notifications for tunnel failures
+	basePath         string                 // Sub-path the GUI is mounted under, e.g. "/aproxymate"
+	updateCheck      bool                   // Check GitHub for newer releases (opt-in via update_check)
+	instance         *GUIInstance
+	portFallback     int    // Number of following ports to try when the GUI port is busy
+	bindAddress      string // Address the GUI listens on; empty for all interfaces
+	readOnly         bool   // Refuse all requests that connect, disconnect or change proxies
+	authTokenPath    string // File holding the instance token, written when missing
+	shutdownCh       chan string
+	shutdownTimeout  time.Duration       // Upper bound for deleting relay pods on shutdown
+	adoptMode        string              // How running pods from an earlier session are handled
+	adoptable        []AdoptablePod      // Running pods waiting for a re-attach decision via the API
+	adminPodDeletion bool                // Allow deleting other users' pods from the cluster view
+	skipCleanup      bool                // Don't delete leftover pods of earlier sessions after startup
+	strictConnect    bool                // Only connect proxies as configured in the config file
+	portPolicy       PortPolicy          // Local ports automatic assignment may hand out, e.g. for RDS imports
+	cost             CostConfig          // Relay pod prices for the cost estimates of /api/stats
+	oidc             *oidcAuth           // Requires an OIDC login for the GUI and API when set
+	oidcErr          error               // Why the configured OIDC login can't be used; Start refuses to run
+	contextHealth    *contextHealthCache // Recent results of /api/contexts/{name}/ping
+	notices          *noticeQueue        // User-facing messages shown as toasts by the frontend
+	stopNotices      func()
+	stopKubeWatch    func() // Stops watching the kubeconfig for changes
+	stopUsage        func() // Stops recording proxy usage
+	startedAt        time.Time
+	phase            string // Reported by /readyz: starting, ready or stopping
 }
 
 // NewGUI creates a new GUI instance
 func NewGUI() *GUI {
 	gui := &GUI{
-		rows:   make(map[string]*ProxyRow),
-		nextID: 1,
+		rows:            make(map[string]*ProxyRow),
+		nextID:          1,
+		manager:         NewProxyManager(),
+		shutdownCh:      make(chan string, 1),
+		shutdownTimeout: 30 * time.Second,
+		adoptMode:       AdoptModeAsk,
+		notices:         newNoticeQueue(),
+		contextHealth:   newContextHealthCache(),
 	}
 
 	// Create one default empty row
@@ -70,6 +268,7 @@ func NewGUI() *GUI {
 		LocalPort:         0,
 		RemotePort:        0,
 		Connected:         false,
+		order:             1,
 	}
 	gui.rows["1"] = defaultRow
 	gui.nextID = 2
@@ -77,6 +276,94 @@ func NewGUI() *GUI {
 	return gui
 }
 
+// maxRowIDLength keeps row IDs readable in URLs and relay pod names
+const maxRowIDLength = 32
+
+// stableRowIDs derives the row IDs of proxy configs from their names, e.g. "orders-db" for
+// "Orders DB", and marks them as used. Entries without a name are named after their remote host
+// and local port. Entries whose names give the same ID, or an ID that is already used, are told
+// apart by a short hash of where they connect to rather than by their position, so reordering
+// or removing entries doesn't change the IDs of other entries.
+func stableRowIDs(configs []ProxyConfig, used map[string]bool) []string {
+	bases := make([]string, len(configs))
+	counts := make(map[string]int, len(configs))
+	for i, config := range configs {
+		name := config.Name
+		if name == "" {
+			name = fmt.Sprintf("%s:%d", config.RemoteHost, config.LocalPort)
+		}
+		bases[i] = rowIDBase(name)
+		counts[bases[i]]++
+	}
+
+	ids := make([]string, len(configs))
+	for i, config := range configs {
+		id := bases[i]
+		if counts[id] > 1 || used[id] {
+			suffix := rowIDSuffix(config)
+			base := id
+			if room := maxRowIDLength - len(suffix) - 1; len(base) > room {
+				base = strings.TrimRight(base[:room], "-")
+			}
+			id = base + "-" + suffix
+			// Only entries connecting to the same place through the same cluster end up here
+			for n, hashed := 2, id; used[id]; n++ {
+				id = fmt.Sprintf("%s-%d", hashed, n)
+			}
+		}
+		used[id] = true
+		ids[i] = id
+	}
+	return ids
+}
+
+// rowIDBase derives the readable part of a row ID from a proxy name
+func rowIDBase(name string) string {
+	base := nameSlug(name)
+	if len(base) > maxRowIDLength {
+		base = strings.TrimRight(base[:maxRowIDLength], "-")
+	}
+	if base == "" {
+		return "proxy"
+	}
+	if _, err := strconv.Atoi(base); err == nil {
+		// Numbers are left to the rows added in the GUI, which are numbered from nextID
+		return "proxy-" + base
+	}
+	return base
+}
+
+// rowIDSuffix is a short hash of a proxy's cluster, namespace and remote host and port, which
+// sets apart the IDs of entries with the same name
+func rowIDSuffix(config ProxyConfig) string {
+	target := fmt.Sprintf("%s/%s/%s:%d", config.KubernetesCluster, config.PodNamespace(), config.RemoteHost, config.RemotePort)
+	sum := sha256.Sum256([]byte(target))
+	return hex.EncodeToString(sum[:3])
+}
+
+// nameSlug lowercases a name and joins its letters and digits with dashes
+func nameSlug(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return slug.String()
+}
+
+// configRowIDs returns the row IDs of the entries of a config file, in entry order
+func configRowIDs(configs []ProxyConfig) []string {
+	return stableRowIDs(configs, make(map[string]bool))
+}
+
 // LoadConfigFromViper loads proxy configurations from Viper config
 func (g *GUI) LoadConfigFromViper() (int, error) {
 	g.mu.Lock()
@@ -86,10 +373,24 @@ func (g *GUI) LoadConfigFromViper() (int, error) {
 	if err := viper.Unmarshal(&config); err != nil {
 		return 0, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	if configFile := viper.ConfigFileUsed(); configFile != "" {
+		if err := config.AnnotateSources(configFile); err != nil {
+			log.Debug("Could not record where the proxy entries are written", "file", configFile, "error", err)
+		}
+	}
+	config, err := config.ForEnvironment(g.environment)
+	if err != nil {
+		return 0, err
+	}
 
 	// Check if we actually loaded proxy configs (indicating a real config file was read)
 	configFileUsed := viper.ConfigFileUsed()
 	g.configFileLoaded = len(config.ProxyConfigs) > 0 && configFileUsed != ""
+	if configFileUsed != "" {
+		if version, err := ConfigFileVersion(configFileUsed); err == nil {
+			g.configVersion = version
+		}
+	}
 
 	// Log configuration validation information
 	if configFileUsed != "" {
@@ -99,62 +400,26 @@ func (g *GUI) LoadConfigFromViper() (int, error) {
 		opCtx.Debug("GUI loading configuration from file", "file", configFileUsed, "num_configs", len(config.ProxyConfigs))
 		log.LogConfigLoad(configFileUsed, len(config.ProxyConfigs))
 
-		// Simple validation - check for missing required fields
-		validationErrors := 0
-		for i, proxy := range config.ProxyConfigs {
-			if proxy.Name == "" {
-				opCtx.Warn("Configuration validation warning", "issue", "missing name", "config_index", i+1)
-				validationErrors++
-			}
-			if proxy.KubernetesCluster == "" {
-				opCtx.Warn("Configuration validation warning", "issue", "missing kubernetes_cluster", "config_index", i+1, "name", proxy.Name)
-				validationErrors++
-			}
-			if proxy.RemoteHost == "" {
-				opCtx.Warn("Configuration validation warning", "issue", "missing remote_host", "config_index", i+1, "name", proxy.Name)
-				validationErrors++
-			}
-			if proxy.LocalPort == 0 {
-				opCtx.Warn("Configuration validation warning", "issue", "invalid local_port", "config_index", i+1, "name", proxy.Name, "port", proxy.LocalPort)
-				validationErrors++
-			}
-			if proxy.RemotePort == 0 {
-				opCtx.Warn("Configuration validation warning", "issue", "invalid remote_port", "config_index", i+1, "name", proxy.Name, "port", proxy.RemotePort)
-				validationErrors++
-			}
-		}
-
-		if validationErrors > 0 {
-			opCtx.Warn("Configuration validation completed with warnings", "total_errors", validationErrors)
-		} else {
+		// Check for missing required fields; findings already logged by an earlier load of the
+		// same file are only repeated at debug level
+		report := ValidateProxyConfigs(configFileUsed, config.ProxyConfigs)
+		repeated := report.sameFindings(g.validation)
+		switch {
+		case report.Total == 0:
 			opCtx.Debug("Configuration validation completed successfully")
+		case repeated:
+			opCtx.Debug("Configuration validation found the same issues as before", "total_issues", report.Total, "issues", report.Summary())
+		default:
+			log.Warn("Configuration validation completed with warnings", "file", configFileUsed, "total_issues", report.Total, "issues", report.Summary())
 		}
-
-		// Check for missing clusters and prompt if needed
-		if HasConfigsWithMissingClusters(config.ProxyConfigs) {
-			missingConfigs := FindConfigsWithMissingClusters(config.ProxyConfigs)
-			opCtx.Debug("Found configurations with missing Kubernetes clusters", "count", len(missingConfigs))
-
-			selectedCluster, err := SelectKubernetesClusterTUI("")
-			if err != nil {
-				return 0, fmt.Errorf("failed to select Kubernetes cluster: %w", err)
-			}
-
-			// Update all configs with missing clusters
-			config.ProxyConfigs = UpdateConfigsWithCluster(config.ProxyConfigs, selectedCluster)
-			log.Debug("Updated configurations with selected cluster", "cluster", selectedCluster, "updated_count", len(missingConfigs))
-
-			// Save the updated configuration back to the file
-			if configFileUsed != "" {
-				viper.Set("proxy_configs", config.ProxyConfigs)
-				if err := viper.WriteConfig(); err != nil {
-					outputCtx := NewSimpleOutputContext()
-					outputCtx.Warn("Failed to save updated configuration with cluster information", "Warning: Could not save updated configuration: %v\n", err)
-				} else {
-					outputCtx := NewSimpleOutputContext()
-					outputCtx.Success("Saved updated configuration with cluster information", "✅ Updated configuration saved with cluster '%s'\n", selectedCluster)
-				}
-			}
+		g.validation = report
+
+		// Entries without a cluster are loaded as they are: the loader runs in the server, which
+		// may have no terminal to prompt on
+		if missing := FindConfigsWithMissingClusters(config.ProxyConfigs); len(missing) > 0 && !repeated {
+			outputCtx := NewSimpleOutputContext()
+			outputCtx.Warn("Found configurations with missing Kubernetes clusters",
+				"⚠️  %d proxy configuration(s) have no kubernetes_cluster.\n   Assign one in the GUI or run: aproxymate config fix\n", len(missing))
 		}
 	} else {
 		log.Debug("No configuration file loaded - using default empty configuration")
@@ -164,11 +429,13 @@ func (g *GUI) LoadConfigFromViper() (int, error) {
 	if len(config.ProxyConfigs) > 0 {
 		// Clear existing rows (including the default empty row)
 		g.rows = make(map[string]*ProxyRow)
-		g.nextID = 1
+		g.nextID = len(config.ProxyConfigs) + 1
 
-		// Load proxy configurations
+		// Load proxy configurations with IDs derived from their names, so that scripts
+		// can keep using an ID when other entries are added, removed or reordered
+		ids := configRowIDs(config.ProxyConfigs)
 		for i, proxyConfig := range config.ProxyConfigs {
-			id := strconv.Itoa(i + 1)
+			id := ids[i]
 			row := &ProxyRow{
 				ID:                id,
 				KubernetesCluster: proxyConfig.KubernetesCluster,
@@ -176,21 +443,203 @@ func (g *GUI) LoadConfigFromViper() (int, error) {
 				LocalPort:         proxyConfig.LocalPort,
 				RemotePort:        proxyConfig.RemotePort,
 				Connected:         false,
+				Config:            proxyConfig,
+				order:             i + 1,
+				configured:        true,
 			}
 			g.rows[id] = row
+		}
+	}
 
-			// Update nextID to be after the loaded configs
-			if nextID, err := strconv.Atoi(id); err == nil && nextID >= g.nextID {
-				g.nextID = nextID + 1
-			}
+	g.manager.ApplyConfig(config)
+	g.updateCheck = config.UpdateCheck
+	if config.StrictConnect {
+		g.strictConnect = true
+	}
+	g.oidc, g.oidcErr = nil, nil
+	if config.OIDC.Enabled() {
+		if g.oidc, err = newOIDCAuth(config.OIDC); err != nil {
+			g.oidcErr = fmt.Errorf("oidc is invalid: %w", err)
 		}
 	}
+	g.cost = config.Cost
+	if policy, err := config.PortPolicy(); err == nil {
+		g.portPolicy = policy
+	} else {
+		log.Warn("Ignoring invalid port range for automatic port assignment", "error", err)
+	}
+
+	if g.stopWebhooks != nil {
+		g.stopWebhooks()
+	}
+	g.stopWebhooks = StartWebhookNotifier(g.manager, config.Webhooks)
+
+	if g.stopStatsD != nil {
+		g.stopStatsD()
+		g.stopStatsD = nil
+	}
+	stopStatsD, err := StartStatsDEmitter(g.manager, config.StatsD)
+	if err != nil {
+		log.Warn("Failed to start StatsD metrics", "error", err)
+	} else {
+		g.stopStatsD = stopStatsD
+	}
+
+	if g.stopDNS != nil {
+		g.stopDNS()
+		g.stopDNS = nil
+	}
+	stopDNS, err := StartDNSServer(config.DNS, g.proxyConfigs)
+	if err != nil {
+		log.Warn("Failed to start DNS server", "error", err)
+		outputCtx := NewSimpleOutputContext()
+		outputCtx.Warn("Failed to start DNS server", "⚠️  DNS server not started: %v\n", err)
+	} else {
+		g.stopDNS = stopDNS
+	}
 
 	return len(config.ProxyConfigs), nil
 }
 
+// EnableDebugEndpoints exposes the net/http/pprof handlers under /debug/pprof/ and /api/debug/exec
+func (g *GUI) EnableDebugEndpoints() {
+	g.debug = true
+}
+
+// EnableDesktopNotifications shows native desktop notifications when tunnels drop or recover
+func (g *GUI) EnableDesktopNotifications() {
+	g.notify = true
+}
+
+// SetBasePath mounts the GUI and API routes under a sub-path, for use behind a reverse proxy
+func (g *GUI) SetBasePath(basePath string) {
+	g.basePath = NormalizeBasePath(basePath)
+}
+
+// SetPortFallback makes Start try up to n following ports when the requested port is busy
+func (g *GUI) SetPortFallback(n int) {
+	g.portFallback = n
+}
+
+// SetBindAddress makes the GUI listen on one address, e.g. "127.0.0.1", instead of all interfaces
+func (g *GUI) SetBindAddress(address string) error {
+	if err := validateBindAddress(address); err != nil {
+		return fmt.Errorf("invalid bind address %w", err)
+	}
+	g.bindAddress = address
+	return nil
+}
+
+// loopbackAddress reports whether a bind address only accepts connections from this machine
+func loopbackAddress(address string) bool {
+	if address == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
+
+// localAddress returns host:port to reach the GUI from this machine: localhost unless it only
+// listens on another address
+func (g *GUI) localAddress(port int) string {
+	host := "localhost"
+	if ip := net.ParseIP(g.bindAddress); ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+		host = g.bindAddress
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// EnableReadOnly shows the proxies without letting anyone connect, disconnect or change them
+func (g *GUI) EnableReadOnly() {
+	g.readOnly = true
+}
+
+// SetAuthTokenPath takes the instance token from a file instead of generating one; a missing file
+// is created with a random token, so scripts can read it
+func (g *GUI) SetAuthTokenPath(path string) {
+	g.authTokenPath = path
+}
+
+// SetEnvironment selects the environment of the config file whose proxies are loaded
+func (g *GUI) SetEnvironment(name string) {
+	g.environment = name
+}
+
+// SetShutdownTimeout bounds how long shutdown waits for relay pods to be deleted
+func (g *GUI) SetShutdownTimeout(timeout time.Duration) {
+	g.shutdownTimeout = timeout
+}
+
+// DisableStartupCleanup leaves relay pods of earlier sessions in place instead of deleting them
+// after startup
+func (g *GUI) DisableStartupCleanup() {
+	g.skipCleanup = true
+}
+
+// EnableStrictConnect only allows connecting the proxies of the config file, as configured
+func (g *GUI) EnableStrictConnect() {
+	g.strictConnect = true
+}
+
+// errStrictConnectConfig is returned for changes of the config in strict connect mode
+var errStrictConnectConfig = errors.New("strict connect mode: proxies can only be added, changed or removed in the config file")
+
+// checkStrictConnect refuses, in strict connect mode, to connect rows that aren't entries of the
+// config file or whose cluster, host or ports were changed. Caller must hold g.mu.
+func (g *GUI) checkStrictConnect(row *ProxyRow, cluster, host string, localPort, remotePort int) error {
+	if !g.strictConnect {
+		return nil
+	}
+	if row == nil || !row.configured {
+		return fmt.Errorf("strict connect mode: only proxies of the config file can be connected")
+	}
+	config := row.Config
+	if config.KubernetesCluster != cluster || config.RemoteHost != host || config.LocalPort != localPort || config.RemotePort != remotePort {
+		return fmt.Errorf("strict connect mode: %s can only be connected as configured (%s, %s, ports %d:%d)",
+			config.Name, config.KubernetesCluster, config.RemoteHost, config.LocalPort, config.RemotePort)
+	}
+	return nil
+}
+
+// EnableAdminPodDeletion allows deleting other users' pods from the cluster view
+func (g *GUI) EnableAdminPodDeletion() {
+	g.adminPodDeletion = true
+}
+
+// SetAdoptMode sets how relay pods still running from an earlier session are handled on
+// startup: "ask" (prompt, or offer them in the GUI), "always" re-attaches, "never" deletes them
+func (g *GUI) SetAdoptMode(mode string) error {
+	switch mode {
+	case AdoptModeAsk, AdoptModeAlways, AdoptModeNever:
+		g.adoptMode = mode
+		return nil
+	}
+	return fmt.Errorf("invalid adopt mode %q: must be ask, always or never", mode)
+}
+
+// URL returns the address the GUI is served on; it is set once the server is listening
+func (g *GUI) URL() string {
+	if g.instance == nil {
+		return ""
+	}
+	return g.instance.URL
+}
+
+// NormalizeBasePath cleans a base path to the form "/prefix" without a trailing slash; "/" becomes ""
+func NormalizeBasePath(basePath string) string {
+	basePath = strings.Trim(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return ""
+	}
+	return "/" + basePath
+}
+
 // Start starts the GUI web server
 func (g *GUI) Start(port int, serverReady chan<- bool) error {
+	// The debug endpoints run commands in relay pods, so they are never served to the network
+	if g.debug && !loopbackAddress(g.bindAddress) {
+		return errors.New("--debug requires a loopback bind address such as --bind-address 127.0.0.1")
+	}
 	// Load configuration from Viper
 	if numrows, err := g.LoadConfigFromViper(); err != nil {
 		log.Warn("Failed to load configuration", "error", err)
@@ -199,25 +648,39 @@ func (g *GUI) Start(port int, serverReady chan<- bool) error {
 	} else {
 		log.Debug("Starting GUI with empty configuration")
 	}
+	// Never serve without the login that was asked for
+	if g.oidcErr != nil {
+		return g.oidcErr
+	}
 
-	// Clean up any orphaned aproxymate pods from previous sessions
-	log.Debug("Starting orphaned pod cleanup")
-	contexts, err := GetKubernetesContexts("")
+	// Bind before doing anything else so a busy port is reported instead of failing silently
+	requestedPort := port
+	listener, err := g.listen(port)
 	if err != nil {
-		log.Warn("Could not get Kubernetes contexts for cleanup", "error", err)
-	} else {
-		for _, contextName := range contexts {
-			kubeClient, err := GetKubernetesClient(KubeConfig{Context: contextName})
-			if err != nil {
-				log.Warn("Could not create Kubernetes client for cleanup", "context", contextName, "error", err)
-				continue
-			}
+		return err
+	}
+	port = listener.Addr().(*net.TCPAddr).Port
 
-			if err := CleanupOrphanedAproxymatePodsForUser(kubeClient, "default"); err != nil {
-				log.Warn("Failed to cleanup orphaned pods", "context", contextName, "error", err)
-			}
+	instance, err := newGUIInstance(port, fmt.Sprintf("http://%s%s/", g.localAddress(port), g.basePath))
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	if g.authTokenPath != "" {
+		if instance.Token, err = loadAuthToken(g.authTokenPath, instance.Token); err != nil {
+			listener.Close()
+			return err
 		}
 	}
+	if err := instance.write(); err != nil {
+		log.Warn("Failed to record GUI instance; other launches won't detect this one", "error", err)
+	}
+	g.instance = instance
+
+	// Re-attach to relay pods that survived an earlier session if wanted; the rest are cleaned
+	// up once the server is ready
+	g.startedAt = time.Now()
+	pending := g.resolveAdoptablePods()
 
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -225,15 +688,65 @@ func (g *GUI) Start(port int, serverReady chan<- bool) error {
 
 	go func() {
 		sig := <-sigChan
-		log.Info("Received shutdown signal, cleaning up", "signal", sig.String())
-		g.cleanupAllPods()
-		os.Exit(0)
+		g.RequestShutdown("signal " + sig.String())
+	}()
+	defer signal.Stop(sigChan)
+
+	if g.notify {
+		StartDesktopNotifier(g.manager)
+	}
+	g.stopNotices = startNoticeFeed(g.manager, g.notices)
+	// A changed kubeconfig may add contexts or carry refreshed credentials
+	g.stopKubeWatch = WatchKubeconfig("", g.contextHealth.reset)
+	g.stopUsage = g.manager.RecordUsage()
+	g.server = &http.Server{Handler: g.routes()}
+
+	outputCtx := NewSimpleOutputContext()
+	if requestedPort != 0 && port != requestedPort {
+		outputCtx.Warn("GUI port busy, using fallback", "⚠️  Port %d is in use, using port %d instead\n", requestedPort, port)
+	}
+	outputCtx.Info("GUI server starting", "Aproxymate GUI starting on %s\n", g.URL())
+
+	// Start the server in a goroutine
+	go func() {
+		if err := g.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error("GUI server failed", "error", err)
+			g.RequestShutdown("server error: " + err.Error())
+		}
 	}()
 
+	// Wait for server to be ready by trying to connect to it
+	for i := 0; i < 30; i++ { // Try for up to 3 seconds
+		if g.isServerReady(port) {
+			if serverReady != nil {
+				close(serverReady)
+			}
+			log.Debug("GUI server is ready and accepting connections", "port", port)
+			g.setPhase(guiPhaseReady)
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if g.skipCleanup {
+		log.Info("Skipping the cleanup of orphaned pods")
+	} else {
+		go g.cleanupOrphanedPods(pending)
+	}
+
+	// Serve until a shutdown is requested, then tear down in order
+	reason := <-g.shutdownCh
+	return g.shutdown(reason)
+}
+
+// routes registers the pages and API endpoints and wraps them in the read-only, login and
+// base path handling that is configured
+func (g *GUI) routes() http.Handler {
 	mux := http.NewServeMux()
 
 	// Serve the main page
 	mux.HandleFunc("/", g.handleIndex)
+	mux.Handle("/static/", staticHandler())
 
 	// API endpoints
 	mux.HandleFunc("/api/proxy", g.handleProxy)
@@ -241,39 +754,110 @@ func (g *GUI) Start(port int, serverReady chan<- bool) error {
 	mux.HandleFunc("/api/connect", g.handleConnect)
 	mux.HandleFunc("/api/disconnect/", g.handleDisconnect)
 	mux.HandleFunc("/api/contexts", g.handleContexts)
+	mux.HandleFunc("/api/contexts/", g.handleContextWithName)
 	mux.HandleFunc("/api/config/save", g.handleSaveConfig)
+	mux.HandleFunc("/api/config/preview", g.handleConfigPreview)
 	mux.HandleFunc("/api/config/location", g.handleConfigLocation)
+	mux.HandleFunc("/api/config/validation", g.handleConfigValidation)
+	mux.HandleFunc("/api/config/missing-clusters", g.handleMissingClusters)
 	mux.HandleFunc("/api/status", g.handleStatus)
+	mux.HandleFunc("/api/page", g.handlePageData)
+	mux.HandleFunc("/api/events", g.handleEvents)
+	mux.HandleFunc("/api/notifications", g.handleNotifications)
+	mux.HandleFunc("/api/stream", g.handleStream)
+	mux.HandleFunc("/api/summary", g.handleSummary)
+	mux.HandleFunc("/api/stats", g.handleStats)
+	mux.HandleFunc("/api/version", g.handleVersion)
+	mux.HandleFunc("/healthz", g.handleHealthz)
+	mux.HandleFunc("/readyz", g.handleReadyz)
+	mux.HandleFunc("/api/update", g.handleUpdate)
+	mux.HandleFunc("/api/debug/runtime", g.handleDebugRuntime)
+	mux.HandleFunc("/api/shutdown", g.handleShutdown)
+	mux.HandleFunc("/api/adoptable", g.handleAdoptable)
+	mux.HandleFunc("/api/cluster/pods", g.handleClusterPods)
+	mux.HandleFunc("/api/aws/profiles", g.handleAWSProfiles)
+	mux.HandleFunc("/api/aws/regions", g.handleAWSRegions)
+	mux.HandleFunc("/api/aws/rds", g.handleAWSRDS)
+	mux.HandleFunc("/api/aws/rds/import", g.handleAWSRDSImport)
+
+	if g.debug {
+		log.Warn("Debug endpoints enabled", "paths", "/debug/pprof/, /api/debug/exec/")
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		mux.HandleFunc("/api/debug/exec/", g.handleDebugExec)
+	}
 
-	g.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
+	var handler http.Handler = mux
+	if g.readOnly {
+		handler = g.refuseChanges(handler)
+		log.Info("GUI is read-only")
+	}
+	if g.oidc != nil {
+		mux.HandleFunc("/auth/login", g.handleLogin)
+		mux.HandleFunc("/auth/callback", g.handleAuthCallback)
+		mux.HandleFunc("/auth/logout", g.handleLogout)
+		handler = g.requireLogin(handler)
+		log.Info("GUI requires an OIDC login", "issuer", g.oidc.config.Issuer)
 	}
+	mux.HandleFunc("/api/session", g.handleSession)
+	if g.basePath != "" {
+		// Accept both the full path and paths already stripped by the reverse proxy
+		// (e.g. Traefik's StripPrefix); generated URLs always carry the prefix
+		root := http.NewServeMux()
+		root.Handle(g.basePath+"/", http.StripPrefix(g.basePath, handler))
+		root.Handle(g.basePath, http.RedirectHandler(g.basePath+"/", http.StatusMovedPermanently))
+		root.Handle("/", handler)
+		handler = root
+	}
+	return handler
+}
 
-	outputCtx := NewSimpleOutputContext()
-	outputCtx.Info("GUI server starting", "Aproxymate GUI starting on http://localhost:%d\n", port)
+// cleanupOrphanedPods deletes leftover relay pods of earlier sessions in the clusters this config
+// uses. It runs while the GUI serves, so it keeps the pods offered for re-attach, the pods of
+// connected proxies and pods created since startup.
+func (g *GUI) cleanupOrphanedPods(pending []AdoptablePod) {
+	offered := make(map[string]bool, len(pending))
+	for _, pod := range pending {
+		offered[pod.key()] = true
+	}
+	// Allow for the cluster's clock being behind ours; pods of proxies still connecting aren't
+	// known to the manager yet
+	createdBefore := g.startedAt.Add(-time.Minute)
+	keep := func(cluster string, pod *corev1.Pod) bool {
+		key := podKey(cluster, pod.Namespace, pod.Name)
+		return offered[key] || g.manager.hasPod(key) || !pod.CreationTimestamp.Time.Before(createdBefore)
+	}
 
-	// Start the server in a goroutine
-	go func() {
-		if err := g.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Error("GUI server failed to start", "error", err)
-		}
-	}()
+	log.Debug("Starting orphaned pod cleanup")
+	CleanupOrphanedPods(CleanupTargetsForConfigs(g.proxyConfigs()), keep, 15*time.Second)
+	log.Debug("Finished orphaned pod cleanup")
+}
 
-	// Wait for server to be ready by trying to connect to it
-	for i := 0; i < 30; i++ { // Try for up to 3 seconds
-		if g.isServerReady(port) {
-			if serverReady != nil {
-				close(serverReady)
-			}
-			log.Debug("GUI server is ready and accepting connections", "port", port)
+// listen binds the GUI port, trying the following ports when port fallback is enabled
+func (g *GUI) listen(port int) (net.Listener, error) {
+	var firstErr error
+	for attempt := 0; attempt <= g.portFallback; attempt++ {
+		listener, err := net.Listen("tcp", net.JoinHostPort(g.bindAddress, strconv.Itoa(port+attempt)))
+		if err == nil {
+			return listener, nil
+		}
+		log.Debug("GUI port unavailable", "port", port+attempt, "error", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+		// Port 0 asks the OS for any free port, so retrying can't help
+		if port == 0 || port+attempt >= 65535 {
 			break
 		}
-		time.Sleep(100 * time.Millisecond)
 	}
 
-	// Block indefinitely to keep the server running
-	select {}
+	if g.portFallback > 0 {
+		return nil, fmt.Errorf("cannot listen on ports %d-%d: %w (use --port 0 to pick any free port)", port, port+g.portFallback, firstErr)
+	}
+	return nil, fmt.Errorf("cannot listen on port %d: %w (use --port-fallback or --port 0 to pick another port)", port, firstErr)
 }
 
 // isServerReady checks if the GUI server is ready to accept connections
@@ -282,7 +866,7 @@ func (g *GUI) isServerReady(port int) bool {
 		Timeout: 50 * time.Millisecond,
 	}
 
-	url := fmt.Sprintf("http://localhost:%d/api/status", port)
+	url := fmt.Sprintf("http://%s%s/api/version", g.localAddress(port), g.basePath)
 	resp, err := client.Get(url)
 	if err != nil {
 		return false
@@ -294,48 +878,99 @@ func (g *GUI) isServerReady(port int) bool {
 
 // handleIndex serves the main HTML page
 func (g *GUI) handleIndex(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.New("index").Parse(indexHTML)
-	if err != nil {
-		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "text/html")
+	if err := guiTemplates.ExecuteTemplate(w, "index.html", g.pageData()); err != nil {
+		http.Error(w, "Template execution error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handlePageData handles GET requests for the data the GUI pages are rendered from
+func (g *GUI) handlePageData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.pageData())
+}
+
+// pageData collects the rows with their connection state and the settings the GUI pages need
+func (g *GUI) pageData() GuiData {
 	g.mu.RLock()
 	rows := make([]*ProxyRow, 0, len(g.rows))
+	snapshot := g.statusSnapshot()
 	for _, row := range g.rows {
-		rows = append(rows, row)
+		// Copy the row so the connection state can be filled in without mutating shared data
+		rows = append(rows, row.withStatus(snapshot))
 	}
 	nextID := g.nextID
+	configVersion := g.configVersion
+	strictConnect := g.strictConnect
 	g.mu.RUnlock()
 
-	// Sort rows by ID to preserve the order from the config file
-	sort.Slice(rows, func(i, j int) bool {
-		idI, errI := strconv.Atoi(rows[i].ID)
-		idJ, errJ := strconv.Atoi(rows[j].ID)
+	sortRows(rows)
+
+	return GuiData{
+		ProxyRows:     rows,
+		Groups:        groupByCluster(rows),
+		NextID:        nextID,
+		BasePath:      g.basePath,
+		ConfigVersion: configVersion,
+		StrictConnect: strictConnect,
+		ReadOnly:      g.readOnly,
+		Version:       Version,
+		AssetVersion:  assetVersion(),
+	}
+}
 
-		// If both IDs are valid numbers, sort numerically
-		if errI == nil && errJ == nil {
-			return idI < idJ
+// sortRows sorts rows to preserve the order from the config file
+func sortRows(rows []*ProxyRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].order != rows[j].order {
+			return rows[i].order < rows[j].order
 		}
-
-		// Fall back to string comparison for non-numeric IDs
 		return rows[i].ID < rows[j].ID
 	})
+}
 
-	data := GuiData{
-		ProxyRows: rows,
-		NextID:    nextID,
+// listProxies handles GET requests for the rows matching the query, cluster and connected
+// parameters, with the number of rows before filtering
+func (g *GUI) listProxies(w http.ResponseWriter, r *http.Request) {
+	filter, err := ParseProxyFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	w.Header().Set("Content-Type", "text/html")
-	if err := tmpl.Execute(w, data); err != nil {
-		http.Error(w, "Template execution error: "+err.Error(), http.StatusInternalServerError)
-		return
+	g.mu.RLock()
+	snapshot := g.statusSnapshot()
+	rows := make([]*ProxyRow, 0)
+	for _, row := range g.rows {
+		row = row.withStatus(snapshot)
+		if filter.Matches(row.toProxyConfig(), row.Connected) {
+			rows = append(rows, row)
+		}
 	}
+	total := len(g.rows)
+	g.mu.RUnlock()
+
+	sortRows(rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"proxies": rows,
+		"total":   total,
+	})
 }
 
-// handleProxy handles POST requests to create/update proxy configurations
+// handleProxy handles GET requests to list proxies and POST requests to create/update proxy
+// configurations
 func (g *GUI) handleProxy(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		g.listProxies(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -357,13 +992,30 @@ func (g *GUI) handleProxy(w http.ResponseWriter, r *http.Request) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	if g.strictConnect {
+		http.Error(w, errStrictConnectConfig.Error(), http.StatusForbidden)
+		return
+	}
+
 	row := &ProxyRow{
 		ID:                req.ID,
 		KubernetesCluster: req.KubernetesCluster,
 		RemoteHost:        req.RemoteHost,
 		LocalPort:         req.LocalPort,
 		RemotePort:        req.RemotePort,
-		Connected:         false,
+	}
+
+	// Keep settings that are only configurable in the config file, and the row's position
+	if existing, exists := g.rows[req.ID]; exists {
+		row.Config = existing.Config
+		row.order = existing.order
+		row.configured = existing.configured
+	} else {
+		// Rows added in the GUI get numbered IDs from nextID
+		row.order = g.nextID
+		if id, err := strconv.Atoi(req.ID); err == nil {
+			row.order = id
+		}
 	}
 
 	g.rows[req.ID] = row
@@ -377,31 +1029,221 @@ func (g *GUI) handleProxy(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-// handleProxyWithID handles DELETE requests for specific proxy configurations
+// handleProxyWithID handles requests for specific proxy configurations:
+// DELETE /api/proxy/{id}, GET /api/proxy/{id}/connection-string, POST /api/proxy/{id}/test and
+// GET or PUT /api/proxy/{id}/reconnect
 func (g *GUI) handleProxyWithID(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Path[len("/api/proxy/"):]
+
+	if rowID, found := strings.CutSuffix(id, "/connection-string"); found {
+		g.handleConnectionString(w, r, rowID)
+		return
+	}
+	if rowID, found := strings.CutSuffix(id, "/test"); found {
+		g.handleTestProxy(w, r, rowID)
+		return
+	}
+	if rowID, found := strings.CutSuffix(id, "/reconnect"); found {
+		g.handleReconnectPolicy(w, r, rowID)
+		return
+	}
+
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	id := r.URL.Path[len("/api/proxy/"):]
-
 	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	if row, exists := g.rows[id]; exists {
-		// Stop the proxy if it's running
-		if row.Connected && row.Process != nil {
-			row.Process.Process.Kill()
+	if g.strictConnect {
+		g.mu.Unlock()
+		http.Error(w, errStrictConnectConfig.Error(), http.StatusForbidden)
+		return
+	}
+	row, exists := g.rows[id]
+	if exists && row.Config.Protected && r.URL.Query().Get("force") != "true" {
+		g.mu.Unlock()
+		http.Error(w, fmt.Sprintf("'%s' is protected: delete it with ?force=true", row.Config.Name), http.StatusForbidden)
+		return
+	}
+	delete(g.rows, id)
+	g.mu.Unlock()
+
+	// Stop the proxy if it's running; deleting the pod can be slow, so don't hold the lock
+	if exists {
+		if err := g.manager.Disconnect(id); err != nil && !errors.Is(err, ErrProxyNotConnected) {
+			log.Warn("Failed to disconnect proxy before deleting row", "id", id, "error", err)
 		}
-		delete(g.rows, id)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-// handleConnect handles POST requests to start a proxy connection
+// handleReconnectPolicy handles GET and PUT requests for a proxy's reconnect policy. PUT replaces
+// the proxy's overrides of the global policy; they are written by the next config save and apply
+// to a connected proxy from its next drop.
+func (g *GUI) handleReconnectPolicy(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var policy ReconnectPolicy
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := policy.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	g.mu.Lock()
+	row, exists := g.rows[id]
+	if !exists {
+		g.mu.Unlock()
+		http.Error(w, "Proxy not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPut {
+		if g.strictConnect {
+			g.mu.Unlock()
+			http.Error(w, errStrictConnectConfig.Error(), http.StatusForbidden)
+			return
+		}
+		updated := *row
+		updated.Config.Reconnect = policy
+		g.rows[id] = &updated
+	} else {
+		policy = row.Config.Reconnect
+	}
+	g.mu.Unlock()
+
+	if r.Method == http.MethodPut {
+		g.manager.SetReconnectPolicy(id, policy)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"policy":    policy,
+		"effective": g.manager.ReconnectPolicy(policy),
+	})
+}
+
+// handleTestProxy handles POST requests running the preflight checks of a proxy without connecting it.
+// The body may carry the row's unsaved cluster, host and ports, like a connect request.
+func (g *GUI) handleTestProxy(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		KubernetesCluster string `json:"cluster"`
+		RemoteHost        string `json:"host"`
+		LocalPort         int    `json:"localPort"`
+		RemotePort        int    `json:"remotePort"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	g.mu.RLock()
+	row, exists := g.rows[id]
+	var config ProxyConfig
+	if exists {
+		config = row.toProxyConfig()
+	}
+	g.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Proxy not found", http.StatusNotFound)
+		return
+	}
+	if req.KubernetesCluster != "" {
+		config.KubernetesCluster = req.KubernetesCluster
+	}
+	if req.RemoteHost != "" {
+		config.RemoteHost = req.RemoteHost
+	}
+	if req.LocalPort != 0 {
+		config.LocalPort = req.LocalPort
+	}
+	if req.RemotePort != 0 {
+		config.RemotePort = req.RemotePort
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	result := g.manager.Preflight(ctx, NewProxySpec(id, config))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleConnectionString handles GET requests for a ready-to-paste connection string to a proxy
+func (g *GUI) handleConnectionString(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.mu.RLock()
+	row, exists := g.rows[id]
+	var config ProxyConfig
+	if exists {
+		config = row.toProxyConfig()
+	}
+	g.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Proxy not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := ConnectionStringOptions{
+		Format:   query.Get("format"),
+		User:     query.Get("user"),
+		Database: query.Get("database"),
+	}
+
+	// Connected proxies with a vault role come with their own database user
+	creds, err := g.manager.Credentials(id)
+	if err != nil && !errors.Is(err, ErrProxyNotConnected) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if creds != nil && opts.User == "" {
+		opts.User = creds.Username
+		opts.Password = creds.Password
+	}
+
+	connectionString, err := BuildConnectionString(config, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]any{
+		"connectionString": connectionString,
+		"engine":           config.ResolvedEngine(),
+	}
+	if creds != nil {
+		response["credentials"] = creds
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleConnect handles POST requests to start a proxy connection. It returns 202 with an
+// operation ID once the connect is registered; pod creation and the port-forward run in the
+// background and report their progress as connect_progress events.
 func (g *GUI) handleConnect(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -428,9 +1270,13 @@ func (g *GUI) handleConnect(w http.ResponseWriter, r *http.Request) {
 		"remote_port", req.RemotePort)
 
 	g.mu.Lock()
-	defer g.mu.Unlock()
-
 	row, exists := g.rows[req.ID]
+	if err := g.checkStrictConnect(row, req.KubernetesCluster, req.RemoteHost, req.LocalPort, req.RemotePort); err != nil {
+		g.mu.Unlock()
+		log.Warn("Refused connect request in strict connect mode", "id", req.ID, "error", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if !exists {
 		row = &ProxyRow{
 			ID:                req.ID,
@@ -441,537 +1287,1609 @@ func (g *GUI) handleConnect(w http.ResponseWriter, r *http.Request) {
 		}
 		g.rows[req.ID] = row
 	}
+	config := row.Config
+	g.mu.Unlock()
+
+	config.KubernetesCluster = req.KubernetesCluster
+	config.RemoteHost = req.RemoteHost
+	config.LocalPort = req.LocalPort
+	config.RemotePort = req.RemotePort
+
+	spec := NewProxySpec(req.ID, config)
+	spec.OperationID = rand.Text()
+	spec.User = g.requestUser(r)
+	err := g.manager.ConnectAsync(spec)
+	if err != nil {
+		var portErr *LocalPortError
+		switch {
+		case errors.As(err, &portErr):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":  portErr.Message,
+				"port":   portErr.Port,
+				"reason": portErr.Reason,
+			})
+		case errors.Is(err, ErrProxyAlreadyConnected):
+			http.Error(w, "Proxy already connected", http.StatusBadRequest)
+		case errors.Is(err, ErrProxyConnecting):
+			// Join the connect in progress, e.g. when "connect all" repeats a request
+			progress, connecting := g.manager.Connecting()[req.ID]
+			if !connecting {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]any{
+				"status":      string(ProxyStateConnecting),
+				"id":          req.ID,
+				"operationId": progress.OperationID,
+				"coalesced":   true,
+			})
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":      string(ProxyStateConnecting),
+		"id":          req.ID,
+		"operationId": spec.OperationID,
+	})
+}
+
+// handleDisconnect handles POST requests to stop a proxy connection
+func (g *GUI) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Path[len("/api/disconnect/"):]
+
+	g.mu.RLock()
+	var rowCopy ProxyRow
+	var availableIDs []string
+	row, exists := g.rows[id]
+	if exists {
+		rowCopy = *row
+	} else {
+		for k := range g.rows {
+			availableIDs = append(availableIDs, k)
+		}
+	}
+	g.mu.RUnlock()
+
+	if !exists {
+		log.Warn("Disconnect request for non-existent row", "requested_id", id, "available_ids", availableIDs)
+		http.Error(w, "Proxy not found", http.StatusBadRequest)
+		return
+	}
+	row = &rowCopy
+
+	log.Info("Disconnect request received",
+		"id", id,
+		"cluster", row.KubernetesCluster,
+		"host", row.RemoteHost,
+		"local_port", row.LocalPort,
+		"remote_port", row.RemotePort)
+
+	// Don't pull the tunnel from under clients, e.g. a running migration, without confirmation
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	if open, err := g.manager.OpenConnections(id); err == nil && len(open) > 0 && !force {
+		log.Info("Disconnect needs confirmation, proxy has open client connections", "id", id, "connections", len(open))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":      "requires_force",
+			"error":       fmt.Sprintf("%d client connection(s) are using this proxy; disconnect with force=true to close them", len(open)),
+			"connections": open,
+		})
+		return
+	}
+
+	if err := g.manager.Disconnect(id); err != nil {
+		if errors.Is(err, ErrProxyNotConnected) {
+			log.Warn("Disconnect request for already disconnected proxy", "id", id)
+			http.Error(w, "Proxy not connected", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleContexts handles GET requests to fetch available Kubernetes contexts
+func (g *GUI) handleContexts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contexts, err := GetKubernetesContexts("")
+	if err != nil {
+		http.Error(w, "Failed to get contexts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"contexts": contexts})
+}
+
+// handleContextWithName handles GET /api/contexts/{name}/ping, reporting whether the context's
+// API server is reachable and accepts the user's credentials. Results are cached for a short
+// while; ?refresh=true checks again.
+func (g *GUI) handleContextWithName(w http.ResponseWriter, r *http.Request) {
+	// Context names may contain slashes, e.g. EKS ARNs, so only the last segment is the action
+	name, found := strings.CutSuffix(r.URL.Path[len("/api/contexts/"):], "/ping")
+	if !found || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contexts, err := GetKubernetesContexts("")
+	if err != nil {
+		http.Error(w, "Failed to get contexts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !slices.Contains(contexts, name) {
+		http.Error(w, fmt.Sprintf("Context '%s' not found in kubeconfig", name), http.StatusNotFound)
+		return
+	}
+
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	health := g.contextHealth.get(r.Context(), name, refresh)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+// saveConfigRequest is the body of /api/config/save and /api/config/preview
+type saveConfigRequest struct {
+	OrderedRows []struct {
+		ID         string `json:"id"`
+		Order      int    `json:"order"`
+		Cluster    string `json:"cluster"`
+		Host       string `json:"host"`
+		LocalPort  int    `json:"localPort"`
+		RemotePort int    `json:"remotePort"`
+	} `json:"orderedRows"`
+	// RemoveProtected confirms removing these protected entries
+	RemoveProtected []string `json:"removeProtected"`
+}
+
+// configsForSave builds the proxy configs a save writes, in the order given by the frontend
+// or in arbitrary order without one, and returns the IDs of their rows. Caller must hold g.mu.
+func (g *GUI) configsForSave(req saveConfigRequest) ([]ProxyConfig, []string) {
+	var configs []ProxyConfig
+	var ids []string
+
+	if len(req.OrderedRows) > 0 {
+		// Use ordered rows from frontend
+		log.Debug("Saving configuration with preserved order", "ordered_rows", len(req.OrderedRows))
+
+		// Sort by order field to ensure correct sequence
+		orderedRows := req.OrderedRows
+		for i := 0; i < len(orderedRows); i++ {
+			for j := i + 1; j < len(orderedRows); j++ {
+				if orderedRows[i].Order > orderedRows[j].Order {
+					orderedRows[i], orderedRows[j] = orderedRows[j], orderedRows[i]
+				}
+			}
+		}
+
+		// Convert ordered rows to config format
+		for _, orderedRow := range orderedRows {
+			// Skip empty configurations
+			if orderedRow.Cluster == "" && orderedRow.Host == "" && orderedRow.LocalPort == 0 && orderedRow.RemotePort == 0 {
+				continue
+			}
+
+			row := &ProxyRow{
+				KubernetesCluster: orderedRow.Cluster,
+				RemoteHost:        orderedRow.Host,
+				LocalPort:         orderedRow.LocalPort,
+				RemotePort:        orderedRow.RemotePort,
+			}
+			if existing, exists := g.rows[orderedRow.ID]; exists {
+				row.Config = existing.Config
+			}
+			configs = append(configs, row.toProxyConfig())
+			ids = append(ids, orderedRow.ID)
+		}
+	} else {
+		// Fall back to current rows (arbitrary order)
+		log.Debug("No order specified, saving rows in arbitrary order", "row_count", len(g.rows))
+		for _, row := range g.rows {
+			// Skip empty configurations
+			if row.KubernetesCluster == "" && row.RemoteHost == "" && row.LocalPort == 0 && row.RemotePort == 0 {
+				continue
+			}
+
+			configs = append(configs, row.toProxyConfig())
+			ids = append(ids, row.ID)
+		}
+	}
+	return configs, ids
+}
+
+// saveConfigPath returns the file a save writes to. Caller must hold g.mu.
+func (g *GUI) saveConfigPath() string {
+	if !g.configFileLoaded {
+		return GetLocalConfigPath()
+	}
+	return viper.ConfigFileUsed()
+}
+
+// writeConfig saves the proxy configs to the config file and records its new version and the
+// new source lines of the entries. Caller must hold g.mu.
+func (g *GUI) writeConfig(path string, configs []ProxyConfig, expectedVersion string) error {
+	if g.environment != "" {
+		return fmt.Errorf("%w %q; edit its entries in the config file instead", ErrEnvironmentSelected, g.environment)
+	}
+	version, err := SaveProxyConfigs(path, configs, expectedVersion)
+	if err != nil {
+		return err
+	}
+	g.configVersion = version
+
+	// Saving may move entries to other lines
+	saved := AppConfig{ProxyConfigs: configs}
+	if err := saved.AnnotateSources(path); err != nil {
+		log.Debug("Could not record where the proxy entries are written", "file", path, "error", err)
+	}
+	return nil
+}
+
+// handleConfigPreview handles POST requests returning the YAML a save would write and how it
+// differs from the current file, without writing anything
+func (g *GUI) handleConfigPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req saveConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Debug("No ordered rows data provided, using current rows", "error", err)
+	}
+
+	g.mu.RLock()
+	configs, _ := g.configsForSave(req)
+	path := g.saveConfigPath()
+	g.mu.RUnlock()
+
+	existing, _, err := readConfigFile(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := RenderProxyConfigs(existing, configs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to render configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	current, err := ReadProxyConfigsFile(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	diff := DiffProxyConfigs(current, configs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"path":    GetAbsolutePathForDisplay(path),
+		"yaml":    string(data),
+		"diff":    diff,
+		"summary": diff.Summary(),
+	})
+}
+
+// handleSaveConfig handles saving the current configuration to file
+func (g *GUI) handleSaveConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if we have ordered rows data from the frontend
+	var orderedRowsRequest saveConfigRequest
+
+	// Try to decode the request body
+	if err := json.NewDecoder(r.Body).Decode(&orderedRowsRequest); err != nil {
+		// If JSON decode fails, fall back to using current rows in arbitrary order
+		log.Debug("No ordered rows data provided, using current rows", "error", err)
+	}
+
+	// Saving updates configFileLoaded and viper's global state, so take the write lock
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.strictConnect {
+		http.Error(w, errStrictConnectConfig.Error(), http.StatusForbidden)
+		return
+	}
+
+	configs, ids := g.configsForSave(orderedRowsRequest)
+
+	// Detect changes made since this page (If-Match) or the GUI loaded the file;
+	// ?force=true overwrites them
+	expectedVersion := strings.Trim(r.Header.Get("If-Match"), `"`)
+	if expectedVersion == "" {
+		expectedVersion = g.configVersion
+	}
+	if r.URL.Query().Get("force") == "true" {
+		expectedVersion = ""
+	}
+
+	configFile := g.saveConfigPath()
+	savedConfigFile := GetAbsolutePathForDisplay(configFile)
+	if !g.configFileLoaded {
+		log.Info("No config file was loaded on startup, saving to default location", "file", savedConfigFile)
+	}
+
+	// Protected entries are only removed when the request names them; ?force=true doesn't
+	// confirm them, as it only overwrites changes made elsewhere
+	current, err := ReadProxyConfigsFile(configFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var unconfirmed []string
+	for _, name := range DiffProxyConfigs(current, configs).RemovedProtected {
+		if !slices.Contains(orderedRowsRequest.RemoveProtected, name) {
+			unconfirmed = append(unconfirmed, name)
+		}
+	}
+	if len(unconfirmed) > 0 {
+		http.Error(w, fmt.Sprintf("Not saved: the save removes protected entries (%s). Confirm removing them in removeProtected.",
+			strings.Join(unconfirmed, ", ")), http.StatusForbidden)
+		return
+	}
+
+	if err := g.writeConfig(configFile, configs, expectedVersion); err != nil {
+		if errors.Is(err, ErrEnvironmentSelected) {
+			http.Error(w, fmt.Sprintf("Not saved: %v", err), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, ErrConfigConflict) {
+			log.Warn("Config file changed since it was loaded, not saving", "file", savedConfigFile)
+			http.Error(w, fmt.Sprintf("%s: %v. Reload the page to pick up the changes, or save again to overwrite them.", savedConfigFile, err), http.StatusConflict)
+			return
+		}
+		log.Error("Error saving configuration", "file", configFile, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to save configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	viper.Set("proxy_configs", configs)
+
+	// Keep the rows in the saved order and with the saved entries; their IDs don't change
+	for i, id := range ids {
+		if row, exists := g.rows[id]; exists {
+			saved := *row
+			saved.Config = configs[i]
+			saved.order = i + 1
+			g.rows[id] = &saved
+		}
+	}
+
+	// Now that we've saved a config file, mark it as loaded for future saves
+	// and set viper to use this file
+	if !g.configFileLoaded {
+		viper.SetConfigFile(configFile)
+		g.configFileLoaded = true
+	}
+
+	log.Info("Configuration saved successfully", "proxy_configs", len(configs), "file", savedConfigFile, "order_preserved", len(orderedRowsRequest.OrderedRows) > 0)
+	g.notices.add(NoticeSuccess, "", "Configuration saved to %s", savedConfigFile)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+g.configVersion+`"`)
+	response := map[string]string{"status": "success", "message": "Configuration saved successfully", "version": g.configVersion}
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleConfigLocation handles GET requests to retrieve the current config file location
+func (g *GUI) handleConfigLocation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	location := g.GetConfigSaveLocation()
+	nextSaveLocation := GetLocalConfigPath()
+
+	if g.configFileLoaded {
+		configFile := viper.ConfigFileUsed()
+		if configFile != "" {
+			nextSaveLocation = configFile
+		}
+	}
+
+	// Convert nextSaveLocation to absolute path for consistent display
+	absNextSaveLocation := GetAbsolutePathForDisplay(nextSaveLocation)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"location":         location,
+		"nextSaveLocation": absNextSaveLocation,
+		"loaded":           fmt.Sprintf("%t", g.configFileLoaded),
+	})
+}
+
+// handleConfigValidation handles GET requests for the issues found in the proxy entries when the
+// config file was last loaded
+func (g *GUI) handleConfigValidation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.mu.RLock()
+	report := g.validation
+	g.mu.RUnlock()
+	if report.Issues == nil {
+		report.Issues = []ConfigValidationIssue{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleStatus handles GET requests to check the status of all proxies
+func (g *GUI) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.statusPayload())
+}
+
+// statusPayload is the body of /api/status, also sent as "status" events by /api/stream.
+// "status" keeps the plain connected flags for older clients.
+func (g *GUI) statusPayload() map[string]any {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	snapshot := g.statusSnapshot()
+	status := make(map[string]bool)
+	proxies := make(map[string]*ProxyRow)
+	for id, row := range g.rows {
+		proxies[id] = row.withStatus(snapshot)
+		status[id] = proxies[id].Connected
+	}
+
+	return map[string]any{
+		"status":  status,
+		"proxies": proxies,
+	}
+}
+
+// handleStream handles GET requests for a Server-Sent Events stream carrying "status"
+// (the /api/status payload), "proxy" (lifecycle events) and "notice" (toasts) events.
+// It is an alternative to polling that works through most corporate proxies.
+func (g *GUI) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Ask nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	events, unsubscribe := g.manager.Subscribe()
+	defer unsubscribe()
+
+	_, lastNotice, noticesChanged := g.notices.after(0)
+
+	// Status is also sent periodically for uptime and pod details, which change without events
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	send := func(event string, data any) bool {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			log.Error("Failed to encode stream event", "event", event, "error", err)
+			return true
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	if !send("status", g.statusPayload()) {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-g.notices.closed:
+			return
+		case event, ok := <-events:
+			if !ok || !send("proxy", event) || !send("status", g.statusPayload()) {
+				return
+			}
+		case <-noticesChanged:
+			var notices []Notice
+			notices, lastNotice, noticesChanged = g.notices.after(lastNotice)
+			for _, notice := range notices {
+				if !send("notice", notice) {
+					return
+				}
+			}
+		case <-ticker.C:
+			if !send("status", g.statusPayload()) {
+				return
+			}
+		}
+	}
+}
+
+// handleEvents handles GET requests for the proxy event history. Optional filters:
+// proxy (ID), type (comma-separated event types), since (RFC 3339) and limit.
+func (g *GUI) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := EventFilter{ProxyID: query.Get("proxy")}
+	if types := query.Get("type"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			filter.Types = append(filter.Types, ProxyEventType(strings.TrimSpace(eventType)))
+		}
+	}
+	if since := query.Get("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 timestamp, e.g. 2024-05-01T14:30:00Z", http.StatusBadRequest)
+			return
+		}
+		filter.Since = parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 0 {
+			http.Error(w, "limit must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"events": g.manager.Events(filter),
+	})
+}
+
+// handleNotifications handles GET requests for user-facing notices (long-poll). Clients pass the
+// last seen ID as after and wait up to wait seconds (default 25) for newer notices. Without after,
+// only the current ID is returned so clients start with new notices.
+func (g *GUI) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("after") == "" {
+		_, lastID, _ := g.notices.after(0)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"notices": []Notice{}, "last": lastID})
+		return
+	}
+
+	after, err := strconv.ParseInt(query.Get("after"), 10, 64)
+	if err != nil {
+		http.Error(w, "after must be a notice ID", http.StatusBadRequest)
+		return
+	}
+	wait := 25 * time.Second
+	if value := query.Get("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 || seconds > 60 {
+			http.Error(w, "wait must be between 0 and 60 seconds", http.StatusBadRequest)
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	notices, lastID := g.notices.wait(r.Context(), after, wait)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"notices": notices, "last": lastID})
+}
+
+// GuiSummary is a compact overview of the proxies, designed for menu-bar companions
+type GuiSummary struct {
+	Version   string           `json:"version"`
+	Total     int              `json:"total"`
+	Connected int              `json:"connected"`
+	Failed    int              `json:"failed"`
+	Favorites []FavoriteStatus `json:"favorites"`
+}
+
+// FavoriteStatus is the state of a proxy marked as favorite in the config
+type FavoriteStatus struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Summary returns counts of connected and failed proxies and the state of favorite proxies
+func (g *GUI) Summary() GuiSummary {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	connected := g.manager.Status()
+	failures := g.manager.Failures()
+
+	summary := GuiSummary{Version: Version, Favorites: []FavoriteStatus{}}
+	for id, row := range g.rows {
+		if row.KubernetesCluster == "" && row.RemoteHost == "" {
+			continue
+		}
+		summary.Total++
+
+		_, isConnected := connected[id]
+		failure, isFailed := failures[id]
+		if isConnected {
+			summary.Connected++
+		} else if isFailed {
+			summary.Failed++
+		}
+
+		if row.Config.Favorite {
+			name := row.Config.Name
+			if name == "" {
+				name = fmt.Sprintf("%s:%d", row.RemoteHost, row.LocalPort)
+			}
+			summary.Favorites = append(summary.Favorites, FavoriteStatus{
+				ID:        id,
+				Name:      name,
+				Connected: isConnected,
+				Error:     failure.Message,
+			})
+		}
+	}
+
+	sort.Slice(summary.Favorites, func(i, j int) bool {
+		return summary.Favorites[i].Name < summary.Favorites[j].Name
+	})
+
+	return summary
+}
+
+// ToggleProxy connects the proxy if it is disconnected and disconnects it otherwise
+func (g *GUI) ToggleProxy(id string) error {
+	g.mu.RLock()
+	row, exists := g.rows[id]
+	var config ProxyConfig
+	var strictErr error
+	if exists {
+		config = row.toProxyConfig()
+		config.Name = row.Config.Name
+		strictErr = g.checkStrictConnect(row, row.KubernetesCluster, row.RemoteHost, row.LocalPort, row.RemotePort)
+	}
+	g.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("proxy %s not found", id)
+	}
+
+	// Toggling a connecting proxy cancels the connect
+	if g.manager.State(id) != ProxyStateStopped {
+		return g.manager.Disconnect(id)
+	}
+	if strictErr != nil {
+		return strictErr
+	}
+	return g.manager.Connect(NewProxySpec(id, config))
+}
+
+// handleSummary handles GET requests for the compact proxy overview
+func (g *GUI) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.Summary())
+}
+
+// handleStats handles GET requests for the recorded usage of each proxy over the last
+// days (query parameter, default 30) and the estimated relay pod cost
+func (g *GUI) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := 30
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > usageRetentionDays {
+			http.Error(w, fmt.Sprintf("Invalid days: must be between 1 and %d", usageRetentionDays), http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	history, err := LoadUsageHistory()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	g.mu.RLock()
+	names := make([]string, 0, len(g.rows))
+	for id, row := range g.rows {
+		if row.KubernetesCluster == "" && row.RemoteHost == "" {
+			continue
+		}
+		config := row.Config
+		config.KubernetesCluster = row.KubernetesCluster
+		config.RemoteHost = row.RemoteHost
+		config.LocalPort = row.LocalPort
+		config.RemotePort = row.RemotePort
+		names = append(names, usageKey(NewProxySpec(id, config)))
+	}
+	cost := g.cost
+	g.mu.RUnlock()
+
+	usage := history.Summarize(names, days, time.Now())
+	estimate := cost.EstimateCost(usage, g.manager.Status())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"days":    days,
+		"proxies": usage,
+		"cost":    estimate,
+	})
+}
+
+// handleVersion handles GET requests for build information
+func (g *GUI) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetBuildInfo())
+}
+
+// Phases of the GUI server reported by /readyz
+const (
+	guiPhaseStarting = "starting"
+	guiPhaseReady    = "ready"
+	guiPhaseStopping = "stopping"
+)
+
+// setPhase records the phase reported by /readyz
+func (g *GUI) setPhase(phase string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.phase = phase
+}
+
+// handleHealthz handles liveness probes: the process is up and serving requests
+func (g *GUI) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadyz handles readiness probes: 200 once startup has finished, 503 before that and
+// while shutting down. Like /healthz it reveals nothing about the proxies.
+func (g *GUI) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.mu.RLock()
+	phase := g.phase
+	g.mu.RUnlock()
+	if phase == "" {
+		phase = guiPhaseStarting
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if phase != guiPhaseReady {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": phase})
+}
+
+// handleUpdate handles GET requests for the latest release, when update checks are enabled
+func (g *GUI) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.mu.RLock()
+	enabled := g.updateCheck
+	g.mu.RUnlock()
+
+	status := &UpdateStatus{Current: Version}
+	if enabled {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var err error
+		if status, err = CheckForUpdate(ctx); err != nil {
+			log.Debug("Update check failed", "error", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleAdoptable lists relay pods awaiting a re-attach decision (GET) or applies the decision
+// to all of them (POST with {"action": "adopt"} or {"action": "delete"})
+func (g *GUI) handleAdoptable(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		g.mu.RLock()
+		pods := append([]AdoptablePod{}, g.adoptable...)
+		g.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"pods": pods})
+
+	case http.MethodPost:
+		var req struct {
+			Action string `json:"action"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Action != "adopt" && req.Action != "delete" {
+			http.Error(w, "action must be adopt or delete", http.StatusBadRequest)
+			return
+		}
+
+		g.mu.Lock()
+		pods := g.adoptable
+		g.adoptable = nil
+		g.mu.Unlock()
+
+		var failures []string
+		if req.Action == "adopt" {
+			failures = g.adoptPods(pods)
+		} else {
+			for _, pod := range pods {
+				deleteAdoptablePod(pod)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"processed": len(pods), "errors": failures})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ClusterPod is an aproxymate pod shown in the cluster view
+type ClusterPod struct {
+	ManagedPod
+	// Mine is set for pods created by the current user
+	Mine bool `json:"mine"`
+	// Deletable is set when the current user may delete the pod from the GUI
+	Deletable bool `json:"deletable"`
+}
+
+// handleClusterPods lists every user's aproxymate pods in a cluster (GET ?context=) or deletes
+// one (DELETE ?context=&namespace=&name=). Other users' pods can only be deleted when admin
+// deletion is enabled.
+func (g *GUI) handleClusterPods(w http.ResponseWriter, r *http.Request) {
+	cluster := r.URL.Query().Get("context")
+	if cluster == "" {
+		http.Error(w, "context is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		pods, errs := FindManagedPods(PodFilter{Targets: CleanupTargets{cluster: {""}}, AllUsers: true}, 15*time.Second)
+		if len(errs) > 0 {
+			// Listing across namespaces is often forbidden; fall back to the configured namespaces
+			log.Debug("Cluster-wide pod listing failed, using configured namespaces", "context", cluster, "error", errs[0])
+			namespaces := CleanupTargetsForConfigs(g.proxyConfigs())[cluster]
+			if len(namespaces) == 0 {
+				namespaces = []string{DefaultNamespace()}
+			}
+			pods, errs = FindManagedPods(PodFilter{Targets: CleanupTargets{cluster: namespaces}, AllUsers: true}, 15*time.Second)
+		}
+		if len(errs) > 0 && len(pods) == 0 {
+			http.Error(w, errs[0].Error(), http.StatusBadGateway)
+			return
+		}
+
+		user := requestLabelUser(g.requestUser(r))
+		result := make([]ClusterPod, len(pods))
+		for i, pod := range pods {
+			mine := pod.User == user
+			result[i] = ClusterPod{ManagedPod: pod, Mine: mine, Deletable: mine || g.adminPodDeletion}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"context": cluster, "pods": result})
+
+	case http.MethodDelete:
+		namespace := r.URL.Query().Get("namespace")
+		name := r.URL.Query().Get("name")
+		if namespace == "" || name == "" {
+			http.Error(w, "namespace and name are required", http.StatusBadRequest)
+			return
+		}
+
+		if err := DeleteManagedPod(cluster, namespace, name, g.requestUser(r), g.adminPodDeletion); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrNotPodOwner) {
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAWSProfiles lists the profiles of the AWS config file
+func (g *GUI) handleAWSProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profiles, err := ParseAWSProfiles()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	current := os.Getenv("AWS_PROFILE")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"profiles": profiles, "current": current})
+}
+
+// handleAWSRegions lists the regions RDS endpoints can be imported from
+func (g *GUI) handleAWSRegions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"regions": AWSRegions(), "current": os.Getenv("AWS_REGION")})
+}
+
+// RDSEndpointChoice is an RDS endpoint offered for import by the GUI
+type RDSEndpointChoice struct {
+	RDSEndpoint
+	// Name is the name the proxy entry gets when imported
+	Name string `json:"name"`
+	// Imported is set when a row already points at the endpoint
+	Imported bool `json:"imported"`
+}
+
+// handleAWSRDS handles GET ?profile=&region= requests listing the available RDS endpoints of an
+// account, optionally filtered by comma-separated engines and names
+func (g *GUI) handleAWSRDS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	awsConfig := AWSConfig{Profile: query.Get("profile"), Region: query.Get("region")}
+	if valid, err := ValidateAWSProfile(awsConfig.Profile); err != nil || !valid {
+		http.Error(w, fmt.Sprintf("AWS profile '%s' not found", awsConfig.Profile), http.StatusBadRequest)
+		return
+	}
+	if !ValidateAWSRegion(awsConfig.Region) {
+		http.Error(w, fmt.Sprintf("AWS region '%s' not supported (only US regions are supported)", awsConfig.Region), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	endpoints, err := GetAWSRDSEndpoints(ctx, awsConfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if engines := query.Get("engines"); engines != "" {
+		endpoints = FilterRDSEndpointsByEngine(endpoints, strings.Split(strings.ReplaceAll(engines, " ", ""), ","))
+	}
+	if names := query.Get("names"); names != "" {
+		endpoints = FilterRDSEndpointsByName(endpoints, strings.Split(strings.ReplaceAll(names, " ", ""), ","))
+	}
+	endpoints = FilterRDSEndpointsByStatus(endpoints, []string{"available", "running"})
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Identifier < endpoints[j].Identifier
+	})
+
+	existing := make(map[string]bool)
+	for _, config := range g.proxyConfigs() {
+		existing[fmt.Sprintf("%s:%d", config.RemoteHost, config.RemotePort)] = true
+	}
+
+	choices := make([]RDSEndpointChoice, len(endpoints))
+	for i, endpoint := range endpoints {
+		choices[i] = RDSEndpointChoice{
+			RDSEndpoint: endpoint,
+			Name:        generateProxyConfigName(endpoint),
+			Imported:    existing[fmt.Sprintf("%s:%d", endpoint.Endpoint, endpoint.Port)],
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"profile": awsConfig.Profile, "region": awsConfig.Region, "endpoints": choices})
+}
+
+// handleAWSRDSImport handles POST requests adding rows for the selected RDS endpoints. Endpoints
+// that a row already points at are skipped, and new rows get free local ports from the port
+// range. The rows are saved with the rest of the configuration.
+func (g *GUI) handleAWSRDSImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		KubernetesCluster string        `json:"cluster"`
+		Endpoints         []RDSEndpoint `json:"endpoints"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.KubernetesCluster == "" {
+		http.Error(w, "cluster is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Endpoints) == 0 {
+		http.Error(w, "no endpoints selected", http.StatusBadRequest)
+		return
+	}
+
+	g.mu.Lock()
+	if g.strictConnect {
+		g.mu.Unlock()
+		http.Error(w, errStrictConnectConfig.Error(), http.StatusForbidden)
+		return
+	}
+	existing := make([]ProxyConfig, 0, len(g.rows))
+	for _, row := range g.rows {
+		existing = append(existing, row.toProxyConfig())
+	}
+	startingPort := GetStartingPortForAWSConfigs(existing, g.portPolicy)
+	newConfigs := ConvertRDSEndpointsToProxyConfigs(req.Endpoints, req.KubernetesCluster, startingPort)
+	added := MergeProxyConfigs(existing, newConfigs, g.portPolicy)[len(existing):]
+
+	used := make(map[string]bool, len(g.rows))
+	for id := range g.rows {
+		used[id] = true
+	}
+	ids := stableRowIDs(added, used)
+	rows := make([]*ProxyRow, 0, len(added))
+	for i, config := range added {
+		id := ids[i]
+		row := &ProxyRow{
+			ID:                id,
+			KubernetesCluster: config.KubernetesCluster,
+			RemoteHost:        config.RemoteHost,
+			LocalPort:         config.LocalPort,
+			RemotePort:        config.RemotePort,
+			Config:            config,
+			order:             g.nextID,
+		}
+		g.nextID++
+		g.rows[id] = row
+		rows = append(rows, row)
+	}
+	g.mu.Unlock()
+
+	log.Debug("Imported RDS endpoints from the GUI", "cluster", req.KubernetesCluster, "selected", len(req.Endpoints), "added", len(rows))
+	if len(rows) > 0 {
+		g.notices.add(NoticeSuccess, "", "Imported %d RDS endpoint(s); save the configuration to keep them", len(rows))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"rows": rows, "skipped": len(req.Endpoints) - len(rows)})
+}
+
+// requireLogin passes on requests of logged-in users, public paths and requests with the
+// instance token. Pages redirect to the login; API calls get 401.
+func (g *GUI) requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if oidcPublicPath(r.URL.Path) || g.oidc.session(r) != nil || (g.instance != nil && g.instance.authorized(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/debug/") {
+			http.Error(w, "Login required", http.StatusUnauthorized)
+			return
+		}
+		returnTo := g.basePath + r.URL.RequestURI()
+		http.Redirect(w, r, g.basePath+"/auth/login?return="+url.QueryEscape(returnTo), http.StatusFound)
+	})
+}
+
+// handleLogin starts an OIDC login: the PKCE verifier, state and nonce are kept in a signed
+// cookie and the browser is sent to the provider
+func (g *GUI) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metadata, err := g.oidc.providerMetadata(r.Context())
+	if err != nil {
+		log.Error("OIDC provider unavailable", "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// Only return to paths of this GUI, never to another site
+	returnTo := r.URL.Query().Get("return")
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		returnTo = g.basePath + "/"
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	flow := oidcFlow{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+		Return:   returnTo,
+		Expires:  time.Now().Add(oidcFlowTimeout),
+	}
+	value, err := g.oidc.sign(flow)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setCookie(w, r, g.basePath, oidcFlowCookie, value, flow.Expires)
+
+	config := g.oidc.oauth2Config(r, g.basePath, metadata)
+	http.Redirect(w, r, config.AuthCodeURL(state, oauth2.S256ChallengeOption(flow.Verifier), oauth2.SetAuthURLParam("nonce", nonce)), http.StatusFound)
+}
+
+// handleAuthCallback completes an OIDC login: the code is exchanged with the PKCE verifier, the
+// ID token is checked and the user gets a session cookie
+func (g *GUI) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		http.Error(w, fmt.Sprintf("Login failed: %s %s", providerErr, query.Get("error_description")), http.StatusForbidden)
+		return
+	}
 
-	if row.Connected {
-		http.Error(w, "Proxy already connected", http.StatusBadRequest)
+	var flow oidcFlow
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err == nil {
+		err = g.oidc.verify(cookie.Value, &flow)
+	}
+	if err != nil || time.Now().After(flow.Expires) || query.Get("state") != flow.State {
+		http.Error(w, "Login expired or was started elsewhere; please try again", http.StatusBadRequest)
 		return
 	}
+	setCookie(w, r, g.basePath, oidcFlowCookie, "", time.Time{})
 
-	// Create Kubernetes client
-	kubeClient, err := GetKubernetesClient(KubeConfig{
-		Context: req.KubernetesCluster,
-	})
+	metadata, err := g.oidc.providerMetadata(r.Context())
 	if err != nil {
-		log.Error("Failed to create Kubernetes client", "cluster", req.KubernetesCluster, "error", err)
-		http.Error(w, fmt.Sprintf("Cannot connect to Kubernetes cluster '%s'. Please check if the cluster is accessible and your kubeconfig is valid. Error: %v", req.KubernetesCluster, err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
-
-	// Generate unique pod name with username
-	username := getSafeUsername()
-	podName := fmt.Sprintf("aproxymate-%s-%s-%d", username, req.ID, time.Now().Unix())
-	namespace := "default" // You might want to make this configurable
-
-	// Create socat proxy pod configuration
-	socatConfig := SocatProxyConfig{
-		PodName:    podName,
-		Namespace:  namespace,
-		ListenPort: req.RemotePort, // The port the socat pod will listen on
-		RemoteHost: req.RemoteHost,
-		RemotePort: req.RemotePort,
+	config := g.oidc.oauth2Config(r, g.basePath, metadata)
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+	token, err := config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		log.Error("OIDC code exchange failed", "error", err)
+		http.Error(w, "Login failed: the identity provider did not accept the login", http.StatusBadGateway)
+		return
 	}
-
-	log.Info("Creating socat proxy pod",
-		"pod", podName,
-		"namespace", namespace,
-		"target_host", req.RemoteHost,
-		"target_port", req.RemotePort)
-
-	// Create the socat proxy pod
-	pod, err := CreateSocatProxyPod(kubeClient, socatConfig)
+	rawIDToken, _ := token.Extra("id_token").(string)
+	claims, err := g.oidc.parseIDToken(rawIDToken, metadata.Issuer, flow.Nonce)
 	if err != nil {
-		log.Error("Failed to create socat proxy pod", "pod", podName, "cluster", req.KubernetesCluster, "error", err)
-		http.Error(w, fmt.Sprintf("Failed to create proxy pod in Kubernetes cluster '%s'. This could be due to insufficient permissions, network issues, or cluster configuration problems. Error: %v", req.KubernetesCluster, err), http.StatusInternalServerError)
+		log.Error("OIDC ID token rejected", "error", err)
+		http.Error(w, "Login failed: "+err.Error(), http.StatusForbidden)
 		return
 	}
-
-	log.Info("Socat pod created, waiting for running state", "pod", pod.Name, "namespace", namespace)
-
-	// Wait for the pod to be running
-	if err := WaitForPodRunning(kubeClient, namespace, podName, 30*time.Second); err != nil {
-		log.Error("Pod failed to start", "pod", podName, "namespace", namespace, "error", err)
-		// Clean up the pod
-		DeleteSocatProxyPod(kubeClient, namespace, podName)
-		http.Error(w, fmt.Sprintf("Proxy pod failed to start within 30 seconds. This could be due to resource constraints, image pull issues, or networking problems in cluster '%s'. Error: %v", req.KubernetesCluster, err), http.StatusInternalServerError)
+	if !g.oidc.allowed(claims) {
+		log.Warn("OIDC login refused", "subject", claims.Subject, "email", claims.Email)
+		http.Error(w, "You are not allowed to use this aproxymate GUI", http.StatusForbidden)
 		return
 	}
 
-	log.Info("Socat pod is running, starting kubectl port-forward", "pod", podName, "local_port", req.LocalPort, "remote_port", req.RemotePort)
-
-	// Now start kubectl port-forward to the socat pod
-	cmd := exec.Command("kubectl",
-		"port-forward",
-		fmt.Sprintf("pod/%s", podName),
-		fmt.Sprintf("%d:%d", req.LocalPort, req.RemotePort),
-		"--context", req.KubernetesCluster,
-		"--namespace", namespace,
-	)
-
-	// Capture stderr to see kubectl errors
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
+	session := OIDCSession{
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		Name:      claims.Name,
+		ExpiresAt: time.Now().Add(g.oidc.sessionDuration),
+	}
+	value, err := g.oidc.sign(session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setCookie(w, r, g.basePath, oidcSessionCookie, value, session.ExpiresAt)
+	log.Info("GUI login", "subject", session.Subject, "email", session.Email)
+	http.Redirect(w, r, flow.Return, http.StatusFound)
+}
 
-	log.Debug("Starting kubectl port-forward command", "command", cmd.String(), "cluster", req.KubernetesCluster)
+// handleLogout ends the session of the current user
+func (g *GUI) handleLogout(w http.ResponseWriter, r *http.Request) {
+	setCookie(w, r, g.basePath, oidcSessionCookie, "", time.Time{})
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<!DOCTYPE html><html><body><p>You have been logged out of aproxymate.</p><p><a href="%s/auth/login">Log in again</a></p></body></html>`, html.EscapeString(g.basePath))
+}
 
-	if err := cmd.Start(); err != nil {
-		log.Error("Failed to start kubectl port-forward", "command", cmd.String(), "error", err)
-		// Clean up the pod
-		DeleteSocatProxyPod(kubeClient, namespace, podName)
+// requestUser returns the logged-in user of a request, by email or else subject. It is empty
+// without OIDC login, and for requests made with the instance token.
+func (g *GUI) requestUser(r *http.Request) string {
+	if g.oidc == nil {
+		return ""
+	}
+	session := g.oidc.session(r)
+	if session == nil {
+		return ""
+	}
+	if session.Email != "" {
+		return session.Email
+	}
+	return session.Subject
+}
 
-		// Provide more specific error messages based on the error type
-		errorMsg := fmt.Sprintf("Failed to start port forwarding to local port %d", req.LocalPort)
+// handleSession handles GET requests for the logged-in user, if OIDC login is enabled
+func (g *GUI) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-		// Check for common port binding issues
-		if strings.Contains(err.Error(), "permission denied") || strings.Contains(err.Error(), "bind: permission denied") {
-			if req.LocalPort <= 1023 {
-				errorMsg = fmt.Sprintf("Permission denied: Port %d is a privileged port (1-1023) that requires administrator privileges. Please try using a port above 1023 or run with elevated permissions", req.LocalPort)
-			} else {
-				errorMsg = fmt.Sprintf("Permission denied binding to port %d. Please check your system permissions", req.LocalPort)
-			}
-		} else if strings.Contains(err.Error(), "address already in use") || strings.Contains(err.Error(), "bind: address already in use") {
-			errorMsg = fmt.Sprintf("Port %d is already in use by another service. Please choose a different local port or stop the service using port %d", req.LocalPort, req.LocalPort)
-		} else if strings.Contains(err.Error(), "kubectl") {
-			errorMsg = fmt.Sprintf("kubectl command failed. Please ensure kubectl is installed and properly configured. Error: %v", err)
+	response := map[string]any{"enabled": g.oidc != nil}
+	if g.oidc != nil {
+		if session := g.oidc.session(r); session != nil {
+			response["user"] = session
 		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-		http.Error(w, errorMsg, http.StatusInternalServerError)
+// handleShutdown handles POST requests from another aproxymate process taking over this GUI
+func (g *GUI) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	// Give the command a moment to start properly
-	time.Sleep(500 * time.Millisecond)
-
-	// Check if the process is still running
-	if cmd.Process == nil {
-		log.Error("kubectl port-forward process failed to start properly", "cluster", req.KubernetesCluster)
-		DeleteSocatProxyPod(kubeClient, namespace, podName)
-		http.Error(w, fmt.Sprintf("Port forwarding failed to initialize properly. This might indicate a problem with kubectl or the Kubernetes cluster connection for '%s'.", req.KubernetesCluster), http.StatusInternalServerError)
+	if g.instance == nil || !g.instance.authorized(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	// Check if the process has already exited
-	if cmd.ProcessState != nil && cmd.ProcessState.Exited() {
-		exitCode := cmd.ProcessState.ExitCode()
-		log.Error("kubectl port-forward process exited immediately", "exit_code", exitCode, "cluster", req.KubernetesCluster)
-		DeleteSocatProxyPod(kubeClient, namespace, podName)
-
-		// Provide specific error messages based on exit code
-		var errorMsg string
-		switch exitCode {
-		case 1:
-			if req.LocalPort <= 1023 {
-				errorMsg = fmt.Sprintf("Port forwarding failed: Port %d is a privileged port (1-1023) that requires administrator privileges. Please try using a port above 1023 (e.g., 8080, 9000) or run with elevated permissions", req.LocalPort)
-			} else {
-				errorMsg = fmt.Sprintf("Port forwarding failed: Port %d is likely already in use by another service. Please try a different local port or stop the service using port %d", req.LocalPort, req.LocalPort)
-			}
-		case 2:
-			errorMsg = fmt.Sprintf("Port forwarding failed due to incorrect usage or invalid arguments. Please check if cluster '%s' is accessible and the configuration is correct", req.KubernetesCluster)
-		default:
-			errorMsg = fmt.Sprintf("Port forwarding failed immediately (exit code %d). This usually means local port %d is already in use, requires elevated permissions, or there was a network/authentication issue with cluster '%s'. Please try a different local port or check your cluster connection", exitCode, req.LocalPort, req.KubernetesCluster)
-		}
+	w.WriteHeader(http.StatusAccepted)
+	g.RequestShutdown("takeover by another aproxymate GUI")
+}
 
-		http.Error(w, errorMsg, http.StatusInternalServerError)
+// handleDebugRuntime handles GET requests for process runtime statistics
+func (g *GUI) handleDebugRuntime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Update row with connection info
-	row.Process = cmd
-	row.Connected = true
-	row.SocatPodName = podName
-	row.SocatNamespace = namespace
-
-	log.Info("Successfully started proxy connection",
-		"cluster", req.KubernetesCluster,
-		"host", req.RemoteHost,
-		"local_port", req.LocalPort,
-		"remote_port", req.RemotePort,
-		"pod", podName,
-		"pid", cmd.Process.Pid)
-
-	// Monitor the process in a goroutine
-	go func() {
-		err := cmd.Wait()
-		g.mu.Lock()
-		if r, exists := g.rows[req.ID]; exists {
-			r.Connected = false
-			r.Process = nil
-
-			// Clean up the socat pod
-			if r.SocatPodName != "" {
-				log.Debug("Cleaning up socat pod after connection ended", "pod", r.SocatPodName, "namespace", r.SocatNamespace)
-				if kubeClient, err := GetKubernetesClient(KubeConfig{Context: r.KubernetesCluster}); err == nil {
-					DeleteSocatProxyPod(kubeClient, r.SocatNamespace, r.SocatPodName)
-				}
-				r.SocatPodName = ""
-				r.SocatNamespace = ""
-			}
-
-			if err != nil {
-				// Check if this was an intentional stop
-				if r.IntentionalStop {
-					log.Info("Port-forward stopped intentionally",
-						"cluster", r.KubernetesCluster,
-						"host", r.RemoteHost,
-						"local_port", r.LocalPort,
-						"remote_port", r.RemotePort)
-				} else {
-					log.Error("Port-forward exited with error",
-						"cluster", r.KubernetesCluster,
-						"host", r.RemoteHost,
-						"local_port", r.LocalPort,
-						"remote_port", r.RemotePort,
-						"error", err)
-				}
-			} else {
-				log.Info("Port-forward exited normally",
-					"cluster", r.KubernetesCluster,
-					"host", r.RemoteHost,
-					"local_port", r.LocalPort,
-					"remote_port", r.RemotePort)
-			}
-
-			// Reset the intentional stop flag
-			r.IntentionalStop = false
-		}
-		g.mu.Unlock()
-	}()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	json.NewEncoder(w).Encode(map[string]any{
+		"uptimeSeconds":  int64(time.Since(g.startedAt).Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"heapAllocBytes": mem.HeapAlloc,
+		"heapInuseBytes": mem.HeapInuse,
+		"heapObjects":    mem.HeapObjects,
+		"sysBytes":       mem.Sys,
+		"numGC":          mem.NumGC,
+		"forwards":       g.manager.Stats(),
+	})
 }
 
-// handleDisconnect handles POST requests to stop a proxy connection
-func (g *GUI) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+// debugExecTimeout bounds commands run by /api/debug/exec, e.g. a ping without -c
+const debugExecTimeout = 30 * time.Second
+
+// handleDebugExec handles POST /api/debug/exec/{id}: it runs a command such as
+// ["nc", "-zv", "orders-db", "5432"] in the connected proxy's relay pod and returns its output
+func (g *GUI) handleDebugExec(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	id := r.URL.Path[len("/api/disconnect/"):]
-
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	row, exists := g.rows[id]
-	if !exists {
-		availableIDs := func() []string {
-			var ids []string
-			for k := range g.rows {
-				ids = append(ids, k)
-			}
-			return ids
-		}()
-		log.Warn("Disconnect request for non-existent row", "requested_id", id, "available_ids", availableIDs)
-		http.Error(w, "Proxy not found", http.StatusBadRequest)
+	// Only local tools holding the instance token may run commands, and the JSON content type
+	// keeps web pages from sending the request cross-site as a simple form or text POST
+	if g.instance == nil || !g.instance.authorized(r) {
+		http.Error(w, "The instance token is required in the "+guiTokenHeader+" header", http.StatusUnauthorized)
 		return
 	}
-
-	log.Info("Disconnect request received",
-		"id", id,
-		"cluster", row.KubernetesCluster,
-		"host", row.RemoteHost,
-		"local_port", row.LocalPort,
-		"remote_port", row.RemotePort)
-
-	if !row.Connected {
-		log.Warn("Disconnect request for already disconnected proxy", "id", id)
-		http.Error(w, "Proxy not connected", http.StatusBadRequest)
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
 		return
 	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/debug/exec/")
 
-	// Kill the kubectl port-forward process
-	if row.Process != nil {
-		row.IntentionalStop = true // Mark as intentional stop
-		if err := row.Process.Process.Kill(); err != nil {
-			log.Error("Error killing kubectl process",
-				"cluster", row.KubernetesCluster,
-				"host", row.RemoteHost,
-				"local_port", row.LocalPort,
-				"remote_port", row.RemotePort,
-				"error", err)
-		}
-		row.Process = nil
+	var req struct {
+		Command   []string `json:"command"`
+		Container string   `json:"container"`
 	}
-
-	// Clean up the socat pod
-	if row.SocatPodName != "" {
-		log.Debug("Cleaning up socat pod", "pod", row.SocatPodName, "namespace", row.SocatNamespace)
-		kubeClient, err := GetKubernetesClient(KubeConfig{Context: row.KubernetesCluster})
-		if err != nil {
-			log.Error("Failed to create Kubernetes client for cleanup", "cluster", row.KubernetesCluster, "error", err)
-		} else {
-			if err := DeleteSocatProxyPod(kubeClient, row.SocatNamespace, row.SocatPodName); err != nil {
-				log.Error("Error deleting socat pod", "pod", row.SocatPodName, "namespace", row.SocatNamespace, "error", err)
-			} else {
-				log.Debug("Successfully deleted socat pod", "pod", row.SocatPodName, "namespace", row.SocatNamespace)
-			}
-		}
-		row.SocatPodName = ""
-		row.SocatNamespace = ""
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Command) == 0 {
+		http.Error(w, "command is required", http.StatusBadRequest)
+		return
 	}
 
-	row.Connected = false
-	log.Info("Successfully disconnected proxy",
-		"cluster", row.KubernetesCluster,
-		"host", row.RemoteHost,
-		"local_port", row.LocalPort,
-		"remote_port", row.RemotePort)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
-}
+	g.mu.RLock()
+	row, exists := g.rows[id]
+	if exists {
+		row = row.withStatus(g.statusSnapshot())
+	}
+	g.mu.RUnlock()
 
-// handleContexts handles GET requests to fetch available Kubernetes contexts
-func (g *GUI) handleContexts(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !exists {
+		http.Error(w, "Proxy not found", http.StatusNotFound)
+		return
+	}
+	if !row.Connected {
+		http.Error(w, fmt.Sprintf("'%s' is not connected; connect it to start its relay pod", row.Name), http.StatusConflict)
 		return
 	}
 
-	contexts, err := GetKubernetesContexts("")
-	if err != nil {
-		http.Error(w, "Failed to get contexts: "+err.Error(), http.StatusInternalServerError)
+	ctx, cancel := context.WithTimeout(r.Context(), debugExecTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	err := RelayPodExec{
+		Cluster:   row.KubernetesCluster,
+		Namespace: row.Namespace,
+		PodName:   row.PodName,
+		Container: req.Container,
+		Command:   req.Command,
+		Stdout:    &stdout,
+		Stderr:    &stderr,
+	}.Run(ctx)
+	exitCode, exited := RelayExitCode(err)
+	if err != nil && !exited {
+		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string][]string{"contexts": contexts})
+	json.NewEncoder(w).Encode(map[string]any{
+		"pod":      row.PodName,
+		"command":  req.Command,
+		"exitCode": exitCode,
+		"stdout":   stdout.String(),
+		"stderr":   stderr.String(),
+	})
 }
 
-// handleSaveConfig handles saving the current configuration to file
-func (g *GUI) handleSaveConfig(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// resolveAdoptablePods finds relay pods from an earlier session that match the configured proxies
+// and re-attaches or drops them according to the adopt mode. Pods still awaiting a decision from
+// the GUI are returned so the orphan cleanup leaves them alone.
+func (g *GUI) resolveAdoptablePods() []AdoptablePod {
+	if g.adoptMode == AdoptModeNever {
+		return nil
 	}
 
-	// Check if we have ordered rows data from the frontend
-	var orderedRowsRequest struct {
-		OrderedRows []struct {
-			ID         string `json:"id"`
-			Order      int    `json:"order"`
-			Cluster    string `json:"cluster"`
-			Host       string `json:"host"`
-			LocalPort  int    `json:"localPort"`
-			RemotePort int    `json:"remotePort"`
-		} `json:"orderedRows"`
+	g.mu.RLock()
+	specs := make([]ProxySpec, 0, len(g.rows))
+	for _, row := range g.rows {
+		specs = append(specs, NewProxySpec(row.ID, row.toProxyConfig()))
 	}
+	g.mu.RUnlock()
 
-	// Try to decode the request body
-	if err := json.NewDecoder(r.Body).Decode(&orderedRowsRequest); err != nil {
-		// If JSON decode fails, fall back to using current rows in arbitrary order
-		log.Debug("No ordered rows data provided, using current rows", "error", err)
+	pods := FindAdoptablePods(specs, 15*time.Second)
+	if len(pods) == 0 {
+		return nil
 	}
+	log.Info("Found relay pods from an earlier session", "count", len(pods))
 
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-
-	var configs []ProxyConfig
-
-	if len(orderedRowsRequest.OrderedRows) > 0 {
-		// Use ordered rows from frontend
-		log.Debug("Saving configuration with preserved order", "ordered_rows", len(orderedRowsRequest.OrderedRows))
-
-		// Sort by order field to ensure correct sequence
-		orderedRows := orderedRowsRequest.OrderedRows
-		for i := 0; i < len(orderedRows); i++ {
-			for j := i + 1; j < len(orderedRows); j++ {
-				if orderedRows[i].Order > orderedRows[j].Order {
-					orderedRows[i], orderedRows[j] = orderedRows[j], orderedRows[i]
-				}
-			}
-		}
-
-		// Convert ordered rows to config format
-		for _, orderedRow := range orderedRows {
-			// Skip empty configurations
-			if orderedRow.Cluster == "" && orderedRow.Host == "" && orderedRow.LocalPort == 0 && orderedRow.RemotePort == 0 {
-				continue
-			}
-
-			config := ProxyConfig{
-				Name:              fmt.Sprintf("%s:%d", orderedRow.Host, orderedRow.LocalPort),
-				KubernetesCluster: orderedRow.Cluster,
-				RemoteHost:        orderedRow.Host,
-				LocalPort:         orderedRow.LocalPort,
-				RemotePort:        orderedRow.RemotePort,
-			}
-			configs = append(configs, config)
+	if g.adoptMode == AdoptModeAsk {
+		adopt, cancelled, err := PromptAdoptPodsTUI(pods)
+		if err != nil {
+			// Without a terminal the decision is left to the GUI
+			log.Debug("Cannot prompt for re-attach, offering pods in the GUI", "error", err)
+			g.mu.Lock()
+			g.adoptable = pods
+			g.mu.Unlock()
+			return pods
 		}
-	} else {
-		// Fall back to current rows (arbitrary order)
-		log.Debug("No order specified, saving rows in arbitrary order", "row_count", len(g.rows))
-		for _, row := range g.rows {
-			// Skip empty configurations
-			if row.KubernetesCluster == "" && row.RemoteHost == "" && row.LocalPort == 0 && row.RemotePort == 0 {
-				continue
-			}
-
-			config := ProxyConfig{
-				Name:              fmt.Sprintf("%s:%d", row.RemoteHost, row.LocalPort),
-				KubernetesCluster: row.KubernetesCluster,
-				RemoteHost:        row.RemoteHost,
-				LocalPort:         row.LocalPort,
-				RemotePort:        row.RemotePort,
-			}
-			configs = append(configs, config)
+		if cancelled || !adopt {
+			return nil
 		}
 	}
 
-	// Save to Viper and write to file
-	viper.Set("proxy_configs", configs)
-
-	var savedConfigFile string
+	g.adoptPods(pods)
+	return nil
+}
 
-	if !g.configFileLoaded {
-		// No config file was initially loaded, use default location
-		configFile := GetLocalConfigPath()
-		// Convert to absolute path for display and consistency
-		absConfigFile := GetAbsolutePathForDisplay(configFile)
-		log.Info("No config file was loaded on startup, saving to default location", "file", absConfigFile)
-		savedConfigFile = absConfigFile
-
-		// Force write using WriteConfigAs to ensure we get the correct filename
-		err := viper.WriteConfigAs(configFile)
-		if err != nil {
-			log.Error("Error saving configuration", "file", configFile, "error", err)
-			http.Error(w, fmt.Sprintf("Failed to save configuration: %v", err), http.StatusInternalServerError)
-			return
+// adoptPods re-attaches the proxies to their running pods; pods that fail are deleted
+func (g *GUI) adoptPods(pods []AdoptablePod) []string {
+	var failures []string
+	for _, pod := range pods {
+		g.mu.RLock()
+		row, exists := g.rows[pod.ProxyID]
+		var spec ProxySpec
+		if exists {
+			spec = NewProxySpec(row.ID, row.toProxyConfig())
 		}
+		g.mu.RUnlock()
 
-		// Now that we've saved a config file, mark it as loaded for future saves
-		// and set viper to use this file
-		viper.SetConfigFile(configFile)
-		g.configFileLoaded = true
-	} else {
-		// Config file was loaded, try to write to the same location
-		configFile := viper.ConfigFileUsed()
-		err := viper.WriteConfig()
+		err := ErrProxyNotConnected
+		if exists {
+			err = g.manager.Adopt(spec, pod)
+		}
 		if err != nil {
-			log.Error("Error writing to existing config file", "file", configFile, "error", err)
-			http.Error(w, fmt.Sprintf("Failed to save configuration: %v", err), http.StatusInternalServerError)
-			return
+			log.Warn("Failed to re-attach proxy, deleting its pod", "proxy", pod.ProxyName, "pod", pod.PodName, "error", err)
+			failures = append(failures, fmt.Sprintf("%s: %v", pod.ProxyName, err))
+			deleteAdoptablePod(pod)
 		}
-		// Convert to absolute path for display consistency
-		savedConfigFile = GetAbsolutePathForDisplay(configFile)
 	}
-
-	log.Info("Configuration saved successfully", "proxy_configs", len(configs), "file", savedConfigFile, "order_preserved", len(orderedRowsRequest.OrderedRows) > 0)
-
-	w.Header().Set("Content-Type", "application/json")
-	response := map[string]string{"status": "success", "message": "Configuration saved successfully"}
-	json.NewEncoder(w).Encode(response)
+	return failures
 }
 
-// handleConfigLocation handles GET requests to retrieve the current config file location
-func (g *GUI) handleConfigLocation(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// deleteAdoptablePod deletes a relay pod that was not re-attached
+func deleteAdoptablePod(pod AdoptablePod) {
+	kubeClient, err := GetKubernetesClient(KubeConfig{Context: pod.Cluster})
+	if err != nil {
+		log.Warn("Could not create Kubernetes client to delete pod", "context", pod.Cluster, "pod", pod.PodName, "error", err)
 		return
 	}
+	if err := DeleteSocatProxyPod(kubeClient, pod.Namespace, pod.PodName); err != nil {
+		log.Warn("Failed to delete pod", "pod", pod.PodName, "namespace", pod.Namespace, "error", err)
+	}
+}
 
+// proxyConfigs returns the config entries of all rows
+func (g *GUI) proxyConfigs() []ProxyConfig {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
-	location := g.GetConfigSaveLocation()
-	nextSaveLocation := GetLocalConfigPath()
-
-	if g.configFileLoaded {
-		configFile := viper.ConfigFileUsed()
-		if configFile != "" {
-			nextSaveLocation = configFile
-		}
+	configs := make([]ProxyConfig, 0, len(g.rows))
+	for _, row := range g.rows {
+		configs = append(configs, row.toProxyConfig())
 	}
-
-	// Convert nextSaveLocation to absolute path for consistent display
-	absNextSaveLocation := GetAbsolutePathForDisplay(nextSaveLocation)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"location":         location,
-		"nextSaveLocation": absNextSaveLocation,
-		"loaded":           fmt.Sprintf("%t", g.configFileLoaded),
-	})
+	return configs
 }
 
-// handleStatus handles GET requests to check the status of all proxies
-func (g *GUI) handleStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// RequestShutdown asks a running Start to shut down and return; extra requests are ignored
+func (g *GUI) RequestShutdown(reason string) {
+	select {
+	case g.shutdownCh <- reason:
+	default:
 	}
+}
 
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+// shutdown stops accepting API calls, closes all forwards and deletes the relay pods,
+// giving up on pods still being deleted after the shutdown timeout
+func (g *GUI) shutdown(reason string) error {
+	log.Info("Shutting down, cleaning up", "reason", reason, "timeout", g.shutdownTimeout)
+	g.setPhase(guiPhaseStopping)
 
-	// Check actual process status and update accordingly
-	for id, row := range g.rows {
-		if row.Process != nil {
-			// Check if process is still running
-			if row.Process.ProcessState != nil && row.Process.ProcessState.Exited() {
-				log.Debug("Process has exited, updating status", "id", id, "exit_code", row.Process.ProcessState.ExitCode())
-				row.Connected = false
-				row.Process = nil
-			}
-		}
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), g.shutdownTimeout)
+	defer cancel()
 
-	// Return current status
-	status := make(map[string]bool)
-	for id, row := range g.rows {
-		status[id] = row.Connected
+	// Release clients waiting for notices, then stop accepting API calls so nothing
+	// connects while proxies are torn down
+	g.notices.close()
+	if err := g.server.Shutdown(ctx); err != nil {
+		log.Warn("GUI server did not stop cleanly", "error", err)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": status,
-	})
-}
-
-// cleanupAllPods cleans up all socat pods managed by this GUI instance
-func (g *GUI) cleanupAllPods() {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-
-	log.Info("Cleaning up all active socat pods")
+	err := g.manager.Shutdown(ctx)
+	if g.stopUsage != nil {
+		g.stopUsage()
+	}
 
-	for _, row := range g.rows {
-		if row.Connected && row.SocatPodName != "" {
-			log.Debug("Cleaning up pod during shutdown",
-				"cluster", row.KubernetesCluster,
-				"host", row.RemoteHost,
-				"local_port", row.LocalPort,
-				"remote_port", row.RemotePort,
-				"pod", row.SocatPodName)
-
-			// Kill the kubectl process
-			if row.Process != nil {
-				row.Process.Process.Kill()
-			}
+	g.mu.Lock()
+	if g.stopWebhooks != nil {
+		g.stopWebhooks()
+		g.stopWebhooks = nil
+	}
+	if g.stopStatsD != nil {
+		g.stopStatsD()
+		g.stopStatsD = nil
+	}
+	if g.stopDNS != nil {
+		g.stopDNS()
+		g.stopDNS = nil
+	}
+	if g.stopNotices != nil {
+		g.stopNotices()
+		g.stopNotices = nil
+	}
+	if g.stopKubeWatch != nil {
+		g.stopKubeWatch()
+		g.stopKubeWatch = nil
+	}
+	g.mu.Unlock()
 
-			// Delete the pod
-			kubeClient, err := GetKubernetesClient(KubeConfig{Context: row.KubernetesCluster})
-			if err != nil {
-				log.Warn("Failed to get Kubernetes client for pod cleanup",
-					"cluster", row.KubernetesCluster,
-					"error", err)
-				continue
-			}
+	// Removing the instance record last tells a taking-over GUI that this one has drained
+	if g.instance != nil {
+		g.instance.remove()
+	}
 
-			if err := DeleteSocatProxyPod(kubeClient, row.SocatNamespace, row.SocatPodName); err != nil {
-				log.Warn("Failed to delete socat pod during cleanup",
-					"cluster", row.KubernetesCluster,
-					"namespace", row.SocatNamespace,
-					"pod", row.SocatPodName,
-					"error", err)
-			} else {
-				log.Debug("Successfully deleted socat pod",
-					"cluster", row.KubernetesCluster,
-					"namespace", row.SocatNamespace,
-					"pod", row.SocatPodName)
-			}
-		}
+	if err != nil {
+		return err
 	}
+	log.Info("Shutdown complete")
+	return nil
 }
 
 // GetConfigSaveLocation returns the location where the config will be saved
@@ -998,9 +2916,13 @@ func getSafeUsername() string {
 	if err != nil {
 		return "unknown"
 	}
+	return safeUsername(currentUser.Username)
+}
 
+// safeUsername turns a user name into one usable in pod names
+func safeUsername(name string) string {
 	// Clean the username to be Kubernetes-safe (lowercase, no special chars except hyphens)
-	username := strings.ToLower(currentUser.Username)
+	username := strings.ToLower(name)
 	// Replace any non-alphanumeric characters with hyphens
 	var safeName strings.Builder
 	for _, r := range username {
@@ -1042,7 +2964,7 @@ func (g *GUI) DisplayConfigurations() {
 		fmt.Printf("  Local Port: %d\n", row.LocalPort)
 		fmt.Printf("  Remote Port: %d\n", row.RemotePort)
 		fmt.Printf("  Status: %s\n", func() string {
-			if row.Connected {
+			if g.manager.IsConnected(row.ID) {
 				return "Connected"
 			}
 			return "Disconnected"
@@ -1053,8 +2975,6 @@ func (g *GUI) DisplayConfigurations() {
 
 // Stop gracefully stops the GUI server
 func (g *GUI) Stop() error {
-	if g.server != nil {
-		return g.server.Close()
-	}
+	g.RequestShutdown("stopped")
 	return nil
 }
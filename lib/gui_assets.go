@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sync"
+)
+
+// guiAssets holds the web GUI: the HTML templates and the CSS and JavaScript they load.
+// Everything is served from the binary, so the GUI works on machines without internet access.
+//
+//go:embed templates static
+var guiAssets embed.FS
+
+// guiTemplates are the parsed HTML templates of the GUI pages, by file name
+var guiTemplates = template.Must(template.ParseFS(guiAssets, "templates/*.html"))
+
+// assetVersion identifies the static files of this build. Pages request them with ?v= set to
+// it, so browsers fetch new files after an upgrade and may cache them until then.
+var assetVersion = sync.OnceValue(func() string {
+	hash := sha256.New()
+	fs.WalkDir(guiAssets, "static", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := guiAssets.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		hash.Write([]byte(path))
+		hash.Write(data)
+		return nil
+	})
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+})
+
+// staticHandler serves the embedded CSS and JavaScript below /static/
+func staticHandler() http.Handler {
+	static, err := fs.Sub(guiAssets, "static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix("/static/", http.FileServerFS(static))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("v") == assetVersion() {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// minAuthTokenLength keeps tokens set in an auth token file from being guessable
+const minAuthTokenLength = 16
+
+// GUIConfig holds the defaults of `aproxymate gui`, so it starts as wanted without a stack of
+// flags; flags given on the command line override them
+type GUIConfig struct {
+	// Port is the GUI port (default 8080, 0 picks a free port)
+	Port int `json:"port,omitempty" mapstructure:"port" yaml:"port,omitempty"`
+	// BindAddress is the address the GUI listens on, e.g. "127.0.0.1" (default all interfaces)
+	BindAddress string `json:"bind_address,omitempty" mapstructure:"bind_address" yaml:"bind_address,omitempty"`
+	// OpenBrowser opens the GUI in the browser on startup (default true)
+	OpenBrowser *bool `json:"open_browser,omitempty" mapstructure:"open_browser" yaml:"open_browser,omitempty"`
+	// ReadOnly shows the proxies without letting anyone connect, disconnect or change them
+	ReadOnly bool `json:"read_only,omitempty" mapstructure:"read_only" yaml:"read_only,omitempty"`
+	// AuthTokenPath is a file holding the token that authorizes control requests such as
+	// --force; a random token is written there when it doesn't exist
+	AuthTokenPath string `json:"auth_token_path,omitempty" mapstructure:"auth_token_path" yaml:"auth_token_path,omitempty"`
+}
+
+// Validate checks the port and bind address
+func (c GUIConfig) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port %d is not between 0 and 65535", c.Port)
+	}
+	if err := validateBindAddress(c.BindAddress); err != nil {
+		return fmt.Errorf("bind_address %w", err)
+	}
+	return nil
+}
+
+// validateBindAddress checks that the GUI can listen on an address; empty means all interfaces
+func validateBindAddress(address string) error {
+	if address != "" && address != "localhost" && net.ParseIP(address) == nil {
+		return fmt.Errorf("%q must be an IP address or localhost", address)
+	}
+	return nil
+}
+
+// errReadOnly is returned for requests that would change something in read-only mode
+var errReadOnly = errors.New("read-only mode: proxies can't be connected, disconnected or changed")
+
+// refuseChanges answers requests that would connect, disconnect or change something with 403 in
+// read-only mode. Previews, proxy tests and requests with the instance token are let through.
+func (g *GUI) refuseChanges(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead,
+			r.URL.Path == "/api/config/preview",
+			strings.HasPrefix(r.URL.Path, "/api/proxy/") && strings.HasSuffix(r.URL.Path, "/test"),
+			g.instance != nil && g.instance.authorized(r):
+			next.ServeHTTP(w, r)
+		default:
+			http.Error(w, errReadOnly.Error(), http.StatusForbidden)
+		}
+	})
+}
+
+// loadAuthToken returns the token in path, or writes generated there if the file doesn't exist
+func loadAuthToken(path, generated string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", fmt.Errorf("failed to create the directory of auth token file %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, []byte(generated+"\n"), 0600); err != nil {
+			return "", fmt.Errorf("failed to write auth token file %s: %w", path, err)
+		}
+		return generated, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read auth token file %s: %w", path, err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if len(token) < minAuthTokenLength {
+		return "", fmt.Errorf("the token in %s is too short: use at least %d characters", path, minAuthTokenLength)
+	}
+	return token, nil
+}
@@ -0,0 +1,227 @@
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// guiTokenHeader carries the instance token on control requests such as /api/shutdown
+const guiTokenHeader = "X-Aproxymate-Token"
+
+// guiTokenKeychainKey returns the keychain entry holding the instance token
+func guiTokenKeychainKey() string {
+	if instanceName != "" {
+		return "gui-token-" + instanceName
+	}
+	return "gui-token"
+}
+
+// GUIInstance describes a running aproxymate GUI, recorded so later launches can find it
+type GUIInstance struct {
+	PID int `json:"pid"`
+	// Name is the instance name, empty for the default instance
+	Name      string    `json:"name,omitempty"`
+	Port      int       `json:"port"`
+	URL       string    `json:"url"`
+	Version   string    `json:"version"`
+	StartedAt time.Time `json:"startedAt"`
+	// Token authorizes control requests from another aproxymate process of the same user.
+	// It is kept in the OS keychain and only written to the instance file without one.
+	Token string `json:"token,omitempty"`
+}
+
+// guiInstancePath returns the file recording the running GUI instance
+func guiInstancePath() string {
+	return filepath.Join(stateDir(), "gui-instance.json")
+}
+
+// FindRunningGUI returns the GUI instance that is currently running for this user, or nil.
+// A recorded instance that no longer answers is treated as stale and forgotten.
+func FindRunningGUI() (*GUIInstance, error) {
+	path := guiInstancePath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GUI instance file %s: %w", path, err)
+	}
+
+	var instance GUIInstance
+	if err := json.Unmarshal(data, &instance); err != nil {
+		log.Debug("Ignoring unreadable GUI instance file", "path", path, "error", err)
+		os.Remove(path)
+		return nil, nil
+	}
+
+	if !instance.responding() {
+		log.Debug("Removing stale GUI instance file", "path", path, "pid", instance.PID, "url", instance.URL)
+		os.Remove(path)
+		return nil, nil
+	}
+
+	if instance.Token == "" {
+		token, err := SystemKeychain().Get(guiTokenKeychainKey())
+		if err != nil {
+			log.Warn("Could not read the running GUI's token from the OS keychain", "error", err)
+		}
+		instance.Token = token
+	}
+	return &instance, nil
+}
+
+// responding reports whether the instance still answers on its URL
+func (i *GUIInstance) responding() bool {
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get(i.URL + "api/version")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Proxies returns the running GUI's proxies that match the filter, and how many it has in total
+func (i *GUIInstance) Proxies(filter ProxyFilter) ([]ProxyRow, int, error) {
+	req, err := http.NewRequest(http.MethodGet, i.URL+"api/proxy?"+filter.Values().Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set(guiTokenHeader, i.Token)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list the proxies of the running GUI (pid %d): %w", i.PID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("the running GUI (pid %d) refused to list its proxies: %s", i.PID, resp.Status)
+	}
+
+	var result struct {
+		Proxies []ProxyRow `json:"proxies"`
+		Total   int        `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("failed to read the proxies of the running GUI (pid %d): %w", i.PID, err)
+	}
+	return result.Proxies, result.Total, nil
+}
+
+// StopRunningGUI asks a running GUI to disconnect its proxies and exit, and waits until it has
+// drained (removed its instance record) or the timeout expires
+func StopRunningGUI(instance *GUIInstance, timeout time.Duration) error {
+	req, err := http.NewRequest(http.MethodPost, instance.URL+"api/shutdown", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(guiTokenHeader, instance.Token)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to ask the running GUI (pid %d) to shut down: %w", instance.PID, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("the running GUI (pid %d) refused to shut down: %s", instance.PID, resp.Status)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !instance.recorded() {
+			return nil
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	// It stopped serving but never finished cleaning up, e.g. because it was killed
+	if !instance.responding() {
+		log.Warn("Previous GUI stopped without finishing cleanup", "pid", instance.PID)
+		instance.remove()
+		return nil
+	}
+	return fmt.Errorf("the running GUI (pid %d) did not shut down within %s", instance.PID, timeout)
+}
+
+// newGUIInstance creates the instance record for this process
+func newGUIInstance(port int, url string) (*GUIInstance, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	return &GUIInstance{
+		PID:       os.Getpid(),
+		Name:      instanceName,
+		Port:      port,
+		URL:       url,
+		Version:   Version,
+		StartedAt: time.Now(),
+		Token:     hex.EncodeToString(token),
+	}, nil
+}
+
+// write records the instance so later launches can find it
+func (i *GUIInstance) write() error {
+	path := guiInstancePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// The token lets other processes shut this instance down, so keep it in the keychain,
+	// or at least in a private file
+	record := *i
+	if err := SystemKeychain().Set(guiTokenKeychainKey(), i.Token); err != nil {
+		log.Debug("Keeping the GUI token in the instance file", "path", path, "error", err)
+	} else {
+		record.Token = ""
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// recorded reports whether the instance file still belongs to this instance
+func (i *GUIInstance) recorded() bool {
+	data, err := os.ReadFile(guiInstancePath())
+	if err != nil {
+		return false
+	}
+
+	var current GUIInstance
+	return json.Unmarshal(data, &current) == nil && current.PID == i.PID && current.StartedAt.Equal(i.StartedAt)
+}
+
+// remove deletes the instance file and keychain token if they still belong to this instance
+func (i *GUIInstance) remove() {
+	if !i.recorded() {
+		return
+	}
+	os.Remove(guiInstancePath())
+
+	keychain := SystemKeychain()
+	if token, err := keychain.Get(guiTokenKeychainKey()); err == nil && token == i.Token {
+		keychain.Delete(guiTokenKeychainKey())
+	}
+}
+
+// authorized reports whether a request carries this instance's token
+func (i *GUIInstance) authorized(r *http.Request) bool {
+	token := r.Header.Get(guiTokenHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(i.Token)) == 1
+}
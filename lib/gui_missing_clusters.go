@@ -0,0 +1,188 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/spf13/viper"
+
+	log "aproxymate/lib/logger"
+)
+
+// MissingClusterEntry is an entry of the config file without a kubernetes_cluster
+type MissingClusterEntry struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	RemoteHost string `json:"remoteHost"`
+	RemotePort int    `json:"remotePort"`
+}
+
+// MissingClusterGroup is a set of entries without a cluster whose remote hosts share a domain,
+// as grouped by `config fix`
+type MissingClusterGroup struct {
+	Domain  string                `json:"domain"`
+	Entries []MissingClusterEntry `json:"entries"`
+}
+
+// assignClusterRequest assigns each entry in Assignments its own cluster, and Cluster to the
+// entries with the given IDs, or to every other entry without a cluster when IDs is empty
+type assignClusterRequest struct {
+	Cluster     string            `json:"cluster"`
+	IDs         []string          `json:"ids"`
+	Assignments map[string]string `json:"assignments"`
+}
+
+// clusterOf returns the cluster requested for the entry with the given ID, or ""
+func (req assignClusterRequest) clusterOf(id string) string {
+	if cluster, found := req.Assignments[id]; found {
+		return cluster
+	}
+	if len(req.IDs) == 0 || slices.Contains(req.IDs, id) {
+		return req.Cluster
+	}
+	return ""
+}
+
+// handleMissingClusters lists the entries of the config file without a cluster (GET) or assigns
+// a cluster to them and saves the file (POST), like `config fix` does on the terminal
+func (g *GUI) handleMissingClusters(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		g.mu.RLock()
+		loaded, path := g.configFileLoaded, g.saveConfigPath()
+		g.mu.RUnlock()
+
+		groups := []MissingClusterGroup{}
+		total := 0
+		if loaded {
+			configs, err := ReadProxyConfigsFile(path)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			ids := configRowIDs(configs)
+			for _, group := range GroupMissingClusters(configs) {
+				entries := make([]MissingClusterEntry, 0, len(group.Indexes))
+				for _, index := range group.Indexes {
+					config := configs[index]
+					entries = append(entries, MissingClusterEntry{ID: ids[index], Name: config.Name, RemoteHost: config.RemoteHost, RemotePort: config.RemotePort})
+				}
+				groups = append(groups, MissingClusterGroup{Domain: group.Domain, Entries: entries})
+				total += len(entries)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"groups": groups, "total": total})
+
+	case http.MethodPost:
+		var req assignClusterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Cluster == "" && len(req.Assignments) == 0 {
+			http.Error(w, "cluster or assignments is required", http.StatusBadRequest)
+			return
+		}
+		contexts, err := GetKubernetesContexts("")
+		if err != nil {
+			http.Error(w, "Failed to get contexts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		clusters := slices.Collect(maps.Values(req.Assignments))
+		if req.Cluster != "" {
+			clusters = append(clusters, req.Cluster)
+		}
+		for _, cluster := range clusters {
+			if !slices.Contains(contexts, cluster) {
+				http.Error(w, fmt.Sprintf("Context '%s' not found in kubeconfig", cluster), http.StatusBadRequest)
+				return
+			}
+		}
+
+		updated, version, status, err := g.assignClusters(req)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"`+version+`"`)
+		json.NewEncoder(w).Encode(map[string]any{"updated": updated, "version": version})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// assignClusters sets the cluster of the requested entries in the config file and in their rows.
+// It returns the IDs of the updated entries and the new version of the file, or an error with
+// the HTTP status to answer.
+func (g *GUI) assignClusters(req assignClusterRequest) ([]string, string, int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.strictConnect {
+		return nil, "", http.StatusForbidden, errStrictConnectConfig
+	}
+	if !g.configFileLoaded {
+		return nil, "", http.StatusConflict, errors.New("no config file is loaded")
+	}
+
+	path := g.saveConfigPath()
+	configs, err := ReadProxyConfigsFile(path)
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, err
+	}
+	ids := configRowIDs(configs)
+
+	var updated []string
+	for i, id := range ids {
+		cluster := req.clusterOf(id)
+		if configs[i].KubernetesCluster != "" || cluster == "" {
+			continue
+		}
+		configs[i].KubernetesCluster = cluster
+		updated = append(updated, id)
+	}
+	for _, id := range append(slices.Collect(maps.Keys(req.Assignments)), req.IDs...) {
+		if !slices.Contains(updated, id) {
+			return nil, "", http.StatusBadRequest, fmt.Errorf("'%s' is not an entry of the config file without a cluster", id)
+		}
+	}
+	if len(updated) == 0 {
+		return nil, "", http.StatusBadRequest, errors.New("no entries of the config file are missing a cluster")
+	}
+
+	savedConfigFile := GetAbsolutePathForDisplay(path)
+	if err := g.writeConfig(path, configs, g.configVersion); err != nil {
+		switch {
+		case errors.Is(err, ErrEnvironmentSelected):
+			return nil, "", http.StatusConflict, fmt.Errorf("not saved: %w", err)
+		case errors.Is(err, ErrConfigConflict):
+			return nil, "", http.StatusConflict, fmt.Errorf("%s: %w; reload the page to pick up the changes", savedConfigFile, err)
+		}
+		return nil, "", http.StatusInternalServerError, fmt.Errorf("failed to save configuration: %w", err)
+	}
+	viper.Set("proxy_configs", configs)
+
+	for i, id := range ids {
+		if row, exists := g.rows[id]; exists && slices.Contains(updated, id) {
+			assigned := *row
+			assigned.KubernetesCluster = configs[i].KubernetesCluster
+			assigned.Config.KubernetesCluster = configs[i].KubernetesCluster
+			assigned.Config.Source = configs[i].Source
+			g.rows[id] = &assigned
+		}
+	}
+	g.validation = ValidateProxyConfigs(path, configs)
+
+	log.Info("Assigned clusters to configurations", "count", len(updated), "file", savedConfigFile)
+	g.notices.add(NoticeSuccess, "", "Assigned clusters to %d configuration(s) in %s", len(updated), savedConfigFile)
+	return updated, g.configVersion, http.StatusOK, nil
+}
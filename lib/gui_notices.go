@@ -0,0 +1,157 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Notice levels, matching the toast styles of the GUI
+const (
+	NoticeInfo    = "info"
+	NoticeSuccess = "success"
+	NoticeWarning = "warning"
+	NoticeError   = "error"
+)
+
+// maxNotices bounds the number of notices kept for clients that poll late
+const maxNotices = 100
+
+// Notice is a user-facing message for the GUI, shown as a toast
+type Notice struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	ProxyID string    `json:"proxyId,omitempty"`
+}
+
+// noticeQueue keeps recent notices and wakes up clients waiting for new ones
+type noticeQueue struct {
+	mu      sync.Mutex
+	notices []Notice
+	lastID  int64
+	// changed is closed and replaced whenever a notice is added
+	changed chan struct{}
+	// closed is closed on shutdown so waiting clients return immediately
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newNoticeQueue creates an empty notice queue
+func newNoticeQueue() *noticeQueue {
+	return &noticeQueue{
+		changed: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+// add appends a notice and wakes up waiting clients
+func (q *noticeQueue) add(level, proxyID, format string, args ...any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.lastID++
+	q.notices = append(q.notices, Notice{
+		ID:      q.lastID,
+		Time:    time.Now(),
+		Level:   level,
+		Message: fmt.Sprintf(format, args...),
+		ProxyID: proxyID,
+	})
+	if len(q.notices) > maxNotices {
+		q.notices = q.notices[len(q.notices)-maxNotices:]
+	}
+
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// after returns the notices newer than id, the latest ID and a channel closed on the next add
+func (q *noticeQueue) after(id int64) ([]Notice, int64, <-chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	notices := []Notice{}
+	for _, notice := range q.notices {
+		if notice.ID > id {
+			notices = append(notices, notice)
+		}
+	}
+	return notices, q.lastID, q.changed
+}
+
+// wait returns the notices newer than id, waiting up to timeout for one to arrive
+func (q *noticeQueue) wait(ctx context.Context, id int64, timeout time.Duration) ([]Notice, int64) {
+	notices, lastID, changed := q.after(id)
+	if len(notices) > 0 || timeout <= 0 {
+		return notices, lastID
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+	case <-timer.C:
+	case <-ctx.Done():
+	case <-q.closed:
+	}
+	notices, lastID, _ = q.after(id)
+	return notices, lastID
+}
+
+// close releases all waiting clients
+func (q *noticeQueue) close() {
+	q.closeOnce.Do(func() { close(q.closed) })
+}
+
+// startNoticeFeed turns proxy lifecycle events into notices until the returned stop function is called
+func startNoticeFeed(manager *ProxyManager, queue *noticeQueue) func() {
+	events, unsubscribe := manager.Subscribe()
+
+	go func() {
+		// A failed pod is followed by a connect_failed event for the same attempt; report it once
+		podFailed := make(map[string]bool)
+
+		for event := range events {
+			name := event.ProxyName
+			if name == "" {
+				name = "Proxy " + event.ProxyID
+			}
+
+			switch event.Type {
+			case ProxyEventConnected:
+				queue.add(NoticeSuccess, event.ProxyID, "%s connected", name)
+			case ProxyEventDisconnected:
+				queue.add(NoticeInfo, event.ProxyID, "%s disconnected", name)
+			case ProxyEventDropped:
+				queue.add(NoticeError, event.ProxyID, "%s disconnected unexpectedly: %s", name, event.Message)
+			case ProxyEventPodFailed:
+				podFailed[event.ProxyID] = true
+				queue.add(NoticeError, event.ProxyID, "Relay pod for %s failed: %s", name, event.Message)
+			case ProxyEventConnectFailed:
+				if !podFailed[event.ProxyID] {
+					queue.add(NoticeError, event.ProxyID, "%s failed to connect: %s", name, event.Message)
+				}
+			case ProxyEventReconnected:
+				queue.add(NoticeSuccess, event.ProxyID, "%s reconnected", name)
+			case ProxyEventReconnectExhausted:
+				queue.add(NoticeError, event.ProxyID, "%s could not be reconnected: %s", name, event.Message)
+			case ProxyEventCredentialsRotated:
+				queue.add(NoticeInfo, event.ProxyID, "%s has new database credentials (%s); reconnect your clients", name, event.Message)
+			case ProxyEventStateChanged:
+				if event.State == ProxyStateDegraded {
+					queue.add(NoticeWarning, event.ProxyID, "%s is degraded: %s", name, event.Message)
+				}
+			}
+
+			if event.Type != ProxyEventPodFailed && event.Type != ProxyEventStateChanged {
+				delete(podFailed, event.ProxyID)
+			}
+		}
+	}()
+
+	return unsubscribe
+}
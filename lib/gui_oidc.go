@@ -0,0 +1,394 @@
+package lib
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// oidcSessionCookie holds the signed session of a logged-in user
+	oidcSessionCookie = "aproxymate_session"
+	// oidcFlowCookie holds the state, nonce and PKCE verifier of a login in progress
+	oidcFlowCookie = "aproxymate_oidc_flow"
+	// oidcFlowTimeout is how long a user has to complete a login at the identity provider
+	oidcFlowTimeout = 10 * time.Minute
+	// defaultOIDCSessionDuration is how long a login lasts unless session_duration is set
+	defaultOIDCSessionDuration = 12 * time.Hour
+)
+
+// OIDCConfig enables single sign-on for the GUI and its API with an OpenID Connect provider,
+// using the authorization code flow with PKCE
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL; its /.well-known/openid-configuration is used
+	Issuer   string `json:"issuer,omitempty" mapstructure:"issuer" yaml:"issuer,omitempty"`
+	ClientID string `json:"client_id,omitempty" mapstructure:"client_id" yaml:"client_id,omitempty"`
+	// ClientSecret is only needed for confidential clients; $APROXYMATE_OIDC_CLIENT_SECRET is used when empty
+	ClientSecret string `json:"client_secret,omitempty" mapstructure:"client_secret" yaml:"client_secret,omitempty"`
+	// RedirectURL is the externally visible {base path}/auth/callback URL, e.g. behind a reverse
+	// proxy. By default it is derived from the request.
+	RedirectURL string `json:"redirect_url,omitempty" mapstructure:"redirect_url" yaml:"redirect_url,omitempty"`
+	// Scopes requested in addition to openid (default: email, profile)
+	Scopes []string `json:"scopes,omitempty" mapstructure:"scopes" yaml:"scopes,omitempty"`
+	// AllowedEmails and AllowedDomains restrict who may log in; anyone the provider accepts may when both are empty
+	AllowedEmails  []string `json:"allowed_emails,omitempty" mapstructure:"allowed_emails" yaml:"allowed_emails,omitempty"`
+	AllowedDomains []string `json:"allowed_domains,omitempty" mapstructure:"allowed_domains" yaml:"allowed_domains,omitempty"`
+	// SessionDuration is how long a login lasts, e.g. "8h" (default 12h)
+	SessionDuration string `json:"session_duration,omitempty" mapstructure:"session_duration" yaml:"session_duration,omitempty"`
+	// SessionSecret signs session cookies so they survive restarts; $APROXYMATE_OIDC_SESSION_SECRET
+	// is used when empty. Without either, a random key is used and restarts end all sessions.
+	SessionSecret string `json:"session_secret,omitempty" mapstructure:"session_secret" yaml:"session_secret,omitempty"`
+}
+
+// Enabled reports whether OIDC login is configured
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// Validate checks that an enabled OIDC config is complete
+func (c OIDCConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	issuer, err := url.Parse(c.Issuer)
+	if err != nil || issuer.Host == "" || (issuer.Scheme != "https" && issuer.Hostname() != "localhost" && issuer.Hostname() != "127.0.0.1") {
+		return fmt.Errorf("issuer must be an https URL, got '%s'", c.Issuer)
+	}
+	if c.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if c.RedirectURL != "" {
+		if redirect, err := url.Parse(c.RedirectURL); err != nil || redirect.Host == "" {
+			return fmt.Errorf("redirect_url must be an absolute URL, got '%s'", c.RedirectURL)
+		}
+	}
+	if _, err := c.sessionDuration(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// sessionDuration returns how long a login lasts
+func (c OIDCConfig) sessionDuration() (time.Duration, error) {
+	if c.SessionDuration == "" {
+		return defaultOIDCSessionDuration, nil
+	}
+	duration, err := time.ParseDuration(c.SessionDuration)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("session_duration must be a positive duration such as 8h, got '%s'", c.SessionDuration)
+	}
+	return duration, nil
+}
+
+// OIDCSession is the identity of a logged-in GUI user
+type OIDCSession struct {
+	Subject   string    `json:"sub"`
+	Email     string    `json:"email,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// oidcProviderMetadata is the part of the provider's discovery document used for login
+type oidcProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	EndSessionEndpoint    string `json:"end_session_endpoint,omitempty"`
+}
+
+// oidcFlow is the state of a login in progress, kept in a signed cookie until the callback
+type oidcFlow struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"`
+	Return   string    `json:"return"`
+	Expires  time.Time `json:"expires"`
+}
+
+// oidcAuth requires an OIDC login for the GUI
+type oidcAuth struct {
+	config          OIDCConfig
+	clientSecret    string
+	sessionDuration time.Duration
+	// key signs the session and flow cookies
+	key []byte
+
+	mu       sync.Mutex
+	metadata *oidcProviderMetadata
+}
+
+// newOIDCAuth prepares OIDC login from a validated config
+func newOIDCAuth(config OIDCConfig) (*oidcAuth, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	duration, _ := config.sessionDuration()
+
+	auth := &oidcAuth{
+		config:          config,
+		clientSecret:    config.ClientSecret,
+		sessionDuration: duration,
+	}
+	if auth.clientSecret == "" {
+		auth.clientSecret = os.Getenv("APROXYMATE_OIDC_CLIENT_SECRET")
+	}
+
+	secret := config.SessionSecret
+	if secret == "" {
+		secret = os.Getenv("APROXYMATE_OIDC_SESSION_SECRET")
+	}
+	if secret != "" {
+		sum := sha256.Sum256([]byte(secret))
+		auth.key = sum[:]
+	} else {
+		auth.key = make([]byte, 32)
+		if _, err := rand.Read(auth.key); err != nil {
+			return nil, err
+		}
+	}
+	return auth, nil
+}
+
+// providerMetadata fetches the provider's discovery document once
+func (a *oidcAuth) providerMetadata(ctx context.Context) (*oidcProviderMetadata, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.metadata != nil {
+		return a.metadata, nil
+	}
+
+	issuer := strings.TrimSuffix(a.config.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach OIDC provider %s: %w", issuer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC provider %s returned %s for its discovery document", issuer, resp.Status)
+	}
+
+	var metadata oidcProviderMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse the discovery document of OIDC provider %s: %w", issuer, err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC provider %s reports a different issuer: %s", issuer, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" {
+		return nil, fmt.Errorf("OIDC provider %s has no authorization or token endpoint", issuer)
+	}
+	a.metadata = &metadata
+	return a.metadata, nil
+}
+
+// oauth2Config returns the client configuration for a request, whose host gives the default redirect URL
+func (a *oidcAuth) oauth2Config(r *http.Request, basePath string, metadata *oidcProviderMetadata) *oauth2.Config {
+	redirectURL := a.config.RedirectURL
+	if redirectURL == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		redirectURL = fmt.Sprintf("%s://%s%s/auth/callback", scheme, r.Host, basePath)
+	}
+
+	scopes := a.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     a.config.ClientID,
+		ClientSecret: a.clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  metadata.AuthorizationEndpoint,
+			TokenURL: metadata.TokenEndpoint,
+		},
+	}
+}
+
+// sign returns the payload as JSON with an HMAC, encoded for a cookie value
+func (a *oidcAuth) sign(payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verify checks a value created by sign and decodes its payload
+func (a *oidcAuth) verify(value string, payload any) error {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return errors.New("malformed cookie")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	expected, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.New("invalid cookie signature")
+	}
+	return json.Unmarshal(data, payload)
+}
+
+// session returns the logged-in user of a request, or nil
+func (a *oidcAuth) session(r *http.Request) *OIDCSession {
+	cookie, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return nil
+	}
+	var session OIDCSession
+	if err := a.verify(cookie.Value, &session); err != nil || time.Now().After(session.ExpiresAt) {
+		return nil
+	}
+	return &session
+}
+
+// setCookie sets a cookie only sent back to the GUI's own paths and never to scripts
+func setCookie(w http.ResponseWriter, r *http.Request, basePath, name, value string, expires time.Time) {
+	path := basePath
+	if path == "" {
+		path = "/"
+	}
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Expires = expires
+	}
+	http.SetCookie(w, cookie)
+}
+
+// randomToken returns a random URL-safe string for state and nonce values
+func randomToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// idTokenClaims are the ID token claims checked on login
+type idTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      json.RawMessage `json:"aud"`
+	Expiry        int64           `json:"exp"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified *bool           `json:"email_verified"`
+	Name          string          `json:"name"`
+}
+
+// parseIDToken decodes the claims of an ID token and checks issuer, audience, expiry and nonce.
+// The token comes straight from the provider's token endpoint over TLS, which OpenID Connect
+// accepts instead of checking its signature.
+func (a *oidcAuth) parseIDToken(rawToken, issuer, nonce string) (*idTokenClaims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("the ID token is malformed")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("the ID token is malformed")
+	}
+
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("the ID token is malformed")
+	}
+
+	var audience []string
+	if err := json.Unmarshal(claims.Audience, &audience); err != nil {
+		var single string
+		if err := json.Unmarshal(claims.Audience, &single); err != nil {
+			return nil, errors.New("the ID token has no audience")
+		}
+		audience = []string{single}
+	}
+
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(issuer, "/"):
+		return nil, fmt.Errorf("the ID token was issued by %s", claims.Issuer)
+	case !slices.Contains(audience, a.config.ClientID):
+		return nil, errors.New("the ID token was issued for another client")
+	case time.Now().After(time.Unix(claims.Expiry, 0)):
+		return nil, errors.New("the ID token has expired")
+	case claims.Nonce != nonce:
+		return nil, errors.New("the ID token does not belong to this login")
+	case claims.Subject == "":
+		return nil, errors.New("the ID token has no subject")
+	}
+	return &claims, nil
+}
+
+// allowed reports whether the user may use the GUI
+func (a *oidcAuth) allowed(claims *idTokenClaims) bool {
+	if len(a.config.AllowedEmails) == 0 && len(a.config.AllowedDomains) == 0 {
+		return true
+	}
+	if claims.Email == "" || (claims.EmailVerified != nil && !*claims.EmailVerified) {
+		return false
+	}
+	email := strings.ToLower(claims.Email)
+	for _, allowed := range a.config.AllowedEmails {
+		if strings.ToLower(allowed) == email {
+			return true
+		}
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	for _, allowed := range a.config.AllowedDomains {
+		if strings.ToLower(strings.TrimPrefix(allowed, "@")) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcPublicPath reports whether a path is served without a login: the login flow itself,
+// static assets, the version probe used by other aproxymate processes, health probes and
+// token-checked control calls
+func oidcPublicPath(path string) bool {
+	return strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/static/") ||
+		path == "/api/version" || path == "/api/shutdown" || path == "/healthz" || path == "/readyz"
+}
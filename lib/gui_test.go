@@ -0,0 +1,256 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// newLoginGUI returns a GUI that requires an OIDC login, and a cookie of a logged-in user
+func newLoginGUI(t *testing.T) (*GUI, *http.Cookie) {
+	t.Helper()
+	auth, err := newOIDCAuth(OIDCConfig{Issuer: "https://login.example.com", ClientID: "aproxymate", SessionSecret: "test-secret"})
+	if err != nil {
+		t.Fatalf("newOIDCAuth: %v", err)
+	}
+	value, err := auth.sign(OIDCSession{Subject: "user-1", Email: "user@example.com", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	gui := NewGUI()
+	gui.oidc = auth
+	return gui, &http.Cookie{Name: oidcSessionCookie, Value: value}
+}
+
+func TestRoutesReadOnlyWithLogin(t *testing.T) {
+	gui, session := newLoginGUI(t)
+	gui.readOnly = true
+	handler := gui.routes()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		loggedIn bool
+		want     int
+	}{
+		{"change without login", http.MethodPost, "/api/proxy", false, http.StatusUnauthorized},
+		{"change when logged in", http.MethodPost, "/api/proxy", true, http.StatusForbidden},
+		{"delete when logged in", http.MethodDelete, "/api/proxy/1", true, http.StatusForbidden},
+		{"save when logged in", http.MethodPost, "/api/config/save", true, http.StatusForbidden},
+		{"status when logged in", http.MethodGet, "/api/status", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`))
+			if tt.loggedIn {
+				req.AddCookie(session)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d (%s)", tt.method, tt.path, rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+			}
+		})
+	}
+}
+
+// TestGUIConcurrentRequests polls the status while rows are added, connected, disconnected,
+// deleted and saved. It finds lock mistakes in the handlers when run with go test -race.
+func TestGUIConcurrentRequests(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), ConfigFilename)
+	viper.Reset()
+	viper.SetConfigFile(configFile)
+	t.Cleanup(viper.Reset)
+
+	gui := NewGUI()
+	gui.configFileLoaded = true
+	gui.manager.relay = newFakeRelay().start
+	t.Cleanup(gui.manager.DisconnectAll)
+	handler := gui.routes()
+
+	request := func(method, path, body string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if rec.Code >= http.StatusInternalServerError {
+			t.Errorf("%s %s = %d: %s", method, path, rec.Code, strings.TrimSpace(rec.Body.String()))
+		}
+	}
+
+	const workers = 4
+	const rounds = 10
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	var pollers sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				request(http.MethodGet, "/api/status", "")
+				request(http.MethodGet, "/api/proxy", "")
+				request(http.MethodGet, "/api/page", "")
+			}
+		}()
+	}
+
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				spec := testSpec(t, fmt.Sprintf("%d", 100+worker*rounds+round))
+				row := fmt.Sprintf(`{"id":%q,"cluster":%q,"host":%q,"localPort":%d,"remotePort":%d}`,
+					spec.ID, spec.KubernetesCluster, spec.RemoteHost, spec.LocalPort, spec.RemotePort)
+
+				request(http.MethodPost, "/api/proxy", row)
+				request(http.MethodPost, "/api/connect", row)
+				request(http.MethodPost, "/api/config/save", `{}`)
+				request(http.MethodPost, "/api/disconnect/"+spec.ID+"?force=true", "")
+				if round%2 == 0 {
+					request(http.MethodDelete, "/api/proxy/"+spec.ID, "")
+				}
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+	close(stop)
+	pollers.Wait()
+
+	gui.mu.RLock()
+	defer gui.mu.RUnlock()
+	if want := 1 + workers*rounds/2; len(gui.rows) != want {
+		t.Errorf("GUI has %d rows, want %d", len(gui.rows), want)
+	}
+}
+
+func TestStrictConnectRefusesRowChanges(t *testing.T) {
+	gui := NewGUI()
+	gui.strictConnect = true
+	handler := gui.routes()
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/api/proxy", `{"id":"2","cluster":"prod","host":"db.internal","localPort":15432,"remotePort":5432}`},
+		{http.MethodPost, "/api/proxy", `{"id":"1","cluster":"prod","host":"db.internal","localPort":15432,"remotePort":5432}`},
+		{http.MethodDelete, "/api/proxy/1", ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s %s = %d, want %d", tt.method, tt.path, tt.body, rec.Code, http.StatusForbidden)
+		}
+	}
+
+	gui.mu.RLock()
+	defer gui.mu.RUnlock()
+	if row, exists := gui.rows["1"]; len(gui.rows) != 1 || !exists || row.KubernetesCluster != "" {
+		t.Errorf("rows changed in strict connect mode: %+v", gui.rows)
+	}
+}
+
+func TestStableRowIDs(t *testing.T) {
+	orders := ProxyConfig{Name: "Orders DB", KubernetesCluster: "prod", RemoteHost: "orders.internal", LocalPort: 15432, RemotePort: 5432}
+	ordersEU := ProxyConfig{Name: "orders-db", KubernetesCluster: "prod-eu", RemoteHost: "orders.internal", LocalPort: 15433, RemotePort: 5432}
+	users := ProxyConfig{Name: "Users", KubernetesCluster: "prod", RemoteHost: "users.internal", LocalPort: 15434, RemotePort: 5432}
+	unnamed := ProxyConfig{KubernetesCluster: "prod", RemoteHost: "cache.internal", LocalPort: 16379, RemotePort: 6379}
+	numbered := ProxyConfig{Name: "42", KubernetesCluster: "prod", RemoteHost: "legacy.internal", LocalPort: 15435, RemotePort: 5432}
+
+	ids := configRowIDs([]ProxyConfig{orders, ordersEU, users, unnamed, numbered})
+	if ids[2] != "users" || ids[3] != "cache-internal-16379" || ids[4] != "proxy-42" {
+		t.Errorf("IDs = %v", ids)
+	}
+	if ids[0] == ids[1] || !strings.HasPrefix(ids[0], "orders-db-") || !strings.HasPrefix(ids[1], "orders-db-") {
+		t.Errorf("colliding names got IDs %q and %q", ids[0], ids[1])
+	}
+
+	// Reordering entries or removing unrelated ones keeps every ID
+	reordered := configRowIDs([]ProxyConfig{users, ordersEU, orders})
+	if reordered[0] != ids[2] || reordered[1] != ids[1] || reordered[2] != ids[0] {
+		t.Errorf("IDs after reordering = %v, want %v", reordered, []string{ids[2], ids[1], ids[0]})
+	}
+
+	// IDs taken by existing rows get the same hash suffix
+	used := map[string]bool{"users": true}
+	if imported := stableRowIDs([]ProxyConfig{users}, used); imported[0] == "users" || !used[imported[0]] {
+		t.Errorf("ID of an entry whose ID is taken = %q", imported[0])
+	}
+
+	long := ProxyConfig{Name: strings.Repeat("very long name ", 5), RemoteHost: "a"}
+	otherLong := long
+	otherLong.RemoteHost = "b"
+	for _, id := range configRowIDs([]ProxyConfig{long, otherLong}) {
+		if len(id) > maxRowIDLength {
+			t.Errorf("ID %q is longer than %d characters", id, maxRowIDLength)
+		}
+	}
+}
+
+func TestDebugExecRequiresTokenAndJSON(t *testing.T) {
+	gui := NewGUI()
+	gui.debug = true
+	gui.instance = &GUIInstance{Token: "0123456789abcdef0123456789abcdef"}
+	handler := gui.routes()
+
+	tests := []struct {
+		name        string
+		token       string
+		contentType string
+		want        int
+	}{
+		{"without token", "", "application/json", http.StatusUnauthorized},
+		{"with wrong token", "not-the-token-of-this-instance", "application/json", http.StatusUnauthorized},
+		{"cross-site text body", gui.instance.Token, "text/plain", http.StatusUnsupportedMediaType},
+		{"form body", gui.instance.Token, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"token and JSON", gui.instance.Token, "application/json; charset=utf-8", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/debug/exec/unknown", strings.NewReader(`{"command":["id"]}`))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.token != "" {
+				req.Header.Set(guiTokenHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("POST /api/debug/exec/unknown = %d, want %d (%s)", rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+			}
+		})
+	}
+}
+
+func TestStartRefusesDebugOnNetworkAddress(t *testing.T) {
+	for _, address := range []string{"", "0.0.0.0", "192.168.1.10", "::"} {
+		gui := NewGUI()
+		gui.debug = true
+		if err := gui.SetBindAddress(address); err != nil {
+			t.Fatalf("SetBindAddress(%q): %v", address, err)
+		}
+		if err := gui.Start(0, nil); err == nil || !strings.Contains(err.Error(), "--debug") {
+			t.Errorf("Start with --debug on %q = %v, want it refused", address, err)
+		}
+	}
+	for _, address := range []string{"localhost", "127.0.0.1", "::1"} {
+		if !loopbackAddress(address) {
+			t.Errorf("loopbackAddress(%q) = false", address)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// HostTemplateData returns the values available to remote_host templates: the entry's vars,
+// plus Cluster and Name unless a var of that name overrides them
+func (p ProxyConfig) HostTemplateData() map[string]string {
+	data := map[string]string{
+		"Cluster": p.KubernetesCluster,
+		"Name":    p.Name,
+	}
+	for key, value := range p.Vars {
+		data[key] = value
+	}
+	return data
+}
+
+// ExpandRemoteHost returns remote_host with placeholders like {{ .Env }} or {{ .Cluster }} filled in
+func (p ProxyConfig) ExpandRemoteHost() (string, error) {
+	return expandHostTemplate(p.RemoteHost, p.HostTemplateData())
+}
+
+// expandHostTemplate fills in a host template; hosts without placeholders are returned unchanged
+func expandHostTemplate(host string, data map[string]string) (string, error) {
+	if !strings.Contains(host, "{{") {
+		return host, nil
+	}
+
+	tmpl, err := template.New("remote_host").Option("missingkey=error").Parse(host)
+	if err != nil {
+		return "", fmt.Errorf("an invalid remote host template %q: %w", host, err)
+	}
+	var expanded strings.Builder
+	if err := tmpl.Execute(&expanded, data); err != nil {
+		return "", fmt.Errorf("a remote host template %q that cannot be expanded: %w (set the value in the entry's 'vars')", host, err)
+	}
+	if expanded.Len() == 0 {
+		return "", fmt.Errorf("a remote host template %q that expands to an empty host", host)
+	}
+	return expanded.String(), nil
+}
+
+// expandRemoteHosts expands remote_host and remote_hosts
+func (p ProxyConfig) expandRemoteHosts() (ProxyConfig, error) {
+	data := p.HostTemplateData()
+	host, err := expandHostTemplate(p.RemoteHost, data)
+	if err != nil {
+		return p, err
+	}
+	p.RemoteHost = host
+
+	if len(p.RemoteHosts) > 0 {
+		hosts := make([]string, len(p.RemoteHosts))
+		for i, host := range p.RemoteHosts {
+			if hosts[i], err = expandHostTemplate(host, data); err != nil {
+				return p, err
+			}
+		}
+		p.RemoteHosts = hosts
+	}
+	return p, nil
+}
@@ -0,0 +1,260 @@
+package lib
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "aproxymate/lib/logger"
+)
+
+// httpGateway serves several HTTP proxies on one local port, routing each request by its path
+// prefix to the proxy's tunnel. The prefix is stripped and the Host header is set to the remote
+// host, so backends see requests as if they were addressed to them directly.
+type httpGateway struct {
+	listener net.Listener
+	server   *http.Server
+
+	mu     sync.Mutex
+	routes map[string]*httpRoute
+	closed bool
+}
+
+// clientAddrKey carries the HTTP client's address to the dial of the tunnel connection
+type clientAddrKey struct{}
+
+// NormalizeHTTPPath returns the path prefix without a trailing slash, e.g. "/service-a"
+func NormalizeHTTPPath(path string) string {
+	if path == "/" {
+		return path
+	}
+	return strings.TrimSuffix(path, "/")
+}
+
+// newHTTPGateway binds the shared local port and starts serving requests
+func newHTTPGateway(bindAddress string, localPort int) (*httpGateway, error) {
+	listener, err := listenTCP(bindAddress, localPort)
+	if err != nil {
+		return nil, err
+	}
+	gateway := &httpGateway{listener: listener, routes: make(map[string]*httpRoute)}
+	gateway.server = &http.Server{Handler: gateway}
+	go func() {
+		if err := gateway.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) && !gateway.Closed() {
+			log.Error("HTTP gateway stopped", "addr", listener.Addr().String(), "error", err)
+		}
+	}()
+	return gateway, nil
+}
+
+// Route registers a path prefix for a proxy and returns a listener that receives its tunnel
+// connections. Closing the listener removes the route; the gateway stops once its last route is gone.
+func (g *httpGateway) Route(prefix, remoteHost string, remotePort int, backendTLS bool) (net.Listener, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return nil, net.ErrClosed
+	}
+	prefix = NormalizeHTTPPath(prefix)
+	if _, taken := g.routes[prefix]; taken {
+		return nil, fmt.Errorf("HTTP path %s is already served on %s by another proxy", prefix, g.listener.Addr())
+	}
+
+	route := &httpRoute{
+		gateway: g,
+		prefix:  prefix,
+		conns:   make(chan net.Conn),
+		done:    make(chan struct{}),
+	}
+	route.proxy = route.reverseProxy(remoteHost, remotePort, backendTLS)
+	g.routes[prefix] = route
+	return route, nil
+}
+
+// Closed reports whether the gateway has stopped and a new one must be bound
+func (g *httpGateway) Closed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.closed
+}
+
+// remove drops a route and stops the gateway when no routes are left
+func (g *httpGateway) remove(route *httpRoute) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.routes[route.prefix] == route {
+		delete(g.routes, route.prefix)
+	}
+	if len(g.routes) == 0 && !g.closed {
+		g.closed = true
+		g.server.Close()
+	}
+}
+
+// match returns the route with the longest prefix matching the path
+func (g *httpGateway) match(path string) *httpRoute {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var best *httpRoute
+	for prefix, route := range g.routes {
+		if !pathHasPrefix(path, prefix) {
+			continue
+		}
+		if best == nil || len(prefix) > len(best.prefix) {
+			best = route
+		}
+	}
+	return best
+}
+
+// pathHasPrefix reports whether path is prefix or lies below it
+func pathHasPrefix(path, prefix string) bool {
+	if prefix == "/" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// ServeHTTP proxies a request to the matching route, listing the routes when none matches
+func (g *httpGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := g.match(r.URL.Path)
+	if route == nil {
+		g.mu.Lock()
+		prefixes := make([]string, 0, len(g.routes))
+		for prefix := range g.routes {
+			prefixes = append(prefixes, prefix+"/")
+		}
+		g.mu.Unlock()
+		sort.Strings(prefixes)
+		http.Error(w, fmt.Sprintf("No connected proxy serves %s. Available paths: %s", r.URL.Path, strings.Join(prefixes, ", ")), http.StatusNotFound)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), clientAddrKey{}, r.RemoteAddr)
+	route.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// httpRoute is the net.Listener a proxy's forwarder accepts the gateway's tunnel connections from
+type httpRoute struct {
+	gateway   *httpGateway
+	prefix    string
+	proxy     *httputil.ReverseProxy
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// reverseProxy builds the reverse proxy that sends requests through the route's tunnel
+func (r *httpRoute) reverseProxy(remoteHost string, remotePort int, backendTLS bool) *httputil.ReverseProxy {
+	scheme, defaultPort := "http", 80
+	if backendTLS {
+		scheme, defaultPort = "https", 443
+	}
+	host := remoteHost
+	if remotePort != defaultPort {
+		host = net.JoinHostPort(remoteHost, strconv.Itoa(remotePort))
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = scheme
+			pr.Out.URL.Host = host
+			pr.Out.Host = host
+			if r.prefix != "/" {
+				pr.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(pr.In.URL.Path, r.prefix), "/")
+				pr.Out.URL.RawPath = ""
+				pr.Out.Header.Set("X-Forwarded-Prefix", r.prefix)
+			}
+			pr.SetXForwarded()
+		},
+		// Keep redirects to absolute paths below the prefix
+		ModifyResponse: func(resp *http.Response) error {
+			location := resp.Header.Get("Location")
+			if r.prefix != "/" && strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") {
+				resp.Header.Set("Location", r.prefix+location)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Warn("HTTP gateway request failed", "path", req.URL.Path, "backend", host, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to reach %s through the tunnel: %v", host, err), http.StatusBadGateway)
+		},
+		// Every request dials its own tunnel connection, so the forwarder's client access
+		// policy sees the address of the client that sent it
+		Transport: &http.Transport{
+			DialContext:       r.dial,
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{ServerName: remoteHost},
+		},
+	}
+}
+
+// dial hands one end of an in-memory connection to the proxy's forwarder
+func (r *httpRoute) dial(ctx context.Context, _, _ string) (net.Conn, error) {
+	client, server := net.Pipe()
+	conn := &gatewayConn{Conn: server, remoteAddr: gatewayClientAddr(ctx)}
+	select {
+	case r.conns <- conn:
+		return client, nil
+	case <-r.done:
+		client.Close()
+		server.Close()
+		return nil, fmt.Errorf("proxy for %s is disconnected", r.prefix)
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// gatewayClientAddr returns the address of the HTTP client that made a request
+func gatewayClientAddr(ctx context.Context) net.Addr {
+	remoteAddr, _ := ctx.Value(clientAddrKey{}).(string)
+	if addr, err := net.ResolveTCPAddr("tcp", remoteAddr); err == nil {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
+
+// gatewayConn reports the HTTP client as the remote address of a tunnel connection
+type gatewayConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+func (c *gatewayConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+// Accept waits for the next tunnel connection of the route
+func (r *httpRoute) Accept() (net.Conn, error) {
+	select {
+	case conn := <-r.conns:
+		return conn, nil
+	case <-r.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close removes the route from the gateway
+func (r *httpRoute) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.gateway.remove(r)
+	})
+	return nil
+}
+
+// Addr returns the shared local address
+func (r *httpRoute) Addr() net.Addr {
+	return r.gateway.listener.Addr()
+}
@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// instanceLabel marks the pods of a named instance, so each instance only cleans up and adopts
+// its own pods. Pods of the default instance don't have it.
+const instanceLabel = "aproxymate.instance"
+
+// instanceNamePattern keeps instance names usable as label values and directory names
+var instanceNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,38}[a-z0-9])?$`)
+
+// instanceName names the instance of this process; empty for the default instance
+var instanceName string
+
+// SetInstanceName makes this process a named instance, with its own pod labels, state files
+// and default GUI port, so it can run next to other instances of the same user
+func SetInstanceName(name string) error {
+	if name != "" && !instanceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid instance name %q: use up to 40 lowercase letters, digits and '-', starting and ending with a letter or digit", name)
+	}
+	instanceName = name
+	return nil
+}
+
+// InstanceName returns the name of this process's instance, or "" for the default instance
+func InstanceName() string {
+	return instanceName
+}
+
+// InstanceDefaultPort returns the default GUI port of this instance: port itself for the default
+// instance, and a port between port+1 and port+1000 derived from the name for named ones
+func InstanceDefaultPort(port int) int {
+	if instanceName == "" {
+		return port
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(instanceName))
+	return port + 1 + int(hash.Sum32()%1000)
+}
+
+// stateDir returns the directory of this instance's state files in the user cache directory
+func stateDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	dir = filepath.Join(dir, "aproxymate")
+	if instanceName != "" {
+		dir = filepath.Join(dir, "instances", instanceName)
+	}
+	return dir
+}
+
+// instanceSelector returns the label selector requirement matching this instance's pods
+func instanceSelector() string {
+	if instanceName == "" {
+		return "!" + instanceLabel
+	}
+	return instanceLabel + "=" + instanceName
+}
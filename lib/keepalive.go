@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// KeepaliveConfig sets TCP keepalive probes on tunnel connections, so that NAT gateways and
+// firewalls between the relay pod and the remote host don't drop idle connections. Values are
+// in seconds; zero keeps the system default.
+type KeepaliveConfig struct {
+	// Idle is how long a connection is idle before the first probe
+	Idle int `json:"idle,omitempty" mapstructure:"idle" yaml:"idle,omitempty"`
+	// Interval is the time between probes
+	Interval int `json:"interval,omitempty" mapstructure:"interval" yaml:"interval,omitempty"`
+	// Count is the number of unanswered probes after which the connection is dropped
+	Count int `json:"count,omitempty" mapstructure:"count" yaml:"count,omitempty"`
+}
+
+// Enabled reports whether any keepalive setting is configured
+func (c KeepaliveConfig) Enabled() bool {
+	return c.Idle > 0 || c.Interval > 0 || c.Count > 0
+}
+
+// Validate checks that no value is negative
+func (c KeepaliveConfig) Validate() error {
+	if c.Idle < 0 || c.Interval < 0 || c.Count < 0 {
+		return fmt.Errorf("idle, interval and count must not be negative")
+	}
+	return nil
+}
+
+// merge returns the settings with the non-zero values of override applied
+func (c KeepaliveConfig) merge(override KeepaliveConfig) KeepaliveConfig {
+	if override.Idle > 0 {
+		c.Idle = override.Idle
+	}
+	if override.Interval > 0 {
+		c.Interval = override.Interval
+	}
+	if override.Count > 0 {
+		c.Count = override.Count
+	}
+	return c
+}
+
+// netConfig returns the settings for local client connections
+func (c KeepaliveConfig) netConfig() net.KeepAliveConfig {
+	return net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     time.Duration(c.Idle) * time.Second,
+		Interval: time.Duration(c.Interval) * time.Second,
+		Count:    c.Count,
+	}
+}
+
+// socatOptions returns the socat address options for the relay's connection to the remote
+// host, e.g. ",keepalive,keepidle=60,keepintvl=15"
+func (c KeepaliveConfig) socatOptions() string {
+	if !c.Enabled() {
+		return ""
+	}
+	options := []string{"keepalive"}
+	if c.Idle > 0 {
+		options = append(options, fmt.Sprintf("keepidle=%d", c.Idle))
+	}
+	if c.Interval > 0 {
+		options = append(options, fmt.Sprintf("keepintvl=%d", c.Interval))
+	}
+	if c.Count > 0 {
+		options = append(options, fmt.Sprintf("keepcnt=%d", c.Count))
+	}
+	return "," + strings.Join(options, ",")
+}
@@ -0,0 +1,33 @@
+package lib
+
+import (
+	"errors"
+)
+
+// keychainService groups aproxymate's entries in the OS credential store
+const keychainService = "aproxymate"
+
+var (
+	// ErrSecretNotFound is returned when the keychain has no entry for a key
+	ErrSecretNotFound = errors.New("secret not found in the OS keychain")
+	// ErrKeychainUnavailable is returned when the platform has no usable credential store,
+	// e.g. a headless Linux machine without a Secret Service provider
+	ErrKeychainUnavailable = errors.New("no OS keychain available")
+)
+
+// Keychain stores small secrets in the operating system's credential store: the macOS
+// Keychain, the Secret Service (GNOME Keyring, KWallet) on Linux or the Windows Credential
+// Manager. Callers fall back to a private file when it returns an error.
+type Keychain interface {
+	// Get returns the secret stored under key, or ErrSecretNotFound
+	Get(key string) (string, error)
+	// Set stores the secret under key, replacing an existing one
+	Set(key, secret string) error
+	// Delete removes the secret stored under key; a missing entry is not an error
+	Delete(key string) error
+}
+
+// SystemKeychain returns the credential store of the current platform
+func SystemKeychain() Keychain {
+	return newSystemKeychain()
+}
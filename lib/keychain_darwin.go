@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// macKeychain keeps secrets in the login keychain through the security tool
+type macKeychain struct{}
+
+func newSystemKeychain() Keychain {
+	return macKeychain{}
+}
+
+// Get returns the secret stored under key
+func (macKeychain) Get(key string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", key, "-w").Output()
+	if err != nil {
+		// Exit status 44 means the item could not be found
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+			return "", ErrSecretNotFound
+		}
+		return "", fmt.Errorf("failed to read %s from the keychain: %w", key, err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// Set stores the secret under key. The command is passed on stdin so the secret does not
+// show up in the process list.
+func (macKeychain) Set(key, secret string) error {
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		strconv.Quote(keychainService), strconv.Quote(key), strconv.Quote(secret))
+
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to store %s in the keychain: %v %s", key, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Delete removes the secret stored under key
+func (macKeychain) Delete(key string) error {
+	err := exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", key).Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from the keychain: %w", key, err)
+	}
+	return nil
+}
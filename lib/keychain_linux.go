@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secretServiceKeychain keeps secrets in the Secret Service (GNOME Keyring, KWallet) through secret-tool
+type secretServiceKeychain struct{}
+
+func newSystemKeychain() Keychain {
+	return secretServiceKeychain{}
+}
+
+// run runs secret-tool, reporting ErrKeychainUnavailable when it is missing. A failure without
+// any message on stderr is how secret-tool reports that no entry matched.
+func (secretServiceKeychain) run(stdin string, args ...string) (out []byte, notFound bool, err error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, false, fmt.Errorf("%w: secret-tool is not installed (package libsecret-tools)", ErrKeychainUnavailable)
+	}
+
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err = cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && stderr.Len() == 0 {
+		return out, true, err
+	}
+	if err != nil && stderr.Len() > 0 {
+		return out, false, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, false, err
+}
+
+// Get returns the secret stored under key
+func (k secretServiceKeychain) Get(key string) (string, error) {
+	out, notFound, err := k.run("", "lookup", "service", keychainService, "key", key)
+	if notFound {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from the Secret Service: %w", key, err)
+	}
+	return string(out), nil
+}
+
+// Set stores the secret under key. secret-tool reads the secret from stdin so it does not
+// show up in the process list.
+func (k secretServiceKeychain) Set(key, secret string) error {
+	_, _, err := k.run(secret, "store", "--label", keychainService+" "+key, "service", keychainService, "key", key)
+	if err != nil {
+		return fmt.Errorf("failed to store %s in the Secret Service: %w", key, err)
+	}
+	return nil
+}
+
+// Delete removes the secret stored under key
+func (k secretServiceKeychain) Delete(key string) error {
+	_, notFound, err := k.run("", "clear", "service", keychainService, "key", key)
+	if err != nil && !notFound {
+		return fmt.Errorf("failed to delete %s from the Secret Service: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build !darwin && !linux && !windows
+
+package lib
+
+// unsupportedKeychain is used on platforms without a supported credential store
+type unsupportedKeychain struct{}
+
+func newSystemKeychain() Keychain {
+	return unsupportedKeychain{}
+}
+
+// Get always fails with ErrKeychainUnavailable
+func (unsupportedKeychain) Get(string) (string, error) {
+	return "", ErrKeychainUnavailable
+}
+
+// Set always fails with ErrKeychainUnavailable
+func (unsupportedKeychain) Set(string, string) error {
+	return ErrKeychainUnavailable
+}
+
+// Delete always fails with ErrKeychainUnavailable
+func (unsupportedKeychain) Delete(string) error {
+	return ErrKeychainUnavailable
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Windows Credential Manager API, see wincred.h
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// winCredential mirrors the CREDENTIALW structure
+type winCredential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// windowsKeychain keeps secrets as generic credentials in the Windows Credential Manager
+type windowsKeychain struct{}
+
+func newSystemKeychain() Keychain {
+	return windowsKeychain{}
+}
+
+// target returns the credential name for a key, e.g. "aproxymate:gui-token"
+func (windowsKeychain) target(key string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(keychainService + ":" + key)
+}
+
+// Get returns the secret stored under key
+func (k windowsKeychain) Get(key string) (string, error) {
+	target, err := k.target(key)
+	if err != nil {
+		return "", err
+	}
+
+	var cred *winCredential
+	ret, _, callErr := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ret == 0 {
+		if errors.Is(callErr, errorNotFound) {
+			return "", ErrSecretNotFound
+		}
+		return "", fmt.Errorf("failed to read %s from the Credential Manager: %w", key, callErr)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+// Set stores the secret under key
+func (k windowsKeychain) Set(key, secret string) error {
+	target, err := k.target(key)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(keychainService)
+	if err != nil {
+		return err
+	}
+
+	cred := winCredential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(secret)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(secret) > 0 {
+		blob := []byte(secret)
+		cred.CredentialBlob = &blob[0]
+	}
+
+	ret, _, callErr := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if ret == 0 {
+		return fmt.Errorf("failed to store %s in the Credential Manager: %w", key, callErr)
+	}
+	return nil
+}
+
+// Delete removes the secret stored under key
+func (k windowsKeychain) Delete(key string) error {
+	target, err := k.target(key)
+	if err != nil {
+		return err
+	}
+
+	ret, _, callErr := procCredDelete.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if ret == 0 && !errors.Is(callErr, errorNotFound) {
+		return fmt.Errorf("failed to delete %s from the Credential Manager: %w", key, callErr)
+	}
+	return nil
+}
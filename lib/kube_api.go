@@ -0,0 +1,216 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	log "aproxymate/lib/logger"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// defaultKubernetesAPIRetries is how often a rejected pod call is retried by default
+	defaultKubernetesAPIRetries = 4
+	// defaultKubernetesAPIRetryBackoff is the wait before the first retry; it doubles after each one
+	defaultKubernetesAPIRetryBackoff = 500 * time.Millisecond
+	// maxKubernetesAPIRetryBackoff caps the wait between retries
+	maxKubernetesAPIRetryBackoff = 10 * time.Second
+)
+
+// KubernetesAPIConfig tunes the Kubernetes API clients for busy shared clusters
+type KubernetesAPIConfig struct {
+	// QPS and Burst are the client-side rate limit (client-go defaults: 5 and 10)
+	QPS   float32 `json:"qps,omitempty" mapstructure:"qps" yaml:"qps,omitempty"`
+	Burst int     `json:"burst,omitempty" mapstructure:"burst" yaml:"burst,omitempty"`
+	// Retries is how often pod create, delete and list calls are retried after a 429 or 5xx
+	// response (default 4, -1 disables retries)
+	Retries int `json:"retries,omitempty" mapstructure:"retries" yaml:"retries,omitempty"`
+	// RetryBackoff is the wait before the first retry, e.g. "500ms"; it doubles after each retry
+	RetryBackoff string `json:"retry_backoff,omitempty" mapstructure:"retry_backoff" yaml:"retry_backoff,omitempty"`
+	// ProxyURL is the HTTP(S) or SOCKS5 proxy the API servers are reached through, overriding
+	// HTTPS_PROXY and the kubeconfig's proxy-url; "direct" connects without a proxy
+	ProxyURL string `json:"proxy_url,omitempty" mapstructure:"proxy_url" yaml:"proxy_url,omitempty"`
+	// ProxyURLs overrides ProxyURL by Kubernetes context
+	ProxyURLs map[string]string `json:"proxy_urls,omitempty" mapstructure:"proxy_urls" yaml:"proxy_urls,omitempty"`
+}
+
+// Validate checks the rate limit and retry settings
+func (c KubernetesAPIConfig) Validate() error {
+	if c.QPS < 0 {
+		return fmt.Errorf("qps must not be negative")
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	if c.Retries < -1 {
+		return fmt.Errorf("retries must be -1 (disabled) or more")
+	}
+	if _, err := c.retryBackoff(); err != nil {
+		return err
+	}
+	if err := validateAPIProxyURL(c.ProxyURL); err != nil {
+		return fmt.Errorf("proxy_url %w", err)
+	}
+	for context, proxyURL := range c.ProxyURLs {
+		if err := validateAPIProxyURL(proxyURL); err != nil {
+			return fmt.Errorf("proxy_urls of context '%s' %w", context, err)
+		}
+	}
+	return nil
+}
+
+// apiProxyDirect is the proxy URL that connects to an API server without a proxy
+const apiProxyDirect = "direct"
+
+// validateAPIProxyURL checks a proxy URL for reaching an API server; empty means the default
+func validateAPIProxyURL(proxyURL string) error {
+	if proxyURL == "" || proxyURL == apiProxyDirect {
+		return nil
+	}
+	parsed, err := url.Parse(proxyURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("must be a URL such as http://proxy:3128 or socks5://bastion:1080, or \"direct\", got '%s'", proxyURL)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5":
+		return nil
+	default:
+		return fmt.Errorf("has unsupported scheme '%s' (use http, https or socks5)", parsed.Scheme)
+	}
+}
+
+// WithProxyURLs adds the api_proxy_url of proxy entries as overrides for their contexts
+func (c KubernetesAPIConfig) WithProxyURLs(proxies []ProxyConfig) KubernetesAPIConfig {
+	overrides := make(map[string]string, len(c.ProxyURLs))
+	for context, proxyURL := range c.ProxyURLs {
+		overrides[context] = proxyURL
+	}
+	for _, proxy := range proxies {
+		if proxy.APIProxyURL != "" && proxy.KubernetesCluster != "" {
+			overrides[proxy.KubernetesCluster] = proxy.APIProxyURL
+		}
+	}
+	c.ProxyURLs = overrides
+	return c
+}
+
+// proxyURL returns the proxy URL configured for a context; empty leaves the choice to client-go
+func (c KubernetesAPIConfig) proxyURL(context string) string {
+	if proxyURL, ok := c.ProxyURLs[context]; ok {
+		return proxyURL
+	}
+	return c.ProxyURL
+}
+
+// retryBackoff returns the wait before the first retry
+func (c KubernetesAPIConfig) retryBackoff() (time.Duration, error) {
+	if c.RetryBackoff == "" {
+		return defaultKubernetesAPIRetryBackoff, nil
+	}
+	backoff, err := time.ParseDuration(c.RetryBackoff)
+	if err != nil || backoff <= 0 {
+		return 0, fmt.Errorf("retry_backoff must be a positive duration such as 500ms, got '%s'", c.RetryBackoff)
+	}
+	return backoff, nil
+}
+
+// retries returns how often a call is retried
+func (c KubernetesAPIConfig) retries() int {
+	switch {
+	case c.Retries < 0:
+		return 0
+	case c.Retries == 0:
+		return defaultKubernetesAPIRetries
+	default:
+		return c.Retries
+	}
+}
+
+// apply sets the rate limit and the proxy of the context on a client config. Without a proxy
+// URL, client-go uses the kubeconfig's proxy-url or HTTPS_PROXY, for API calls and port-forwards alike.
+func (c KubernetesAPIConfig) apply(context string, config *rest.Config) {
+	if c.QPS > 0 {
+		config.QPS = c.QPS
+	}
+	if c.Burst > 0 {
+		config.Burst = c.Burst
+	}
+
+	switch proxyURL := c.proxyURL(context); proxyURL {
+	case "":
+	case apiProxyDirect:
+		config.Proxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+	default:
+		if parsed, err := url.Parse(proxyURL); err == nil {
+			config.Proxy = http.ProxyURL(parsed)
+		}
+	}
+}
+
+var (
+	kubeAPIMu     sync.RWMutex
+	kubeAPIConfig KubernetesAPIConfig
+)
+
+// SetKubernetesAPIConfig sets the rate limit and retries of Kubernetes clients created from now on
+func SetKubernetesAPIConfig(config KubernetesAPIConfig) {
+	kubeAPIMu.Lock()
+	defer kubeAPIMu.Unlock()
+	kubeAPIConfig = config
+}
+
+// currentKubernetesAPIConfig returns the settings of SetKubernetesAPIConfig
+func currentKubernetesAPIConfig() KubernetesAPIConfig {
+	kubeAPIMu.RLock()
+	defer kubeAPIMu.RUnlock()
+	return kubeAPIConfig
+}
+
+// retryableAPIError reports whether a call may succeed when repeated: the API server was
+// throttling or had a temporary problem
+func retryableAPIError(err error) bool {
+	if apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) ||
+		apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) {
+		return true
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return status.Status().Code >= 500
+	}
+	return false
+}
+
+// retryKubernetesCall runs call, repeating it with exponential backoff and jitter while the API
+// server answers with 429 or 5xx. A Retry-After of the server is honored. retried is false on
+// the first run, so that calls can tell whether an earlier attempt may have gone through.
+func retryKubernetesCall(ctx context.Context, operation string, call func(retried bool) error) error {
+	config := currentKubernetesAPIConfig()
+	backoff, _ := config.retryBackoff()
+	retries := config.retries()
+
+	err := call(false)
+	for attempt := 1; attempt <= retries && err != nil && retryableAPIError(err); attempt++ {
+		wait := backoff/2 + rand.N(backoff/2+1)
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > wait {
+			wait = time.Duration(seconds) * time.Second
+		}
+		log.Debug("Retrying Kubernetes API call", "operation", operation, "attempt", attempt, "wait", wait, "error", err)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		err = call(true)
+		backoff = min(backoff*2, maxKubernetesAPIRetryBackoff)
+	}
+	return err
+}
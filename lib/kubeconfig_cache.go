@@ -0,0 +1,147 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/homedir"
+
+	log "aproxymate/lib/logger"
+)
+
+// kubeconfigCacheTTL bounds how long a parsed kubeconfig is reused. The GUI also watches the
+// file and drops the cache as soon as it changes.
+const kubeconfigCacheTTL = 30 * time.Second
+
+// kubeconfigWatchInterval is how often WatchKubeconfig checks the file for changes
+const kubeconfigWatchInterval = 2 * time.Second
+
+// cachedKubeconfig is a parsed kubeconfig file
+type cachedKubeconfig struct {
+	config   *clientcmdapi.Config
+	loadedAt time.Time
+}
+
+// kubeconfigCache holds parsed kubeconfig files by path. The mutex is held while loading, so
+// concurrent callers share one read of the file.
+var kubeconfigCache = struct {
+	sync.Mutex
+	entries map[string]cachedKubeconfig
+}{entries: make(map[string]cachedKubeconfig)}
+
+// defaultKubeconfigPath is the kubeconfig set with SetKubeconfigPath
+var defaultKubeconfigPath string
+
+// SetKubeconfigPath makes Kubernetes clients, context lists and validations use the kubeconfig at
+// path instead of ~/.kube/config, e.g. a temporary one in CI; empty restores ~/.kube/config
+func SetKubeconfigPath(path string) {
+	defaultKubeconfigPath = path
+}
+
+// resolveKubeconfigPath returns the given kubeconfig path, or else the one of SetKubeconfigPath
+// or ~/.kube/config
+func resolveKubeconfigPath(kubeconfigPath string) (string, error) {
+	if kubeconfigPath != "" {
+		return kubeconfigPath, nil
+	}
+	if defaultKubeconfigPath != "" {
+		return defaultKubeconfigPath, nil
+	}
+	if home := homedir.HomeDir(); home != "" {
+		return filepath.Join(home, ".kube", "config"), nil
+	}
+	return "", fmt.Errorf("unable to locate kubeconfig: home directory not found and no path provided")
+}
+
+// loadKubeconfig returns the parsed kubeconfig file, reusing a recent read. The result is
+// shared between callers and must not be modified.
+func loadKubeconfig(kubeconfigPath string) (*clientcmdapi.Config, error) {
+	path, err := resolveKubeconfigPath(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeconfigCache.Lock()
+	defer kubeconfigCache.Unlock()
+
+	if entry, ok := kubeconfigCache.entries[path]; ok && time.Since(entry.loadedAt) < kubeconfigCacheTTL {
+		return entry.config, nil
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("kubeconfig file not found at path: %s", path)
+	}
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	kubeconfigCache.entries[path] = cachedKubeconfig{config: config, loadedAt: time.Now()}
+	return config, nil
+}
+
+// InvalidateKubeconfigCache drops all parsed kubeconfig files, e.g. after `tsh kube login`
+// rewrote them
+func InvalidateKubeconfigCache() {
+	kubeconfigCache.Lock()
+	defer kubeconfigCache.Unlock()
+	clear(kubeconfigCache.entries)
+}
+
+// WatchKubeconfig polls the kubeconfig file and, when it changes, invalidates the cache and
+// calls onChange. The returned function stops watching.
+func WatchKubeconfig(kubeconfigPath string, onChange func()) func() {
+	stop := make(chan struct{})
+	path, err := resolveKubeconfigPath(kubeconfigPath)
+	if err != nil {
+		log.Debug("Not watching kubeconfig", "error", err)
+		return func() {}
+	}
+
+	// fileState identifies a version of the file; a missing file has the zero state
+	type fileState struct {
+		modTime time.Time
+		size    int64
+	}
+	stat := func() fileState {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fileState{}
+		}
+		return fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	go func() {
+		ticker := time.NewTicker(kubeconfigWatchInterval)
+		defer ticker.Stop()
+
+		last := stat()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				current := stat()
+				if current == last {
+					continue
+				}
+				last = current
+				log.Debug("Kubeconfig changed, dropping cached contexts", "path", path)
+				InvalidateKubeconfigCache()
+				if onChange != nil {
+					onChange()
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
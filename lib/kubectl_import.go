@@ -0,0 +1,261 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PortForwardSkip is a kubectl port-forward command that could not be converted
+type PortForwardSkip struct {
+	Command string
+	Reason  string
+}
+
+// ParsePortForwardCommands converts the kubectl port-forward commands found in a shell history
+// file or command list into proxy configs. Bash, zsh (extended history) and fish history formats
+// are understood; other lines are ignored. Commands without --context use defaultCluster, and
+// names are chosen so they don't clash with the existing entries.
+// Only Services can be imported, since pods and deployments have no stable address to relay to.
+// Local ports given as ":remote" are left 0 for the caller to assign.
+func ParsePortForwardCommands(r io.Reader, defaultCluster string, existing []ProxyConfig) ([]ProxyConfig, []PortForwardSkip, error) {
+	var configs []ProxyConfig
+	var skipped []PortForwardSkip
+	seen := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, config := range existing {
+		names[strings.ToLower(config.Name)] = true
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := historyCommand(scanner.Text())
+		if !strings.Contains(line, "port-forward") {
+			continue
+		}
+		for _, args := range shellCommands(line) {
+			args = kubectlArgs(args)
+			if len(args) == 0 || !slices.Contains(args, "port-forward") {
+				continue
+			}
+			command := strings.Join(args, " ")
+			config, err := parsePortForward(args, defaultCluster)
+			if err != nil {
+				skipped = append(skipped, PortForwardSkip{Command: command, Reason: err.Error()})
+				continue
+			}
+
+			// History files repeat the same commands
+			key := fmt.Sprintf("%s|%s|%s|%v", config.KubernetesCluster, config.RemoteHost, config.LocalEndpoint(), config.RemotePort)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			config.Name = uniqueImportName(config, names)
+			configs = append(configs, config)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read kubectl commands: %w", err)
+	}
+	return configs, skipped, nil
+}
+
+// historyCommand strips the zsh extended history and fish history prefixes from a line
+func historyCommand(line string) string {
+	line = strings.TrimSpace(line)
+	// zsh: ": 1700000000:0;kubectl port-forward ..."
+	if strings.HasPrefix(line, ": ") {
+		if i := strings.Index(line, ";"); i >= 0 {
+			return line[i+1:]
+		}
+	}
+	// fish: "- cmd: kubectl port-forward ..."
+	return strings.TrimPrefix(line, "- cmd: ")
+}
+
+// shellCommands splits a command line into the words of each command, honoring quotes and
+// backslashes and splitting at ;, &, && and |
+func shellCommands(line string) [][]string {
+	var commands [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			commands = append(commands, words)
+			words = nil
+		}
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == ' ' || r == '\t':
+			endWord()
+		case r == ';' || r == '&' || r == '|':
+			endCommand()
+		case r == '#' && !inWord:
+			endCommand()
+			return commands
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands
+}
+
+// kubectlArgs returns the arguments after kubectl, skipping prefixes such as environment
+// assignments, sudo or nohup, or nil when the command isn't kubectl
+func kubectlArgs(words []string) []string {
+	for i, word := range words {
+		if path.Base(word) == "kubectl" {
+			return words[i+1:]
+		}
+	}
+	return nil
+}
+
+// parsePortForward converts the arguments of one kubectl port-forward command
+func parsePortForward(args []string, defaultCluster string) (ProxyConfig, error) {
+	config := ProxyConfig{KubernetesCluster: defaultCluster}
+	namespace := ""
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		takeValue := func() string {
+			if hasValue {
+				return value
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+
+		switch name {
+		case "port-forward":
+		case "--context":
+			config.KubernetesCluster = takeValue()
+		case "-n", "--namespace":
+			namespace = takeValue()
+		case "--address":
+			// Only the first address is used; aproxymate listens on one
+			address, _, _ := strings.Cut(takeValue(), ",")
+			if address != "localhost" && address != "127.0.0.1" {
+				config.LocalBindAddress = address
+			}
+		case "--kubeconfig", "--pod-running-timeout", "--cluster", "--user", "-s", "--server", "--token":
+			takeValue()
+		default:
+			if strings.HasPrefix(arg, "-") {
+				// Boolean flags such as -v=4 or --insecure-skip-tls-verify
+				continue
+			}
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) < 2 {
+		return ProxyConfig{}, fmt.Errorf("no resource or ports given")
+	}
+	kind, service, found := strings.Cut(positional[0], "/")
+	if !found || kind == "pod" || kind == "pods" || kind == "po" {
+		return ProxyConfig{}, fmt.Errorf("'%s' is a pod, which has no stable address; port-forward to its Service instead", positional[0])
+	}
+	if kind != "svc" && kind != "service" && kind != "services" {
+		return ProxyConfig{}, fmt.Errorf("'%s' is not a Service; only Services have a stable address to relay to", positional[0])
+	}
+	if namespace == "" {
+		namespace = DefaultPodNamespace
+	}
+
+	config.RemoteHost = fmt.Sprintf("%s.%s.svc.cluster.local", service, namespace)
+	config.Namespace = namespace
+	for i, spec := range positional[1:] {
+		localPort, remotePort, err := parsePortForwardPorts(spec)
+		if err != nil {
+			return ProxyConfig{}, err
+		}
+		if i == 0 {
+			config.LocalPort, config.RemotePort = localPort, remotePort
+		} else {
+			config.Ports = append(config.Ports, PortMapping{LocalPort: localPort, RemotePort: remotePort})
+		}
+	}
+	return config, nil
+}
+
+// parsePortForwardPorts parses "8080:80", ":80" (any local port, returned as 0) or "80"
+func parsePortForwardPorts(spec string) (int, int, error) {
+	local, remote, found := strings.Cut(spec, ":")
+	if !found {
+		local, remote = spec, spec
+	}
+	remotePort, err := strconv.Atoi(remote)
+	if err != nil || remotePort < 1 || remotePort > 65535 {
+		return 0, 0, fmt.Errorf("remote port '%s' is not a port number; named ports can't be imported", remote)
+	}
+	if local == "" {
+		return 0, remotePort, nil
+	}
+	localPort, err := strconv.Atoi(local)
+	if err != nil || localPort < 1 || localPort > 65535 {
+		return 0, 0, fmt.Errorf("local port '%s' is not a port number", local)
+	}
+	return localPort, remotePort, nil
+}
+
+// uniqueImportName names an imported proxy after its Service, adding the cluster and then a
+// number when the name is taken, and marks the name as used
+func uniqueImportName(config ProxyConfig, names map[string]bool) string {
+	service, _, _ := strings.Cut(config.RemoteHost, ".")
+	name := service
+	if names[strings.ToLower(name)] && config.KubernetesCluster != "" {
+		name = fmt.Sprintf("%s (%s)", service, config.KubernetesCluster)
+	}
+	base := name
+	for n := 2; names[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s %d", base, n)
+	}
+	names[strings.ToLower(name)] = true
+	return name
+}
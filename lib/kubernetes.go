@@ -4,19 +4,19 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	log "aproxymate/lib/logger"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 )
 
 // KubeConfig represents configuration for Kubernetes connection
@@ -33,12 +33,56 @@ type SocatProxyConfig struct {
 	PodName string
 	// Namespace is the Kubernetes namespace to deploy the pod
 	Namespace string
-	// ListenPort is the port to listen on
+	// ListenPort is the port to listen on, see relayListenPort
 	ListenPort int
 	// RemoteHost is the target host to proxy to
 	RemoteHost string
 	// RemotePort is the target port to proxy to
 	RemotePort int
+	// RemoteHosts, when set, are tried in order instead of relaying to RemoteHost only
+	RemoteHosts []string
+	// AdditionalPorts are extra listen/target port pairs relayed to the same remote host
+	AdditionalPorts []SocatPortMapping
+	// PriorityClassName is the PriorityClass of the pod; the cluster default applies when empty
+	PriorityClassName string
+	// Annotations are set on the pod, including the service mesh injection opt-outs
+	Annotations map[string]string
+	// Image is the socat image (default alpine/socat)
+	Image string
+	// Spread spreads the pod away from other relay pods
+	Spread PodSpreadConfig
+	// Keepalive enables TCP keepalive probes on the connections to the remote host
+	Keepalive KeepaliveConfig
+	// TLSCertificate is the PEM certificate and key the relay terminates TLS with; the relay
+	// accepts plain TCP when it is empty
+	TLSCertificate []byte
+	// User is the logged-in user the pod is created for; the OS user when empty
+	User string
+}
+
+// SocatPortMapping is a port the socat pod listens on and the remote port it relays to
+type SocatPortMapping struct {
+	ListenPort int
+	RemotePort int
+}
+
+// relayListenPortBase is the first port relay pods listen on
+const relayListenPortBase = 10000
+
+// relayListenPort returns the port a relay pod listens on for the i-th port of its proxy, the
+// main port being 0. The listen ports don't depend on the remote ports, so a pod can relay to
+// several targets on the same remote port and never binds a privileged port.
+func relayListenPort(i int) int {
+	return relayListenPortBase + i
+}
+
+// listenPorts returns the ports the pod listens on, the main port first
+func (c SocatProxyConfig) listenPorts() []int {
+	ports := []int{c.ListenPort}
+	for _, mapping := range c.AdditionalPorts {
+		ports = append(ports, mapping.ListenPort)
+	}
+	return ports
 }
 
 // GetKubernetesClient creates a Kubernetes clientset using provided or default configuration
@@ -46,16 +90,11 @@ func GetKubernetesClient(config KubeConfig) (*kubernetes.Clientset, error) {
 	opCtx, _ := log.StartOperation(context.Background(), "kubernetes", "get_client")
 	defer opCtx.Complete("get_kubernetes_client", nil)
 
-	// If no kubeconfig path provided, try to use default
-	kubeconfigPath := config.KubeconfigPath
-	if kubeconfigPath == "" {
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfigPath = filepath.Join(home, ".kube", "config")
-		} else {
-			err := fmt.Errorf("unable to locate kubeconfig: home directory not found and no path provided")
-			opCtx.Error("Failed to determine kubeconfig path", err)
-			return nil, err
-		}
+	// If no kubeconfig path provided, use the --kubeconfig one or the default
+	kubeconfigPath, err := resolveKubeconfigPath(config.KubeconfigPath)
+	if err != nil {
+		opCtx.Error("Failed to determine kubeconfig path", err)
+		return nil, err
 	}
 
 	opCtx.Debug("Using kubeconfig", "path", kubeconfigPath, "context", config.Context)
@@ -82,6 +121,7 @@ func GetKubernetesClient(config KubeConfig) (*kubernetes.Clientset, error) {
 		opCtx.Error("Failed to create Kubernetes client config", err, "kubeconfig_path", kubeconfigPath, "context", config.Context)
 		return nil, fmt.Errorf("failed to create Kubernetes client config: %w", err)
 	}
+	currentKubernetesAPIConfig().apply(resolvedContext(kubeConfig, config.Context), clientConfig)
 
 	// Create the clientset
 	clientset, err := kubernetes.NewForConfig(clientConfig)
@@ -97,14 +137,10 @@ func GetKubernetesClient(config KubeConfig) (*kubernetes.Clientset, error) {
 
 // GetKubernetesClientConfig creates a Kubernetes client config using provided or default configuration
 func GetKubernetesClientConfig(config KubeConfig) (*rest.Config, error) {
-	// If no kubeconfig path provided, try to use default
-	kubeconfigPath := config.KubeconfigPath
-	if kubeconfigPath == "" {
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfigPath = filepath.Join(home, ".kube", "config")
-		} else {
-			return nil, fmt.Errorf("unable to locate kubeconfig: home directory not found and no path provided")
-		}
+	// If no kubeconfig path provided, use the --kubeconfig one or the default
+	kubeconfigPath, err := resolveKubeconfigPath(config.KubeconfigPath)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if kubeconfig file exists
@@ -126,30 +162,28 @@ func GetKubernetesClientConfig(config KubeConfig) (*rest.Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes client config: %w", err)
 	}
+	currentKubernetesAPIConfig().apply(resolvedContext(kubeConfig, config.Context), clientConfig)
 
 	return clientConfig, nil
 }
 
-// GetKubernetesContexts returns a list of available Kubernetes contexts from kubeconfig
-func GetKubernetesContexts(kubeconfigPath string) ([]string, error) {
-	// If no kubeconfig path provided, try to use default
-	if kubeconfigPath == "" {
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfigPath = filepath.Join(home, ".kube", "config")
-		} else {
-			return nil, fmt.Errorf("unable to locate kubeconfig: home directory not found and no path provided")
-		}
+// resolvedContext returns the context a client config is built for: the requested one or the
+// kubeconfig's current context
+func resolvedContext(kubeConfig clientcmd.ClientConfig, context string) string {
+	if context != "" {
+		return context
 	}
-
-	// Check if kubeconfig file exists
-	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("kubeconfig file not found at path: %s", kubeconfigPath)
+	if raw, err := kubeConfig.RawConfig(); err == nil {
+		return raw.CurrentContext
 	}
+	return ""
+}
 
-	// Load the kubeconfig file
-	config, err := clientcmd.LoadFromFile(kubeconfigPath)
+// GetKubernetesContexts returns a list of available Kubernetes contexts from kubeconfig
+func GetKubernetesContexts(kubeconfigPath string) ([]string, error) {
+	config, err := loadKubeconfig(kubeconfigPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+		return nil, err
 	}
 
 	// Extract context names
@@ -166,27 +200,133 @@ func GetKubernetesContexts(kubeconfigPath string) ([]string, error) {
 
 // GetCurrentKubernetesContext returns the current default context from kubeconfig
 func GetCurrentKubernetesContext(kubeconfigPath string) (string, error) {
-	// If no kubeconfig path provided, try to use default
-	if kubeconfigPath == "" {
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfigPath = filepath.Join(home, ".kube", "config")
-		} else {
-			return "", fmt.Errorf("unable to locate kubeconfig: home directory not found and no path provided")
+	config, err := loadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return "", err
+	}
+
+	return config.CurrentContext, nil
+}
+
+// hostUserLabel records the OS user running the aproxymate process that created a pod. It
+// differs from the "user" label when a shared server creates pods for logged-in users.
+const hostUserLabel = "aproxymate.host-user"
+
+// podLabelUser returns the OS user recorded in the "user" label of pods created for no logged-in user
+func podLabelUser() string {
+	if u := os.Getenv("USER"); u != "" {
+		return userLabelValue(u)
+	}
+	if u := os.Getenv("USERNAME"); u != "" {
+		return userLabelValue(u)
+	}
+	return "unknown"
+}
+
+// requestLabelUser returns the "user" label value of pods created for a logged-in user, or for
+// the OS user when user is empty
+func requestLabelUser(user string) string {
+	if user == "" {
+		return podLabelUser()
+	}
+	return userLabelValue(user)
+}
+
+// userLabelValue turns a user name such as an email address into a valid label value:
+// characters other than letters, digits, '-', '_' and '.' become '_'
+func userLabelValue(name string) string {
+	value := []byte(name)
+	for i, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			value[i] = '_'
 		}
 	}
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	// Label values must start and end with a letter or digit
+	trimmed := strings.Trim(string(value), "-_.")
+	if trimmed == "" {
+		return "unknown"
+	}
+	return trimmed
+}
 
-	// Check if kubeconfig file exists
-	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("kubeconfig file not found at path: %s", kubeconfigPath)
+// managedPodLabels returns the labels applied to every pod created by aproxymate for a user,
+// or for the OS user when user is empty
+func managedPodLabels(component, user string) map[string]string {
+	labels := map[string]string{
+		"app":                "aproxymate",
+		"component":          component,
+		"created-by":         "aproxymate",
+		"user":               requestLabelUser(user),
+		hostUserLabel:        podLabelUser(),
+		"aproxymate.managed": "true",
+		"aproxymate.version": versionLabelValue(),
+	}
+	if instanceName != "" {
+		labels[instanceLabel] = instanceName
+	}
+	return labels
+}
+
+// socatContainer builds a container that relays a listen port to a remote host and port.
+// targetOptions are socat address options appended to the remote connection, e.g. ",keepalive".
+func socatContainer(name, image, remoteHost string, listenPort, remotePort int, targetOptions string) corev1.Container {
+	socatCommand := fmt.Sprintf("TCP-LISTEN:%d,fork", listenPort)
+	socatTarget := fmt.Sprintf("TCP:%s:%d%s", remoteHost, remotePort, targetOptions)
+
+	return corev1.Container{
+		Name:    name,
+		Image:   image,
+		Command: []string{"socat"},
+		Args:    []string{socatCommand, socatTarget},
+		Ports: []corev1.ContainerPort{
+			{
+				ContainerPort: int32(listenPort),
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("50m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
 	}
+}
 
-	// Load the kubeconfig file
-	config, err := clientcmd.LoadFromFile(kubeconfigPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to load kubeconfig: %w", err)
+// socatContainers returns the containers of a relay pod; each additional port gets its own
+// socat container in the same pod
+func socatContainers(config SocatProxyConfig) []corev1.Container {
+	image := config.Image
+	if image == "" {
+		image = DefaultRelayImage
+	}
+	targetOptions := config.Keepalive.socatOptions()
+	container := func(name string, listenPort, remotePort int) corev1.Container {
+		var container corev1.Container
+		if len(config.RemoteHosts) > 1 {
+			container = failoverContainer(name, image, config.RemoteHosts, listenPort, remotePort, targetOptions)
+		} else {
+			container = socatContainer(name, image, config.RemoteHost, listenPort, remotePort, targetOptions)
+		}
+		if len(config.TLSCertificate) > 0 {
+			container = withRelayTLS(container, listenPort, config.TLSCertificate)
+		}
+		return container
 	}
 
-	return config.CurrentContext, nil
+	containers := []corev1.Container{container("socat", config.ListenPort, config.RemotePort)}
+	for _, mapping := range config.AdditionalPorts {
+		name := fmt.Sprintf("socat-%d", mapping.ListenPort)
+		containers = append(containers, container(name, mapping.ListenPort, mapping.RemotePort))
+	}
+	return containers
 }
 
 // CreateSocatProxyPod creates a pod running socat to proxy traffic
@@ -212,6 +352,7 @@ func CreateSocatProxyPod(clientset *kubernetes.Clientset, config SocatProxyConfi
 		"listen_port", config.ListenPort,
 		"remote_host", config.RemoteHost,
 		"remote_port", config.RemotePort,
+		"priority_class", config.PriorityClassName,
 	)
 
 	// Validate required fields
@@ -231,75 +372,50 @@ func CreateSocatProxyPod(clientset *kubernetes.Clientset, config SocatProxyConfi
 		return nil, err
 	}
 
-	// Create socat command
-	socatCommand := fmt.Sprintf("TCP-LISTEN:%d,fork", config.ListenPort)
-	socatTarget := fmt.Sprintf("TCP:%s:%d", config.RemoteHost, config.RemotePort)
-
-	// Get current user for labeling
-	currentUser := "unknown"
-	if u := os.Getenv("USER"); u != "" {
-		currentUser = u
-	} else if u := os.Getenv("USERNAME"); u != "" {
-		currentUser = u
+	for _, mapping := range config.AdditionalPorts {
+		if mapping.ListenPort <= 0 || mapping.RemotePort <= 0 {
+			err := fmt.Errorf("valid listen and remote ports are required for additional port mappings")
+			opCtx.Error("Invalid configuration", err, "invalid_field", "additional_ports")
+			return nil, err
+		}
 	}
 
 	// Define pod
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      podName,
-			Namespace: namespace,
-			Labels: map[string]string{
-				"app":                "aproxymate",
-				"component":          "socat-proxy",
-				"created-by":         "aproxymate",
-				"user":               currentUser,
-				"aproxymate.managed": "true",
-			},
+			Name:        podName,
+			Namespace:   namespace,
+			Labels:      relayPodLabels(podName, config.User, config.Annotations),
+			Annotations: config.Annotations,
 		},
 		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Name:    "socat",
-					Image:   "alpine/socat",
-					Command: []string{"socat"},
-					Args:    []string{socatCommand, socatTarget},
-					Ports: []corev1.ContainerPort{
-						{
-							ContainerPort: int32(config.ListenPort),
-							Protocol:      corev1.ProtocolTCP,
-						},
-					},
-					Resources: corev1.ResourceRequirements{
-						Limits: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse("100m"),
-							corev1.ResourceMemory: resource.MustParse("128Mi"),
-						},
-						Requests: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse("50m"),
-							corev1.ResourceMemory: resource.MustParse("64Mi"),
-						},
-					},
-				},
-			},
-			RestartPolicy: corev1.RestartPolicyNever,
+			Containers:        socatContainers(config),
+			RestartPolicy:     corev1.RestartPolicyNever,
+			PriorityClassName: config.PriorityClassName,
 		},
 	}
 
+	config.Spread.apply(&pod.Spec)
+
 	// Create the pod
 	timer := log.StartTimer("pod_creation")
-	createdPod, err := clientset.CoreV1().Pods(namespace).Create(
-		context.Background(),
-		pod,
-		metav1.CreateOptions{},
-	)
+	var createdPod *corev1.Pod
+	err := retryKubernetesCall(context.Background(), "create_pod", func(retried bool) error {
+		var err error
+		createdPod, err = clientset.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+		// An earlier attempt that failed with a server error may have created the pod after all
+		if retried && apierrors.IsAlreadyExists(err) {
+			createdPod, err = clientset.CoreV1().Pods(namespace).Get(context.Background(), podName, metav1.GetOptions{})
+		}
+		return err
+	})
 	timer.Stop()
 
 	if err != nil {
 		opCtx.Error("Failed to create socat proxy pod", err,
 			"pod_name", podName,
 			"namespace", namespace,
-			"socat_command", socatCommand,
-			"socat_target", socatTarget,
+			"socat_args", pod.Spec.Containers[0].Args,
 		)
 		log.LogKubernetesPodOperation("create", podName, namespace, "", err)
 		return nil, fmt.Errorf("failed to create socat proxy pod: %w", err)
@@ -324,18 +440,35 @@ func WaitForPodRunning(clientset *kubernetes.Clientset, namespace, podName strin
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
+	// problem is the last reason seen for a container not running, e.g. ImagePullBackOff
+	problem := ""
 	for {
 		select {
 		case <-ctx.Done():
+			if problem != "" {
+				return fmt.Errorf("timeout waiting for pod %s to be running (%s)", podName, problem)
+			}
 			return fmt.Errorf("timeout waiting for pod %s to be running", podName)
 		case <-ticker.C:
 			pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 			if err != nil {
 				return fmt.Errorf("error getting pod %s: %w", podName, err)
 			}
+			if status := relayPodStatus(pod); status.Problem != "" {
+				problem = status.Problem
+			}
 
 			if pod.Status.Phase == corev1.PodRunning {
-				return nil
+				// An injected sidecar must be ready before socat's outbound connections get through it
+				sidecars := injectedSidecars(pod)
+				if len(sidecars) == 0 {
+					return nil
+				}
+				if podReady(pod) {
+					log.Info("Relay pod runs with injected service mesh sidecars",
+						"pod", podName, "namespace", namespace, "sidecars", strings.Join(sidecars, ","))
+					return nil
+				}
 			}
 
 			if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
@@ -345,75 +478,165 @@ func WaitForPodRunning(clientset *kubernetes.Clientset, namespace, podName strin
 	}
 }
 
-// DeleteSocatProxyPod deletes a socat proxy pod by name
-func DeleteSocatProxyPod(clientset *kubernetes.Clientset, namespace, podName string) error {
-	err := clientset.CoreV1().Pods(namespace).Delete(
-		context.Background(),
-		podName,
-		metav1.DeleteOptions{},
-	)
+// RelayPodStatus is the observed state of a relay pod
+type RelayPodStatus struct {
+	Phase    string `json:"phase,omitempty"`
+	Node     string `json:"node,omitempty"`
+	Restarts int32  `json:"restarts"`
+	// Problem explains why a container is not running, e.g. "CrashLoopBackOff: back-off restarting"
+	Problem string `json:"problem,omitempty"`
+}
+
+// GetRelayPodStatus reads the phase, node, restart count and container problems of a relay pod
+func GetRelayPodStatus(ctx context.Context, clientset kubernetes.Interface, namespace, podName string) (RelayPodStatus, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to delete socat proxy pod: %w", err)
+		return RelayPodStatus{}, fmt.Errorf("error getting pod %s: %w", podName, err)
 	}
-	return nil
+	return relayPodStatus(pod), nil
 }
 
-// CleanupOrphanedAproxymatePodsForUser cleans up any orphaned aproxymate pods for the current user
-func CleanupOrphanedAproxymatePodsForUser(clientset *kubernetes.Clientset, namespace string) error {
-	opCtx, _ := log.StartOperation(context.Background(), "kubernetes", "cleanup_user_pods")
-	defer opCtx.Complete("cleanup_user_pods", nil)
+// RecentPodEvents returns up to limit of the latest events of a pod, oldest first, formatted as
+// "Warning Failed: Failed to pull image ..."
+func RecentPodEvents(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, limit int) ([]string, error) {
+	list, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,involvedObject.name=" + podName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing events of pod %s: %w", podName, err)
+	}
 
-	if namespace == "" {
-		namespace = "default"
+	events := list.Items
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(&events[i]).Before(eventTime(&events[j]))
+	})
+	if len(events) > limit {
+		events = events[len(events)-limit:]
 	}
 
-	// Get current user
-	currentUser := "unknown"
-	if u := os.Getenv("USER"); u != "" {
-		currentUser = u
-	} else if u := os.Getenv("USERNAME"); u != "" {
-		currentUser = u
+	lines := make([]string, 0, len(events))
+	for _, event := range events {
+		line := fmt.Sprintf("%s %s: %s", event.Type, event.Reason, strings.TrimSpace(event.Message))
+		if event.Count > 1 {
+			line += fmt.Sprintf(" (x%d)", event.Count)
+		}
+		lines = append(lines, line)
 	}
+	return lines, nil
+}
 
-	opCtx.Debug("Starting cleanup of orphaned pods", "namespace", namespace, "user", currentUser)
+// podLogBytesLimit caps how much of a container's log RecentPodLogs reads
+const podLogBytesLimit = 16 * 1024
 
-	// List all aproxymate pods for this user
-	listOptions := metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("aproxymate.managed=true,user=%s", currentUser),
-	}
+// ContainerLog is the end of the log of a pod's container
+type ContainerLog struct {
+	Container string `json:"container"`
+	// Previous is set when the log is of the container's previous instance, which exited
+	Previous bool     `json:"previous,omitempty"`
+	Lines    []string `json:"lines"`
+}
 
-	pods, err := clientset.CoreV1().Pods(namespace).List(context.Background(), listOptions)
+// RecentPodLogs returns up to lines of the latest log lines of each container of a pod. For a
+// container that restarted, the log of the instance that exited is returned, as it tells why.
+// Containers without a log, e.g. still pulling their image, are left out.
+func RecentPodLogs(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, lines int64) ([]ContainerLog, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
-		opCtx.Error("Failed to list aproxymate pods", err, "namespace", namespace, "user", currentUser)
-		return fmt.Errorf("failed to list aproxymate pods: %w", err)
+		return nil, fmt.Errorf("error getting pod %s: %w", podName, err)
+	}
+
+	logs := []ContainerLog{}
+	limitBytes := int64(podLogBytesLimit)
+	for _, status := range pod.Status.ContainerStatuses {
+		previous := status.RestartCount > 0
+		data, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+			Container:  status.Name,
+			Previous:   previous,
+			TailLines:  &lines,
+			LimitBytes: &limitBytes,
+		}).DoRaw(ctx)
+		if err != nil {
+			log.Debug("Could not read the log of a pod container", "pod", podName, "namespace", namespace, "container", status.Name, "error", err)
+			continue
+		}
+		if text := strings.TrimRight(string(data), "\n"); text != "" {
+			logs = append(logs, ContainerLog{Container: status.Name, Previous: previous, Lines: strings.Split(text, "\n")})
+		}
 	}
+	return logs, nil
+}
 
-	// Only log if there are orphaned pods to clean up
-	if len(pods.Items) > 0 {
-		opCtx.Debug("Found orphaned aproxymate pods for cleanup", "user", currentUser, "count", len(pods.Items))
+// eventTime returns when an event last happened, for events of both the old and new event APIs
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
 	}
+}
 
-	// Delete each pod
-	for _, pod := range pods.Items {
-		opCtx.Debug("Cleaning up orphaned pod", "pod", pod.Name, "user", currentUser, "namespace", namespace)
-		log.LogPodCleanup("delete_orphaned", pod.Name, namespace, nil)
+// relayPodStatus summarizes a pod's status
+func relayPodStatus(pod *corev1.Pod) RelayPodStatus {
+	status := RelayPodStatus{
+		Phase: string(pod.Status.Phase),
+		Node:  pod.Spec.NodeName,
+	}
+	if pod.DeletionTimestamp != nil {
+		status.Phase = "Terminating"
+	}
 
-		err := clientset.CoreV1().Pods(namespace).Delete(
-			context.Background(),
-			pod.Name,
-			metav1.DeleteOptions{},
-		)
-		if err != nil {
-			opCtx.Warn("Failed to delete orphaned pod", "pod", pod.Name, "error", err.Error())
-			log.LogPodCleanup("delete_orphaned", pod.Name, namespace, err)
-		} else {
-			opCtx.Debug("Successfully deleted orphaned pod", "pod", pod.Name)
+	for _, container := range pod.Status.ContainerStatuses {
+		status.Restarts += container.RestartCount
+		if status.Problem != "" {
+			continue
+		}
+		switch {
+		case container.State.Waiting != nil:
+			status.Problem = describeContainerProblem(container.State.Waiting.Reason, container.State.Waiting.Message)
+		case container.State.Terminated != nil:
+			status.Problem = describeContainerProblem(container.State.Terminated.Reason, container.State.Terminated.Message)
+		case container.LastTerminationState.Terminated != nil && container.RestartCount > 0:
+			status.Problem = describeContainerProblem("last exit: "+container.LastTerminationState.Terminated.Reason, container.LastTerminationState.Terminated.Message)
 		}
 	}
+	return status
+}
 
-	if len(pods.Items) > 0 {
-		opCtx.Info("Completed cleanup of orphaned pods", "cleaned_count", len(pods.Items), "user", currentUser)
+// describeContainerProblem joins a container state reason and message
+func describeContainerProblem(reason, message string) string {
+	if message == "" {
+		return reason
 	}
+	return reason + ": " + message
+}
+
+// DeleteSocatProxyPod deletes a socat proxy pod by name
+func DeleteSocatProxyPod(clientset *kubernetes.Clientset, namespace, podName string) error {
+	return deleteSocatProxyPod(context.Background(), clientset, namespace, podName)
+}
 
+// deleteSocatProxyPod deletes a socat proxy pod, giving up when ctx ends
+func deleteSocatProxyPod(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string) error {
+	err := retryKubernetesCall(ctx, "delete_pod", func(retried bool) error {
+		err := clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{})
+		if retried && apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete socat proxy pod: %w", err)
+	}
 	return nil
 }
+
+// CleanupOrphanedAproxymatePodsForUser cleans up any orphaned aproxymate pods for the current user
+func CleanupOrphanedAproxymatePodsForUser(clientset *kubernetes.Clientset, namespace string) error {
+	if namespace == "" {
+		namespace = DefaultNamespace()
+	}
+	return cleanupOrphanedPods(context.Background(), clientset, namespace, nil)
+}
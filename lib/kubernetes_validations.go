@@ -17,6 +17,10 @@ func ValidateKubernetesCluster(clusterName string) (bool, error) {
 
 	for _, cluster := range clusters {
 		if cluster == clusterName {
+			// Teleport-gated contexts also need a valid tsh session to be usable
+			if err := EnsureTeleportSessionTUI("", clusterName); err != nil {
+				return false, err
+			}
 			return true, nil
 		}
 	}
@@ -19,6 +19,8 @@ var (
 	UILogger *slog.Logger
 	// OperationLogger is for tracking operations with context
 	OperationLogger *slog.Logger
+	// AuditLogger records security-relevant events such as rejected clients
+	AuditLogger *slog.Logger
 )
 
 // LogLevel represents the logging level
@@ -59,6 +61,8 @@ type LoggerConfig struct {
 	AddSource     bool
 	IncludeStack  bool
 	MaxStackDepth int
+	// AuditOutput receives audit events as JSON instead of Output when set
+	AuditOutput io.Writer
 }
 
 // OperationContext holds operation-specific logging context
@@ -244,6 +248,13 @@ func InitLogger(config LoggerConfig) {
 	// Create operation logger with additional context
 	OperationLogger = slog.New(handler).With("logger_type", "operation")
 
+	// Audit events go to the main handler unless a dedicated destination is configured
+	if config.AuditOutput != nil {
+		AuditLogger = slog.New(slog.NewJSONHandler(config.AuditOutput, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	} else {
+		AuditLogger = slog.New(handler).With("logger_type", "audit")
+	}
+
 	// Set as default logger
 	slog.SetDefault(AppLogger)
 
@@ -551,6 +562,23 @@ func LogSystemEvent(event, category string, details map[string]any) {
 	AppLogger.Debug("System event", attrs...)
 }
 
+// LogAuditEvent logs a security-relevant event to the audit log
+func LogAuditEvent(event, outcome string, details map[string]any) {
+	attrs := []any{
+		"event", event,
+		"outcome", outcome,
+		"component", "audit",
+		"user_id", getUserID(),
+		"timestamp", time.Now().Format(time.RFC3339),
+	}
+
+	for key, value := range details {
+		attrs = append(attrs, key, value)
+	}
+
+	AuditLogger.Info("Audit event", attrs...)
+}
+
 // Helper functions
 func getAbsolutePath(path string) (string, error) {
 	if path == "" {
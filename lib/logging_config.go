@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	log "aproxymate/lib/logger"
+)
+
+// Defaults for log file rotation settings left empty
+const (
+	defaultLogMaxSizeMB  = 10
+	defaultLogMaxBackups = 3
+)
+
+// LoggingConfig sets where and how much aproxymate logs; --log-level, --log-format and their
+// APROXYMATE_* variables override the level and format
+type LoggingConfig struct {
+	// Level is debug, info (default), warn or error
+	Level string `json:"level,omitempty" mapstructure:"level" yaml:"level,omitempty"`
+	// Format is text (default) or json
+	Format string `json:"format,omitempty" mapstructure:"format" yaml:"format,omitempty"`
+	// File receives the log instead of stderr
+	File string `json:"file,omitempty" mapstructure:"file" yaml:"file,omitempty"`
+	// MaxSizeMB is the size at which File is rotated (default 10)
+	MaxSizeMB int `json:"max_size_mb,omitempty" mapstructure:"max_size_mb" yaml:"max_size_mb,omitempty"`
+	// MaxBackups is the number of rotated files kept (default 3)
+	MaxBackups int `json:"max_backups,omitempty" mapstructure:"max_backups" yaml:"max_backups,omitempty"`
+	// AuditFile receives audit events as JSON lines instead of the main log; it is rotated like File
+	AuditFile string `json:"audit_file,omitempty" mapstructure:"audit_file" yaml:"audit_file,omitempty"`
+}
+
+// Validate checks the level, format and rotation settings
+func (c LoggingConfig) Validate() error {
+	if _, err := ParseLogLevel(c.Level); c.Level != "" && err != nil {
+		return err
+	}
+	if _, err := ParseLogFormat(c.Format); c.Format != "" && err != nil {
+		return err
+	}
+	if c.MaxSizeMB < 0 {
+		return fmt.Errorf("max_size_mb must not be negative")
+	}
+	if c.MaxBackups < 0 {
+		return fmt.Errorf("max_backups must not be negative")
+	}
+	return nil
+}
+
+// ParseLogLevel parses a log level name, ignoring case
+func ParseLogLevel(level string) (log.LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return log.LevelDebug, nil
+	case "info":
+		return log.LevelInfo, nil
+	case "warn", "warning":
+		return log.LevelWarn, nil
+	case "error":
+		return log.LevelError, nil
+	}
+	return log.LevelInfo, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", level)
+}
+
+// ParseLogFormat parses a log format name, ignoring case
+func ParseLogFormat(format string) (log.LogFormat, error) {
+	switch strings.ToLower(format) {
+	case "text":
+		return log.FormatText, nil
+	case "json":
+		return log.FormatJSON, nil
+	}
+	return log.FormatText, fmt.Errorf("invalid log format %q: must be text or json", format)
+}
+
+// Outputs opens the log and audit destinations: stderr and no separate audit output unless
+// files are configured
+func (c LoggingConfig) Outputs() (output io.Writer, audit io.Writer, err error) {
+	maxSize, maxBackups := c.MaxSizeMB, c.MaxBackups
+	if maxSize == 0 {
+		maxSize = defaultLogMaxSizeMB
+	}
+	if maxBackups == 0 {
+		maxBackups = defaultLogMaxBackups
+	}
+
+	output = os.Stderr
+	if c.File != "" {
+		file, err := log.OpenRotatingFile(c.File, maxSize, maxBackups)
+		if err != nil {
+			return nil, nil, fmt.Errorf("log file %s: %w", c.File, err)
+		}
+		output = file
+	}
+	if c.AuditFile != "" {
+		file, err := log.OpenRotatingFile(c.AuditFile, maxSize, maxBackups)
+		if err != nil {
+			return nil, nil, fmt.Errorf("audit log file %s: %w", c.AuditFile, err)
+		}
+		audit = file
+	}
+	return output, audit, nil
+}
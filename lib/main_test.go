@@ -0,0 +1,32 @@
+package lib
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "aproxymate/lib/logger"
+)
+
+// TestMain keeps the tests away from the user's state, config and kubeconfig
+func TestMain(m *testing.M) {
+	log.InitLogger(log.LoggerConfig{Level: log.LevelError, Output: io.Discard})
+
+	dir, err := os.MkdirTemp("", "aproxymate-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", dir)
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	os.Setenv("KUBECONFIG", filepath.Join(dir, "kubeconfig"))
+	// Saves without a loaded config file go to the working directory
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// istioInjectKey is both an annotation and a label; newer Istio versions only honour the label
+const istioInjectKey = "sidecar.istio.io/inject"
+
+// meshOptOutAnnotations keep the common service meshes from injecting a sidecar into relay pods.
+// A sidecar intercepts the raw TCP relayed by socat and delays pod startup.
+var meshOptOutAnnotations = map[string]string{
+	istioInjectKey:                        "false",
+	"linkerd.io/inject":                   "disabled",
+	"consul.hashicorp.com/connect-inject": "false",
+	"kuma.io/sidecar-injection":           "disabled",
+}
+
+// relayPodAnnotations merges the annotations of a relay pod: the mesh opt-outs unless sidecar
+// injection is allowed, then the global annotations, then the proxy's own
+func relayPodAnnotations(global, proxy map[string]string, sidecarInjection bool) map[string]string {
+	annotations := make(map[string]string)
+	if !sidecarInjection {
+		maps.Copy(annotations, meshOptOutAnnotations)
+	}
+	maps.Copy(annotations, global)
+	maps.Copy(annotations, proxy)
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// relayPodLabels returns the labels of a relay pod, mirroring the Istio injection annotation
+// as a label so that revision-based Istio installs see it too
+func relayPodLabels(podName, user string, annotations map[string]string) map[string]string {
+	labels := managedPodLabels("socat-proxy", user)
+	labels[relayPodNameLabel] = podName
+	if value, ok := annotations[istioInjectKey]; ok {
+		labels[istioInjectKey] = value
+	}
+	return labels
+}
+
+// injectedSidecars returns the names of containers in a relay pod that aproxymate did not create,
+// which is how a mesh that enforces injection shows up
+func injectedSidecars(pod *corev1.Pod) []string {
+	var names []string
+	for _, container := range pod.Spec.Containers {
+		if container.Name != "socat" && !strings.HasPrefix(container.Name, "socat-") {
+			names = append(names, container.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
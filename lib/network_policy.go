@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+
+	log "aproxymate/lib/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// relayPodNameLabel identifies a single relay pod, so its NetworkPolicy selects nothing else
+const relayPodNameLabel = "aproxymate.pod"
+
+// CreateRelayNetworkPolicy creates a NetworkPolicy that denies all ingress to the relay pod and
+// only allows egress to the remote host and ports. kubectl port-forward enters the pod's network
+// namespace directly, so it is not affected by the ingress rule. The policy is owned by the pod
+// and garbage-collected together with it.
+func CreateRelayNetworkPolicy(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, config SocatProxyConfig) error {
+	policy := relayNetworkPolicy(pod, config)
+	_, err := clientset.NetworkingV1().NetworkPolicies(pod.Namespace).Create(ctx, policy, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create NetworkPolicy for relay pod %s: %w", pod.Name, err)
+	}
+	log.Debug("Created relay NetworkPolicy", "policy", policy.Name, "namespace", pod.Namespace)
+	return nil
+}
+
+// relayNetworkPolicy builds the NetworkPolicy of a relay pod
+func relayNetworkPolicy(pod *corev1.Pod, config SocatProxyConfig) *networkingv1.NetworkPolicy {
+	tcp := corev1.ProtocolTCP
+	udp := corev1.ProtocolUDP
+
+	var ports []networkingv1.NetworkPolicyPort
+	for _, port := range relayRemotePorts(config) {
+		target := intstr.FromInt32(int32(port))
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &target})
+	}
+	remote := networkingv1.NetworkPolicyEgressRule{Ports: ports}
+	egress := []networkingv1.NetworkPolicyEgressRule{remote}
+
+	// NetworkPolicies can't match host names, so only IP addresses restrict the destination.
+	// Host names need DNS, and their ports are allowed to any destination.
+	hosts := config.RemoteHosts
+	if len(hosts) == 0 {
+		hosts = []string{config.RemoteHost}
+	}
+	var peers []networkingv1.NetworkPolicyPeer
+	for _, host := range hosts {
+		ip := net.ParseIP(host)
+		if ip == nil {
+			peers = nil
+			break
+		}
+		cidr := ip.String() + "/32"
+		if ip.To4() == nil {
+			cidr = ip.String() + "/128"
+		}
+		peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	if peers != nil {
+		egress[0].To = peers
+	} else {
+		dns := intstr.FromInt32(53)
+		egress = append(egress, networkingv1.NetworkPolicyEgressRule{
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: &udp, Port: &dns},
+				{Protocol: &tcp, Port: &dns},
+			},
+		})
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Labels:    managedPodLabels("socat-proxy-policy", ""),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Name:       pod.Name,
+				UID:        pod.UID,
+			}},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{relayPodNameLabel: pod.Name},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Egress:      egress,
+		},
+	}
+}
+
+// relayRemotePorts returns the remote ports a relay pod connects to, without duplicates
+func relayRemotePorts(config SocatProxyConfig) []int {
+	ports := []int{config.RemotePort}
+	for _, mapping := range config.AdditionalPorts {
+		if !slices.Contains(ports, mapping.RemotePort) {
+			ports = append(ports, mapping.RemotePort)
+		}
+	}
+	return ports
+}
@@ -0,0 +1,142 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxConcurrentPodOperations is how many relay pods are created or deleted at the same
+// time in one cluster unless pod_operations says otherwise. It keeps connecting many proxies
+// at once below client-go's default rate limit of 5 requests per second.
+const DefaultMaxConcurrentPodOperations = 4
+
+// PodOperationsConfig limits how many relay pod creations and deletions run at the same time
+type PodOperationsConfig struct {
+	// MaxConcurrent is the limit per cluster (default DefaultMaxConcurrentPodOperations)
+	MaxConcurrent int `json:"max_concurrent,omitempty" mapstructure:"max_concurrent" yaml:"max_concurrent,omitempty"`
+	// Clusters overrides MaxConcurrent by Kubernetes context
+	Clusters map[string]int `json:"clusters,omitempty" mapstructure:"clusters" yaml:"clusters,omitempty"`
+}
+
+// Validate checks that no limit is negative
+func (c PodOperationsConfig) Validate() error {
+	if c.MaxConcurrent < 0 {
+		return fmt.Errorf("max_concurrent must not be negative")
+	}
+	for cluster, limit := range c.Clusters {
+		if limit < 0 {
+			return fmt.Errorf("limit of cluster '%s' must not be negative", cluster)
+		}
+	}
+	return nil
+}
+
+// Limit returns how many pod operations may run at the same time in the cluster
+func (c PodOperationsConfig) Limit(cluster string) int {
+	if limit, ok := c.Clusters[cluster]; ok && limit > 0 {
+		return limit
+	}
+	if c.MaxConcurrent > 0 {
+		return c.MaxConcurrent
+	}
+	return DefaultMaxConcurrentPodOperations
+}
+
+// podOpQueue runs relay pod operations with a concurrency limit per cluster. Operations over
+// the limit wait for a slot in the order the Go runtime wakes them. Identical operations that
+// are requested while one is running are coalesced: they wait for it and share its result.
+type podOpQueue struct {
+	mu     sync.Mutex
+	config PodOperationsConfig
+	// slots holds a semaphore per cluster; it is replaced when the limits change, and
+	// operations holding a slot of the old one release it there
+	slots map[string]chan struct{}
+	// inflight holds the running operations by key
+	inflight map[string]*podOp
+}
+
+// podOp is a running pod operation that coalesced requests wait for
+type podOp struct {
+	done chan struct{}
+	err  error
+}
+
+// newPodOpQueue creates a queue with the default limits
+func newPodOpQueue() *podOpQueue {
+	return &podOpQueue{
+		slots:    make(map[string]chan struct{}),
+		inflight: make(map[string]*podOp),
+	}
+}
+
+// configure applies new limits to operations that start from now on
+func (q *podOpQueue) configure(config PodOperationsConfig) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.config = config
+	q.slots = make(map[string]chan struct{})
+}
+
+// acquire waits for a slot in the cluster and returns the function releasing it. waiting is
+// called first when the cluster has no free slot. It fails when ctx ends before a slot frees up.
+func (q *podOpQueue) acquire(ctx context.Context, cluster string, waiting func()) (func(), error) {
+	q.mu.Lock()
+	slots, exists := q.slots[cluster]
+	if !exists {
+		slots = make(chan struct{}, q.config.Limit(cluster))
+		q.slots[cluster] = slots
+	}
+	q.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		if waiting != nil {
+			waiting()
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up waiting for other pod operations in cluster '%s': %w", cluster, ctx.Err())
+		}
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { <-slots }) }, nil
+}
+
+// do runs fn in a slot of the cluster. While an operation with the same key runs, fn is not
+// run again; the call waits for that operation and returns its error.
+func (q *podOpQueue) do(ctx context.Context, cluster, key string, fn func(context.Context) error) error {
+	q.mu.Lock()
+	if op, exists := q.inflight[key]; exists {
+		q.mu.Unlock()
+		select {
+		case <-op.done:
+			return op.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	op := &podOp{done: make(chan struct{})}
+	q.inflight[key] = op
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		delete(q.inflight, key)
+		q.mu.Unlock()
+		close(op.done)
+	}()
+
+	release, err := q.acquire(ctx, cluster, nil)
+	if err != nil {
+		op.err = err
+		return err
+	}
+	defer release()
+
+	op.err = fn(ctx)
+	return op.err
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Pod spread modes
+const (
+	PodSpreadPreferred = "preferred"
+	PodSpreadRequired  = "required"
+)
+
+// DefaultSpreadTopologyKey spreads relay pods over nodes
+const DefaultSpreadTopologyKey = "kubernetes.io/hostname"
+
+// PodSpreadConfig spreads relay pods over nodes or zones, so that draining one node doesn't
+// drop every proxy at once
+type PodSpreadConfig struct {
+	// Mode is "preferred" (schedule anyway when the spread can't be met) or "required"; empty disables spreading
+	Mode string `json:"mode,omitempty" mapstructure:"mode" yaml:"mode,omitempty"`
+	// TopologyKey is the node label pods are spread over (default kubernetes.io/hostname)
+	TopologyKey string `json:"topology_key,omitempty" mapstructure:"topology_key" yaml:"topology_key,omitempty"`
+	// MaxSkew is the largest allowed difference in relay pods between two topology domains (default 1)
+	MaxSkew int `json:"max_skew,omitempty" mapstructure:"max_skew" yaml:"max_skew,omitempty"`
+}
+
+// Validate checks the mode and skew
+func (c PodSpreadConfig) Validate() error {
+	switch c.Mode {
+	case "", PodSpreadPreferred, PodSpreadRequired:
+	default:
+		return fmt.Errorf("mode %q must be %q or %q", c.Mode, PodSpreadPreferred, PodSpreadRequired)
+	}
+	if c.MaxSkew < 0 {
+		return fmt.Errorf("max_skew must be at least 1")
+	}
+	return nil
+}
+
+// apply adds the topology spread constraint and, in preferred mode, a matching pod
+// anti-affinity to a relay pod spec. Relay pods of all users in the namespace are spread together.
+func (c PodSpreadConfig) apply(spec *corev1.PodSpec) {
+	if c.Mode == "" {
+		return
+	}
+	topologyKey := c.TopologyKey
+	if topologyKey == "" {
+		topologyKey = DefaultSpreadTopologyKey
+	}
+	maxSkew := c.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = 1
+	}
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"aproxymate.managed": "true",
+			"component":          "socat-proxy",
+		},
+	}
+
+	whenUnsatisfiable := corev1.ScheduleAnyway
+	if c.Mode == PodSpreadRequired {
+		whenUnsatisfiable = corev1.DoNotSchedule
+	}
+	spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+		MaxSkew:           int32(maxSkew),
+		TopologyKey:       topologyKey,
+		WhenUnsatisfiable: whenUnsatisfiable,
+		LabelSelector:     selector,
+	}}
+
+	// ScheduleAnyway only lowers the score of crowded domains; the anti-affinity adds to it
+	if c.Mode == PodSpreadPreferred {
+		spec.Affinity = &corev1.Affinity{
+			PodAntiAffinity: &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+					Weight: 100,
+					PodAffinityTerm: corev1.PodAffinityTerm{
+						LabelSelector: selector,
+						TopologyKey:   topologyKey,
+					},
+				}},
+			},
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+)
+
+// Reasons a local port cannot be used, reported in LocalPortError
+const (
+	PortReasonPrivileged = "privileged"
+	PortReasonReserved   = "reserved"
+	PortReasonInUse      = "in_use"
+)
+
+// LocalPortError reports a local port that cannot be bound. It is returned before any relay pod
+// is created, so the GUI can show the reason without parsing the message.
+type LocalPortError struct {
+	Port int
+	// Reason is one of the PortReason constants
+	Reason string
+	// Message explains the problem and how to fix it
+	Message string
+}
+
+func (e *LocalPortError) Error() string { return e.Message }
+
+// CheckLocalPort reports ports this process cannot bind on the platform: privileged ports
+// without the needed privileges on Unix, and ports in reserved (excluded) ranges on Windows
+func CheckLocalPort(bindAddress string, port int) error {
+	if bindAddress == "" {
+		bindAddress = DefaultLocalBindAddress
+	}
+	return checkLocalPort(bindAddress, port)
+}
+
+// privilegedPortError is the error for a privileged port this process may not bind
+func privilegedPortError(port int) *LocalPortError {
+	return &LocalPortError{
+		Port:    port,
+		Reason:  PortReasonPrivileged,
+		Message: fmt.Sprintf("Permission denied: Port %d is a privileged port (1-1023) that requires administrator privileges. Please try using a port above 1023 or run with elevated permissions", port),
+	}
+}
+
+// isIPv6 reports whether a bind address is an IPv6 address
+func isIPv6(bindAddress string) bool {
+	ip := net.ParseIP(bindAddress)
+	return ip != nil && ip.To4() == nil
+}
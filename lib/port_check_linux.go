@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// capNetBindService is the capability that allows binding privileged ports
+const capNetBindService = 10
+
+// canBindPrivilegedPort checks the kernel's unprivileged port start and the process's
+// CAP_NET_BIND_SERVICE capability
+func canBindPrivilegedPort(port int) (bool, bool) {
+	if data, err := os.ReadFile("/proc/sys/net/ipv4/ip_unprivileged_port_start"); err == nil {
+		if start, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && port >= start {
+			return true, true
+		}
+	}
+
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return false, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := strings.CutPrefix(line, "CapEff:")
+		if !ok {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return false, false
+		}
+		return caps&(1<<capNetBindService) != 0, true
+	}
+	return false, false
+}
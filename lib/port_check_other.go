@@ -0,0 +1,9 @@
+//go:build !windows && !linux
+
+package lib
+
+// canBindPrivilegedPort can't tell on this platform; macOS, for example, lets any user bind
+// privileged ports on all interfaces
+func canBindPrivilegedPort(int) (bool, bool) {
+	return false, false
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package lib
+
+import (
+	"os"
+
+	log "aproxymate/lib/logger"
+)
+
+// checkLocalPort refuses privileged ports when this process is known to lack the privilege to
+// bind them, and warns when that can't be determined
+func checkLocalPort(bindAddress string, port int) error {
+	if port >= 1024 || os.Geteuid() == 0 {
+		return nil
+	}
+	allowed, known := canBindPrivilegedPort(port)
+	if !known {
+		log.Warn("Local port is privileged and may require administrator privileges", "bind_address", bindAddress, "local_port", port)
+		return nil
+	}
+	if !allowed {
+		return privilegedPortError(port)
+	}
+	return nil
+}
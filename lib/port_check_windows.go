@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// excludedRangePattern matches a "start end" line of netsh's excluded port range table
+var excludedRangePattern = regexp.MustCompile(`(?m)^\s*(\d+)\s+(\d+)`)
+
+// checkLocalPort refuses ports inside the ranges Windows reserves, e.g. for Hyper-V, WSL or
+// Docker. Binding those fails with a permission error even for administrators.
+func checkLocalPort(bindAddress string, port int) error {
+	family := "ipv4"
+	if isIPv6(bindAddress) {
+		family = "ipv6"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "netsh", "interface", family, "show", "excludedportrange", "protocol=tcp").Output()
+	if err != nil {
+		log.Debug("Failed to read reserved port ranges", "error", err)
+		return nil
+	}
+
+	for _, match := range excludedRangePattern.FindAllStringSubmatch(string(output), -1) {
+		start, _ := strconv.Atoi(match[1])
+		end, _ := strconv.Atoi(match[2])
+		if port >= start && port <= end {
+			return &LocalPortError{
+				Port:    port,
+				Reason:  PortReasonReserved,
+				Message: fmt.Sprintf("Port %d is in the range %d-%d that Windows reserves (e.g. for Hyper-V, WSL or Docker) and cannot be bound. Please choose a different local port or check 'netsh interface %s show excludedportrange protocol=tcp'", port, start, end, family),
+			}
+		}
+	}
+	return nil
+}
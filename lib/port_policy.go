@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "aproxymate/lib/logger"
+)
+
+const (
+	// minAutoPort and maxAutoPort bound automatic port assignment when no port_range is configured
+	minAutoPort = 1024
+	maxAutoPort = 65535
+	// defaultStartingPort is the first port handed out when no port_range is configured
+	defaultStartingPort = 3001
+)
+
+// PortPolicy controls which local ports automatic port assignment may hand out.
+// The zero value allows any unprivileged port.
+type PortPolicy struct {
+	// Min and Max bound the allowed range (inclusive); zero means no range configured
+	Min int
+	Max int
+	// Reserved ports are never assigned, even when inside the range
+	Reserved map[int]bool
+}
+
+// ParsePortPolicy builds a PortPolicy from a "start-end" range string and a list of reserved ports
+func ParsePortPolicy(portRange string, reservedPorts []int) (PortPolicy, error) {
+	policy := PortPolicy{Reserved: make(map[int]bool)}
+
+	if portRange = strings.TrimSpace(portRange); portRange != "" {
+		start, end, found := strings.Cut(portRange, "-")
+		if !found {
+			return PortPolicy{}, fmt.Errorf("invalid port_range %q: expected format start-end (e.g. 15000-15999)", portRange)
+		}
+
+		minPort, err := strconv.Atoi(strings.TrimSpace(start))
+		if err != nil {
+			return PortPolicy{}, fmt.Errorf("invalid port_range %q: start is not a number", portRange)
+		}
+		maxPort, err := strconv.Atoi(strings.TrimSpace(end))
+		if err != nil {
+			return PortPolicy{}, fmt.Errorf("invalid port_range %q: end is not a number", portRange)
+		}
+		if minPort < 1 || maxPort > 65535 || minPort > maxPort {
+			return PortPolicy{}, fmt.Errorf("invalid port_range %q: must be within 1-65535 with start <= end", portRange)
+		}
+
+		policy.Min = minPort
+		policy.Max = maxPort
+	}
+
+	for _, port := range reservedPorts {
+		if port < 1 || port > 65535 {
+			return PortPolicy{}, fmt.Errorf("invalid reserved port %d (must be 1-65535)", port)
+		}
+		policy.Reserved[port] = true
+	}
+
+	return policy, nil
+}
+
+// PortPolicy returns the port allocation policy defined by the config
+func (c AppConfig) PortPolicy() (PortPolicy, error) {
+	return ParsePortPolicy(c.PortRange, c.ReservedPorts)
+}
+
+// bounds returns the effective port range of the policy
+func (p PortPolicy) bounds() (int, int) {
+	if p.Min == 0 {
+		return minAutoPort, maxAutoPort
+	}
+	return p.Min, p.Max
+}
+
+// Allows reports whether automatic assignment may use the port
+func (p PortPolicy) Allows(port int) bool {
+	minPort, maxPort := p.bounds()
+	return port >= minPort && port <= maxPort && !p.Reserved[port]
+}
+
+// NextAvailable returns the first allowed port that is not in use, starting from the preferred
+// port and wrapping around within the range. Falls back to the preferred port if none is free.
+func (p PortPolicy) NextAvailable(usedPorts map[int]bool, preferredPort int) int {
+	minPort, maxPort := p.bounds()
+
+	start := preferredPort
+	if start < minPort || start > maxPort {
+		start = minPort
+	}
+
+	port := start
+	for {
+		if !usedPorts[port] && p.Allows(port) {
+			return port
+		}
+		port++
+		if port > maxPort {
+			port = minPort
+		}
+		if port == start {
+			break
+		}
+	}
+
+	log.Warn("Could not find available port in the allowed range, using preferred port",
+		"port", preferredPort,
+		"range_start", minPort,
+		"range_end", maxPort)
+	return preferredPort
+}
+
+// StartingPort returns the first port to assign to new configurations, after the
+// highest port already used by the existing configurations
+func (p PortPolicy) StartingPort(configs []ProxyConfig) int {
+	usedPorts := GetUsedLocalPorts(configs)
+
+	minPort, maxPort := p.bounds()
+	start := minPort
+	if p.Min == 0 {
+		start = defaultStartingPort
+	}
+
+	highest := 0
+	for port := range usedPorts {
+		if port >= minPort && port <= maxPort && port > highest {
+			highest = port
+		}
+	}
+	if highest >= start {
+		start = highest + 1
+	}
+
+	return p.NextAvailable(usedPorts, start)
+}
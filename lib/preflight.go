@@ -0,0 +1,265 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Outcomes of a preflight check
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+	PreflightSkip = "skip"
+)
+
+// PreflightCheck is the result of one dry-run check of a proxy
+type PreflightCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// PreflightResult holds the checks of a proxy; Passed is false when any check failed
+type PreflightResult struct {
+	Passed bool             `json:"passed"`
+	Checks []PreflightCheck `json:"checks"`
+}
+
+// relayPermissions are the API calls connecting a proxy makes in the relay pod's namespace
+var relayPermissions = []authorizationv1.ResourceAttributes{
+	{Verb: "create", Resource: "pods"},
+	{Verb: "get", Resource: "pods"},
+	{Verb: "delete", Resource: "pods"},
+	{Verb: "create", Resource: "pods", Subresource: "portforward"},
+}
+
+// Preflight runs the checks connecting a proxy depends on without creating anything: the local
+// port is free, the cluster is reachable, the user may create relay pods and the remote host
+// resolves. Checks that depend on a failed one are skipped.
+func (m *ProxyManager) Preflight(ctx context.Context, spec ProxySpec) PreflightResult {
+	result := PreflightResult{Passed: true}
+	add := func(name, status, format string, args ...any) {
+		result.Checks = append(result.Checks, PreflightCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+		if status == PreflightFail {
+			result.Passed = false
+		}
+	}
+
+	m.mu.Lock()
+	_, connected := m.proxies[spec.ID]
+	_, connecting := m.connecting[spec.ID]
+	socatConfig := m.settings.socatProxyConfig(spec, "")
+	networkPolicy := m.settings.networkPolicy
+	m.mu.Unlock()
+
+	if connected {
+		add("local_port", PreflightPass, "the proxy is connected and listening on %s", spec.localEndpoint())
+	} else if connecting {
+		add("local_port", PreflightPass, "the proxy is connecting on %s", spec.localEndpoint())
+	} else if err := m.checkLocalEndpoint(spec); err != nil {
+		add("local_port", PreflightFail, "%v", err)
+	} else {
+		add("local_port", PreflightPass, "%s is free", spec.localEndpoint())
+	}
+
+	if spec.hostTemplateErr != nil {
+		add("remote_host", PreflightFail, "the proxy has %v", spec.hostTemplateErr)
+	}
+
+	clientset, err := m.checkCluster(ctx, spec)
+	if err != nil {
+		add("cluster", PreflightFail, "%v", err)
+		add("permissions", PreflightSkip, "the cluster is not reachable")
+		add("quota", PreflightSkip, "the cluster is not reachable")
+	} else {
+		add("cluster", PreflightPass, "cluster '%s' is reachable", spec.KubernetesCluster)
+
+		if missing, err := missingRelayPermissions(ctx, clientset, socatConfig.Namespace, networkPolicy); err != nil {
+			add("permissions", PreflightWarn, "could not check permissions: %v", err)
+		} else if len(missing) > 0 {
+			add("permissions", PreflightFail, "missing permissions in namespace %s: %s", socatConfig.Namespace, strings.Join(missing, ", "))
+		} else {
+			add("permissions", PreflightPass, "relay pods may be created and port-forwarded in namespace %s", socatConfig.Namespace)
+		}
+
+		if err := CheckSocatPodQuota(ctx, clientset, socatConfig); err != nil {
+			add("quota", PreflightFail, "%v", err)
+		} else {
+			add("quota", PreflightPass, "namespace %s has room for the relay pod", socatConfig.Namespace)
+		}
+	}
+
+	if spec.hostTemplateErr == nil {
+		// Keep the interface nil when the cluster is unreachable
+		var client kubernetes.Interface
+		if clientset != nil {
+			client = clientset
+		}
+		status, message := checkRemoteHosts(ctx, client, spec)
+		add("remote_host", status, "%s", message)
+	}
+
+	return result
+}
+
+// localEndpoint describes where a proxy listens locally
+func (s ProxySpec) localEndpoint() string {
+	if s.LocalSocket != "" {
+		return s.LocalSocket
+	}
+	bindAddress, _ := sharedListenAddress(s)
+	return net.JoinHostPort(bindAddress, fmt.Sprint(s.LocalPort))
+}
+
+// checkLocalEndpoint checks that the local ports of a proxy can be bound, or are shared with
+// connected proxies of the same kind
+func (m *ProxyManager) checkLocalEndpoint(spec ProxySpec) error {
+	if spec.LocalSocket != "" {
+		if conn, err := net.DialTimeout("unix", spec.LocalSocket, 500*time.Millisecond); err == nil {
+			conn.Close()
+			return fmt.Errorf("socket %s is in use by another process", spec.LocalSocket)
+		}
+		return nil
+	}
+
+	_, key := sharedListenAddress(spec)
+	m.sharedMu.Lock()
+	mux, gateway := m.sniMuxes[key], m.httpGateways[key]
+	m.sharedMu.Unlock()
+	if (len(spec.ServerNames) > 0 && mux != nil && !mux.Closed()) || (spec.HTTPPath != "" && gateway != nil && !gateway.Closed()) {
+		return nil
+	}
+
+	localPorts := []int{spec.LocalPort}
+	for _, mapping := range spec.Ports {
+		localPorts = append(localPorts, mapping.LocalPort)
+	}
+	for _, port := range localPorts {
+		if err := CheckLocalPort(spec.LocalBindAddress, port); err != nil {
+			return err
+		}
+		listener, err := listenTCP(spec.LocalBindAddress, port)
+		if err != nil {
+			return err
+		}
+		listener.Close()
+	}
+	return nil
+}
+
+// checkCluster connects to the proxy's cluster and asks for its version
+func (m *ProxyManager) checkCluster(ctx context.Context, spec ProxySpec) (*kubernetes.Clientset, error) {
+	if spec.KubernetesCluster == "" {
+		return nil, fmt.Errorf("no Kubernetes cluster is selected")
+	}
+	if err := CheckTeleportSession("", spec.KubernetesCluster); err != nil {
+		return nil, fmt.Errorf("cannot connect to Kubernetes cluster '%s': %w", spec.KubernetesCluster, err)
+	}
+	clientset, _, err := kubeClientsForSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := clientset.Discovery().ServerVersion()
+		done <- err
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the API server of cluster '%s': %v", spec.KubernetesCluster, err)
+	}
+	return clientset, nil
+}
+
+// missingRelayPermissions returns the relay pod permissions the user lacks in a namespace
+func missingRelayPermissions(ctx context.Context, clientset kubernetes.Interface, namespace string, networkPolicy bool) ([]string, error) {
+	permissions := relayPermissions
+	if networkPolicy {
+		permissions = append(permissions[:len(permissions):len(permissions)],
+			authorizationv1.ResourceAttributes{Verb: "create", Group: "networking.k8s.io", Resource: "networkpolicies"})
+	}
+
+	var missing []string
+	for _, permission := range permissions {
+		permission.Namespace = namespace
+		review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &permission},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if !review.Status.Allowed {
+			resource := permission.Resource
+			if permission.Subresource != "" {
+				resource += "/" + permission.Subresource
+			}
+			missing = append(missing, permission.Verb+" "+resource)
+		}
+	}
+	return missing, nil
+}
+
+// checkRemoteHosts checks that the remote hosts of a proxy resolve. Names without a dot, or
+// ending in .svc or .svc.cluster.local, are looked up as Services in the cluster; other names
+// are resolved from this machine, which can't see cluster-internal DNS, so a failure is only a warning.
+func checkRemoteHosts(ctx context.Context, clientset kubernetes.Interface, spec ProxySpec) (string, string) {
+	hosts := spec.RemoteHosts
+	if len(hosts) == 0 {
+		hosts = []string{spec.RemoteHost}
+	}
+
+	var unresolved []string
+	for _, host := range hosts {
+		if net.ParseIP(host) != nil {
+			continue
+		}
+
+		if service, namespace, ok := clusterServiceName(host, spec.Namespace); ok {
+			if clientset == nil {
+				return PreflightSkip, "the cluster is not reachable to look up Service " + host
+			}
+			if _, err := clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{}); err != nil {
+				return PreflightFail, fmt.Sprintf("Service %s not found in namespace %s: %v", service, namespace, err)
+			}
+			continue
+		}
+
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			unresolved = append(unresolved, host)
+		}
+	}
+
+	if len(unresolved) > 0 {
+		return PreflightWarn, fmt.Sprintf("%s does not resolve from this machine; it may still resolve inside the cluster", strings.Join(unresolved, ", "))
+	}
+	return PreflightPass, fmt.Sprintf("%s resolves", strings.Join(hosts, ", "))
+}
+
+// clusterServiceName returns the Service and namespace a cluster-internal host name refers to
+func clusterServiceName(host, podNamespace string) (string, string, bool) {
+	if podNamespace == "" {
+		podNamespace = DefaultNamespace()
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(host, ".cluster.local"), ".svc")
+	if name != host || !strings.Contains(host, ".") {
+		service, namespace, found := strings.Cut(name, ".")
+		if !found {
+			namespace = podNamespace
+		}
+		return service, namespace, true
+	}
+	return "", "", false
+}
@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+const (
+	// credentialsRetryInterval is how often leasing credentials is retried after a failure
+	credentialsRetryInterval = 30 * time.Second
+	// credentialsMinLifetime is the remaining lease time below which credentials are replaced
+	// instead of renewed, since Vault caps renewals at the lease's maximum TTL
+	credentialsMinLifetime = time.Minute
+)
+
+// issueCredentials leases database credentials from Vault for a proxy that just connected,
+// before it is registered. A failure leaves the tunnel up; maintainCredentials keeps retrying.
+func (m *ProxyManager) issueCredentials(proxy *managedProxy) {
+	if !proxy.spec.Vault.Enabled() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultRequestTimeout)
+	defer cancel()
+
+	creds, err := IssueVaultCredentials(ctx, proxy.vault, proxy.spec.Vault)
+	if err != nil {
+		log.Error("Failed to get database credentials from Vault", "proxy_id", proxy.spec.ID, "role", proxy.spec.Vault.Role, "error", err)
+		proxy.credentialsError = err.Error()
+		return
+	}
+	proxy.credentials = creds
+	log.Info("Leased database credentials from Vault", "proxy_id", proxy.spec.ID, "role", proxy.spec.Vault.Role, "username", creds.Username, "expires_at", creds.ExpiresAt)
+}
+
+// maintainCredentials keeps the proxy's credentials valid for as long as the tunnel is up:
+// the lease is renewed after two thirds of its remaining time, and replaced by new
+// credentials once Vault won't extend it any further
+func (m *ProxyManager) maintainCredentials(proxy *managedProxy) {
+	if !proxy.spec.Vault.Enabled() {
+		return
+	}
+
+	for {
+		m.mu.RLock()
+		creds := proxy.credentials
+		m.mu.RUnlock()
+
+		wait := credentialsRetryInterval
+		if creds != nil {
+			wait = max(time.Until(creds.ExpiresAt)*2/3, 5*time.Second)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-proxy.forwarder.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		m.refreshCredentials(proxy, creds)
+	}
+}
+
+// refreshCredentials renews the current lease, or leases new credentials when that is not possible
+func (m *ProxyManager) refreshCredentials(proxy *managedProxy, current *VaultCredentials) {
+	ctx, cancel := context.WithTimeout(context.Background(), vaultRequestTimeout)
+	defer cancel()
+
+	if current != nil && current.Renewable {
+		expiresAt, err := RenewVaultLease(ctx, proxy.vault, current.LeaseID)
+		if err == nil && time.Until(expiresAt) > credentialsMinLifetime {
+			m.mu.Lock()
+			if m.proxies[proxy.spec.ID] == proxy && proxy.credentials == current {
+				renewed := *current
+				renewed.ExpiresAt = expiresAt
+				proxy.credentials = &renewed
+				proxy.credentialsError = ""
+			}
+			m.mu.Unlock()
+			log.Debug("Renewed Vault lease", "proxy_id", proxy.spec.ID, "expires_at", expiresAt)
+			return
+		}
+		if err != nil {
+			log.Warn("Failed to renew Vault lease, requesting new credentials", "proxy_id", proxy.spec.ID, "error", err)
+		}
+	}
+
+	creds, err := IssueVaultCredentials(ctx, proxy.vault, proxy.spec.Vault)
+
+	m.mu.Lock()
+	if m.proxies[proxy.spec.ID] != proxy {
+		// Disconnected meanwhile; don't leave the new lease behind
+		m.mu.Unlock()
+		if err == nil {
+			RevokeVaultLease(ctx, proxy.vault, creds.LeaseID)
+		}
+		return
+	}
+	if err != nil {
+		proxy.credentialsError = err.Error()
+		m.mu.Unlock()
+		log.Error("Failed to get database credentials from Vault", "proxy_id", proxy.spec.ID, "role", proxy.spec.Vault.Role, "error", err)
+		return
+	}
+	proxy.credentials = creds
+	proxy.credentialsError = ""
+	m.mu.Unlock()
+
+	// The previous lease expires on its own, so sessions opened with it are not cut off early
+	if current != nil {
+		log.Info("Leased new database credentials from Vault", "proxy_id", proxy.spec.ID, "username", creds.Username, "expires_at", creds.ExpiresAt)
+		m.publish(newProxyEvent(ProxyEventCredentialsRotated, proxy.spec, fmt.Sprintf("new database user %s", creds.Username)))
+	}
+}
+
+// revokeCredentials revokes the proxy's lease when its tunnel ends. The proxy must have been
+// removed from m.proxies, so its credentials no longer change.
+func (m *ProxyManager) revokeCredentials(ctx context.Context, proxy *managedProxy) {
+	creds := proxy.credentials
+	if creds == nil || creds.LeaseID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, vaultRequestTimeout)
+	defer cancel()
+
+	if err := RevokeVaultLease(ctx, proxy.vault, creds.LeaseID); err != nil {
+		log.Warn("Failed to revoke Vault lease; the credentials stay valid until they expire", "proxy_id", proxy.spec.ID, "expires_at", creds.ExpiresAt, "error", err)
+		return
+	}
+	log.Debug("Revoked Vault lease", "proxy_id", proxy.spec.ID, "username", creds.Username)
+}
+
+// credentialsStatus returns a copy of the proxy's credentials for status reports. Caller must hold m.mu.
+func (p *managedProxy) credentialsStatus() *VaultCredentials {
+	if p.credentials == nil {
+		return nil
+	}
+	creds := *p.credentials
+	return &creds
+}
+
+// Credentials returns the database credentials leased for a connected proxy, or nil if it
+// has no vault role
+func (m *ProxyManager) Credentials(id string) (*VaultCredentials, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	proxy, exists := m.proxies[id]
+	if !exists {
+		return nil, ErrProxyNotConnected
+	}
+	if !proxy.spec.Vault.Enabled() {
+		return nil, nil
+	}
+	if proxy.credentials == nil {
+		return nil, fmt.Errorf("no database credentials from Vault yet: %s", proxy.credentialsError)
+	}
+	return proxy.credentialsStatus(), nil
+}
@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ProxyFilter selects proxies by a search term, cluster and connection state. The GUI's
+// GET /api/proxy and 'aproxymate config list' share it.
+type ProxyFilter struct {
+	// Query matches the name, cluster, hosts, ports, namespace, description and owner, ignoring case
+	Query string
+	// Cluster matches the Kubernetes context exactly
+	Cluster string
+	// Connected, when set, only matches proxies that are or are not connected
+	Connected *bool
+}
+
+// ParseProxyFilter reads a filter from the query, cluster and connected URL parameters
+func ParseProxyFilter(values url.Values) (ProxyFilter, error) {
+	filter := ProxyFilter{
+		Query:   strings.TrimSpace(values.Get("query")),
+		Cluster: values.Get("cluster"),
+	}
+	if value := values.Get("connected"); value != "" {
+		connected, err := strconv.ParseBool(value)
+		if err != nil {
+			return ProxyFilter{}, fmt.Errorf("connected must be true or false, got '%s'", value)
+		}
+		filter.Connected = &connected
+	}
+	return filter, nil
+}
+
+// Values encodes the filter as URL parameters for ParseProxyFilter
+func (f ProxyFilter) Values() url.Values {
+	values := url.Values{}
+	if f.Query != "" {
+		values.Set("query", f.Query)
+	}
+	if f.Cluster != "" {
+		values.Set("cluster", f.Cluster)
+	}
+	if f.Connected != nil {
+		values.Set("connected", strconv.FormatBool(*f.Connected))
+	}
+	return values
+}
+
+// Matches reports whether a proxy with the given connection state passes the filter
+func (f ProxyFilter) Matches(config ProxyConfig, connected bool) bool {
+	if f.Cluster != "" && config.KubernetesCluster != f.Cluster {
+		return false
+	}
+	if f.Connected != nil && *f.Connected != connected {
+		return false
+	}
+	if f.Query == "" {
+		return true
+	}
+
+	fields := []string{
+		config.Name, config.KubernetesCluster, config.RemoteHost, config.PodNamespace(),
+		config.Description, config.Owner,
+		strconv.Itoa(config.LocalPort), strconv.Itoa(config.RemotePort),
+	}
+	for _, mapping := range config.Ports {
+		fields = append(fields, strconv.Itoa(mapping.LocalPort), strconv.Itoa(mapping.RemotePort))
+	}
+	fields = append(fields, config.RemoteHosts...)
+
+	query := strings.ToLower(f.Query)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,1739 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "aproxymate/lib/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	// ErrProxyAlreadyConnected is returned when connecting a proxy that is already connected
+	ErrProxyAlreadyConnected = errors.New("proxy already connected")
+	// ErrProxyNotConnected is returned when disconnecting a proxy that is not connected
+	ErrProxyNotConnected = errors.New("proxy not connected")
+	// ErrProxyConnecting is returned when connecting a proxy whose previous connect is still running
+	ErrProxyConnecting = errors.New("proxy is already connecting")
+	// ErrConnectCancelled is returned by a connect that a disconnect request stopped midway
+	ErrConnectCancelled = errors.New("connect cancelled by a disconnect request")
+)
+
+// ProxySpec describes a proxy connection to establish
+type ProxySpec struct {
+	ID                string
+	Name              string
+	KubernetesCluster string
+	RemoteHost        string
+	LocalPort         int
+	RemotePort        int
+	// RemoteHosts lists RemoteHost and its failover hosts in order, when there are any
+	RemoteHosts []string
+	// Namespace is where the relay pod is created
+	Namespace    string
+	ClientAccess ClientAccessConfig
+	// LocalBindAddress is the address the local listener binds to (default 127.0.0.1)
+	LocalBindAddress string
+	// LocalSocket is a Unix socket path used instead of LocalPort when set
+	LocalSocket string
+	// Ports are additional local/remote port pairs forwarded through the same pod
+	Ports []PortMapping
+	// Vault selects the role database credentials are leased from while connected
+	Vault VaultCredentialsConfig
+	// PriorityClassName overrides the global PriorityClass of the relay pod
+	PriorityClassName string
+	// PodAnnotations are added to the relay pod on top of the global ones
+	PodAnnotations map[string]string
+	// ServerNames route TLS connections on the shared LocalPort to this proxy when set
+	ServerNames []string
+	// HTTPPath routes HTTP requests below this path on the shared LocalPort to this proxy when set
+	HTTPPath       string
+	HTTPBackendTLS bool
+	// AccessLog overrides the global access log target
+	AccessLog string
+	// Keepalive overrides individual global TCP keepalive settings
+	Keepalive KeepaliveConfig
+	// RelayTLS encrypts the traffic to the relay pod, which terminates the TLS connection
+	RelayTLS bool
+	// Reconnect overrides individual global reconnect policy settings
+	Reconnect ReconnectPolicy
+	// OperationID identifies the connect request; the events of that connect carry it
+	OperationID string
+	// User is the logged-in user the proxy is connected for on a shared server. It labels the
+	// relay pod and the events instead of the OS user.
+	User string
+
+	// hostTemplateErr is set when the remote host template could not be expanded; Connect fails with it
+	hostTemplateErr error
+}
+
+// NewProxySpec builds a ProxySpec from a proxy config entry, expanding remote host templates
+func NewProxySpec(id string, config ProxyConfig) ProxySpec {
+	expanded, hostTemplateErr := config.expandRemoteHosts()
+	if hostTemplateErr == nil {
+		config = expanded
+	}
+
+	var remoteHosts []string
+	if hosts := config.Hosts(); len(hosts) > 1 {
+		remoteHosts = hosts
+	}
+	return ProxySpec{
+		ID:                id,
+		Name:              config.Name,
+		KubernetesCluster: config.KubernetesCluster,
+		RemoteHost:        config.RemoteHost,
+		LocalPort:         config.LocalPort,
+		RemotePort:        config.RemotePort,
+		RemoteHosts:       remoteHosts,
+		Namespace:         config.PodNamespace(),
+		ClientAccess:      config.ClientAccess,
+		LocalBindAddress:  config.LocalBindAddress,
+		LocalSocket:       config.LocalSocket,
+		Ports:             config.Ports,
+		Vault:             config.Vault,
+		PriorityClassName: config.PriorityClassName,
+		PodAnnotations:    config.PodAnnotations,
+		ServerNames:       config.ServerNames(),
+		HTTPPath:          config.HTTPPath,
+		HTTPBackendTLS:    config.HTTPBackendTLS,
+		AccessLog:         config.AccessLog,
+		Keepalive:         config.Keepalive,
+		RelayTLS:          config.RelayTLS,
+		Reconnect:         config.Reconnect,
+		hostTemplateErr:   hostTemplateErr,
+	}
+}
+
+// ProxyState is the lifecycle state of a proxy
+type ProxyState string
+
+const (
+	ProxyStateConnecting ProxyState = "connecting"
+	ProxyStateConnected  ProxyState = "connected"
+	// ProxyStateDegraded means the port-forward is up but the relay pod is unhealthy or unreachable
+	ProxyStateDegraded ProxyState = "degraded"
+	ProxyStateStopped  ProxyState = "stopped"
+)
+
+// ProxyStatus is a point-in-time snapshot of a managed proxy
+type ProxyStatus struct {
+	ID          string     `json:"id"`
+	Cluster     string     `json:"cluster,omitempty"`
+	Connected   bool       `json:"connected"`
+	State       ProxyState `json:"state"`
+	PodName     string     `json:"podName,omitempty"`
+	Namespace   string     `json:"namespace,omitempty"`
+	ConnectedAt time.Time  `json:"connectedAt,omitempty"`
+	// UptimeSeconds is how long the proxy has been connected
+	UptimeSeconds int64 `json:"uptimeSeconds"`
+	// Pod is the last observed state of the relay pod
+	Pod RelayPodStatus `json:"pod"`
+	// LastError is the latest problem seen with the relay pod, if any
+	LastError string `json:"lastError,omitempty"`
+	// Credentials are the database credentials leased from Vault, without the password
+	Credentials *VaultCredentials `json:"credentials,omitempty"`
+	// CredentialsError is why credentials could not be leased or renewed
+	CredentialsError string `json:"credentialsError,omitempty"`
+	// Stats holds traffic accounting from the in-process local listener
+	Stats ForwarderStats `json:"stats"`
+	// IdleSeconds is how long the proxy has had no open client connections
+	IdleSeconds int64 `json:"idleSeconds"`
+}
+
+// ProxyEventType identifies the kind of lifecycle event emitted by the ProxyManager
+type ProxyEventType string
+
+const (
+	ProxyEventConnected     ProxyEventType = "connected"
+	ProxyEventDisconnected  ProxyEventType = "disconnected"
+	ProxyEventDropped       ProxyEventType = "dropped"
+	ProxyEventConnectFailed ProxyEventType = "connect_failed"
+	// ProxyEventPodFailed is emitted when the relay pod cannot be created or does not start
+	ProxyEventPodFailed ProxyEventType = "pod_failed"
+	// ProxyEventReconnected is emitted when a dropped proxy is connected again automatically
+	ProxyEventReconnected ProxyEventType = "reconnected"
+	// ProxyEventReconnectExhausted is emitted when automatic reconnects give up
+	ProxyEventReconnectExhausted ProxyEventType = "reconnect_exhausted"
+	// ProxyEventStateChanged is emitted on every proxy state transition
+	ProxyEventStateChanged ProxyEventType = "state_changed"
+	// ProxyEventPodDeleted is emitted when a proxy's relay pod has been deleted
+	ProxyEventPodDeleted ProxyEventType = "pod_deleted"
+	// ProxyEventCredentialsRotated is emitted when a proxy's Vault lease could not be renewed
+	// any further and new database credentials were issued
+	ProxyEventCredentialsRotated ProxyEventType = "credentials_rotated"
+	// ProxyEventConnectProgress is emitted when a connect reaches the next ConnectStage
+	ProxyEventConnectProgress ProxyEventType = "connect_progress"
+)
+
+// ConnectStage is a step of connecting a proxy, reported by connect_progress events
+type ConnectStage string
+
+const (
+	// ConnectStageQueued is reported when other pod operations of the cluster use every slot
+	ConnectStageQueued             ConnectStage = "queued"
+	ConnectStagePodCreated         ConnectStage = "pod_created"
+	ConnectStagePodRunning         ConnectStage = "pod_running"
+	ConnectStageForwardEstablished ConnectStage = "forward_established"
+)
+
+// maxEventHistory bounds the number of proxy events kept for /api/events
+const maxEventHistory = 500
+
+// ProxyEvent describes a change in a proxy's lifecycle
+type ProxyEvent struct {
+	Type      ProxyEventType `json:"type"`
+	ProxyID   string         `json:"proxyId"`
+	ProxyName string         `json:"proxyName,omitempty"`
+	Cluster   string         `json:"cluster,omitempty"`
+	Time      time.Time      `json:"time"`
+	Message   string         `json:"message,omitempty"`
+	// State and PreviousState are set on state_changed events
+	State         ProxyState `json:"state,omitempty"`
+	PreviousState ProxyState `json:"previousState,omitempty"`
+	// OperationID is the connect request the event belongs to, if any
+	OperationID string `json:"operationId,omitempty"`
+	// Stage is set on connect_progress events
+	Stage ConnectStage `json:"stage,omitempty"`
+	// User is the logged-in user the proxy was connected for, if any
+	User string `json:"user,omitempty"`
+}
+
+// newProxyEvent creates a lifecycle event for the proxy described by spec
+func newProxyEvent(eventType ProxyEventType, spec ProxySpec, message string) ProxyEvent {
+	return ProxyEvent{
+		Type:        eventType,
+		ProxyID:     spec.ID,
+		ProxyName:   spec.Name,
+		Cluster:     spec.KubernetesCluster,
+		Time:        time.Now(),
+		Message:     message,
+		OperationID: spec.OperationID,
+		User:        spec.User,
+	}
+}
+
+// managedProxy holds the runtime state of a connected proxy
+type managedProxy struct {
+	spec        ProxySpec
+	forwarder   *LocalForwarder
+	podName     string
+	namespace   string
+	connectedAt time.Time
+	// pod and podError are refreshed by watchPod; guarded by ProxyManager.mu
+	pod      RelayPodStatus
+	podError string
+	// credentials are leased from vault for proxies with a vault role; guarded by ProxyManager.mu
+	credentials      *VaultCredentials
+	credentialsError string
+	vault            VaultConfig
+	// usage is how much of the proxy's usage has been recorded
+	usage usageMeter
+	// reconnecting is set while a new port-forward stream is opened after the old one closed;
+	// guarded by ProxyManager.mu, like podName and namespace, which a reconnect may change
+	reconnecting bool
+	// reconnect is the effective reconnect policy; guarded by ProxyManager.mu
+	reconnect ReconnectPolicy
+	// retries counts the reconnect attempts since the proxy last stayed connected for the
+	// policy's reset window, and stableSince is when it last (re)connected; used by monitor only
+	retries     int
+	stableSince time.Time
+}
+
+// podSlotTimeout is how long a connect waits for other pod operations of its cluster
+const podSlotTimeout = 5 * time.Minute
+
+// podStatusInterval is how often the relay pod of a connected proxy is inspected
+const podStatusInterval = 15 * time.Second
+
+// reconnectHoldTimeout is how long the local listeners of a dropped proxy hold new client
+// connections while it is reconnected
+const reconnectHoldTimeout = time.Minute
+
+// managerSettings are the global settings taken from the application config. Connects work
+// on a copy, so a config reload doesn't change a connect midway.
+type managerSettings struct {
+	clientAccess      ClientAccessConfig
+	vault             VaultConfig
+	priorityClassName string
+	podAnnotations    map[string]string
+	sidecarInjection  bool
+	networkPolicy     bool
+	relayImage        RelayImageConfig
+	podSpread         PodSpreadConfig
+	accessLog         string
+	keepalive         KeepaliveConfig
+	reconnect         ReconnectPolicy
+}
+
+// connectAttempt marks a proxy that is connecting. Creating the relay pod and waiting for it
+// takes up to a minute, so it happens without holding the manager's lock; the attempt keeps
+// a second connect of the same proxy out and lets a disconnect request cancel it.
+type connectAttempt struct {
+	spec ProxySpec
+	// cancelled is set by a disconnect request during the attempt; guarded by ProxyManager.mu
+	cancelled bool
+	// done is closed when the attempt has finished, including stopping a cancelled proxy
+	done chan struct{}
+	// stage is the last step reached; guarded by ProxyManager.mu
+	stage ConnectStage
+}
+
+// podEventsExcerpt is the number of relay pod events kept with a proxy failure
+const podEventsExcerpt = 5
+
+// podLogsExcerpt is the number of log lines of each relay pod container kept with a proxy failure
+const podLogsExcerpt = 20
+
+// ProxyFailure is why a proxy last failed to connect or dropped
+type ProxyFailure struct {
+	Message string `json:"message"`
+	// Stage is the last connect stage reached before a connect failed; empty when it failed
+	// before the relay pod was created, or when a connected proxy dropped
+	Stage ConnectStage `json:"stage,omitempty"`
+	// PodEvents are the latest Kubernetes events of the relay pod, e.g. "Warning Failed: ... ImagePullBackOff"
+	PodEvents []string `json:"podEvents,omitempty"`
+	// PodLogs are the last lines logged by the relay pod's containers, e.g. why socat exited
+	PodLogs []ContainerLog `json:"podLogs,omitempty"`
+	Time    time.Time      `json:"time"`
+}
+
+// podFailureError is a connect error that carries the relay pod's latest events and logs, read
+// before the failed pod was deleted
+type podFailureError struct {
+	err    error
+	events []string
+	logs   []ContainerLog
+}
+
+func (e *podFailureError) Error() string { return e.err.Error() }
+func (e *podFailureError) Unwrap() error { return e.err }
+
+// withPodDetails attaches the latest events and logs of a relay pod that is about to be deleted
+// to a connect error
+func withPodDetails(kubeClient kubernetes.Interface, namespace, podName string, err error) error {
+	events, logs := readPodDetails(kubeClient, namespace, podName)
+	if len(events) == 0 && len(logs) == 0 {
+		return err
+	}
+	return &podFailureError{err: err, events: events, logs: logs}
+}
+
+// readPodDetails reads the latest events and container logs of a relay pod; what can't be read
+// is left out
+func readPodDetails(kubeClient kubernetes.Interface, namespace, podName string) ([]string, []ContainerLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	events, err := RecentPodEvents(ctx, kubeClient, namespace, podName, podEventsExcerpt)
+	cancel()
+	if err != nil {
+		log.Debug("Could not read the relay pod's events", "pod", podName, "namespace", namespace, "error", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	logs, err := RecentPodLogs(ctx, kubeClient, namespace, podName, podLogsExcerpt)
+	cancel()
+	if err != nil {
+		log.Debug("Could not read the relay pod's logs", "pod", podName, "namespace", namespace, "error", err)
+	}
+	return events, logs
+}
+
+// ConnectProgress describes a connect in progress
+type ConnectProgress struct {
+	OperationID string       `json:"operationId,omitempty"`
+	Stage       ConnectStage `json:"stage,omitempty"`
+}
+
+// ProxyManager owns proxy connections: relay pods, local forwarders and their monitoring.
+// It is shared by the HTTP handlers and the command-line tools. mu is only held for map and
+// field updates, never across calls to the cluster.
+type ProxyManager struct {
+	mu      sync.RWMutex
+	proxies map[string]*managedProxy
+	// connecting holds the proxies whose connect is in progress
+	connecting map[string]*connectAttempt
+	// failures holds the last failure of proxies that failed to connect or dropped, until they connect again
+	failures map[string]ProxyFailure
+	settings managerSettings
+	// usage collects proxy usage for the stats file while RecordUsage is active
+	usage *usageRecorder
+	// ops limits the relay pods created and deleted at the same time per cluster
+	ops *podOpQueue
+	// relay creates the relay pod of a connect and opens the forwarder's stream to it, returning
+	// the pod's namespace and name; startRelay unless replaced in tests
+	relay func(spec ProxySpec, settings managerSettings, forwarder *LocalForwarder) (string, string, error)
+
+	// sniMuxes and httpGateways are the shared local ports of SNI and HTTP gateway proxies,
+	// keyed by listen address
+	sharedMu     sync.Mutex
+	sniMuxes     map[string]*sniMux
+	httpGateways map[string]*httpGateway
+
+	// states has its own mutex so that it can be updated while mu is held. Proxies without an
+	// entry are stopped.
+	stateMu sync.Mutex
+	states  map[string]ProxyState
+
+	subMu       sync.Mutex
+	subscribers map[chan ProxyEvent]struct{}
+	// history holds the most recent events, oldest first; guarded by subMu
+	history []ProxyEvent
+}
+
+// NewProxyManager creates a new ProxyManager instance
+func NewProxyManager() *ProxyManager {
+	m := &ProxyManager{
+		proxies:      make(map[string]*managedProxy),
+		connecting:   make(map[string]*connectAttempt),
+		failures:     make(map[string]ProxyFailure),
+		ops:          newPodOpQueue(),
+		sniMuxes:     make(map[string]*sniMux),
+		httpGateways: make(map[string]*httpGateway),
+		states:       make(map[string]ProxyState),
+		subscribers:  make(map[chan ProxyEvent]struct{}),
+	}
+	m.relay = m.startRelay
+	return m
+}
+
+// ApplyConfig updates the global settings used for new connections
+func (m *ProxyManager) ApplyConfig(config AppConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.settings = managerSettings{
+		clientAccess:      config.ClientAccess,
+		vault:             config.Vault,
+		priorityClassName: config.PriorityClassName,
+		podAnnotations:    config.PodAnnotations,
+		sidecarInjection:  config.SidecarInjection,
+		networkPolicy:     config.NetworkPolicy,
+		relayImage:        config.RelayImage,
+		podSpread:         config.PodSpread,
+		accessLog:         config.AccessLog,
+		keepalive:         config.Keepalive,
+		reconnect:         config.Reconnect,
+	}
+	m.ops.configure(config.PodOperations)
+	SetKubernetesAPIConfig(config.KubernetesAPI.WithProxyURLs(config.ProxyConfigs))
+}
+
+// Connect creates the relay pod for the spec and starts forwarding the local port to it
+func (m *ProxyManager) Connect(spec ProxySpec) error {
+	attempt, settings, err := m.beginConnect(spec, "")
+	if err != nil {
+		return err
+	}
+	return m.connect(attempt, settings)
+}
+
+// ConnectAsync registers the connect and returns, leaving pod creation and the port-forward
+// to a goroutine. Progress and the outcome are published as events carrying spec.OperationID.
+func (m *ProxyManager) ConnectAsync(spec ProxySpec) error {
+	attempt, settings, err := m.beginConnect(spec, "")
+	if err != nil {
+		return err
+	}
+	// Port conflicts are quick to find and are returned to the caller rather than as an event
+	if err := m.checkLocalEndpoint(spec); err != nil {
+		if m.failConnect(attempt, err, true) {
+			m.publish(newProxyEvent(ProxyEventConnectFailed, spec, err.Error()))
+		}
+		return err
+	}
+	go m.connect(attempt, settings)
+	return nil
+}
+
+// connect runs a registered connect attempt to its end
+func (m *ProxyManager) connect(attempt *connectAttempt, settings managerSettings) error {
+	spec := attempt.spec
+	proxy, err := m.startProxy(spec, settings)
+	if err != nil {
+		if m.failConnect(attempt, err, true) {
+			m.publish(newProxyEvent(ProxyEventConnectFailed, spec, err.Error()))
+		}
+		return err
+	}
+
+	m.issueCredentials(proxy)
+	if !m.finishConnect(attempt, proxy) {
+		return ErrConnectCancelled
+	}
+	m.publish(newProxyEvent(ProxyEventConnected, spec, ""))
+	// The cluster is reachable again, so the next startup cleans it up again
+	go forgetClusterScanFailures(spec.KubernetesCluster)
+
+	// Monitor the process in a goroutine
+	go m.monitor(spec.ID, proxy)
+
+	return nil
+}
+
+// beginConnect registers a connect attempt for the spec and returns the settings to connect with
+func (m *ProxyManager) beginConnect(spec ProxySpec, message string) (*connectAttempt, managerSettings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.proxies[spec.ID]; exists {
+		return nil, managerSettings{}, ErrProxyAlreadyConnected
+	}
+	if _, exists := m.connecting[spec.ID]; exists {
+		return nil, managerSettings{}, ErrProxyConnecting
+	}
+
+	attempt := &connectAttempt{spec: spec, done: make(chan struct{})}
+	m.connecting[spec.ID] = attempt
+	m.setState(spec, ProxyStateConnecting, message)
+	return attempt, m.settings, nil
+}
+
+// reportStage records the stage reached by a connect and publishes a connect_progress event
+func (m *ProxyManager) reportStage(spec ProxySpec, stage ConnectStage, message string) {
+	m.mu.Lock()
+	if attempt, exists := m.connecting[spec.ID]; exists {
+		attempt.stage = stage
+	}
+	m.mu.Unlock()
+
+	event := newProxyEvent(ProxyEventConnectProgress, spec, message)
+	event.Stage = stage
+	m.publish(event)
+}
+
+// Connecting returns the progress of the proxies that are connecting, keyed by ID
+func (m *ProxyManager) Connecting() map[string]ConnectProgress {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	progress := make(map[string]ConnectProgress, len(m.connecting))
+	for id, attempt := range m.connecting {
+		progress[id] = ConnectProgress{OperationID: attempt.spec.OperationID, Stage: attempt.stage}
+	}
+	return progress
+}
+
+// finishConnect registers the proxy of a successful attempt. It returns false, after stopping
+// the proxy, when the attempt was cancelled meanwhile.
+func (m *ProxyManager) finishConnect(attempt *connectAttempt, proxy *managedProxy) bool {
+	defer close(attempt.done)
+
+	m.mu.Lock()
+	id := attempt.spec.ID
+	delete(m.connecting, id)
+	cancelled := attempt.cancelled
+	if !cancelled {
+		delete(m.failures, id)
+		m.proxies[id] = proxy
+		m.setState(attempt.spec, ProxyStateConnected, "")
+		if m.usage != nil {
+			m.usage.addConnect(attempt.spec, proxy.connectedAt)
+		}
+	}
+	m.mu.Unlock()
+
+	if cancelled {
+		log.Info("Connect was cancelled, removing the relay pod", "proxy_id", id, "pod", proxy.podName)
+		m.stopProxy(proxy)
+	}
+	return !cancelled
+}
+
+// failConnect ends an attempt that failed, recording the error as the proxy's last failure when
+// wanted. It returns false when the attempt had been cancelled, so the failure is not reported.
+func (m *ProxyManager) failConnect(attempt *connectAttempt, err error, recordFailure bool) bool {
+	defer close(attempt.done)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.connecting, attempt.spec.ID)
+	if attempt.cancelled {
+		return false
+	}
+	if recordFailure {
+		failure := ProxyFailure{Message: err.Error(), Stage: attempt.stage, Time: time.Now()}
+		var podErr *podFailureError
+		if errors.As(err, &podErr) {
+			failure.PodEvents = podErr.events
+			failure.PodLogs = podErr.logs
+		}
+		m.failures[attempt.spec.ID] = failure
+	}
+	m.setState(attempt.spec, ProxyStateStopped, err.Error())
+	return true
+}
+
+// newForwarder binds the local listeners of a proxy and applies its client access policy.
+// Binding happens before any pod is created so port conflicts are reported early.
+func (m *ProxyManager) newForwarder(spec ProxySpec, settings managerSettings) (*LocalForwarder, error) {
+	accessPolicy, err := NewClientAccessPolicy(settings.clientAccess, spec.ClientAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.LocalSocket == "" {
+		localPorts := []int{spec.LocalPort}
+		for _, mapping := range spec.Ports {
+			localPorts = append(localPorts, mapping.LocalPort)
+		}
+		for _, port := range localPorts {
+			if err := CheckLocalPort(spec.LocalBindAddress, port); err != nil {
+				log.Error("Local port cannot be used", "bind_address", spec.LocalBindAddress, "local_port", port, "error", err)
+				return nil, err
+			}
+		}
+	}
+
+	var forwarder *LocalForwarder
+	if spec.LocalSocket != "" {
+		forwarder, err = NewUnixSocketForwarder(spec.LocalSocket, spec.RemotePort)
+	} else if len(spec.ServerNames) > 0 {
+		var route net.Listener
+		if route, err = m.sniRoute(spec); err == nil {
+			forwarder = newLocalForwarder(route, spec.RemotePort)
+		}
+	} else if spec.HTTPPath != "" {
+		var route net.Listener
+		if route, err = m.httpRoute(spec); err == nil {
+			forwarder = newLocalForwarder(route, spec.RemotePort)
+		}
+	} else {
+		forwarder, err = NewLocalForwarder(spec.LocalBindAddress, spec.LocalPort, spec.RemotePort)
+	}
+	if err != nil {
+		log.Error("Failed to bind local endpoint", "bind_address", spec.LocalBindAddress, "local_port", spec.LocalPort, "local_socket", spec.LocalSocket, "error", err)
+		return nil, err
+	}
+	for _, mapping := range spec.Ports {
+		if err := forwarder.AddListener(spec.LocalBindAddress, mapping.LocalPort, mapping.RemotePort); err != nil {
+			forwarder.Close()
+			log.Error("Failed to bind additional local port", "bind_address", spec.LocalBindAddress, "local_port", mapping.LocalPort, "error", err)
+			return nil, err
+		}
+	}
+	forwarder.AccessPolicy = accessPolicy
+	forwarder.ParkTimeout = reconnectHoldTimeout
+	accessLog := spec.AccessLog
+	if accessLog == "" {
+		accessLog = settings.accessLog
+	}
+	forwarder.OnConnectionClosed = newAccessLogger(accessLog, spec)
+	if keepalive := settings.keepalive.merge(spec.Keepalive); keepalive.Enabled() {
+		config := keepalive.netConfig()
+		forwarder.KeepAlive = &config
+	}
+	forwarder.OnConnectionRejected = func(clientAddr, reason string) {
+		log.LogAuditEvent("client_rejected", "denied", map[string]any{
+			"proxy_id":   spec.ID,
+			"client":     clientAddr,
+			"local_port": spec.LocalPort,
+			"reason":     reason,
+		})
+	}
+	return forwarder, nil
+}
+
+// sniRoute registers the spec's server names on the SNI mux of its local port, binding the port
+// when no other SNI proxy is connected on it
+func (m *ProxyManager) sniRoute(spec ProxySpec) (net.Listener, error) {
+	m.sharedMu.Lock()
+	defer m.sharedMu.Unlock()
+
+	bindAddress, key := sharedListenAddress(spec)
+
+	// A mux closes itself when its last route goes away, possibly while we register
+	for {
+		mux := m.sniMuxes[key]
+		if mux == nil || mux.Closed() {
+			var err error
+			if mux, err = newSNIMux(bindAddress, spec.LocalPort); err != nil {
+				return nil, err
+			}
+			m.sniMuxes[key] = mux
+		}
+		route, err := mux.Route(spec.ServerNames)
+		if !errors.Is(err, net.ErrClosed) {
+			return route, err
+		}
+	}
+}
+
+// httpRoute registers the spec's path on the HTTP gateway of its local port, binding the port
+// when no other HTTP gateway proxy is connected on it
+func (m *ProxyManager) httpRoute(spec ProxySpec) (net.Listener, error) {
+	m.sharedMu.Lock()
+	defer m.sharedMu.Unlock()
+
+	bindAddress, key := sharedListenAddress(spec)
+	for {
+		gateway := m.httpGateways[key]
+		if gateway == nil || gateway.Closed() {
+			var err error
+			if gateway, err = newHTTPGateway(bindAddress, spec.LocalPort); err != nil {
+				return nil, err
+			}
+			m.httpGateways[key] = gateway
+		}
+		route, err := gateway.Route(spec.HTTPPath, spec.RemoteHost, spec.RemotePort, spec.HTTPBackendTLS)
+		if !errors.Is(err, net.ErrClosed) {
+			return route, err
+		}
+	}
+}
+
+// sharedListenAddress returns the bind address of a shared local port and its map key
+func sharedListenAddress(spec ProxySpec) (string, string) {
+	bindAddress := spec.LocalBindAddress
+	if bindAddress == "" {
+		bindAddress = DefaultLocalBindAddress
+	}
+	return bindAddress, net.JoinHostPort(bindAddress, strconv.Itoa(spec.LocalPort))
+}
+
+// kubeClientsForSpec creates the Kubernetes clients for the proxy's cluster
+func kubeClientsForSpec(spec ProxySpec) (*kubernetes.Clientset, *rest.Config, error) {
+	kubeConfig := KubeConfig{Context: spec.KubernetesCluster}
+	kubeClient, err := GetKubernetesClient(kubeConfig)
+	if err != nil {
+		log.Error("Failed to create Kubernetes client", "cluster", spec.KubernetesCluster, "error", err)
+		return nil, nil, fmt.Errorf("Cannot connect to Kubernetes cluster '%s'. Please check if the cluster is accessible and your kubeconfig is valid. Error: %v", spec.KubernetesCluster, err)
+	}
+
+	restConfig, err := GetKubernetesClientConfig(kubeConfig)
+	if err != nil {
+		log.Error("Failed to create Kubernetes client config", "cluster", spec.KubernetesCluster, "error", err)
+		return nil, nil, fmt.Errorf("Cannot connect to Kubernetes cluster '%s'. Please check if the cluster is accessible and your kubeconfig is valid. Error: %v", spec.KubernetesCluster, err)
+	}
+	return kubeClient, restConfig, nil
+}
+
+// Adopt re-attaches a proxy to a relay pod that is still running from an earlier session
+func (m *ProxyManager) Adopt(spec ProxySpec, pod AdoptablePod) error {
+	namespace, podName := pod.Namespace, pod.PodName
+	attempt, settings, err := m.beginConnect(spec, "re-attaching to running pod "+podName)
+	if err != nil {
+		return err
+	}
+
+	proxy, err := m.attachProxy(spec, settings, pod)
+	if err != nil {
+		m.failConnect(attempt, err, false)
+		return err
+	}
+	m.issueCredentials(proxy)
+	if !m.finishConnect(attempt, proxy) {
+		return ErrConnectCancelled
+	}
+
+	log.Info("Re-attached proxy to running pod", "proxy_id", spec.ID, "pod", podName, "namespace", namespace, "local_port", spec.LocalPort)
+	m.publish(newProxyEvent(ProxyEventConnected, spec, "re-attached to running pod "+podName))
+
+	go m.monitor(spec.ID, proxy)
+	return nil
+}
+
+// attachProxy binds the local listeners and opens the port-forward stream to an existing relay pod
+func (m *ProxyManager) attachProxy(spec ProxySpec, settings managerSettings, pod AdoptablePod) (*managedProxy, error) {
+	namespace, podName := pod.Namespace, pod.PodName
+	forwarder, err := m.newForwarder(spec, settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := forwarder.SetPodPorts(pod.ListenPorts); err != nil {
+		forwarder.Close()
+		return nil, err
+	}
+	if spec.RelayTLS {
+		relayTLS, err := relayTLSFromPEM(pod.relayCertificate)
+		if err != nil {
+			forwarder.Close()
+			return nil, err
+		}
+		forwarder.RelayTLS = relayTLS.clientConfig
+	}
+
+	kubeClient, restConfig, err := kubeClientsForSpec(spec)
+	if err != nil {
+		forwarder.Close()
+		return nil, err
+	}
+
+	if err := forwarder.Start(kubeClient, restConfig, namespace, podName); err != nil {
+		forwarder.Close()
+		log.Error("Failed to re-attach to running pod", "pod", podName, "namespace", namespace, "error", err)
+		return nil, fmt.Errorf("failed to re-attach to pod '%s' in cluster '%s': %v", podName, spec.KubernetesCluster, err)
+	}
+
+	return &managedProxy{
+		spec:        spec,
+		forwarder:   forwarder,
+		podName:     podName,
+		namespace:   namespace,
+		connectedAt: time.Now(),
+		vault:       settings.vault,
+		reconnect:   settings.reconnect.merge(spec.Reconnect).withDefaults(),
+		stableSince: time.Now(),
+	}, nil
+}
+
+// socatProxyConfig builds the relay pod configuration of a spec from the global settings
+func (s managerSettings) socatProxyConfig(spec ProxySpec, podName string) SocatProxyConfig {
+	namespace := spec.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace()
+	}
+
+	priorityClassName := spec.PriorityClassName
+	if priorityClassName == "" {
+		priorityClassName = s.priorityClassName
+	}
+
+	socatConfig := SocatProxyConfig{
+		PodName:           podName,
+		Namespace:         namespace,
+		ListenPort:        relayListenPort(0),
+		RemoteHost:        spec.RemoteHost,
+		RemotePort:        spec.RemotePort,
+		RemoteHosts:       spec.RemoteHosts,
+		PriorityClassName: priorityClassName,
+		Annotations:       relayPodAnnotations(s.podAnnotations, spec.PodAnnotations, s.sidecarInjection),
+		Image:             s.relayImage.Reference(),
+		Spread:            s.podSpread,
+		Keepalive:         s.keepalive.merge(spec.Keepalive),
+		User:              spec.User,
+	}
+	for i, mapping := range spec.Ports {
+		socatConfig.AdditionalPorts = append(socatConfig.AdditionalPorts, SocatPortMapping{
+			ListenPort: relayListenPort(i + 1),
+			RemotePort: mapping.RemotePort,
+		})
+	}
+	return socatConfig
+}
+
+// relayPodName names a relay pod after the user and proxy ID. Long IDs are shortened, since the
+// name is also used as a label value, which is limited to 63 characters.
+func relayPodName(username, proxyID string, now time.Time) string {
+	prefix := "aproxymate-" + username + "-"
+	suffix := fmt.Sprintf("-%d", now.Unix())
+	if room := 63 - len(prefix) - len(suffix); len(proxyID) > room {
+		proxyID = strings.TrimRight(proxyID[:room], "-")
+	}
+	return prefix + proxyID + suffix
+}
+
+// startProxy binds the local listener, creates the socat pod and opens the port-forward stream
+func (m *ProxyManager) startProxy(spec ProxySpec, settings managerSettings) (*managedProxy, error) {
+	if spec.hostTemplateErr != nil {
+		return nil, fmt.Errorf("proxy %s has %w", spec.Name, spec.hostTemplateErr)
+	}
+
+	forwarder, err := m.newForwarder(spec, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, podName, err := m.relay(spec, settings, forwarder)
+	if err != nil {
+		forwarder.Close()
+		return nil, err
+	}
+
+	log.Info("Successfully started proxy connection",
+		"cluster", spec.KubernetesCluster,
+		"host", spec.RemoteHost,
+		"local_port", spec.LocalPort,
+		"remote_port", spec.RemotePort,
+		"pod", podName,
+		"listen_addrs", forwarder.Addrs())
+
+	return &managedProxy{
+		spec:        spec,
+		forwarder:   forwarder,
+		podName:     podName,
+		namespace:   namespace,
+		connectedAt: time.Now(),
+		vault:       settings.vault,
+		reconnect:   settings.reconnect.merge(spec.Reconnect).withDefaults(),
+		stableSince: time.Now(),
+	}, nil
+}
+
+// startRelay creates a relay pod for the spec and opens the forwarder's port-forward stream to
+// it, returning the pod's namespace and name. The caller closes the forwarder on errors.
+func (m *ProxyManager) startRelay(spec ProxySpec, settings managerSettings, forwarder *LocalForwarder) (string, string, error) {
+	// Fail fast with a login hint when the cluster is behind an expired Teleport session
+	if err := CheckTeleportSession("", spec.KubernetesCluster); err != nil {
+		log.Error("Teleport session check failed", "cluster", spec.KubernetesCluster, "error", err)
+		return "", "", fmt.Errorf("cannot connect to Kubernetes cluster '%s': %w", spec.KubernetesCluster, err)
+	}
+
+	kubeClient, restConfig, err := kubeClientsForSpec(spec)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Generate unique pod name with username
+	username := getSafeUsername()
+	if spec.User != "" {
+		username = safeUsername(spec.User)
+	}
+	podName := relayPodName(username, spec.ID, time.Now())
+	socatConfig := settings.socatProxyConfig(spec, podName)
+	namespace := socatConfig.Namespace
+	if err := forwarder.SetPodPorts(socatConfig.listenPorts()); err != nil {
+		return "", "", err
+	}
+	if spec.RelayTLS {
+		relayTLS, err := newRelayTLS()
+		if err != nil {
+			return "", "", err
+		}
+		socatConfig.TLSCertificate = relayTLS.pem
+		forwarder.RelayTLS = relayTLS.clientConfig
+	}
+
+	log.Info("Creating socat proxy pod",
+		"pod", podName,
+		"namespace", namespace,
+		"target_host", spec.RemoteHost,
+		"target_port", spec.RemotePort)
+
+	// Refuse unpinned or unsigned images before anything is created in the cluster
+	verifyCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	err = VerifyRelayImage(verifyCtx, settings.relayImage)
+	cancel()
+	if err != nil {
+		log.Error("Relay image verification failed", "image", socatConfig.Image, "error", err)
+		m.publish(newProxyEvent(ProxyEventPodFailed, spec, err.Error()))
+		return "", "", fmt.Errorf("Cannot use relay image %s: %v", socatConfig.Image, err)
+	}
+
+	// Fail early when the namespace's quota has no room for the pod, rather than with a generic creation error
+	quotaCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err = CheckSocatPodQuota(quotaCtx, kubeClient, socatConfig)
+	cancel()
+	if err != nil {
+		log.Error("Relay pod would exceed the namespace quota", "pod", podName, "namespace", namespace, "cluster", spec.KubernetesCluster, "error", err)
+		m.publish(newProxyEvent(ProxyEventPodFailed, spec, err.Error()))
+		return "", "", fmt.Errorf("Cannot create the proxy pod in Kubernetes cluster '%s': %v", spec.KubernetesCluster, err)
+	}
+
+	// Wait for a pod operation slot, so that connecting many proxies at once doesn't flood the
+	// cluster's API server. The slot is held until the pod runs.
+	slotCtx, cancel := context.WithTimeout(context.Background(), podSlotTimeout)
+	release, err := m.ops.acquire(slotCtx, spec.KubernetesCluster, func() {
+		m.reportStage(spec, ConnectStageQueued, "waiting for other relay pods of the cluster")
+	})
+	cancel()
+	if err != nil {
+		return "", "", fmt.Errorf("Cannot create the proxy pod in Kubernetes cluster '%s': %v", spec.KubernetesCluster, err)
+	}
+	defer release()
+
+	// Create the socat proxy pod
+	pod, err := CreateSocatProxyPod(kubeClient, socatConfig)
+	auditDetails := map[string]any{
+		"cluster":   spec.KubernetesCluster,
+		"namespace": namespace,
+		"pod":       podName,
+	}
+	if spec.User != "" {
+		auditDetails["session_user"] = spec.User
+	}
+	log.LogAuditEvent("pod_created", outcome(err), auditDetails)
+	if err != nil {
+		log.Error("Failed to create socat proxy pod", "pod", podName, "cluster", spec.KubernetesCluster, "error", err)
+		m.publish(newProxyEvent(ProxyEventPodFailed, spec, err.Error()))
+		return "", "", fmt.Errorf("Failed to create proxy pod in Kubernetes cluster '%s'. This could be due to insufficient permissions, network issues, or cluster configuration problems. Error: %v", spec.KubernetesCluster, err)
+	}
+
+	if settings.networkPolicy {
+		policyCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := CreateRelayNetworkPolicy(policyCtx, kubeClient, pod, socatConfig)
+		cancel()
+		if err != nil {
+			log.Error("Failed to create relay NetworkPolicy", "pod", podName, "namespace", namespace, "cluster", spec.KubernetesCluster, "error", err)
+			m.publish(newProxyEvent(ProxyEventPodFailed, spec, err.Error()))
+			DeleteSocatProxyPod(kubeClient, namespace, podName)
+			return "", "", fmt.Errorf("Cannot restrict the proxy pod in Kubernetes cluster '%s' with a NetworkPolicy. Check that you may create NetworkPolicies in namespace '%s' or disable network_policy. Error: %v", spec.KubernetesCluster, namespace, err)
+		}
+	}
+
+	log.Info("Socat pod created, waiting for running state", "pod", pod.Name, "namespace", namespace)
+	m.reportStage(spec, ConnectStagePodCreated, fmt.Sprintf("relay pod %s created in namespace %s", podName, namespace))
+
+	// Wait for the pod to be running
+	if err := WaitForPodRunning(kubeClient, namespace, podName, 30*time.Second); err != nil {
+		log.Error("Pod failed to start", "pod", podName, "namespace", namespace, "error", err)
+		m.publish(newProxyEvent(ProxyEventPodFailed, spec, err.Error()))
+		err = withPodDetails(kubeClient, namespace, podName, fmt.Errorf("Proxy pod failed to start within 30 seconds. This could be due to resource constraints, image pull issues, or networking problems in cluster '%s'. Error: %v", spec.KubernetesCluster, err))
+		// Clean up the pod
+		DeleteSocatProxyPod(kubeClient, namespace, podName)
+		return "", "", err
+	}
+
+	// Check that the node reports running the pinned digest, e.g. behind a registry mirror
+	if digest := settings.relayImage.Digest(); digest != "" {
+		imageCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := VerifyRelayPodImage(imageCtx, kubeClient, namespace, podName, digest)
+		cancel()
+		if err != nil {
+			log.Error("Relay pod runs an unexpected image", "pod", podName, "namespace", namespace, "error", err)
+			m.publish(newProxyEvent(ProxyEventPodFailed, spec, err.Error()))
+			err = withPodDetails(kubeClient, namespace, podName, fmt.Errorf("Proxy pod in cluster '%s' does not run the pinned relay image: %v", spec.KubernetesCluster, err))
+			DeleteSocatProxyPod(kubeClient, namespace, podName)
+			return "", "", err
+		}
+	}
+
+	log.Info("Socat pod is running, starting port-forward", "pod", podName, "local_port", spec.LocalPort, "remote_port", spec.RemotePort)
+	m.reportStage(spec, ConnectStagePodRunning, fmt.Sprintf("relay pod %s is running", podName))
+
+	// Open the port-forward stream and start accepting local connections
+	if err := forwarder.Start(kubeClient, restConfig, namespace, podName); err != nil {
+		log.Error("Failed to start port-forward", "pod", podName, "cluster", spec.KubernetesCluster, "error", err)
+		err = withPodDetails(kubeClient, namespace, podName, fmt.Errorf("Port forwarding failed to initialize properly. This might indicate a problem with the Kubernetes cluster connection for '%s'. Error: %v", spec.KubernetesCluster, err))
+		DeleteSocatProxyPod(kubeClient, namespace, podName)
+		return "", "", err
+	}
+	m.reportStage(spec, ConnectStageForwardEstablished, "port-forward established")
+	return namespace, podName, nil
+}
+
+// monitor waits for the forwarder's port-forward stream to close and reconnects the proxy as
+// its policy allows, or cleans it up once the forwarder stopped or the reconnects gave up
+func (m *ProxyManager) monitor(id string, proxy *managedProxy) {
+	go m.watchPod(proxy)
+	go m.maintainCredentials(proxy)
+
+	for {
+		select {
+		case <-proxy.forwarder.Done():
+			m.dropProxy(id, proxy, ProxyEventDropped, "port-forward stream closed")
+			return
+		case <-proxy.forwarder.Dropped():
+		}
+
+		m.mu.RLock()
+		disabled := proxy.reconnect.Disabled
+		m.mu.RUnlock()
+		if disabled {
+			proxy.forwarder.Close()
+			m.dropProxy(id, proxy, ProxyEventDropped, "port-forward stream closed")
+			return
+		}
+		if err := m.reconnect(id, proxy); err != nil {
+			proxy.forwarder.Close()
+			m.dropProxy(id, proxy, ProxyEventReconnectExhausted, err.Error())
+			return
+		}
+	}
+}
+
+// dropProxy unregisters a proxy whose forwarder stopped unexpectedly, deletes its relay pod and
+// ends its credentials. Proxies that were disconnected meanwhile are left alone.
+func (m *ProxyManager) dropProxy(id string, proxy *managedProxy, eventType ProxyEventType, message string) {
+	m.mu.Lock()
+	// The proxy may have been replaced or removed by an explicit disconnect
+	if current, exists := m.proxies[id]; !exists || current != proxy {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.proxies, id)
+	failure := ProxyFailure{Message: message, Time: time.Now()}
+	m.failures[id] = failure
+	m.setState(proxy.spec, ProxyStateStopped, message)
+	m.mu.Unlock()
+	m.sampleUsage(proxy)
+
+	// Keep the events and logs that may explain the drop, e.g. an eviction, before the pod goes
+	m.recordDropDetails(id, proxy, failure)
+
+	// Clean up the socat pod and end the credentials that came with the tunnel
+	m.deletePod(proxy)
+	m.revokeCredentials(context.Background(), proxy)
+
+	spec := proxy.spec
+	log.Error("Port-forward stopped unexpectedly",
+		"cluster", spec.KubernetesCluster,
+		"host", spec.RemoteHost,
+		"local_port", spec.LocalPort,
+		"remote_port", spec.RemotePort,
+		"reason", message)
+	m.publish(newProxyEvent(eventType, spec, message))
+}
+
+// recordDropDetails adds the relay pod's latest events and logs to the failure of a dropped proxy,
+// unless the proxy failed again or connected meanwhile
+func (m *ProxyManager) recordDropDetails(id string, proxy *managedProxy, failure ProxyFailure) {
+	m.mu.RLock()
+	namespace, podName := proxy.namespace, proxy.podName
+	m.mu.RUnlock()
+	if podName == "" {
+		return
+	}
+
+	kubeClient, err := GetKubernetesClient(KubeConfig{Context: proxy.spec.KubernetesCluster})
+	if err != nil {
+		log.Debug("Could not create Kubernetes client to read pod events", "cluster", proxy.spec.KubernetesCluster, "error", err)
+		return
+	}
+	events, logs := readPodDetails(kubeClient, namespace, podName)
+
+	m.mu.Lock()
+	if current, exists := m.failures[id]; exists && current.Time.Equal(failure.Time) {
+		current.PodEvents = events
+		current.PodLogs = logs
+		m.failures[id] = current
+	}
+	m.mu.Unlock()
+}
+
+// reconnect opens a new port-forward stream for a proxy whose stream closed, retrying with
+// the backoff of its reconnect policy. The forwarder keeps its listeners bound and holds new
+// client connections meanwhile. It fails when the policy's retries are used up or the proxy
+// was stopped.
+func (m *ProxyManager) reconnect(id string, proxy *managedProxy) error {
+	m.mu.Lock()
+	if current, exists := m.proxies[id]; !exists || current != proxy {
+		m.mu.Unlock()
+		return ErrProxyNotConnected
+	}
+	proxy.reconnecting = true
+	namespace, podName := proxy.namespace, proxy.podName
+	settings := m.settings
+	policy := proxy.reconnect
+	m.setState(proxy.spec, ProxyStateConnecting, "port-forward stream closed, reconnecting")
+	m.mu.Unlock()
+
+	spec := proxy.spec
+	log.Warn("Port-forward stream closed, reconnecting", "proxy_id", id, "pod", podName, "namespace", namespace)
+	m.publish(newProxyEvent(ProxyEventDropped, spec, "port-forward stream closed, reconnecting"))
+
+	// Drops within the reset window keep using up the retries, so a flapping tunnel gives up
+	if time.Since(proxy.stableSince) >= time.Duration(policy.ResetWindow)*time.Second {
+		proxy.retries = 0
+	}
+
+	if proxy.retries >= policy.MaxRetries {
+		return fmt.Errorf("dropped again within %d seconds after %d reconnect attempts", policy.ResetWindow, proxy.retries)
+	}
+
+	for failed := 1; ; failed++ {
+		proxy.retries++
+
+		var err error
+		namespace, podName, err = m.reopenRelay(spec, settings, proxy.forwarder, namespace, podName)
+
+		m.mu.Lock()
+		if current, exists := m.proxies[id]; !exists || current != proxy {
+			// Stopped meanwhile; the pod it deleted may not be the one now in use
+			replaced := podName != proxy.podName
+			m.mu.Unlock()
+			if replaced {
+				m.deletePod(&managedProxy{spec: spec, namespace: namespace, podName: podName})
+			}
+			return ErrProxyNotConnected
+		}
+		proxy.namespace, proxy.podName = namespace, podName
+		if err == nil {
+			proxy.reconnecting = false
+			proxy.pod, proxy.podError = RelayPodStatus{}, ""
+			delete(m.failures, id)
+			m.setState(spec, ProxyStateConnected, "")
+		}
+		m.mu.Unlock()
+
+		if err == nil {
+			proxy.stableSince = time.Now()
+			log.Info("Reconnected proxy", "proxy_id", id, "pod", podName, "namespace", namespace, "attempt", proxy.retries)
+			m.publish(newProxyEvent(ProxyEventReconnected, spec, "port-forward to pod "+podName+" reopened"))
+			return nil
+		}
+		log.Warn("Reconnect attempt failed", "proxy_id", id, "attempt", proxy.retries, "max_retries", policy.MaxRetries, "error", err)
+		if proxy.retries >= policy.MaxRetries {
+			return fmt.Errorf("gave up after %d attempts: %v", proxy.retries, err)
+		}
+
+		select {
+		case <-proxy.forwarder.Done():
+			return ErrProxyNotConnected
+		case <-time.After(policy.backoff(failed)):
+		}
+	}
+}
+
+// reopenRelay opens a new port-forward stream for a parked forwarder: to the relay pod when it
+// still runs, otherwise to a new pod replacing it. It returns the pod in use afterwards, empty
+// when there is none.
+func (m *ProxyManager) reopenRelay(spec ProxySpec, settings managerSettings, forwarder *LocalForwarder, namespace, podName string) (string, string, error) {
+	if podName != "" {
+		kubeClient, restConfig, err := kubeClientsForSpec(spec)
+		if err != nil {
+			return namespace, podName, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		status, err := GetRelayPodStatus(ctx, kubeClient, namespace, podName)
+		cancel()
+		switch {
+		case err == nil && status.Phase == string(corev1.PodRunning) && status.Problem == "":
+			if err := forwarder.Start(kubeClient, restConfig, namespace, podName); err != nil {
+				return namespace, podName, err
+			}
+			return namespace, podName, nil
+		case err != nil && !apierrors.IsNotFound(err):
+			// The API server may not be reachable yet; keep the pod for the next attempt
+			return namespace, podName, err
+		}
+
+		log.Info("Relay pod is gone or unhealthy, replacing it", "pod", podName, "namespace", namespace, "phase", status.Phase, "problem", status.Problem)
+		m.deletePod(&managedProxy{spec: spec, namespace: namespace, podName: podName})
+	}
+
+	namespace, podName, err := m.startRelay(spec, settings, forwarder)
+	if err != nil {
+		return "", "", err
+	}
+	return namespace, podName, nil
+}
+
+// watchPod periodically records the relay pod's phase, node and restarts until the forwarder stops
+func (m *ProxyManager) watchPod(proxy *managedProxy) {
+	kubeClient, err := GetKubernetesClient(KubeConfig{Context: proxy.spec.KubernetesCluster})
+	if err != nil {
+		log.Debug("Could not create Kubernetes client to watch relay pod", "cluster", proxy.spec.KubernetesCluster, "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(podStatusInterval)
+	defer ticker.Stop()
+
+	for {
+		m.mu.RLock()
+		namespace, podName, reconnecting := proxy.namespace, proxy.podName, proxy.reconnecting
+		m.mu.RUnlock()
+
+		// The pod is being replaced during a reconnect
+		if !reconnecting {
+			m.inspectPod(proxy, kubeClient, namespace, podName)
+		}
+
+		select {
+		case <-proxy.forwarder.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// inspectPod records the status of a proxy's relay pod and updates the proxy's state from it
+func (m *ProxyManager) inspectPod(proxy *managedProxy, kubeClient kubernetes.Interface, namespace, podName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	status, err := GetRelayPodStatus(ctx, kubeClient, namespace, podName)
+	cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A reconnect may have started or replaced the pod meanwhile
+	if proxy.reconnecting || proxy.podName != podName {
+		return
+	}
+	if err != nil {
+		log.Debug("Failed to read relay pod status", "pod", podName, "namespace", namespace, "error", err)
+		proxy.podError = err.Error()
+	} else {
+		if status.Restarts > proxy.pod.Restarts {
+			log.Warn("Relay pod restarted", "pod", podName, "namespace", namespace, "restarts", status.Restarts, "problem", status.Problem)
+		}
+		proxy.pod = status
+		proxy.podError = status.Problem
+	}
+	// Only the proxy currently registered under its ID may change the state
+	if current, exists := m.proxies[proxy.spec.ID]; exists && current == proxy {
+		if err == nil && status.Phase == string(corev1.PodRunning) && status.Problem == "" {
+			m.setState(proxy.spec, ProxyStateConnected, "")
+		} else {
+			m.setState(proxy.spec, ProxyStateDegraded, proxy.podErrorOrPhase())
+		}
+	}
+}
+
+// podErrorOrPhase explains why the relay pod is considered unhealthy. Caller must hold m.mu.
+func (p *managedProxy) podErrorOrPhase() string {
+	if p.podError != "" {
+		return p.podError
+	}
+	return "relay pod is " + p.pod.Phase
+}
+
+// setState records a proxy's state and publishes a state_changed event if it changed
+func (m *ProxyManager) setState(spec ProxySpec, state ProxyState, message string) {
+	m.stateMu.Lock()
+	previous := m.stateLocked(spec.ID)
+	if state == ProxyStateStopped {
+		delete(m.states, spec.ID)
+	} else {
+		m.states[spec.ID] = state
+	}
+	m.stateMu.Unlock()
+
+	if previous == state {
+		return
+	}
+	log.Debug("Proxy state changed", "proxy_id", spec.ID, "from", previous, "to", state, "message", message)
+
+	event := newProxyEvent(ProxyEventStateChanged, spec, message)
+	event.State = state
+	event.PreviousState = previous
+	m.publish(event)
+}
+
+// stateLocked returns a proxy's state. Caller must hold m.stateMu.
+func (m *ProxyManager) stateLocked(id string) ProxyState {
+	if state, exists := m.states[id]; exists {
+		return state
+	}
+	return ProxyStateStopped
+}
+
+// State returns the lifecycle state of a proxy. It does not wait for a connect in progress.
+func (m *ProxyManager) State(id string) ProxyState {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	return m.stateLocked(id)
+}
+
+// States returns the state of every proxy that is not stopped, keyed by ID
+func (m *ProxyManager) States() map[string]ProxyState {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	states := make(map[string]ProxyState, len(m.states))
+	for id, state := range m.states {
+		states[id] = state
+	}
+	return states
+}
+
+// Disconnect stops the port-forward for a proxy and deletes its relay pod. A proxy that is
+// still connecting is cancelled: its connect stops and cleans up once the current step ends.
+func (m *ProxyManager) Disconnect(id string) error {
+	m.mu.Lock()
+	proxy, exists := m.proxies[id]
+	if !exists {
+		attempt, connecting := m.connecting[id]
+		if connecting {
+			attempt.cancelled = true
+			delete(m.failures, id)
+			m.setState(attempt.spec, ProxyStateStopped, "connect cancelled")
+		}
+		m.mu.Unlock()
+
+		if !connecting {
+			return ErrProxyNotConnected
+		}
+		log.Info("Cancelled connecting proxy", "proxy_id", id, "host", attempt.spec.RemoteHost, "local_port", attempt.spec.LocalPort)
+		m.publish(newProxyEvent(ProxyEventDisconnected, attempt.spec, "connect cancelled"))
+		return nil
+	}
+	delete(m.proxies, id)
+	delete(m.failures, id)
+	m.setState(proxy.spec, ProxyStateStopped, "")
+	m.mu.Unlock()
+
+	m.sampleUsage(proxy)
+	m.stopProxy(proxy)
+
+	log.Info("Successfully disconnected proxy",
+		"cluster", proxy.spec.KubernetesCluster,
+		"host", proxy.spec.RemoteHost,
+		"local_port", proxy.spec.LocalPort,
+		"remote_port", proxy.spec.RemotePort)
+	m.publish(newProxyEvent(ProxyEventDisconnected, proxy.spec, ""))
+
+	return nil
+}
+
+// DisconnectAll stops every managed proxy and cancels the ones connecting, used during shutdown
+func (m *ProxyManager) DisconnectAll() {
+	proxies, _ := m.takeAll()
+
+	log.Info("Cleaning up all active socat pods")
+
+	for _, proxy := range proxies {
+		log.Debug("Cleaning up pod during shutdown",
+			"cluster", proxy.spec.KubernetesCluster,
+			"host", proxy.spec.RemoteHost,
+			"local_port", proxy.spec.LocalPort,
+			"remote_port", proxy.spec.RemotePort,
+			"pod", proxy.podName)
+
+		m.stopProxy(proxy)
+	}
+}
+
+// takeAll unregisters every proxy and cancels the connects in progress. It returns the
+// proxies, which the caller stops, and the cancelled attempts.
+func (m *ProxyManager) takeAll() ([]*managedProxy, []*connectAttempt) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	proxies := make([]*managedProxy, 0, len(m.proxies))
+	for id, proxy := range m.proxies {
+		proxies = append(proxies, proxy)
+		delete(m.proxies, id)
+		delete(m.failures, id)
+		m.setState(proxy.spec, ProxyStateStopped, "shutting down")
+		if m.usage != nil {
+			recordProxyUsage(m.usage, proxy)
+		}
+	}
+
+	attempts := make([]*connectAttempt, 0, len(m.connecting))
+	for _, attempt := range m.connecting {
+		if !attempt.cancelled {
+			attempt.cancelled = true
+			m.setState(attempt.spec, ProxyStateStopped, "shutting down")
+		}
+		attempts = append(attempts, attempt)
+	}
+	return proxies, attempts
+}
+
+// Shutdown stops every managed proxy: local listeners are closed first so no new client
+// connections arrive, then the relay pods are deleted in parallel until ctx ends
+func (m *ProxyManager) Shutdown(ctx context.Context) error {
+	proxies, attempts := m.takeAll()
+
+	log.Info("Shutting down proxies", "count", len(proxies), "connecting", len(attempts))
+
+	for _, proxy := range proxies {
+		if err := proxy.forwarder.Close(); err != nil {
+			log.Error("Error closing local listener", "host", proxy.spec.RemoteHost, "local_port", proxy.spec.LocalPort, "error", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, proxy := range proxies {
+		wg.Add(1)
+		go func(proxy *managedProxy) {
+			defer wg.Done()
+			m.deletePodContext(ctx, proxy)
+			m.revokeCredentials(ctx, proxy)
+		}(proxy)
+	}
+	// Cancelled connects delete their own pods once their current step ends
+	for _, attempt := range attempts {
+		wg.Add(1)
+		go func(attempt *connectAttempt) {
+			defer wg.Done()
+			select {
+			case <-attempt.done:
+			case <-ctx.Done():
+			}
+		}(attempt)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out deleting relay pods; leftovers are removed by the next orphaned pod cleanup: %w", ctx.Err())
+	}
+}
+
+// stopProxy closes the local forwarder, deletes the relay pod and revokes the proxy's
+// credentials. The proxy must have been removed from m.proxies; m.mu must not be held.
+func (m *ProxyManager) stopProxy(proxy *managedProxy) {
+	if err := proxy.forwarder.Close(); err != nil {
+		log.Error("Error closing local listener",
+			"cluster", proxy.spec.KubernetesCluster,
+			"host", proxy.spec.RemoteHost,
+			"local_port", proxy.spec.LocalPort,
+			"remote_port", proxy.spec.RemotePort,
+			"error", err)
+	}
+
+	m.deletePod(proxy)
+	m.revokeCredentials(context.Background(), proxy)
+}
+
+// deletePod removes the relay pod of a proxy
+func (m *ProxyManager) deletePod(proxy *managedProxy) {
+	m.deletePodContext(context.Background(), proxy)
+}
+
+// deletePodContext removes the relay pod of a proxy, giving up when ctx ends
+func (m *ProxyManager) deletePodContext(ctx context.Context, proxy *managedProxy) {
+	if proxy.podName == "" {
+		return
+	}
+
+	log.Debug("Cleaning up socat pod", "pod", proxy.podName, "namespace", proxy.namespace)
+	kubeClient, err := GetKubernetesClient(KubeConfig{Context: proxy.spec.KubernetesCluster})
+	if err != nil {
+		log.Error("Failed to create Kubernetes client for cleanup", "cluster", proxy.spec.KubernetesCluster, "error", err)
+		return
+	}
+
+	// Deletes of the same pod, e.g. by a disconnect and the monitor, share one API call
+	key := "delete/" + proxy.spec.KubernetesCluster + "/" + proxy.namespace + "/" + proxy.podName
+	err = m.ops.do(ctx, proxy.spec.KubernetesCluster, key, func(ctx context.Context) error {
+		return deleteSocatProxyPod(ctx, kubeClient, proxy.namespace, proxy.podName)
+	})
+	if err != nil {
+		log.Error("Error deleting socat pod", "pod", proxy.podName, "namespace", proxy.namespace, "error", err)
+	} else {
+		log.Debug("Successfully deleted socat pod", "pod", proxy.podName, "namespace", proxy.namespace)
+		m.publish(newProxyEvent(ProxyEventPodDeleted, proxy.spec, "deleted pod "+proxy.namespace+"/"+proxy.podName))
+	}
+}
+
+// RecentConnections returns the recently finished client connections of a proxy
+func (m *ProxyManager) RecentConnections(id string) ([]ConnectionRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	proxy, exists := m.proxies[id]
+	if !exists {
+		return nil, ErrProxyNotConnected
+	}
+	return proxy.forwarder.RecentConnections(), nil
+}
+
+// OpenConnections returns the client connections of a proxy that are currently open
+func (m *ProxyManager) OpenConnections(id string) ([]ConnectionRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	proxy, exists := m.proxies[id]
+	if !exists {
+		return nil, ErrProxyNotConnected
+	}
+	return proxy.forwarder.OpenConnections(), nil
+}
+
+// ReconnectPolicy returns the reconnect policy a proxy with the given overrides gets: the global
+// policy with the overrides applied and defaults for the fields left unset
+func (m *ProxyManager) ReconnectPolicy(override ReconnectPolicy) ReconnectPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.settings.reconnect.merge(override).withDefaults()
+}
+
+// SetReconnectPolicy changes the reconnect policy overrides of a connected proxy, taking effect
+// from its next drop. Proxies that aren't connected pick them up from their spec when they connect.
+func (m *ProxyManager) SetReconnectPolicy(id string, override ReconnectPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if proxy, exists := m.proxies[id]; exists {
+		proxy.reconnect = m.settings.reconnect.merge(override).withDefaults()
+	}
+}
+
+// hasPod reports whether a connected proxy uses the relay pod with the podKey
+func (m *ProxyManager) hasPod(key string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, proxy := range m.proxies {
+		if podKey(proxy.spec.KubernetesCluster, proxy.namespace, proxy.podName) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// IsConnected reports whether the proxy with the given ID is connected
+func (m *ProxyManager) IsConnected(id string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, exists := m.proxies[id]
+	return exists
+}
+
+// Status returns a snapshot of all connected proxies keyed by ID
+func (m *ProxyManager) Status() map[string]ProxyStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := make(map[string]ProxyStatus, len(m.proxies))
+	for id, proxy := range m.proxies {
+		status[id] = ProxyStatus{
+			ID:               id,
+			Cluster:          proxy.spec.KubernetesCluster,
+			Connected:        true,
+			State:            m.State(id),
+			PodName:          proxy.podName,
+			Namespace:        proxy.namespace,
+			ConnectedAt:      proxy.connectedAt,
+			UptimeSeconds:    int64(time.Since(proxy.connectedAt).Seconds()),
+			Pod:              proxy.pod,
+			LastError:        proxy.podError,
+			Credentials:      proxy.credentialsStatus(),
+			CredentialsError: proxy.credentialsError,
+			Stats:            proxy.forwarder.Stats(),
+			IdleSeconds:      int64(proxy.forwarder.IdleFor().Seconds()),
+		}
+	}
+	return status
+}
+
+// Failures returns the last failure of each proxy that failed to connect or dropped, keyed by ID
+func (m *ProxyManager) Failures() map[string]ProxyFailure {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	failures := make(map[string]ProxyFailure, len(m.failures))
+	for id, failure := range m.failures {
+		failures[id] = failure
+	}
+	return failures
+}
+
+// ManagerStats summarizes the resources held by the ProxyManager
+type ManagerStats struct {
+	Proxies           int `json:"proxies"`
+	Listeners         int `json:"listeners"`
+	ActiveConnections int `json:"activeConnections"`
+	Subscribers       int `json:"subscribers"`
+}
+
+// Stats returns counts of the proxies, listeners, client connections and event subscribers currently held
+func (m *ProxyManager) Stats() ManagerStats {
+	m.mu.RLock()
+	var stats ManagerStats
+	stats.Proxies = len(m.proxies)
+	for _, proxy := range m.proxies {
+		stats.Listeners += len(proxy.forwarder.Addrs())
+		stats.ActiveConnections += proxy.forwarder.Stats().ActiveConnections
+	}
+	m.mu.RUnlock()
+
+	m.subMu.Lock()
+	stats.Subscribers = len(m.subscribers)
+	m.subMu.Unlock()
+
+	return stats
+}
+
+// Subscribe returns a channel receiving proxy lifecycle events and a function to unsubscribe.
+// Events are dropped for subscribers that do not keep up.
+func (m *ProxyManager) Subscribe() (<-chan ProxyEvent, func()) {
+	ch := make(chan ProxyEvent, 32)
+
+	m.subMu.Lock()
+	m.subscribers[ch] = struct{}{}
+	m.subMu.Unlock()
+
+	unsubscribe := func() {
+		m.subMu.Lock()
+		defer m.subMu.Unlock()
+		if _, exists := m.subscribers[ch]; exists {
+			delete(m.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+// EventFilter selects events from the history; zero values match everything
+type EventFilter struct {
+	ProxyID string
+	Types   []ProxyEventType
+	Since   time.Time
+	// Limit keeps only the most recent matching events
+	Limit int
+}
+
+// matches reports whether the event passes the filter
+func (f EventFilter) matches(event ProxyEvent) bool {
+	if f.ProxyID != "" && event.ProxyID != f.ProxyID {
+		return false
+	}
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, eventType := range f.Types {
+		if event.Type == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Events returns recorded events matching the filter, oldest first
+func (m *ProxyManager) Events(filter EventFilter) []ProxyEvent {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	events := []ProxyEvent{}
+	for _, event := range m.history {
+		if filter.matches(event) {
+			events = append(events, event)
+		}
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events
+}
+
+// LastEvents returns the latest lifecycle event of each proxy, keyed by ID. State changes are
+// skipped since the event that caused them explains more.
+func (m *ProxyManager) LastEvents() map[string]ProxyEvent {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	last := make(map[string]ProxyEvent)
+	for _, event := range m.history {
+		if event.Type != ProxyEventStateChanged {
+			last[event.ProxyID] = event
+		}
+	}
+	return last
+}
+
+// publish records an event in the history and delivers it to all subscribers without blocking
+func (m *ProxyManager) publish(event ProxyEvent) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	m.history = append(m.history, event)
+	if len(m.history) > maxEventHistory {
+		m.history = m.history[len(m.history)-maxEventHistory:]
+	}
+
+	for ch := range m.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Debug("Dropping proxy event for slow subscriber", "type", event.Type, "proxy_id", event.ProxyID)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package lib
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeRelay stands in for the relay pod of a ProxyManager. Connects block until release is
+// closed and then fail with err, if set.
+type fakeRelay struct {
+	started chan ProxySpec
+	release chan struct{}
+	err     error
+}
+
+func newFakeRelay() *fakeRelay {
+	release := make(chan struct{})
+	close(release)
+	return &fakeRelay{started: make(chan ProxySpec, 8), release: release}
+}
+
+func (r *fakeRelay) start(spec ProxySpec, _ managerSettings, _ *LocalForwarder) (string, string, error) {
+	r.started <- spec
+	<-r.release
+	if r.err != nil {
+		return "", "", r.err
+	}
+	return "aproxymate", "aproxymate-test-" + spec.ID, nil
+}
+
+// newTestManager returns a ProxyManager whose connects use relay instead of a cluster
+func newTestManager(t *testing.T, relay *fakeRelay) *ProxyManager {
+	t.Helper()
+	m := NewProxyManager()
+	m.relay = relay.start
+	t.Cleanup(m.DisconnectAll)
+	return m
+}
+
+// testSpec returns a proxy spec on a free local port
+func testSpec(t *testing.T, id string) ProxySpec {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return ProxySpec{
+		ID:                id,
+		Name:              "proxy " + id,
+		KubernetesCluster: "test-cluster",
+		RemoteHost:        "db.internal",
+		LocalPort:         port,
+		RemotePort:        5432,
+		OperationID:       "op-" + id,
+	}
+}
+
+// waitForEvent returns the next event of the given type, skipping others
+func waitForEvent(t *testing.T, events <-chan ProxyEvent, eventType ProxyEventType) ProxyEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no %s event received", eventType)
+		}
+	}
+}
+
+func TestProxyManagerConnectDisconnect(t *testing.T) {
+	m := newTestManager(t, newFakeRelay())
+	spec := testSpec(t, "orders")
+
+	if err := m.Connect(spec); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if !m.IsConnected(spec.ID) || m.State(spec.ID) != ProxyStateConnected {
+		t.Fatalf("state after connect = %s, connected %v", m.State(spec.ID), m.IsConnected(spec.ID))
+	}
+	status, ok := m.Status()[spec.ID]
+	if !ok {
+		t.Fatalf("Status has no entry for %s", spec.ID)
+	}
+	if status.PodName != "aproxymate-test-orders" || status.Namespace != "aproxymate" || !status.Connected {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if err := m.Connect(spec); !errors.Is(err, ErrProxyAlreadyConnected) {
+		t.Errorf("second Connect = %v, want %v", err, ErrProxyAlreadyConnected)
+	}
+
+	// The local port is bound while connected
+	if listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(spec.LocalPort))); err == nil {
+		listener.Close()
+		t.Errorf("local port %d is not bound while connected", spec.LocalPort)
+	}
+
+	if err := m.Disconnect(spec.ID); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	if m.IsConnected(spec.ID) || m.State(spec.ID) != ProxyStateStopped {
+		t.Errorf("state after disconnect = %s, connected %v", m.State(spec.ID), m.IsConnected(spec.ID))
+	}
+	if _, ok := m.Status()[spec.ID]; ok {
+		t.Errorf("Status still lists %s after disconnect", spec.ID)
+	}
+	if err := m.Disconnect(spec.ID); !errors.Is(err, ErrProxyNotConnected) {
+		t.Errorf("second Disconnect = %v, want %v", err, ErrProxyNotConnected)
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(spec.LocalPort)))
+	if err != nil {
+		t.Errorf("local port %d is still bound after disconnect: %v", spec.LocalPort, err)
+	} else {
+		listener.Close()
+	}
+}
+
+func TestProxyManagerStateTransitionEvents(t *testing.T) {
+	m := newTestManager(t, newFakeRelay())
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	spec := testSpec(t, "orders")
+
+	if err := m.Connect(spec); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := m.Disconnect(spec.ID); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+
+	want := []struct {
+		previous ProxyState
+		state    ProxyState
+	}{
+		{ProxyStateStopped, ProxyStateConnecting},
+		{ProxyStateConnecting, ProxyStateConnected},
+		{ProxyStateConnected, ProxyStateStopped},
+	}
+	for _, transition := range want {
+		event := waitForEvent(t, events, ProxyEventStateChanged)
+		if event.PreviousState != transition.previous || event.State != transition.state {
+			t.Errorf("transition %s -> %s, want %s -> %s", event.PreviousState, event.State, transition.previous, transition.state)
+		}
+		if event.ProxyID != spec.ID || event.Cluster != spec.KubernetesCluster {
+			t.Errorf("event for %s/%s, want %s/%s", event.ProxyID, event.Cluster, spec.ID, spec.KubernetesCluster)
+		}
+	}
+}
+
+func TestProxyManagerEventHistory(t *testing.T) {
+	m := newTestManager(t, newFakeRelay())
+	orders, users := testSpec(t, "orders"), testSpec(t, "users")
+
+	for _, spec := range []ProxySpec{orders, users} {
+		if err := m.Connect(spec); err != nil {
+			t.Fatalf("Connect %s: %v", spec.ID, err)
+		}
+	}
+	if err := m.Disconnect(orders.ID); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+
+	lifecycle := []ProxyEventType{ProxyEventConnected, ProxyEventDisconnected}
+	events := m.Events(EventFilter{ProxyID: orders.ID, Types: lifecycle})
+	if len(events) != 2 || events[0].Type != ProxyEventConnected || events[1].Type != ProxyEventDisconnected {
+		t.Fatalf("orders events = %+v, want connected then disconnected", events)
+	}
+	if events[0].OperationID != orders.OperationID {
+		t.Errorf("connected event carries operation %q, want %q", events[0].OperationID, orders.OperationID)
+	}
+	if limited := m.Events(EventFilter{Types: lifecycle, Limit: 1}); len(limited) != 1 || limited[0].Type != ProxyEventDisconnected {
+		t.Errorf("Events with limit 1 = %+v, want the disconnect only", limited)
+	}
+	if since := m.Events(EventFilter{Since: time.Now().Add(time.Hour)}); len(since) != 0 {
+		t.Errorf("Events since the future = %d events, want none", len(since))
+	}
+
+	last := m.LastEvents()
+	if last[orders.ID].Type != ProxyEventDisconnected || last[users.ID].Type != ProxyEventConnected {
+		t.Errorf("LastEvents = %+v", last)
+	}
+}
+
+func TestProxyManagerEventHistoryIsBounded(t *testing.T) {
+	m := NewProxyManager()
+	spec := ProxySpec{ID: "orders"}
+	for i := 0; i < maxEventHistory+10; i++ {
+		m.publish(newProxyEvent(ProxyEventConnectProgress, spec, strconv.Itoa(i)))
+	}
+
+	events := m.Events(EventFilter{})
+	if len(events) != maxEventHistory {
+		t.Fatalf("history holds %d events, want %d", len(events), maxEventHistory)
+	}
+	if events[0].Message != "10" {
+		t.Errorf("oldest event is %q, want the oldest ones dropped", events[0].Message)
+	}
+}
+
+func TestProxyManagerConnectAsync(t *testing.T) {
+	relay := newFakeRelay()
+	relay.release = make(chan struct{})
+	m := newTestManager(t, relay)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	spec := testSpec(t, "orders")
+
+	if err := m.ConnectAsync(spec); err != nil {
+		t.Fatalf("ConnectAsync: %v", err)
+	}
+	<-relay.started
+	if m.State(spec.ID) != ProxyStateConnecting {
+		t.Errorf("state while connecting = %s, want %s", m.State(spec.ID), ProxyStateConnecting)
+	}
+	if progress, ok := m.Connecting()[spec.ID]; !ok || progress.OperationID != spec.OperationID {
+		t.Errorf("Connecting = %+v, want the operation %q", m.Connecting(), spec.OperationID)
+	}
+	if err := m.ConnectAsync(spec); !errors.Is(err, ErrProxyConnecting) {
+		t.Errorf("second ConnectAsync = %v, want %v", err, ErrProxyConnecting)
+	}
+
+	close(relay.release)
+	event := waitForEvent(t, events, ProxyEventConnected)
+	if event.OperationID != spec.OperationID {
+		t.Errorf("connected event carries operation %q, want %q", event.OperationID, spec.OperationID)
+	}
+	if !m.IsConnected(spec.ID) {
+		t.Errorf("proxy is not connected after the connected event")
+	}
+	if len(m.Connecting()) != 0 {
+		t.Errorf("Connecting = %+v after the connect finished", m.Connecting())
+	}
+}
+
+func TestProxyManagerConnectFailure(t *testing.T) {
+	relay := newFakeRelay()
+	relay.err = errors.New("pod did not start")
+	m := newTestManager(t, relay)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+	spec := testSpec(t, "orders")
+
+	if err := m.ConnectAsync(spec); err != nil {
+		t.Fatalf("ConnectAsync: %v", err)
+	}
+	event := waitForEvent(t, events, ProxyEventConnectFailed)
+	if event.Message != relay.err.Error() {
+		t.Errorf("connect_failed message = %q, want %q", event.Message, relay.err)
+	}
+	if m.IsConnected(spec.ID) || m.State(spec.ID) != ProxyStateStopped {
+		t.Errorf("state after failure = %s, connected %v", m.State(spec.ID), m.IsConnected(spec.ID))
+	}
+	if failure := m.Failures()[spec.ID]; failure.Message != relay.err.Error() {
+		t.Errorf("recorded failure = %q, want %q", failure.Message, relay.err)
+	}
+
+	// A successful connect clears the failure
+	relay.err = nil
+	if err := m.Connect(spec); err != nil {
+		t.Fatalf("Connect after failure: %v", err)
+	}
+	if _, ok := m.Failures()[spec.ID]; ok {
+		t.Errorf("failure is still recorded after connecting")
+	}
+}
+
+func TestProxyManagerCancelConnect(t *testing.T) {
+	relay := newFakeRelay()
+	relay.release = make(chan struct{})
+	m := newTestManager(t, relay)
+	spec := testSpec(t, "orders")
+
+	result := make(chan error, 1)
+	go func() { result <- m.Connect(spec) }()
+	<-relay.started
+
+	if err := m.Disconnect(spec.ID); err != nil {
+		t.Fatalf("Disconnect during connect: %v", err)
+	}
+	if m.State(spec.ID) != ProxyStateStopped {
+		t.Errorf("state after cancelling = %s, want %s", m.State(spec.ID), ProxyStateStopped)
+	}
+
+	close(relay.release)
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrConnectCancelled) {
+			t.Errorf("cancelled Connect = %v, want %v", err, ErrConnectCancelled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled Connect did not return")
+	}
+	if m.IsConnected(spec.ID) {
+		t.Errorf("cancelled proxy is connected")
+	}
+	if _, ok := m.Failures()[spec.ID]; ok {
+		t.Errorf("a cancelled connect is recorded as failure")
+	}
+	if events := m.Events(EventFilter{ProxyID: spec.ID, Types: []ProxyEventType{ProxyEventConnected}}); len(events) != 0 {
+		t.Errorf("cancelled connect published %+v", events)
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(spec.LocalPort)))
+	if err != nil {
+		t.Errorf("local port %d is still bound after cancelling: %v", spec.LocalPort, err)
+	} else {
+		listener.Close()
+	}
+}
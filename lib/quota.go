@@ -0,0 +1,208 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	log "aproxymate/lib/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CheckSocatPodQuota checks the ResourceQuotas and LimitRanges of the namespace before a relay
+// pod is created, so that a pod the API server would reject fails right away with the reason,
+// e.g. "namespace tools has 0 remaining pods in quota team-quota". Namespaces whose quotas the
+// user may not read are not checked.
+func CheckSocatPodQuota(ctx context.Context, clientset kubernetes.Interface, config SocatProxyConfig) error {
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace()
+	}
+	containers := socatContainers(config)
+
+	limitRanges, err := clientset.CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if !apierrors.IsForbidden(err) {
+			log.Debug("Could not list LimitRanges, skipping the check", "namespace", namespace, "error", err)
+		}
+	} else {
+		for _, limitRange := range limitRanges.Items {
+			if err := checkLimitRange(namespace, limitRange, containers); err != nil {
+				return err
+			}
+			applyLimitRangeDefaults(limitRange, containers)
+		}
+	}
+
+	quotas, err := clientset.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if !apierrors.IsForbidden(err) {
+			log.Debug("Could not list ResourceQuotas, skipping the check", "namespace", namespace, "error", err)
+		}
+		return nil
+	}
+
+	usage := podQuotaUsage(containers)
+	for _, quota := range quotas.Items {
+		if !quotaAppliesToPod(quota, config.PriorityClassName) {
+			continue
+		}
+		for name, hard := range quota.Status.Hard {
+			needed, tracked := usage[name]
+			if !tracked {
+				if isComputeQuotaResource(name) {
+					return fmt.Errorf("quota %s in namespace %s requires pods to set %s, which relay pods don't; ask an admin to add a LimitRange default for it", quota.Name, namespace, name)
+				}
+				continue
+			}
+
+			used := quota.Status.Used[name]
+			remaining := hard.DeepCopy()
+			remaining.Sub(used)
+			if remaining.Cmp(needed) < 0 {
+				return quotaExceededError(namespace, quota.Name, name, remaining, used, hard, needed)
+			}
+		}
+	}
+	return nil
+}
+
+// quotaExceededError describes a quota that has no room for the relay pod
+func quotaExceededError(namespace, quotaName string, name corev1.ResourceName, remaining, used, hard, needed resource.Quantity) error {
+	if remaining.Sign() < 0 {
+		remaining = resource.Quantity{}
+	}
+	if name == corev1.ResourcePods || name == "count/pods" {
+		return fmt.Errorf("namespace %s has %s remaining pods in quota %s (%s of %s used); delete unused pods or choose another namespace", namespace, remaining.String(), quotaName, used.String(), hard.String())
+	}
+	return fmt.Errorf("namespace %s has only %s %s remaining in quota %s (%s of %s used) but the relay pod needs %s", namespace, remaining.String(), name, quotaName, used.String(), hard.String(), needed.String())
+}
+
+// podQuotaUsage returns how much of each quota resource a pod with these containers consumes
+func podQuotaUsage(containers []corev1.Container) corev1.ResourceList {
+	usage := corev1.ResourceList{
+		corev1.ResourcePods: resource.MustParse("1"),
+		"count/pods":        resource.MustParse("1"),
+	}
+	add := func(name corev1.ResourceName, quantity resource.Quantity) {
+		total := usage[name]
+		total.Add(quantity)
+		usage[name] = total
+	}
+
+	for _, container := range containers {
+		for name, quantity := range container.Resources.Requests {
+			add("requests."+name, quantity)
+			if name == corev1.ResourceCPU || name == corev1.ResourceMemory || name == corev1.ResourceEphemeralStorage {
+				// The plain names count requests too
+				add(name, quantity)
+			}
+		}
+		for name, quantity := range container.Resources.Limits {
+			add("limits."+name, quantity)
+		}
+	}
+	return usage
+}
+
+// isComputeQuotaResource reports whether a quota on the resource requires every container to set it
+func isComputeQuotaResource(name corev1.ResourceName) bool {
+	switch strings.TrimPrefix(strings.TrimPrefix(string(name), "requests."), "limits.") {
+	case string(corev1.ResourceCPU), string(corev1.ResourceMemory), string(corev1.ResourceEphemeralStorage):
+		return true
+	}
+	return false
+}
+
+// quotaAppliesToPod reports whether a quota's scopes select a relay pod: it is not best-effort,
+// has no active deadline and runs with the given PriorityClass
+func quotaAppliesToPod(quota corev1.ResourceQuota, priorityClassName string) bool {
+	for _, scope := range quota.Spec.Scopes {
+		switch scope {
+		case corev1.ResourceQuotaScopeTerminating, corev1.ResourceQuotaScopeBestEffort:
+			return false
+		case corev1.ResourceQuotaScopeNotTerminating, corev1.ResourceQuotaScopeNotBestEffort:
+		default:
+			// Scopes we don't evaluate; leave them to the API server
+			return false
+		}
+	}
+
+	if quota.Spec.ScopeSelector == nil {
+		return true
+	}
+	for _, requirement := range quota.Spec.ScopeSelector.MatchExpressions {
+		if requirement.ScopeName != corev1.ResourceQuotaScopePriorityClass {
+			return false
+		}
+		switch requirement.Operator {
+		case corev1.ScopeSelectorOpIn:
+			if !slices.Contains(requirement.Values, priorityClassName) {
+				return false
+			}
+		case corev1.ScopeSelectorOpNotIn:
+			if slices.Contains(requirement.Values, priorityClassName) {
+				return false
+			}
+		case corev1.ScopeSelectorOpExists:
+			if priorityClassName == "" {
+				return false
+			}
+		case corev1.ScopeSelectorOpDoesNotExist:
+			if priorityClassName != "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkLimitRange reports container requests and limits outside a LimitRange's bounds
+func checkLimitRange(namespace string, limitRange corev1.LimitRange, containers []corev1.Container) error {
+	for _, item := range limitRange.Spec.Limits {
+		if item.Type != corev1.LimitTypeContainer {
+			continue
+		}
+		for _, container := range containers {
+			for name, max := range item.Max {
+				if limit, ok := container.Resources.Limits[name]; ok && limit.Cmp(max) > 0 {
+					return fmt.Errorf("LimitRange %s in namespace %s allows at most %s %s per container but the relay pod uses %s", limitRange.Name, namespace, max.String(), name, limit.String())
+				}
+			}
+			for name, min := range item.Min {
+				if request, ok := container.Resources.Requests[name]; ok && request.Cmp(min) < 0 {
+					return fmt.Errorf("LimitRange %s in namespace %s requires at least %s %s per container but the relay pod requests %s", limitRange.Name, namespace, min.String(), name, request.String())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applyLimitRangeDefaults fills in the requests and limits the API server would default
+func applyLimitRangeDefaults(limitRange corev1.LimitRange, containers []corev1.Container) {
+	for _, item := range limitRange.Spec.Limits {
+		if item.Type != corev1.LimitTypeContainer {
+			continue
+		}
+		for i := range containers {
+			resources := &containers[i].Resources
+			for name, quantity := range item.Default {
+				if _, ok := resources.Limits[name]; !ok {
+					resources.Limits[name] = quantity
+				}
+			}
+			for name, quantity := range item.DefaultRequest {
+				if _, ok := resources.Requests[name]; !ok {
+					resources.Requests[name] = quantity
+				}
+			}
+		}
+	}
+}
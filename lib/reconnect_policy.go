@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults of the reconnect policy fields that are left at zero
+const (
+	defaultReconnectMaxRetries  = 5
+	defaultReconnectBackoffBase = 1
+	defaultReconnectBackoffCap  = 30
+	defaultReconnectResetWindow = 300
+)
+
+// ReconnectPolicy controls how a proxy whose port-forward stream closed is reconnected. Fields
+// left at zero use the global policy, then the defaults.
+type ReconnectPolicy struct {
+	// Disabled stops the proxy when its stream closes instead of reconnecting it
+	Disabled bool `json:"disabled,omitempty" mapstructure:"disabled" yaml:"disabled,omitempty"`
+	// MaxRetries is the number of reconnect attempts before giving up (default 5)
+	MaxRetries int `json:"max_retries,omitempty" mapstructure:"max_retries" yaml:"max_retries,omitempty"`
+	// BackoffBase is the wait in seconds after the first failed attempt, doubled after each further one (default 1)
+	BackoffBase int `json:"backoff_base,omitempty" mapstructure:"backoff_base" yaml:"backoff_base,omitempty"`
+	// BackoffCap is the longest wait in seconds between attempts (default 30)
+	BackoffCap int `json:"backoff_cap,omitempty" mapstructure:"backoff_cap" yaml:"backoff_cap,omitempty"`
+	// ResetWindow is how many seconds a proxy must stay connected before a drop gets the full
+	// number of retries again; drops within the window keep using up the retries (default 300)
+	ResetWindow int `json:"reset_window,omitempty" mapstructure:"reset_window" yaml:"reset_window,omitempty"`
+}
+
+// Validate checks that no value is negative and the backoff cap is not below its base
+func (p ReconnectPolicy) Validate() error {
+	if p.MaxRetries < 0 || p.BackoffBase < 0 || p.BackoffCap < 0 || p.ResetWindow < 0 {
+		return fmt.Errorf("max_retries, backoff_base, backoff_cap and reset_window must not be negative")
+	}
+	if p.BackoffBase > 0 && p.BackoffCap > 0 && p.BackoffCap < p.BackoffBase {
+		return fmt.Errorf("backoff_cap (%d) must not be lower than backoff_base (%d)", p.BackoffCap, p.BackoffBase)
+	}
+	return nil
+}
+
+// merge returns the policy with the non-zero values of override applied. A proxy that is
+// disabled in either policy doesn't reconnect.
+func (p ReconnectPolicy) merge(override ReconnectPolicy) ReconnectPolicy {
+	p.Disabled = p.Disabled || override.Disabled
+	if override.MaxRetries > 0 {
+		p.MaxRetries = override.MaxRetries
+	}
+	if override.BackoffBase > 0 {
+		p.BackoffBase = override.BackoffBase
+	}
+	if override.BackoffCap > 0 {
+		p.BackoffCap = override.BackoffCap
+	}
+	if override.ResetWindow > 0 {
+		p.ResetWindow = override.ResetWindow
+	}
+	return p
+}
+
+// withDefaults fills in the fields left at zero
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	return ReconnectPolicy{
+		MaxRetries:  defaultReconnectMaxRetries,
+		BackoffBase: defaultReconnectBackoffBase,
+		BackoffCap:  defaultReconnectBackoffCap,
+		ResetWindow: defaultReconnectResetWindow,
+	}.merge(p)
+}
+
+// backoff returns the wait after the given number of failed attempts
+func (p ReconnectPolicy) backoff(failed int) time.Duration {
+	wait := time.Duration(p.BackoffBase) * time.Second
+	limit := time.Duration(p.BackoffCap) * time.Second
+	for i := 1; i < failed && wait < limit; i++ {
+		wait *= 2
+	}
+	return min(wait, limit)
+}
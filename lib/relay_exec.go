@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+
+	log "aproxymate/lib/logger"
+)
+
+// DefaultRelayShell is run by `debug shell` when no command is given; the default relay image
+// ships busybox, so sh, nc, ping and nslookup are available
+var DefaultRelayShell = []string{"sh"}
+
+// RelayPodExec runs a command in a container of a relay pod, to investigate network issues from
+// the pod's point of view
+type RelayPodExec struct {
+	Cluster   string
+	Namespace string
+	PodName   string
+	// Container defaults to "socat", the container relaying the proxy's first port
+	Container string
+	Command   []string
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+	// TTY allocates a terminal in the container; Stderr is then merged into Stdout
+	TTY bool
+	// TerminalSizes reports the size of the local terminal while TTY is set
+	TerminalSizes remotecommand.TerminalSizeQueue
+}
+
+// Run runs the command until it exits. A command that exits with a non-zero status returns an
+// error for which RelayExitCode reports the status.
+func (e RelayPodExec) Run(ctx context.Context) error {
+	if e.Container == "" {
+		e.Container = "socat"
+	}
+	if len(e.Command) == 0 {
+		e.Command = DefaultRelayShell
+	}
+
+	restConfig, err := GetKubernetesClientConfig(KubeConfig{Context: e.Cluster})
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	url := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(e.Namespace).
+		Name(e.PodName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: e.Container,
+			Command:   e.Command,
+			Stdin:     e.Stdin != nil,
+			Stdout:    e.Stdout != nil,
+			Stderr:    e.Stderr != nil && !e.TTY,
+			TTY:       e.TTY,
+		}, scheme.ParameterCodec).
+		URL()
+
+	// Prefer WebSockets and fall back to SPDY for API servers older than 1.30, like kubectl
+	websocket, err := remotecommand.NewWebSocketExecutor(restConfig, "GET", url.String())
+	if err != nil {
+		return fmt.Errorf("failed to create exec transport: %w", err)
+	}
+	spdy, err := remotecommand.NewSPDYExecutor(restConfig, "POST", url)
+	if err != nil {
+		return fmt.Errorf("failed to create exec transport: %w", err)
+	}
+	executor, err := remotecommand.NewFallbackExecutor(websocket, spdy, httpstream.IsUpgradeFailure)
+	if err != nil {
+		return fmt.Errorf("failed to create exec transport: %w", err)
+	}
+
+	log.Info("Running command in relay pod", "cluster", e.Cluster, "namespace", e.Namespace, "pod", e.PodName, "container", e.Container, "command", e.Command)
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:             e.Stdin,
+		Stdout:            e.Stdout,
+		Stderr:            e.Stderr,
+		Tty:               e.TTY,
+		TerminalSizeQueue: e.TerminalSizes,
+	})
+	failed := err
+	if _, exited := RelayExitCode(err); exited {
+		failed = nil
+	}
+	log.LogAuditEvent("pod_exec", outcome(failed), map[string]any{
+		"cluster":   e.Cluster,
+		"namespace": e.Namespace,
+		"pod":       e.PodName,
+		"container": e.Container,
+		"command":   e.Command,
+	})
+	if failed != nil {
+		return fmt.Errorf("failed to run %q in relay pod %s: %w", e.Command[0], e.PodName, err)
+	}
+	return err
+}
+
+// RelayExitCode returns the exit status of a command run by RelayPodExec, and whether err is
+// about the command exiting with it
+func RelayExitCode(err error) (int, bool) {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	log "aproxymate/lib/logger"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultRelayImage is the socat image relay pods run unless relay_image is configured
+const DefaultRelayImage = "alpine/socat"
+
+// RelayImageConfig selects the image relay pods run and how it is verified
+type RelayImageConfig struct {
+	// Image is the socat image, preferably pinned by digest, e.g. "alpine/socat@sha256:..."
+	Image string `json:"image,omitempty" mapstructure:"image" yaml:"image,omitempty"`
+	// RequireDigest refuses images that are not pinned by digest
+	RequireDigest bool `json:"require_digest,omitempty" mapstructure:"require_digest" yaml:"require_digest,omitempty"`
+	// Cosign verifies the image signature before the first relay pod uses it
+	Cosign CosignConfig `json:"cosign,omitempty" mapstructure:"cosign" yaml:"cosign,omitempty"`
+}
+
+// CosignConfig is the signer a relay image must be signed by
+type CosignConfig struct {
+	// Key is a public key file or KMS URI to verify against
+	Key string `json:"key,omitempty" mapstructure:"key" yaml:"key,omitempty"`
+	// Identity and Issuer select the signer for keyless verification when no key is set
+	Identity string `json:"identity,omitempty" mapstructure:"identity" yaml:"identity,omitempty"`
+	Issuer   string `json:"issuer,omitempty" mapstructure:"issuer" yaml:"issuer,omitempty"`
+}
+
+// Enabled reports whether signatures are verified
+func (c CosignConfig) Enabled() bool {
+	return c.Key != "" || c.Identity != "" || c.Issuer != ""
+}
+
+// Reference returns the image relay pods run
+func (c RelayImageConfig) Reference() string {
+	if c.Image == "" {
+		return DefaultRelayImage
+	}
+	return c.Image
+}
+
+// Digest returns the digest the image is pinned to, e.g. "sha256:...", or "" when it isn't pinned
+func (c RelayImageConfig) Digest() string {
+	_, digest, _ := strings.Cut(c.Reference(), "@")
+	return digest
+}
+
+// Validate checks the digest format and that the verification settings are complete
+func (c RelayImageConfig) Validate() error {
+	digest := c.Digest()
+	if digest != "" {
+		hexDigest, ok := strings.CutPrefix(digest, "sha256:")
+		if _, err := hex.DecodeString(hexDigest); !ok || len(hexDigest) != 64 || err != nil {
+			return fmt.Errorf("image digest %q must be sha256: followed by 64 hex characters", digest)
+		}
+	}
+	if digest == "" && (c.RequireDigest || c.Cosign.Enabled()) {
+		return fmt.Errorf("image %q must be pinned by digest (image@sha256:...)", c.Reference())
+	}
+	if c.Cosign.Key == "" && c.Cosign.Enabled() && (c.Cosign.Identity == "" || c.Cosign.Issuer == "") {
+		return fmt.Errorf("cosign needs either a key or both identity and issuer")
+	}
+	return nil
+}
+
+// verifiedRelayImages remembers images whose signature was verified, so cosign runs once per image
+var verifiedRelayImages sync.Map
+
+// VerifyRelayImage validates the relay image settings and, when cosign is configured, verifies the
+// image signature with the cosign CLI
+func VerifyRelayImage(ctx context.Context, config RelayImageConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if !config.Cosign.Enabled() {
+		return nil
+	}
+
+	image := config.Reference()
+	cacheKey := image + "|" + config.Cosign.Key + "|" + config.Cosign.Identity + "|" + config.Cosign.Issuer
+	if _, ok := verifiedRelayImages.Load(cacheKey); ok {
+		return nil
+	}
+
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return fmt.Errorf("cosign is not installed; install it or remove relay_image.cosign to skip signature verification")
+	}
+	args := []string{"verify"}
+	if config.Cosign.Key != "" {
+		args = append(args, "--key", config.Cosign.Key)
+	} else {
+		args = append(args, "--certificate-identity", config.Cosign.Identity, "--certificate-oidc-issuer", config.Cosign.Issuer)
+	}
+	args = append(args, image)
+
+	timer := log.StartTimer("cosign_verify")
+	cmd := exec.CommandContext(ctx, "cosign", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	timer.Stop()
+	if err != nil {
+		return fmt.Errorf("signature verification of %s failed: %v %s", image, err, strings.TrimSpace(stderr.String()))
+	}
+
+	log.Info("Verified relay image signature", "image", image)
+	verifiedRelayImages.Store(cacheKey, struct{}{})
+	return nil
+}
+
+// VerifyRelayPodImage checks that every container of a running relay pod runs the pinned digest
+func VerifyRelayPodImage(ctx context.Context, clientset kubernetes.Interface, namespace, podName, digest string) error {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting pod %s: %w", podName, err)
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if !strings.HasPrefix(status.Name, "socat") {
+			continue
+		}
+		if !strings.HasSuffix(status.ImageID, "@"+digest) {
+			return fmt.Errorf("container %s runs image %s instead of the pinned digest %s", status.Name, status.ImageID, digest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+const (
+	// relayTLSServerName is the name relay certificates are issued for and verified against
+	relayTLSServerName = "aproxymate-relay"
+	// relayTLSCertEnv passes the certificate and key to the relay containers
+	relayTLSCertEnv = "RELAY_TLS_CERT"
+	// relayTLSSetup writes the certificate and key to a file for socat before it starts
+	relayTLSSetup = `printf '%s\n' "$RELAY_TLS_CERT" > /tmp/relay.pem && `
+	// relayTLSHandshakeTimeout bounds the TLS handshake with the relay of each client connection
+	relayTLSHandshakeTimeout = 10 * time.Second
+)
+
+// relayTLSListen returns the socat address a relay container terminates TLS on
+func relayTLSListen(listenPort int) string {
+	return fmt.Sprintf("OPENSSL-LISTEN:%d,fork,cert=/tmp/relay.pem,verify=0", listenPort)
+}
+
+// relayTLS is the certificate of one relay pod. The forwarder only trusts this certificate, so
+// nothing between the local machine and the pod can read or terminate the traffic.
+type relayTLS struct {
+	// pem holds the certificate and key for the relay pod
+	pem          []byte
+	clientConfig *tls.Config
+}
+
+// newRelayTLS generates a self-signed certificate for a new relay pod
+func newRelayTLS() (*relayTLS, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate relay TLS key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate relay TLS certificate: %w", err)
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: relayTLSServerName},
+		DNSNames:     []string{relayTLSServerName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate relay TLS certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode relay TLS key: %w", err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	return relayTLSFromPEM(data)
+}
+
+// relayTLSFromPEM trusts the certificate in the PEM data of a relay pod
+func relayTLSFromPEM(data []byte) (*relayTLS, error) {
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("relay pod has no TLS certificate")
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("relay pod has an invalid TLS certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(cert)
+		return &relayTLS{
+			pem: data,
+			clientConfig: &tls.Config{
+				RootCAs:    pool,
+				ServerName: relayTLSServerName,
+				MinVersion: tls.VersionTLS12,
+			},
+		}, nil
+	}
+}
+
+// withRelayTLS makes a relay container terminate TLS with the certificate instead of accepting
+// plain TCP connections
+func withRelayTLS(container corev1.Container, listenPort int, certificate []byte) corev1.Container {
+	container.Env = append(container.Env, corev1.EnvVar{Name: relayTLSCertEnv, Value: string(certificate)})
+	if len(container.Args) == 0 {
+		// The failover script listens on RELAY_LISTEN when it is set
+		container.Env = append(container.Env, corev1.EnvVar{Name: "RELAY_LISTEN", Value: relayTLSListen(listenPort)})
+		container.Command = []string{"sh", "-c", relayTLSSetup + failoverScript}
+		return container
+	}
+	container.Command = []string{"sh", "-c", relayTLSSetup + `exec socat "$1" "$2"`, "relay"}
+	container.Args = []string{relayTLSListen(listenPort), container.Args[1]}
+	return container
+}
+
+// podRelayCertificate returns the certificate and key a relay pod terminates TLS with, or nil
+// when it relays plain TCP
+func podRelayCertificate(pod *corev1.Pod) []byte {
+	for _, container := range pod.Spec.Containers {
+		for _, variable := range container.Env {
+			if variable.Name == relayTLSCertEnv {
+				return []byte(variable.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// streamConn lets a TLS connection run over a port-forward data stream
+type streamConn struct {
+	httpstream.Stream
+}
+
+// Close aborts the stream in both directions; it is only called when a handshake fails
+func (c streamConn) Close() error {
+	return c.Reset()
+}
+
+func (c streamConn) LocalAddr() net.Addr                { return relayAddr{} }
+func (c streamConn) RemoteAddr() net.Addr               { return relayAddr{} }
+func (c streamConn) SetDeadline(t time.Time) error      { return nil }
+func (c streamConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c streamConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// relayAddr is the address of the relay end of a port-forward stream
+type relayAddr struct{}
+
+func (relayAddr) Network() string { return "port-forward" }
+func (relayAddr) String() string  { return relayTLSServerName }
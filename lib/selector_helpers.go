@@ -3,6 +3,7 @@ package lib
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
@@ -80,6 +81,65 @@ func SelectKubernetesClusterTUI(invalidCluster string) (string, error) {
 	return selected, nil
 }
 
+// ClusterChoice is an answer of SelectClusterForEntriesTUI
+type ClusterChoice struct {
+	Cluster string
+	// PerEntry asks for the cluster of each entry separately
+	PerEntry bool
+	// Skip leaves the entries without a cluster
+	Skip bool
+}
+
+// Display implements the Displayable interface
+func (c ClusterChoice) Display() string {
+	switch {
+	case c.PerEntry:
+		return "↳ Choose a cluster for each entry"
+	case c.Skip:
+		return "⏭  Skip, leave without a cluster for now"
+	}
+	return c.Cluster
+}
+
+// SelectClusterForEntriesTUI asks which cluster the entries described by the title belong to.
+// Besides the clusters it offers to choose per entry, when perEntry is set, and to skip the
+// entries; cancelling the selection skips them too.
+func SelectClusterForEntriesTUI(title string, perEntry bool) (ClusterChoice, error) {
+	clusters, err := GetKubernetesContexts("")
+	if err != nil {
+		return ClusterChoice{}, fmt.Errorf("failed to get available Kubernetes contexts: %w", err)
+	}
+	if len(clusters) == 0 {
+		return ClusterChoice{}, fmt.Errorf("no Kubernetes contexts found in kubeconfig. Please ensure kubectl is configured with at least one cluster")
+	}
+
+	var choices []ClusterChoice
+	for _, cluster := range clusters {
+		choices = append(choices, ClusterChoice{Cluster: cluster})
+	}
+	if perEntry {
+		choices = append(choices, ClusterChoice{PerEntry: true})
+	}
+	choices = append(choices, ClusterChoice{Skip: true})
+
+	config := SelectorConfig[ClusterChoice]{
+		Title:         title,
+		Items:         choices,
+		EmptyMessage:  "No Kubernetes contexts found in kubeconfig",
+		CancelMessage: "Skipped",
+		AllowEmpty:    true,
+	}
+
+	selected, cancelled, err := RunSelector(config)
+	if err != nil {
+		return ClusterChoice{}, fmt.Errorf("failed to run cluster selection TUI: %w", err)
+	}
+	if cancelled {
+		return ClusterChoice{Skip: true}, nil
+	}
+	return selected, nil
+}
+
 // SelectAWSProfileTUI uses the generic selector for AWS profile selection
 func SelectAWSProfileTUI() (string, error) {
 	profiles, err := ParseAWSProfiles()
@@ -395,3 +455,59 @@ func PromptRDSImportConfirmation(newConfigs []ProxyConfig, existingCount int) (c
 
 	return confirmed, false, nil
 }
+
+// PromptAdoptPodsTUI asks whether to re-attach to relay pods still running from an earlier session
+func PromptAdoptPodsTUI(pods []AdoptablePod) (adopt bool, cancelled bool, err error) {
+	var summaryBuilder strings.Builder
+	summaryBuilder.WriteString("♻️  Proxy Pods Still Running\n\n")
+	summaryBuilder.WriteString(fmt.Sprintf("%d relay pod(s) from a previous session match your configuration:\n\n", len(pods)))
+	for _, pod := range pods {
+		summaryBuilder.WriteString(fmt.Sprintf("  • %s → %s/%s (started %s ago)\n", pod.ProxyName, pod.Cluster, pod.PodName, time.Since(pod.CreatedAt).Round(time.Second)))
+	}
+	summaryBuilder.WriteString("\nRe-attach to them instead of creating new pods?")
+
+	items := []string{
+		"♻️  Yes, re-attach the running pods",
+		"🗑️  No, delete them",
+	}
+
+	selected, err := SelectFromSlice(summaryBuilder.String(), items, "No options available")
+	if err != nil {
+		if err.Error() == "selection cancelled" {
+			return false, true, nil
+		}
+		return false, false, fmt.Errorf("failed to run re-attach prompt: %w", err)
+	}
+
+	return selected == items[0], false, nil
+}
+
+// PromptPodCleanupConfirmation asks the user to confirm deleting the listed pods
+func PromptPodCleanupConfirmation(pods []ManagedPod) (confirmed bool, cancelled bool, err error) {
+	users := make(map[string]bool)
+	clusters := make(map[string]bool)
+	for _, pod := range pods {
+		users[pod.User] = true
+		clusters[pod.Cluster] = true
+	}
+
+	title := fmt.Sprintf("🧹 Delete %d aproxymate pod(s)?\n\n"+
+		"  • Contexts: %d\n"+
+		"  • Users: %d\n\n"+
+		"Proxies using these pods will stop working.", len(pods), len(clusters), len(users))
+
+	items := []string{
+		"✅ Yes, delete these pods",
+		"❌ No, cancel",
+	}
+
+	selected, err := SelectFromSlice(title, items, "No options available")
+	if err != nil {
+		if err.Error() == "selection cancelled" {
+			return false, true, nil
+		}
+		return false, false, fmt.Errorf("failed to run cleanup confirmation: %w", err)
+	}
+
+	return selected == items[0], false, nil
+}
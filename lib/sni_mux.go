@@ -0,0 +1,229 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// sniReadTimeout bounds how long a client may take to send its TLS ClientHello
+const sniReadTimeout = 10 * time.Second
+
+// errServerNameRead stops the TLS handshake once the ClientHello has been read
+var errServerNameRead = errors.New("server name read")
+
+// ServerNames returns the TLS server names routed to an SNI proxy, or nil when SNI is off
+func (p ProxyConfig) ServerNames() []string {
+	if !p.SNI {
+		return nil
+	}
+	if len(p.SNIHostnames) > 0 {
+		return p.SNIHostnames
+	}
+	return []string{p.RemoteHost}
+}
+
+// sniMux serves several proxies on one local port, routing each TLS connection to the proxy
+// whose hostnames match the server name (SNI) in the client's ClientHello. The connection is
+// passed on unchanged, so TLS is still terminated by the remote service.
+type sniMux struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	routes map[string]*sniRoute
+	closed bool
+}
+
+// newSNIMux binds the shared local port
+func newSNIMux(bindAddress string, localPort int) (*sniMux, error) {
+	listener, err := listenTCP(bindAddress, localPort)
+	if err != nil {
+		return nil, err
+	}
+	mux := &sniMux{listener: listener, routes: make(map[string]*sniRoute)}
+	go mux.acceptLoop()
+	return mux, nil
+}
+
+// Route registers hostnames on the mux and returns a listener that receives their connections.
+// Closing the listener removes the route; the mux stops once its last route is gone.
+func (m *sniMux) Route(hostnames []string) (net.Listener, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, net.ErrClosed
+	}
+	for _, hostname := range hostnames {
+		if _, taken := m.routes[strings.ToLower(hostname)]; taken {
+			return nil, fmt.Errorf("TLS server name %s is already served on %s by another proxy", hostname, m.listener.Addr())
+		}
+	}
+
+	route := &sniRoute{
+		mux:       m,
+		hostnames: hostnames,
+		conns:     make(chan net.Conn),
+		done:      make(chan struct{}),
+	}
+	for _, hostname := range hostnames {
+		m.routes[strings.ToLower(hostname)] = route
+	}
+	return route, nil
+}
+
+// Closed reports whether the mux has stopped and a new one must be bound
+func (m *sniMux) Closed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+// remove drops a route and closes the mux when no routes are left
+func (m *sniMux) remove(route *sniRoute) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, hostname := range route.hostnames {
+		if m.routes[strings.ToLower(hostname)] == route {
+			delete(m.routes, strings.ToLower(hostname))
+		}
+	}
+	if len(m.routes) == 0 && !m.closed {
+		m.closed = true
+		m.listener.Close()
+	}
+}
+
+// lookup finds the route for a server name, falling back to a "*.domain" wildcard
+func (m *sniMux) lookup(serverName string) *sniRoute {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	serverName = strings.ToLower(serverName)
+	if route, ok := m.routes[serverName]; ok {
+		return route
+	}
+	if _, domain, ok := strings.Cut(serverName, "."); ok {
+		return m.routes["*."+domain]
+	}
+	return nil
+}
+
+// acceptLoop accepts client connections until the listener is closed
+func (m *sniMux) acceptLoop() {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			if !m.Closed() {
+				log.Error("SNI listener stopped accepting connections", "addr", m.listener.Addr().String(), "error", err)
+			}
+			return
+		}
+		go m.dispatch(conn)
+	}
+}
+
+// dispatch reads the server name of a connection and hands it to the matching route
+func (m *sniMux) dispatch(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(sniReadTimeout))
+	serverName, peeked, err := readServerName(conn)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		log.Warn("Rejected connection without a TLS server name", "client", conn.RemoteAddr().String(), "addr", m.listener.Addr().String(), "error", err)
+		conn.Close()
+		return
+	}
+
+	route := m.lookup(serverName)
+	if route == nil {
+		log.Warn("No connected proxy serves TLS server name", "server_name", serverName, "client", conn.RemoteAddr().String(), "addr", m.listener.Addr().String())
+		conn.Close()
+		return
+	}
+
+	replayed := &peekedConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(peeked), conn)}
+	select {
+	case route.conns <- replayed:
+	case <-route.done:
+		conn.Close()
+	}
+}
+
+// readServerName reads the TLS ClientHello from a connection and returns the server name along
+// with every byte read, so they can be replayed to the backend
+func readServerName(conn net.Conn) (string, []byte, error) {
+	var peeked bytes.Buffer
+	var serverName string
+	err := tls.Server(readOnlyConn{Conn: conn, reader: io.TeeReader(conn, &peeked)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errServerNameRead
+		},
+	}).Handshake()
+	if !errors.Is(err, errServerNameRead) {
+		return "", nil, fmt.Errorf("not a TLS ClientHello: %w", err)
+	}
+	if serverName == "" {
+		return "", nil, errors.New("the client sent no server name")
+	}
+	return serverName, peeked.Bytes(), nil
+}
+
+// readOnlyConn lets the TLS library read a ClientHello without answering it
+type readOnlyConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)  { return c.reader.Read(p) }
+func (c readOnlyConn) Write(p []byte) (int, error) { return 0, io.ErrClosedPipe }
+
+// peekedConn replays the bytes read while routing before reading from the connection
+type peekedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) { return c.reader.Read(p) }
+
+// sniRoute is the net.Listener a proxy's forwarder accepts its routed connections from
+type sniRoute struct {
+	mux       *sniMux
+	hostnames []string
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept waits for the next connection routed to the proxy
+func (r *sniRoute) Accept() (net.Conn, error) {
+	select {
+	case conn := <-r.conns:
+		return conn, nil
+	case <-r.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close removes the route from the mux
+func (r *sniRoute) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.mux.remove(r)
+	})
+	return nil
+}
+
+// Addr returns the shared local address
+func (r *sniRoute) Addr() net.Addr {
+	return r.mux.listener.Addr()
+}
@@ -0,0 +1,1574 @@
+// Page data rendered into index.html by the server
+let rowCounter = pageData.nextID;
+// Prefix for API routes when the GUI is mounted under a sub-path by a reverse proxy
+const basePath = pageData.basePath;
+// Version of the config file this page last saw; the server refuses saves over newer changes
+let configVersion = pageData.configVersion;
+let availableContexts = [];
+// Latest per-proxy pod and connection details from /api/status
+let proxyDetails = {};
+
+// Message handling functions
+function showErrorMessage(message) {
+    const errorDiv = document.getElementById('error-message');
+    const errorText = document.getElementById('error-text');
+    errorText.textContent = message;
+    errorDiv.classList.add('show');
+
+    // Auto-hide after 10 seconds
+    setTimeout(() => {
+        hideMessage('error-message');
+    }, 10000);
+}
+
+function showSuccessMessage(message) {
+    const successDiv = document.getElementById('success-message');
+    const successText = document.getElementById('success-text');
+    successText.textContent = message;
+    successDiv.classList.add('show');
+
+    // Auto-hide after 5 seconds
+    setTimeout(() => {
+        hideMessage('success-message');
+    }, 5000);
+}
+
+function hideMessage(messageId) {
+    const messageDiv = document.getElementById(messageId);
+    messageDiv.classList.remove('show');
+}
+
+// Toasts for notices from /api/notifications; at most maxToasts are shown at once
+const maxToasts = 5;
+// Proxies with a connect/disconnect request from this page, so their errors aren't shown twice
+const pendingRequests = {};
+
+function showToast(level, message) {
+    const container = document.getElementById('toast-container');
+    const toast = document.createElement('div');
+    toast.className = `toast toast-${level}`;
+    toast.textContent = message;
+    toast.onclick = () => toast.remove();
+    container.appendChild(toast);
+
+    while (container.children.length > maxToasts) {
+        container.firstChild.remove();
+    }
+    setTimeout(() => toast.remove(), level === 'error' ? 12000 : 6000);
+}
+
+function trackRequest(id, pending) {
+    // Keep the entry briefly after the response; its notice may arrive slightly later
+    pendingRequests[id] = pending ? Infinity : Date.now() + 3000;
+}
+
+function handleNotice(notice) {
+    const pending = notice.proxyId && pendingRequests[notice.proxyId];
+    if (notice.level === 'error' && pending && pending > Date.now()) {
+        return;
+    }
+    showToast(notice.level, notice.message);
+}
+
+// Receive status and notices over Server-Sent Events, falling back to polling when the
+// stream can't be opened or a proxy buffers it (no status within 10 seconds)
+function startLiveUpdates() {
+    if (!window.EventSource) {
+        startPolling();
+        return;
+    }
+
+    const source = new EventSource(basePath + '/api/stream');
+    let receiving = false;
+    const fallback = setTimeout(() => {
+        if (!receiving) {
+            console.warn('Event stream unavailable, falling back to polling');
+            source.close();
+            startPolling();
+        }
+    }, 10000);
+
+    source.addEventListener('status', event => {
+        receiving = true;
+        clearTimeout(fallback);
+        applyStatus(JSON.parse(event.data));
+    });
+    source.addEventListener('notice', event => handleNotice(JSON.parse(event.data)));
+    source.onerror = () => {
+        // EventSource reconnects by itself once the stream has worked
+        if (!receiving) {
+            clearTimeout(fallback);
+            source.close();
+            startPolling();
+        }
+    };
+}
+
+function startPolling() {
+    checkStatus();
+    setInterval(checkStatus, 5000);
+    pollNotifications();
+}
+
+// Long-poll the server for notices such as "config saved" or "pod failed"
+async function pollNotifications() {
+    let last = null;
+    while (true) {
+        try {
+            const query = last === null ? '' : `?after=${last}&wait=25`;
+            const response = await fetch(basePath + '/api/notifications' + query);
+            if (!response.ok) {
+                throw new Error(response.statusText);
+            }
+            const data = await response.json();
+            last = data.last;
+            data.notices.forEach(handleNotice);
+        } catch (error) {
+            console.error('Failed to poll notifications:', error);
+            await new Promise(resolve => setTimeout(resolve, 5000));
+        }
+    }
+}
+
+// Load available Kubernetes contexts on page load
+async function loadContexts() {
+    try {
+        const response = await fetch(basePath + '/api/contexts');
+        const data = await response.json();
+        availableContexts = data.contexts || [];
+
+        // Populate existing dropdowns
+        populateContextDropdowns();
+        populateClusterViewContexts();
+
+        // Check the clusters the rows use so unreachable ones are marked before connecting
+        const used = new Set(Array.from(document.querySelectorAll('select[data-field="cluster"]'))
+            .map(select => select.value)
+            .filter(value => value));
+        used.forEach(context => pingContext(context));
+    } catch (error) {
+        console.error('Failed to load Kubernetes contexts:', error);
+        availableContexts = [];
+    }
+}
+
+// Populate all context dropdowns with available options
+function populateContextDropdowns() {
+    const selects = document.querySelectorAll('select[data-field="cluster"]');
+    selects.forEach(select => {
+        const selectedValue = select.getAttribute('data-selected') || select.value;
+
+        // Clear existing options except the first one
+        select.innerHTML = '<option value="">Select a cluster...</option>';
+
+        // Add context options
+        availableContexts.forEach(context => {
+            const option = document.createElement('option');
+            option.value = context;
+            option.textContent = context;
+            if (context === selectedValue) {
+                option.selected = true;
+            }
+            select.appendChild(option);
+        });
+
+        // Set the value after populating options
+        if (selectedValue) {
+            select.value = selectedValue;
+        }
+    });
+}
+
+// Health of contexts from /api/contexts/{name}/ping, by context name
+const contextHealth = {};
+
+async function pingContext(context) {
+    try {
+        const response = await fetch(`${basePath}/api/contexts/${encodeURIComponent(context)}/ping`);
+        if (!response.ok) {
+            return;
+        }
+        contextHealth[context] = await response.json();
+        markContextOptions();
+    } catch (error) {
+        console.error('Failed to check context:', context, error);
+    }
+}
+
+// Flag unreachable clusters in every cluster dropdown
+function markContextOptions() {
+    document.querySelectorAll('select[data-field="cluster"], #cluster-view-context, #rds-cluster').forEach(select => {
+        Array.from(select.options).forEach(option => {
+            const health = option.value && contextHealth[option.value];
+            if (health && !(health.reachable && health.authenticated)) {
+                option.textContent = `⚠️ ${option.value} (${health.reachable ? 'not logged in' : 'unreachable'})`;
+                option.title = health.error || '';
+            } else if (option.value) {
+                option.textContent = option.value;
+                option.title = health && health.version ? `Kubernetes ${health.version}` : '';
+            }
+        });
+        const health = contextHealth[select.value];
+        const unhealthy = !!health && !(health.reachable && health.authenticated);
+        select.classList.toggle('context-unhealthy', unhealthy);
+        select.title = unhealthy ? health.error || '' : '';
+    });
+}
+
+// Check a cluster as soon as it is picked
+document.addEventListener('change', function(e) {
+    const select = e.target.closest('select[data-field="cluster"], #cluster-view-context, #rds-cluster');
+    if (select && select.value) {
+        if (contextHealth[select.value]) {
+            markContextOptions();
+        }
+        pingContext(select.value);
+    }
+});
+
+// Populate the context selectors of the cluster view and the RDS import
+function populateClusterViewContexts() {
+    ['cluster-view-context', 'rds-cluster'].forEach(id => {
+        const select = document.getElementById(id);
+        // The RDS import is hidden in strict connect mode
+        if (!select) {
+            return;
+        }
+        select.innerHTML = '<option value="">Select a cluster...</option>';
+        availableContexts.forEach(context => {
+            const option = document.createElement('option');
+            option.value = context;
+            option.textContent = context;
+            select.appendChild(option);
+        });
+    });
+}
+
+// Add an empty row, or a row the server already created (e.g. by an RDS import)
+function addRow(existing) {
+    const newRow = document.createElement('div');
+    newRow.className = 'proxy-row';
+    // New rows are numbered; rows from the server keep their ID, which is derived from the proxy name
+    const id = existing ? existing.id : String(rowCounter++);
+    newRow.setAttribute('data-id', id);
+
+    newRow.innerHTML = `
+        <select class="select-field" data-field="cluster">
+            <option value="">Select a cluster...</option>
+        </select>
+        <input type="text" class="input-field" placeholder="postgres-service" data-field="host">
+        <input type="number" class="input-field" placeholder="8080" data-field="local-port" min="1" max="65535" title="Local port to bind to. Ports 1-1023 require admin privileges. Consider using ports 1024-65535.">
+        <input type="number" class="input-field" placeholder="5432" data-field="remote-port" min="1" max="65535" title="Enter a valid port number (1-65535)">
+        <div>
+            <button class="btn btn-success" onclick="connect('` + id + `')">Start</button>
+            <button class="btn btn-test" onclick="testProxy('` + id + `')" title="Check the port, cluster, permissions and remote host without connecting">Test</button>
+        </div>
+        <div>
+            <span class="status status-disconnected">Disconnected</span>
+        </div>
+        <div class="proxy-namespace"></div>
+        <div class="proxy-pod"></div>
+        <div class="proxy-uptime"></div>
+        <div>
+            <button class="btn-delete" onclick="removeRow('` + id + `')">⌫</button>
+        </div>
+    `;
+
+    // Populate the new dropdown with contexts
+    const newSelect = newRow.querySelector('select[data-field="cluster"]');
+    availableContexts.forEach(context => {
+        const option = document.createElement('option');
+        option.value = context;
+        option.textContent = context;
+        newSelect.appendChild(option);
+    });
+
+    if (existing) {
+        newSelect.value = existing.cluster;
+        newRow.querySelector('[data-field="host"]').value = existing.host;
+        newRow.querySelector('[data-field="local-port"]').value = existing.localPort;
+        newRow.querySelector('[data-field="remote-port"]').value = existing.remotePort;
+        renderRuntimeColumns(newRow, existing);
+    }
+    groupRows(existing && existing.cluster || '').appendChild(newRow);
+    updateGroups();
+    if (!existing) {
+        saveRow(id);
+    }
+    markContextOptions();
+
+    // Re-run search to ensure new row is properly filtered
+    searchProxies();
+}
+
+function removeRow(id) {
+    const row = document.querySelector(`[data-id="${id}"]`);
+    if (!row) {
+        return;
+    }
+    // Protected entries need an explicit confirmation, which the server checks with force=true
+    const isProtected = row.dataset.protected === 'true';
+    const question = isProtected
+        ? `🔒 ${row.dataset.name || 'This proxy configuration'} is protected.\n\nRemove it anyway? Saving the config will then drop it from the config file.`
+        : 'Are you sure you want to remove this proxy configuration?';
+    if (confirm(question)) {
+        row.remove();
+        updateGroups();
+        fetch(`${basePath}/api/proxy/${id}` + (isProtected ? '?force=true' : ''), { method: 'DELETE' });
+    }
+}
+
+function connect(id) {
+    console.log('Connect called with id:', id);
+    const row = document.querySelector(`[data-id="${id}"]`);
+    const data = getRowData(row);
+    console.log('Connect data:', { id: id, ...data });
+    const actionsDiv = row.querySelector('div:nth-child(5)'); // The actions column
+
+    // Validate required fields
+    if (!data.cluster || !data.host || !data.localPort || !data.remotePort) {
+        showErrorMessage('Please fill in all required fields before connecting.');
+        return;
+    }
+
+    // Validate port ranges
+    if (data.localPort < 1 || data.localPort > 65535) {
+        showErrorMessage('Local port must be between 1 and 65535.');
+        return;
+    }
+
+    if (data.remotePort < 1 || data.remotePort > 65535) {
+        showErrorMessage('Remote port must be between 1 and 65535.');
+        return;
+    }
+
+    // Warn about privileged ports (1-1023) which typically require root/admin privileges
+    if (data.localPort <= 1023) {
+        if (!confirm(`Warning: Port ${data.localPort} is a privileged port (1-1023) that typically requires administrator privileges to bind to. This may fail unless you're running with elevated permissions.\n\nDo you want to continue anyway?`)) {
+            return;
+        }
+    }
+
+    // Show connecting state
+    const connectButton = actionsDiv.querySelector('.btn-success');
+    if (connectButton) {
+        connectButton.disabled = true;
+        connectButton.textContent = 'Connecting...';
+    }
+    trackRequest(id, true);
+
+    fetch(basePath + '/api/connect', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ id: id, ...data })
+    }).then(response => {
+        console.log('Connect response status:', response.status);
+        trackRequest(id, false);
+        if (response.ok) {
+            // The connect continues on the server; its progress and the "connected" or
+            // "failed to connect" toast arrive with the status updates and notices
+            return response.json().then(result => console.log('Connect operation:', result.operationId));
+        } else {
+            return response.text().then(text => {
+                console.log('Connect error response:', text);
+                // Reset button on error
+                if (connectButton) {
+                    connectButton.disabled = false;
+                    connectButton.textContent = 'Start';
+                }
+
+                // Local port problems come back as JSON with the port and the reason
+                let errorMessage = text;
+                if (response.headers.get('Content-Type') === 'application/json') {
+                    try {
+                        errorMessage = JSON.parse(text).error || text;
+                    } catch (e) {
+                        // Not JSON after all; show the text as is
+                    }
+                }
+
+                showErrorMessage(`Failed to connect proxy: ${errorMessage}`);
+            });
+        }
+    }).catch(error => {
+        console.log('Connect fetch error:', error);
+        trackRequest(id, false);
+        // Reset button on error
+        if (connectButton) {
+            connectButton.disabled = false;
+            connectButton.textContent = 'Start';
+        }
+        showErrorMessage(`Connection error: ${error.message}`);
+    });
+}
+
+// Stop a proxy; with force, also when clients are still connected through it
+function disconnect(id, force) {
+    console.log('Disconnect called with id:', id);
+    const row = document.querySelector(`[data-id="${id}"]`);
+    console.log('Found row:', row);
+    const actionsDiv = row.querySelector('div:nth-child(5)'); // The actions column
+
+    // Show disconnecting state
+    const disconnectButton = actionsDiv.querySelector('.btn-danger');
+    if (disconnectButton && disconnectButton.textContent.trim() === 'Stop') {
+        disconnectButton.disabled = true;
+        disconnectButton.textContent = 'Stopping...';
+    }
+
+    const url = `${basePath}/api/disconnect/${id}` + (force ? '?force=true' : '');
+    console.log('Making disconnect request to:', url);
+    trackRequest(id, true);
+    fetch(url, { method: 'POST' })
+    .then(response => {
+        console.log('Disconnect response status:', response.status);
+        console.log('Disconnect response ok:', response.ok);
+        trackRequest(id, false);
+        if (response.ok) {
+            updateRowStatus(id, false);
+        } else if (response.status === 409) {
+            return response.json().then(data => {
+                // Reset the button, the proxy stays connected unless the user confirms
+                if (disconnectButton && disconnectButton.textContent.trim() === 'Stopping...') {
+                    disconnectButton.disabled = false;
+                    disconnectButton.textContent = 'Stop';
+                }
+                if (data.status === 'requires_force' && confirmForcedDisconnect(data.connections)) {
+                    disconnect(id, true);
+                }
+            });
+        } else {
+            return response.text().then(text => {
+                console.log('Disconnect error response:', text);
+                // Reset button on error
+                if (disconnectButton && disconnectButton.textContent.trim() === 'Stopping...') {
+                    disconnectButton.disabled = false;
+                    disconnectButton.textContent = 'Stop';
+                }
+                showErrorMessage(`Failed to disconnect proxy: ${text}`);
+            });
+        }
+    }).catch(error => {
+        console.log('Disconnect fetch error:', error);
+        trackRequest(id, false);
+        // Reset button on error
+        if (disconnectButton && disconnectButton.textContent.trim() === 'Stopping...') {
+            disconnectButton.disabled = false;
+            disconnectButton.textContent = 'Stop';
+        }
+        showErrorMessage(`Disconnection error: ${error.message}`);
+    });
+}
+
+// Ask before closing the client connections that are still open through a proxy
+function confirmForcedDisconnect(connections) {
+    const lines = connections.slice(0, 5).map(connection =>
+        `• ${connection.clientAddr}, open for ${formatAge(connection.startedAt)}`);
+    if (connections.length > lines.length) {
+        lines.push(`• and ${connections.length - lines.length} more`);
+    }
+    return confirm(`${connections.length} client connection(s) are still using this proxy:\n\n${lines.join('\n')}\n\nStopping it closes them, e.g. interrupting a running migration. Stop anyway?`);
+}
+
+// Run the connection checks of a row without connecting it and show one line per check
+async function testProxy(id) {
+    const row = document.querySelector(`[data-id="${id}"]`);
+    const testButton = row.querySelector('.btn-test');
+    if (testButton) {
+        testButton.disabled = true;
+        testButton.textContent = 'Testing...';
+    }
+
+    try {
+        const response = await fetch(`${basePath}/api/proxy/${encodeURIComponent(id)}/test`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(getRowData(row))
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const result = await response.json();
+        const icons = { pass: '✅', warn: '⚠️', fail: '❌', skip: '⏭' };
+        const lines = result.checks.map(check => `${icons[check.status] || ''} ${check.name.replace(/_/g, ' ')}: ${check.message}`);
+        const warned = result.checks.some(check => check.status === 'warn');
+        const level = result.passed ? (warned ? 'warning' : 'success') : 'error';
+        showToast(level, [result.passed ? 'Test passed' : 'Test failed', ...lines].join('\n'));
+    } catch (error) {
+        showToast('error', `Failed to test proxy: ${error.message}`);
+    } finally {
+        if (testButton) {
+            testButton.disabled = false;
+            testButton.textContent = 'Test';
+        }
+    }
+}
+
+function getRowData(row) {
+    return {
+        cluster: row.querySelector('[data-field="cluster"]').value,
+        host: row.querySelector('[data-field="host"]').value,
+        localPort: parseInt(row.querySelector('[data-field="local-port"]').value) || 0,
+        remotePort: parseInt(row.querySelector('[data-field="remote-port"]').value) || 0
+    };
+}      function updateRowStatus(id, connected) {
+    const row = document.querySelector(`[data-id="${id}"]`);
+    const actionsDiv = row.querySelector('div:nth-child(5)'); // The actions column
+    const statusDiv = row.querySelector('div:nth-child(6)'); // The status column
+
+    // Add a small fade effect
+    actionsDiv.style.opacity = '0.5';
+    statusDiv.style.opacity = '0.5';
+
+    setTimeout(() => {
+        if (connected) {
+            actionsDiv.innerHTML = `
+                <button class="btn btn-danger" onclick="disconnect('` + id + `')">Stop</button>
+            `;
+            statusDiv.innerHTML = `
+                <span class="status status-connected">Connected</span>
+            `;
+        } else {
+            actionsDiv.innerHTML = `
+                <button class="btn btn-success" onclick="connect('` + id + `')">Start</button>
+                <button class="btn btn-test" onclick="testProxy('` + id + `')" title="Check the port, cluster, permissions and remote host without connecting">Test</button>
+            `;
+            statusDiv.innerHTML = `
+                <span class="status status-disconnected">Disconnected</span>
+            `;
+        }
+        renderStatusDetail(statusDiv, proxyDetails[id]);
+
+        // Restore opacity
+        actionsDiv.style.opacity = '1';
+        statusDiv.style.opacity = '1';
+    }, 100);
+}
+
+// Labels of the connect_progress stages
+const connectStages = {
+    queued: 'queued',
+    pod_created: 'pod created',
+    pod_running: 'pod running',
+    forward_established: 'port-forward established'
+};
+
+// Keep the Start button disabled while the proxy connects on the server, e.g. after a
+// reload, and enable it again when the connect has failed
+function syncConnectButton(row, proxy) {
+    const connectButton = row.querySelector('div:nth-child(5) .btn-success');
+    // The request from this page is still on its way
+    if (!connectButton || pendingRequests[row.dataset.id] === Infinity) {
+        return;
+    }
+    const connecting = !!proxy && proxy.state === 'connecting';
+    connectButton.disabled = connecting;
+    connectButton.textContent = connecting ? 'Connecting...' : 'Start';
+}
+
+// Show the relay pod phase, node, restarts, uptime and last error below a row's status
+function renderStatusDetail(statusDiv, proxy) {
+    let detail = statusDiv.querySelector('.status-detail');
+    if (!detail) {
+        detail = document.createElement('span');
+        detail.className = 'status-detail';
+        statusDiv.appendChild(detail);
+    }
+    if (!proxy) {
+        detail.textContent = '';
+        statusDiv.title = '';
+        renderCopyCredentials(statusDiv, null);
+        return;
+    }
+
+    const parts = [];
+    if (proxy.state === 'degraded' || proxy.state === 'connecting') {
+        parts.push(proxy.state.charAt(0).toUpperCase() + proxy.state.slice(1));
+    }
+    if (proxy.progress && proxy.progress.stage) {
+        parts.push(connectStages[proxy.progress.stage] || proxy.progress.stage);
+    }
+    if (proxy.connected) {
+        if (proxy.podPhase) parts.push(proxy.podPhase);
+        if (proxy.restarts > 0) parts.push(`${proxy.restarts} restart(s)`);
+    }
+    if (proxy.credentials) {
+        parts.push(`user ${proxy.credentials.username} until ${new Date(proxy.credentials.expiresAt).toLocaleTimeString()}`);
+    }
+    if (proxy.lastError) {
+        parts.push(describeFailure(proxy));
+    } else if (proxy.credentialsError) {
+        parts.push(proxy.credentialsError);
+    } else if (!proxy.connected && proxy.lastEvent) {
+        parts.push(describeEvent(proxy.lastEvent));
+    }
+    detail.textContent = parts.join(' · ');
+    detail.classList.toggle('has-error', !!proxy.lastError || !!proxy.credentialsError || proxy.state === 'degraded');
+    renderCopyCredentials(statusDiv, proxy);
+
+    const title = [];
+    if (proxy.podName) title.push(`Pod: ${proxy.podName}`);
+    if (proxy.node) title.push(`Node: ${proxy.node}`);
+    if (proxy.lastError) title.push(`Last error: ${describeFailure(proxy)}`);
+    if (proxy.lastFailure && proxy.lastFailure.podEvents) {
+        title.push('Pod events:', ...proxy.lastFailure.podEvents.map(event => `  ${event}`));
+    }
+    if (proxy.lastFailure && proxy.lastFailure.podLogs) {
+        proxy.lastFailure.podLogs.forEach(log => {
+            title.push(`Logs of ${log.container}${log.previous ? ' (exited instance)' : ''}:`, ...log.lines.map(line => `  ${line}`));
+        });
+    }
+    if (proxy.lastEvent) title.push(`Last event: ${describeEvent(proxy.lastEvent)}`);
+    statusDiv.title = title.join('\n');
+}
+
+// Describe a proxy's last error with the connect stage it failed after, e.g.
+// "Failed after pod created: Proxy pod failed to start ..."
+function describeFailure(proxy) {
+    const failure = proxy.lastFailure;
+    if (!failure || !failure.stage || failure.message !== proxy.lastError) {
+        return proxy.lastError;
+    }
+    return `Failed after ${connectStages[failure.stage] || failure.stage}: ${proxy.lastError}`;
+}
+
+// Show a link copying the connection string, including the password, for proxies with Vault credentials
+function renderCopyCredentials(statusDiv, proxy) {
+    let button = statusDiv.querySelector('.copy-credentials');
+    if (!button) {
+        button = document.createElement('button');
+        button.className = 'copy-credentials';
+        button.textContent = '🔑 Copy connection string';
+        statusDiv.appendChild(button);
+    }
+    button.style.display = proxy && proxy.credentials ? 'block' : 'none';
+    if (proxy) {
+        button.onclick = () => copyConnectionString(proxy.id);
+    }
+}
+
+async function copyConnectionString(id) {
+    try {
+        const response = await fetch(`${basePath}/api/proxy/${encodeURIComponent(id)}/connection-string`);
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const data = await response.json();
+        await navigator.clipboard.writeText(data.connectionString);
+        showToast('success', 'Connection string copied to the clipboard');
+    } catch (error) {
+        showToast('error', `Failed to copy connection string: ${error.message}`);
+    }
+}
+
+// Render an event as "14:32:05 dropped: port-forward stream closed"
+function describeEvent(event) {
+    const time = new Date(event.time).toLocaleTimeString();
+    const text = `${time} ${event.type.replace(/_/g, ' ')}`;
+    return event.message ? `${text}: ${event.message}` : text;
+}
+
+function saveRow(id) {
+    const row = document.querySelector(`[data-id="${id}"]`);
+    const data = getRowData(row);
+
+    return fetch(basePath + '/api/proxy', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ id: id, ...data })
+    });
+}
+
+// Auto-save on input change
+document.addEventListener('input', function(e) {
+    if (e.target.classList.contains('input-field') || e.target.classList.contains('select-field')) {
+        const row = e.target.closest('.proxy-row');
+        const id = row.getAttribute('data-id');
+        setTimeout(() => {
+            // Re-run search once the server has the new values
+            saveRow(id).then(searchProxies);
+        }, 500); // Debounce saves
+    }
+});
+
+// Also listen for change events on select elements
+document.addEventListener('change', function(e) {
+    if (e.target.classList.contains('select-field')) {
+        const row = e.target.closest('.proxy-row');
+        const id = row.getAttribute('data-id');
+        if (e.target.dataset.field === 'cluster') {
+            moveToGroup(row);
+        }
+        setTimeout(() => {
+            // Re-run search once the server has the new values
+            saveRow(id).then(searchProxies);
+        }, 500); // Debounce saves
+    }
+});
+
+// Save current configuration to file
+async function saveConfiguration() {
+    const button = event.target;
+    const originalText = button.textContent;
+
+    // Get all rows in their current display order (including sorted order)
+    const allRows = document.querySelectorAll('.proxy-row');
+    let hasValidConfig = false;
+    let validationErrors = [];
+    let configData = [];
+
+    allRows.forEach((row, index) => {
+        const data = getRowData(row);
+        const rowId = row.getAttribute('data-id');
+        const rowNum = index + 1;
+
+        if (data.cluster || data.host || data.localPort || data.remotePort) {
+            hasValidConfig = true;
+
+            // Validate individual fields
+            if (!data.cluster) {
+                validationErrors.push(`Row ${rowNum}: Kubernetes cluster is required`);
+            }
+            if (!data.host) {
+                validationErrors.push(`Row ${rowNum}: Remote host is required`);
+            }
+            if (!data.localPort || data.localPort <= 0 || data.localPort > 65535) {
+                validationErrors.push(`Row ${rowNum}: Local port must be between 1 and 65535`);
+            } else if (data.localPort <= 1023) {
+                validationErrors.push(`Row ${rowNum}: Warning - Local port ${data.localPort} is privileged and may require administrator permissions`);
+            }
+            if (!data.remotePort || data.remotePort <= 0 || data.remotePort > 65535) {
+                validationErrors.push(`Row ${rowNum}: Remote port must be between 1 and 65535`);
+            }
+
+            // Add row data with current order index
+            configData.push({
+                id: rowId,
+                order: index,
+                ...data
+            });
+        }
+    });
+
+    if (!hasValidConfig) {
+        showErrorMessage('No configuration to save. Please add at least one proxy configuration.');
+        return;
+    }
+
+    if (validationErrors.length > 0) {
+        showErrorMessage('Configuration validation errors:\n' + validationErrors.join('\n'));
+        return;
+    }
+
+    // Show loading state
+    button.textContent = '💾 Saving...';
+    button.disabled = true;
+
+    try {
+        // Ask before removing or changing existing entries
+        const removeProtected = await confirmConfigChanges(configData);
+        if (!removeProtected) {
+            button.textContent = originalText;
+            button.disabled = false;
+            return;
+        }
+
+        let response = await postConfigSave(configData, removeProtected, false);
+        if (response.status === 409) {
+            const conflict = await response.text();
+            if (!confirm(`${conflict}\n\nOverwrite the changes made elsewhere?`)) {
+                button.textContent = originalText;
+                button.disabled = false;
+                return;
+            }
+            response = await postConfigSave(configData, removeProtected, true);
+        }
+
+        if (response.ok) {
+            const etag = response.headers.get('ETag');
+            if (etag) {
+                configVersion = etag.replace(/"/g, '');
+            }
+            button.textContent = '✅ Saved!';
+            // Update the config location display
+            loadConfigLocation();
+            setTimeout(() => {
+                button.textContent = originalText;
+                button.disabled = false;
+            }, 2000);
+        } else {
+            const errorText = await response.text();
+            throw new Error(`Failed to save configuration: ${errorText}`);
+        }
+    } catch (error) {
+        console.error('Error saving configuration:', error);
+        showErrorMessage(`Failed to save configuration: ${error.message}`);
+        button.textContent = '❌ Error';
+        setTimeout(() => {
+            button.textContent = originalText;
+            button.disabled = false;
+        }, 2000);
+    }
+}
+
+// Post the rows to save, confirming the removal of the protected entries in removeProtected and
+// optionally overwriting changes made since the page was loaded
+function postConfigSave(configData, removeProtected, force) {
+    const headers = { 'Content-Type': 'application/json' };
+    if (configVersion) {
+        headers['If-Match'] = `"${configVersion}"`;
+    }
+    return fetch(basePath + '/api/config/save' + (force ? '?force=true' : ''), {
+        method: 'POST',
+        headers: headers,
+        body: JSON.stringify({ orderedRows: configData, removeProtected: removeProtected })
+    });
+}
+
+// Preview a save and confirm it if entries would be removed or changed. Returns the protected
+// entries confirmed for removal, or null when the save is cancelled.
+async function confirmConfigChanges(configData) {
+    const response = await fetch(basePath + '/api/config/preview', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ orderedRows: configData })
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    const preview = await response.json();
+    const diff = preview.diff;
+    if (diff.removed.length === 0 && diff.changed.length === 0) {
+        return [];
+    }
+
+    const details = [];
+    if (diff.removed.length > 0) details.push(`Removed: ${diff.removed.join(', ')}`);
+    diff.changed.forEach(change => details.push(`Changed ${change.name}: ${change.fields.join(', ')}`));
+    if (!confirm(`Saving to ${preview.path} ${preview.summary}.\n\n${details.join('\n')}\n\nContinue?`)) {
+        return null;
+    }
+    if (diff.removedProtected.length > 0 &&
+        !confirm(`🔒 ${diff.removedProtected.join(', ')} ${diff.removedProtected.length === 1 ? 'is' : 'are'} protected.\n\nRemove ${diff.removedProtected.length === 1 ? 'it' : 'them'} from the config file anyway?`)) {
+        return null;
+    }
+    return diff.removedProtected;
+}
+
+// Load contexts when page loads
+document.addEventListener('DOMContentLoaded', function() {
+    restoreCollapsedGroups();
+    loadContexts().then(loadMissingClusters);
+    loadAWSOptions();
+    loadConfigLocation();
+    checkForUpdate();
+    loadAdoptable();
+    startLiveUpdates();
+    // Update config location every 10 seconds
+    setInterval(loadConfigLocation, 10000);
+});
+
+// Load and display the current config save location
+async function loadConfigLocation() {
+    try {
+        const response = await fetch(basePath + '/api/config/location');
+        const data = await response.json();
+
+        const locationElement = document.getElementById('config-location-text');
+        if (locationElement) {
+            if (data.location === "None") {
+                locationElement.textContent = `None (will save to ${data.nextSaveLocation})`;
+                locationElement.title = `No config loaded. Next save will create: ${data.nextSaveLocation}`;
+            } else {
+                locationElement.textContent = data.location;
+                locationElement.title = `Config loaded from: ${data.location}`;
+            }
+        }
+    } catch (error) {
+        console.error('Failed to load config location:', error);
+        const locationElement = document.getElementById('config-location-text');
+        if (locationElement) {
+            locationElement.textContent = 'Error loading location';
+        }
+    }
+}
+
+// Offer relay pods still running from an earlier session for re-attach
+async function loadAdoptable() {
+    try {
+        const response = await fetch(basePath + '/api/adoptable');
+        const data = await response.json();
+        if (!data.pods || data.pods.length === 0) {
+            return;
+        }
+
+        const names = data.pods.map(pod => pod.proxyName).join(', ');
+        document.getElementById('adopt-text').textContent =
+            `${data.pods.length} proxy pod(s) from a previous session are still running (${names}). `;
+        document.getElementById('adopt-message').classList.add('show');
+    } catch (error) {
+        console.error('Failed to load running pods:', error);
+    }
+}
+
+async function resolveAdoptable(action) {
+    document.getElementById('adopt-message').classList.remove('show');
+    try {
+        const response = await fetch(basePath + '/api/adoptable', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ action: action }),
+        });
+        const data = await response.json();
+        if (data.errors && data.errors.length > 0) {
+            showErrorMessage(`Some proxies could not be re-attached: ${data.errors.join('; ')}`);
+        } else if (action === 'adopt') {
+            showSuccessMessage(`Re-attached ${data.processed} proxy(s)`);
+        }
+        checkStatus();
+    } catch (error) {
+        showErrorMessage(`Failed to handle running pods: ${error.message}`);
+    }
+}
+
+// Offer to assign clusters to the config file entries that have none, per group of hosts in the
+// same domain or per entry
+async function loadMissingClusters() {
+    if (!document.getElementById('missing-clusters-message')) {
+        return;
+    }
+    try {
+        const response = await fetch(basePath + '/api/config/missing-clusters');
+        const data = await response.json();
+        if (!data.total) {
+            return;
+        }
+
+        const names = data.groups.flatMap(group => group.entries.map(entry => entry.name || entry.remoteHost)).join(', ');
+        document.getElementById('missing-clusters-text').textContent =
+            `${data.total} proxy configuration(s) have no Kubernetes cluster (${names}). `;
+        fillSelect('missing-clusters-cluster', availableContexts);
+
+        const container = document.getElementById('missing-clusters-entries');
+        container.innerHTML = '';
+        data.groups.forEach((group, index) => {
+            const groupElement = document.createElement('div');
+            groupElement.className = 'missing-clusters-group';
+            groupElement.appendChild(missingClusterSelect(
+                group.domain ? `Hosts in ${group.domain}` : 'Hosts without a domain',
+                value => selectMissingClusters(value, index)));
+            group.entries.forEach(entry => {
+                const select = missingClusterSelect(`${entry.name} (${entry.remoteHost}:${entry.remotePort})`);
+                select.querySelector('select').setAttribute('data-entry-id', entry.id);
+                select.querySelector('select').setAttribute('data-group', index);
+                select.classList.add('missing-clusters-entry');
+                groupElement.appendChild(select);
+            });
+            container.appendChild(groupElement);
+        });
+        document.getElementById('missing-clusters-message').classList.add('show');
+    } catch (error) {
+        console.error('Failed to load configurations without a cluster:', error);
+    }
+}
+
+// A labelled cluster dropdown of the missing-cluster banner
+function missingClusterSelect(text, onchange) {
+    const label = document.createElement('label');
+    label.textContent = text + ' ';
+    const select = document.createElement('select');
+    select.innerHTML = '<option value="">Select a cluster...</option>';
+    availableContexts.forEach(context => {
+        const option = document.createElement('option');
+        option.value = context;
+        option.textContent = context;
+        select.appendChild(option);
+    });
+    if (onchange) {
+        select.addEventListener('change', () => onchange(select.value));
+    }
+    label.appendChild(select);
+    return label;
+}
+
+// Select a cluster for every entry of the banner, or only for those of one group
+function selectMissingClusters(cluster, group) {
+    const selector = group === undefined ? 'select[data-entry-id]' : `select[data-group="${group}"]`;
+    document.querySelectorAll(`#missing-clusters-entries ${selector}`).forEach(select => {
+        select.value = cluster;
+    });
+}
+
+// Assign the selected clusters to their config file entries and save the file
+async function assignMissingClusters() {
+    const assignments = {};
+    document.querySelectorAll('#missing-clusters-entries select[data-entry-id]').forEach(select => {
+        if (select.value) {
+            assignments[select.getAttribute('data-entry-id')] = select.value;
+        }
+    });
+    if (Object.keys(assignments).length === 0) {
+        showErrorMessage('Select the Kubernetes clusters to assign');
+        return;
+    }
+
+    try {
+        const response = await fetch(basePath + '/api/config/missing-clusters', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ assignments: assignments }),
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const data = await response.json();
+        configVersion = data.version;
+        data.updated.forEach(id => {
+            const select = document.querySelector(`[data-id="${id}"] select[data-field="cluster"]`);
+            if (select) {
+                select.setAttribute('data-selected', assignments[id]);
+                select.value = assignments[id];
+            }
+            const entry = document.querySelector(`#missing-clusters-entries select[data-entry-id="${id}"]`);
+            if (entry) {
+                const group = entry.closest('.missing-clusters-group');
+                entry.closest('label').remove();
+                if (!group.querySelector('select[data-entry-id]')) {
+                    group.remove();
+                }
+            }
+        });
+        if (!document.querySelector('#missing-clusters-entries select[data-entry-id]')) {
+            document.getElementById('missing-clusters-message').classList.remove('show');
+        }
+        showSuccessMessage(`Assigned clusters to ${data.updated.length} proxy configuration(s)`);
+    } catch (error) {
+        showErrorMessage(`Failed to assign the clusters: ${error.message}`);
+    }
+}
+
+// RDS endpoints from the last discovery, in table order
+let rdsEndpoints = [];
+
+// Fill the AWS profile and region selectors, preselecting AWS_PROFILE and AWS_REGION
+async function loadAWSOptions() {
+    if (!document.getElementById('rds-profile')) {
+        return;
+    }
+    try {
+        const [profiles, regions] = await Promise.all([
+            fetch(basePath + '/api/aws/profiles').then(response => response.json()),
+            fetch(basePath + '/api/aws/regions').then(response => response.json())
+        ]);
+        fillSelect('rds-profile', profiles.profiles || [], profiles.current);
+        fillSelect('rds-region', regions.regions || [], regions.current);
+    } catch (error) {
+        console.error('Failed to load AWS profiles and regions:', error);
+    }
+}
+
+function fillSelect(id, values, selected) {
+    const select = document.getElementById(id);
+    values.forEach(value => {
+        const option = document.createElement('option');
+        option.value = value;
+        option.textContent = value;
+        select.appendChild(option);
+    });
+    if (selected && values.includes(selected)) {
+        select.value = selected;
+    }
+}
+
+// List the available RDS endpoints of the selected profile and region
+async function discoverRDS() {
+    const profile = document.getElementById('rds-profile').value;
+    const region = document.getElementById('rds-region').value;
+    if (!profile || !region) {
+        showErrorMessage('Select an AWS profile and region to discover RDS endpoints');
+        return;
+    }
+
+    const params = new URLSearchParams({ profile: profile, region: region });
+    const names = document.getElementById('rds-names').value.trim();
+    if (names) {
+        params.set('names', names);
+    }
+
+    const stats = document.getElementById('rds-stats');
+    stats.textContent = 'Discovering...';
+    try {
+        const response = await fetch(basePath + '/api/aws/rds?' + params.toString());
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const data = await response.json();
+        rdsEndpoints = data.endpoints || [];
+        renderRDSEndpoints();
+    } catch (error) {
+        stats.textContent = '';
+        showErrorMessage(`Failed to discover RDS endpoints: ${error.message}`);
+    }
+}
+
+function renderRDSEndpoints() {
+    const tbody = document.getElementById('rds-endpoints');
+    tbody.innerHTML = '';
+    document.getElementById('rds-select-all').checked = false;
+
+    const imported = rdsEndpoints.filter(endpoint => endpoint.imported).length;
+    document.getElementById('rds-stats').textContent =
+        `${rdsEndpoints.length} endpoint(s), ${imported} already added`;
+
+    rdsEndpoints.forEach((endpoint, index) => {
+        const row = document.createElement('tr');
+        if (endpoint.imported) {
+            row.className = 'imported';
+        }
+
+        const select = document.createElement('td');
+        const checkbox = document.createElement('input');
+        checkbox.type = 'checkbox';
+        checkbox.value = index;
+        checkbox.disabled = endpoint.imported;
+        select.appendChild(checkbox);
+        row.appendChild(select);
+
+        [endpoint.name, endpoint.engine, endpoint.endpoint, endpoint.port, endpoint.imported ? 'Already added' : ''].forEach(value => {
+            const cell = document.createElement('td');
+            cell.textContent = value;
+            row.appendChild(cell);
+        });
+        tbody.appendChild(row);
+    });
+}
+
+function selectAllRDS(checked) {
+    document.querySelectorAll('#rds-endpoints input[type="checkbox"]:not(:disabled)').forEach(checkbox => {
+        checkbox.checked = checked;
+    });
+}
+
+// Add rows for the selected RDS endpoints; they are written on the next save
+async function importRDS() {
+    const cluster = document.getElementById('rds-cluster').value;
+    const selected = Array.from(document.querySelectorAll('#rds-endpoints input[type="checkbox"]:checked'))
+        .map(checkbox => rdsEndpoints[checkbox.value]);
+    if (selected.length === 0) {
+        showErrorMessage('Select the RDS endpoints to import');
+        return;
+    }
+    if (!cluster) {
+        showErrorMessage('Select the Kubernetes cluster the RDS endpoints are reached from');
+        return;
+    }
+
+    try {
+        const response = await fetch(basePath + '/api/aws/rds/import', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ cluster: cluster, endpoints: selected })
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const data = await response.json();
+        (data.rows || []).forEach(row => addRow(row));
+        selected.forEach(endpoint => endpoint.imported = true);
+        renderRDSEndpoints();
+        if (data.skipped > 0) {
+            showToast('warning', `${data.skipped} endpoint(s) were skipped because a row already points at them`);
+        }
+    } catch (error) {
+        showErrorMessage(`Failed to import RDS endpoints: ${error.message}`);
+    }
+}
+
+// Show every user's aproxymate pods in the selected cluster
+async function loadClusterPods() {
+    const context = document.getElementById('cluster-view-context').value;
+    if (!context) {
+        showErrorMessage('Select a cluster to list its pods');
+        return;
+    }
+
+    const stats = document.getElementById('cluster-view-stats');
+    stats.textContent = 'Loading...';
+    try {
+        const response = await fetch(basePath + '/api/cluster/pods?context=' + encodeURIComponent(context));
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const data = await response.json();
+        renderClusterPods(context, data.pods || []);
+    } catch (error) {
+        stats.textContent = '';
+        showErrorMessage(`Failed to list pods: ${error.message}`);
+    }
+}
+
+function renderClusterPods(context, pods) {
+    const tbody = document.getElementById('cluster-view-pods');
+    tbody.innerHTML = '';
+
+    const owners = new Set(pods.map(pod => pod.user));
+    document.getElementById('cluster-view-stats').textContent =
+        `${pods.length} pod(s) from ${owners.size} user(s)`;
+
+    pods.forEach(pod => {
+        const row = document.createElement('tr');
+        if (pod.mine) {
+            row.className = 'mine';
+        }
+        [pod.user, pod.namespace, pod.name, pod.target, formatAge(pod.createdAt), pod.phase].forEach(value => {
+            const cell = document.createElement('td');
+            cell.textContent = value || '';
+            row.appendChild(cell);
+        });
+
+        const actions = document.createElement('td');
+        if (pod.deletable) {
+            const button = document.createElement('button');
+            button.className = 'btn-delete';
+            button.textContent = '⌫';
+            button.title = 'Delete pod';
+            button.onclick = () => deleteClusterPod(context, pod);
+            actions.appendChild(button);
+        }
+        row.appendChild(actions);
+        tbody.appendChild(row);
+    });
+}
+
+async function deleteClusterPod(context, pod) {
+    if (!confirm(`Delete pod ${pod.name} owned by ${pod.user}?`)) {
+        return;
+    }
+    try {
+        const params = new URLSearchParams({ context: context, namespace: pod.namespace, name: pod.name });
+        const response = await fetch(basePath + '/api/cluster/pods?' + params, { method: 'DELETE' });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        showSuccessMessage(`Deleted pod ${pod.name}`);
+        loadClusterPods();
+    } catch (error) {
+        showErrorMessage(`Failed to delete pod: ${error.message}`);
+    }
+}
+
+// Format a timestamp as a short age such as "3h" or "2d"
+function formatAge(timestamp) {
+    const seconds = Math.floor((Date.now() - new Date(timestamp).getTime()) / 1000);
+    if (seconds < 60) return `${seconds}s`;
+    if (seconds < 3600) return `${Math.floor(seconds / 60)}m`;
+    if (seconds < 86400) return `${Math.floor(seconds / 3600)}h`;
+    return `${Math.floor(seconds / 86400)}d`;
+}
+
+// Show a banner when a newer release is available (only if update_check is enabled)
+async function checkForUpdate() {
+    try {
+        const response = await fetch(basePath + '/api/update');
+        if (!response.ok) {
+            return;
+        }
+        const data = await response.json();
+        if (!data.available) {
+            return;
+        }
+
+        document.getElementById('update-text').textContent =
+            `aproxymate ${data.latest} is available (you have ${data.current}).`;
+        document.getElementById('update-link').href = data.url;
+        document.getElementById('update-notes').textContent = data.notes || '';
+        document.getElementById('update-message').classList.add('show');
+    } catch (error) {
+        console.error('Failed to check for updates:', error);
+    }
+}
+
+// Check the actual status of all proxies
+async function checkStatus() {
+    try {
+        const response = await fetch(basePath + '/api/status');
+        applyStatus(await response.json());
+    } catch (error) {
+        console.error('Error checking status:', error);
+    }
+}
+
+// Update rows from an /api/status payload (polled or streamed)
+function applyStatus(data) {
+    proxyDetails = data.proxies || {};
+
+    // Update UI based on actual status
+    for (const [id, connected] of Object.entries(data.status)) {
+        const row = document.querySelector(`[data-id="${id}"]`);
+        if (row) {
+            renderRuntimeColumns(row, proxyDetails[id]);
+            const currentStatus = row.querySelector('.status-connected') ? true : false;
+            if (currentStatus !== connected) {
+                console.log(`Status changed for ID ${id}: ${currentStatus} -> ${connected}`);
+                updateRowStatus(id, connected);
+            } else {
+                renderStatusDetail(row.querySelector('div:nth-child(6)'), proxyDetails[id]);
+                if (!connected) {
+                    syncConnectButton(row, proxyDetails[id]);
+                }
+            }
+        }
+    }
+}
+
+// Search functionality: the server filters the rows, so large configs are matched by the
+// same rules as 'aproxymate config list --query'
+let searchSequence = 0;
+
+async function searchProxies() {
+    const searchInput = document.getElementById('search-input');
+    const searchTerm = searchInput.value.trim();
+    const rows = document.querySelectorAll('.proxy-row');
+    const searchClear = document.querySelector('.search-clear');
+    const searchStats = document.getElementById('search-stats');
+    const sequence = ++searchSequence;
+
+    let matching = null;
+    if (searchTerm !== '') {
+        try {
+            const response = await fetch(`${basePath}/api/proxy?query=${encodeURIComponent(searchTerm)}`);
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            const data = await response.json();
+            matching = new Set(data.proxies.map(proxy => proxy.id));
+        } catch (error) {
+            console.error('Error searching proxies:', error);
+        }
+    }
+    // A newer search was started while this one was waiting for the server
+    if (sequence !== searchSequence) {
+        return;
+    }
+
+    let visibleCount = 0;
+    rows.forEach(row => {
+        const visible = !matching || matching.has(row.dataset.id);
+        row.classList.toggle('hidden', !visible);
+        if (visible) {
+            visibleCount++;
+        }
+    });
+
+    updateGroups();
+
+    // Update search stats
+    if (searchTerm === '') {
+        searchStats.textContent = '';
+        searchClear.style.display = 'none';
+    } else {
+        searchStats.textContent = `Showing ${visibleCount} of ${rows.length} proxies`;
+        searchClear.style.display = 'block';
+    }
+}
+
+function clearSearch() {
+    const searchInput = document.getElementById('search-input');
+    searchInput.value = '';
+    searchProxies(); // This will show all rows and update stats
+    searchInput.focus();
+}
+
+// Add keyboard shortcut for search (Ctrl/Cmd + F)
+document.addEventListener('keydown', function(e) {
+    if ((e.ctrlKey || e.metaKey) && e.key === 'f') {
+        e.preventDefault();
+        const searchInput = document.getElementById('search-input');
+        searchInput.focus();
+        searchInput.select();
+    }
+
+    // ESC to clear search when focused on search input
+    if (e.key === 'Escape' && document.activeElement.id === 'search-input') {
+        clearSearch();
+    }
+});
+
+// Table sorting functionality
+let currentSort = { column: null, direction: 'asc' };
+
+function sortTable(column) {
+    const rows = Array.from(document.querySelectorAll('.proxy-row'));
+
+    // Toggle sort direction if clicking the same column
+    if (currentSort.column === column) {
+        currentSort.direction = currentSort.direction === 'asc' ? 'desc' : 'asc';
+    } else {
+        currentSort.column = column;
+        currentSort.direction = 'asc';
+    }
+
+    // Sort the rows
+    rows.sort((a, b) => {
+        let aVal, bVal;
+
+        switch (column) {
+            case 'cluster':
+                aVal = a.querySelector('[data-field="cluster"]').value.toLowerCase();
+                bVal = b.querySelector('[data-field="cluster"]').value.toLowerCase();
+                break;
+            case 'host':
+                aVal = a.querySelector('[data-field="host"]').value.toLowerCase();
+                bVal = b.querySelector('[data-field="host"]').value.toLowerCase();
+                break;
+            case 'localPort':
+                aVal = parseInt(a.querySelector('[data-field="local-port"]').value) || 0;
+                bVal = parseInt(b.querySelector('[data-field="local-port"]').value) || 0;
+                break;
+            case 'remotePort':
+                aVal = parseInt(a.querySelector('[data-field="remote-port"]').value) || 0;
+                bVal = parseInt(b.querySelector('[data-field="remote-port"]').value) || 0;
+                break;
+            case 'status':
+                aVal = a.querySelector('.status-connected') ? 'connected' : 'disconnected';
+                bVal = b.querySelector('.status-connected') ? 'connected' : 'disconnected';
+                break;
+            case 'uptime':
+                aVal = uptimeOf(a.dataset.id);
+                bVal = uptimeOf(b.dataset.id);
+                break;
+            default:
+                return 0;
+        }
+
+        let comparison = 0;
+        if (aVal < bVal) {
+            comparison = -1;
+        } else if (aVal > bVal) {
+            comparison = 1;
+        }
+
+        return currentSort.direction === 'desc' ? comparison * -1 : comparison;
+    });
+
+    // Update sort indicators
+    updateSortIndicators(column, currentSort.direction);
+
+    // Re-append sorted rows to their cluster's group
+    rows.forEach(row => row.parentElement.appendChild(row));
+
+    // Re-apply search filter after sorting
+    searchProxies();
+}
+
+function updateSortIndicators(activeColumn, direction) {
+    // Reset all indicators
+    document.querySelectorAll('.sortable-header').forEach(header => {
+        header.classList.remove('active');
+        const indicator = header.querySelector('.sort-indicator');
+        if (indicator) {
+            indicator.textContent = '↕';
+        }
+    });
+
+    // Set active indicator
+    const activeIndicator = document.querySelector(`[data-sort="${activeColumn}"]`);
+    if (activeIndicator) {
+        activeIndicator.parentElement.classList.add('active');
+        activeIndicator.textContent = direction === 'asc' ? '↑' : '↓';
+    }
+}
+
+function uptimeOf(id) {
+    const proxy = proxyDetails[id];
+    return proxy && proxy.connected ? proxy.uptimeSeconds : -1;
+}
+
+// Show the namespace, relay pod and uptime of a row from an /api/status entry
+function renderRuntimeColumns(row, proxy) {
+    const connected = !!proxy && proxy.connected;
+    row.querySelector('.proxy-namespace').textContent = proxy ? proxy.namespace || '' : '';
+    const pod = row.querySelector('.proxy-pod');
+    pod.textContent = connected ? proxy.podName || '' : '';
+    pod.title = pod.textContent;
+    row.querySelector('.proxy-uptime').textContent =
+        connected ? formatAge(Date.now() - proxy.uptimeSeconds * 1000) : '';
+}
+
+// Rows are grouped by cluster in collapsible sections; the collapsed clusters are remembered
+const collapsedGroupsKey = 'aproxymate.collapsedGroups';
+
+function collapsedGroups() {
+    try {
+        return JSON.parse(localStorage.getItem(collapsedGroupsKey)) || [];
+    } catch (error) {
+        return [];
+    }
+}
+
+// Return the rows container of a cluster's group, adding the group if it doesn't exist yet
+function groupRows(cluster) {
+    const container = document.getElementById('proxy-rows');
+    for (const group of container.querySelectorAll('.proxy-group')) {
+        if (group.dataset.cluster === cluster) {
+            return group.querySelector('.group-rows');
+        }
+    }
+
+    const group = document.createElement('section');
+    group.className = 'proxy-group';
+    group.dataset.cluster = cluster;
+    group.innerHTML = `
+        <button type="button" class="group-header" onclick="toggleGroup(this.parentElement)">
+            <span class="group-toggle">▾</span>
+            <span class="group-name"></span>
+            <span class="group-count"></span>
+        </button>
+        <div class="group-rows"></div>
+    `;
+    group.querySelector('.group-name').textContent = cluster || 'No cluster';
+    group.classList.toggle('collapsed', collapsedGroups().includes(cluster));
+    container.appendChild(group);
+    return group.querySelector('.group-rows');
+}
+
+// Move a row to the group of the cluster selected in it
+function moveToGroup(row) {
+    const cluster = row.querySelector('[data-field="cluster"]').value;
+    if (row.closest('.proxy-group').dataset.cluster !== cluster) {
+        groupRows(cluster).appendChild(row);
+        updateGroups();
+    }
+}
+
+// Update the counts of the groups, remove empty ones and hide those without search matches
+function updateGroups() {
+    document.querySelectorAll('.proxy-group').forEach(group => {
+        const rows = group.querySelectorAll('.proxy-row');
+        if (rows.length === 0) {
+            group.remove();
+            return;
+        }
+        const visible = group.querySelectorAll('.proxy-row:not(.hidden)').length;
+        group.querySelector('.group-count').textContent =
+            visible === rows.length ? rows.length : `${visible} of ${rows.length}`;
+        group.classList.toggle('hidden', visible === 0);
+    });
+}
+
+function toggleGroup(group) {
+    const collapsed = group.classList.toggle('collapsed');
+    const clusters = collapsedGroups().filter(cluster => cluster !== group.dataset.cluster);
+    if (collapsed) {
+        clusters.push(group.dataset.cluster);
+    }
+    localStorage.setItem(collapsedGroupsKey, JSON.stringify(clusters));
+}
+
+// Collapse the groups that were collapsed before the page was loaded
+function restoreCollapsedGroups() {
+    const collapsed = collapsedGroups();
+    document.querySelectorAll('.proxy-group').forEach(group => {
+        group.classList.toggle('collapsed', collapsed.includes(group.dataset.cluster));
+    });
+}
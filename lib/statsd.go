@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// StatsD line formats
+const (
+	StatsDFormatDogStatsD = "dogstatsd"
+	StatsDFormatStatsD    = "statsd"
+)
+
+// Defaults for StatsD settings left empty
+const (
+	defaultStatsDPrefix   = "aproxymate."
+	defaultStatsDInterval = 10
+)
+
+// StatsDConfig sends proxy lifecycle metrics to a StatsD or DogStatsD agent, e.g. the Datadog
+// agent, so tunnels show up in dashboards without a scrape target on every laptop
+type StatsDConfig struct {
+	// Address is the agent's UDP host:port, e.g. "127.0.0.1:8125"; metrics are only sent when set
+	Address string `json:"address,omitempty" mapstructure:"address" yaml:"address,omitempty"`
+	// Format is "dogstatsd" (default), which adds proxy and cluster tags, or "statsd" without tags
+	Format string `json:"format,omitempty" mapstructure:"format" yaml:"format,omitempty"`
+	// Prefix starts every metric name (default "aproxymate.")
+	Prefix string `json:"prefix,omitempty" mapstructure:"prefix" yaml:"prefix,omitempty"`
+	// Tags are added to every DogStatsD metric, e.g. {"team": "payments"}
+	Tags map[string]string `json:"tags,omitempty" mapstructure:"tags" yaml:"tags,omitempty"`
+	// Interval is the number of seconds between gauge reports (default 10)
+	Interval int `json:"interval,omitempty" mapstructure:"interval" yaml:"interval,omitempty"`
+}
+
+// Enabled reports whether an agent address is configured
+func (c StatsDConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// Validate checks the address, format and interval
+func (c StatsDConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("address %q must be host:port", c.Address)
+	}
+	switch c.Format {
+	case "", StatsDFormatDogStatsD, StatsDFormatStatsD:
+	default:
+		return fmt.Errorf("invalid format %q: must be dogstatsd or statsd", c.Format)
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	return nil
+}
+
+// statsdEmitter writes metrics to the agent, one UDP packet per metric
+type statsdEmitter struct {
+	conn      net.Conn
+	prefix    string
+	tags      []string
+	dogStatsD bool
+	// sent holds the byte counts already reported per proxy ID; used by the gauge loop only
+	sent map[string]ForwarderStats
+}
+
+// StartStatsDEmitter counts ProxyManager events and reports connection gauges to the StatsD agent
+// every interval until the returned stop function is called. Metrics are sent over UDP, so an
+// agent that isn't running only loses them.
+func StartStatsDEmitter(manager *ProxyManager, config StatsDConfig) (func(), error) {
+	if !config.Enabled() {
+		return func() {}, nil
+	}
+
+	conn, err := net.Dial("udp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send metrics to StatsD agent %s: %w", config.Address, err)
+	}
+
+	emitter := &statsdEmitter{
+		conn:      conn,
+		prefix:    config.Prefix,
+		dogStatsD: config.Format != StatsDFormatStatsD,
+		sent:      make(map[string]ForwarderStats),
+	}
+	if emitter.prefix == "" {
+		emitter.prefix = defaultStatsDPrefix
+	}
+	for key, value := range config.Tags {
+		emitter.tags = append(emitter.tags, statsdTag(key, value))
+	}
+	sort.Strings(emitter.tags)
+	interval := config.Interval
+	if interval == 0 {
+		interval = defaultStatsDInterval
+	}
+
+	events, unsubscribe := manager.Subscribe()
+	go func() {
+		for event := range events {
+			emitter.event(event)
+		}
+	}()
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				emitter.gauges(manager)
+			}
+		}
+	}()
+
+	format := StatsDFormatDogStatsD
+	if !emitter.dogStatsD {
+		format = StatsDFormatStatsD
+	}
+	log.Info("StatsD metrics enabled", "address", config.Address, "format", format, "interval", interval)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			unsubscribe()
+			close(stop)
+			conn.Close()
+		})
+	}, nil
+}
+
+// event counts a lifecycle event as <prefix>proxy.<event type>
+func (e *statsdEmitter) event(event ProxyEvent) {
+	if !isKnownProxyEvent(event.Type) {
+		return
+	}
+	tags := []string{statsdTag("proxy", event.ProxyID), statsdTag("cluster", event.Cluster)}
+	if event.Type == ProxyEventStateChanged {
+		tags = append(tags, statsdTag("state", string(event.State)))
+	}
+	e.send("proxy."+string(event.Type), "1", "c", tags)
+}
+
+// gauges reports the number of connected proxies and open client connections. DogStatsD also
+// gets them per proxy, with the bytes relayed since the last report.
+func (e *statsdEmitter) gauges(manager *ProxyManager) {
+	statuses := manager.Status()
+	active := 0
+	for id, status := range statuses {
+		active += status.Stats.ActiveConnections
+		if !e.dogStatsD {
+			continue
+		}
+
+		tags := []string{statsdTag("proxy", id), statsdTag("cluster", status.Cluster)}
+		e.send("proxy.connections.active", fmt.Sprint(status.Stats.ActiveConnections), "g", tags)
+		// A reconnected proxy starts counting from zero again
+		sent := e.sent[id]
+		if status.Stats.BytesIn < sent.BytesIn || status.Stats.BytesOut < sent.BytesOut {
+			sent = ForwarderStats{}
+		}
+		if delta := status.Stats.BytesIn - sent.BytesIn; delta > 0 {
+			e.send("proxy.bytes_in", fmt.Sprint(delta), "c", tags)
+		}
+		if delta := status.Stats.BytesOut - sent.BytesOut; delta > 0 {
+			e.send("proxy.bytes_out", fmt.Sprint(delta), "c", tags)
+		}
+		e.sent[id] = status.Stats
+	}
+	for id := range e.sent {
+		if _, connected := statuses[id]; !connected {
+			delete(e.sent, id)
+		}
+	}
+
+	e.send("proxies.connected", fmt.Sprint(len(statuses)), "g", nil)
+	e.send("connections.active", fmt.Sprint(active), "g", nil)
+}
+
+// send writes one metric line, e.g. "aproxymate.proxy.dropped:1|c|#proxy:orders-db"
+func (e *statsdEmitter) send(name, value, metricType string, tags []string) {
+	line := e.prefix + name + ":" + value + "|" + metricType
+	if e.dogStatsD {
+		if all := append(append([]string(nil), e.tags...), tags...); len(all) > 0 {
+			line += "|#" + strings.Join(all, ",")
+		}
+	}
+	if _, err := e.conn.Write([]byte(line)); err != nil {
+		log.Debug("Failed to send StatsD metric", "metric", name, "error", err)
+	}
+}
+
+// statsdTag formats a DogStatsD tag, replacing the characters that separate tags and fields
+func statsdTag(key, value string) string {
+	replacer := strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_")
+	return replacer.Replace(key) + ":" + replacer.Replace(value)
+}
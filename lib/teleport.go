@@ -0,0 +1,206 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// ErrTeleportSessionExpired is returned when a Teleport-backed context has no valid tsh session
+var ErrTeleportSessionExpired = errors.New("teleport session expired or not logged in")
+
+// TeleportContextInfo describes a kubeconfig context whose credentials are issued by tsh
+type TeleportContextInfo struct {
+	// Context is the kubeconfig context name
+	Context string
+	// ProxyAddr is the Teleport proxy address (from the --proxy exec argument)
+	ProxyAddr string
+	// TeleportCluster is the Teleport cluster name (from the --teleport-cluster exec argument)
+	TeleportCluster string
+	// KubeCluster is the Teleport Kubernetes cluster name (from the --kube-cluster exec argument)
+	KubeCluster string
+}
+
+// TeleportSession represents the active tsh profile as reported by `tsh status`
+type TeleportSession struct {
+	ProfileURL string    `json:"profile_url"`
+	Username   string    `json:"username"`
+	Cluster    string    `json:"cluster"`
+	ValidUntil time.Time `json:"valid_until"`
+}
+
+// tshStatus mirrors the subset of `tsh status --format=json` we rely on
+type tshStatus struct {
+	Active *TeleportSession `json:"active"`
+}
+
+// GetTeleportContextInfo returns Teleport details for a context, or nil if the context does not use tsh
+func GetTeleportContextInfo(kubeconfigPath, contextName string) (*TeleportContextInfo, error) {
+	config, err := loadKubeconfig(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+
+	kubeContext, ok := config.Contexts[contextName]
+	if !ok {
+		return nil, fmt.Errorf("context %s not found in kubeconfig", contextName)
+	}
+
+	authInfo, ok := config.AuthInfos[kubeContext.AuthInfo]
+	if !ok || authInfo.Exec == nil {
+		return nil, nil
+	}
+
+	// tsh-generated kubeconfigs use `tsh kube credentials` as the exec plugin
+	command := strings.TrimSuffix(filepath.Base(authInfo.Exec.Command), ".exe")
+	if command != "tsh" {
+		return nil, nil
+	}
+
+	info := &TeleportContextInfo{Context: contextName}
+	for _, arg := range authInfo.Exec.Args {
+		switch {
+		case strings.HasPrefix(arg, "--proxy="):
+			info.ProxyAddr = strings.TrimPrefix(arg, "--proxy=")
+		case strings.HasPrefix(arg, "--teleport-cluster="):
+			info.TeleportCluster = strings.TrimPrefix(arg, "--teleport-cluster=")
+		case strings.HasPrefix(arg, "--kube-cluster="):
+			info.KubeCluster = strings.TrimPrefix(arg, "--kube-cluster=")
+		}
+	}
+
+	return info, nil
+}
+
+// GetTeleportSession returns the active tsh session, or ErrTeleportSessionExpired if there is none
+func GetTeleportSession(ctx context.Context) (*TeleportSession, error) {
+	if _, err := exec.LookPath("tsh"); err != nil {
+		return nil, fmt.Errorf("tsh not found in PATH: %w", err)
+	}
+
+	output, err := exec.CommandContext(ctx, "tsh", "status", "--format=json").Output()
+	if err != nil {
+		// tsh exits non-zero when not logged in
+		return nil, ErrTeleportSessionExpired
+	}
+
+	var status tshStatus
+	if err := json.Unmarshal(output, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse tsh status output: %w", err)
+	}
+
+	if status.Active == nil || !status.Active.ValidUntil.After(time.Now()) {
+		return nil, ErrTeleportSessionExpired
+	}
+
+	return status.Active, nil
+}
+
+// CheckTeleportSession verifies that a Teleport-backed context has a valid tsh session.
+// Contexts that are not backed by Teleport always pass.
+func CheckTeleportSession(kubeconfigPath, contextName string) error {
+	info, err := GetTeleportContextInfo(kubeconfigPath, contextName)
+	if err != nil || info == nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := GetTeleportSession(ctx)
+	if err != nil {
+		log.Debug("Teleport session check failed", "context", contextName, "proxy", info.ProxyAddr, "error", err)
+		if errors.Is(err, ErrTeleportSessionExpired) {
+			return fmt.Errorf("%w for context '%s'. Please run: %s", ErrTeleportSessionExpired, contextName, info.LoginCommand())
+		}
+		return err
+	}
+
+	log.Debug("Teleport session is valid", "context", contextName, "user", session.Username, "valid_until", session.ValidUntil)
+	return nil
+}
+
+// LoginCommand returns the tsh command a user should run to refresh credentials for this context
+func (t *TeleportContextInfo) LoginCommand() string {
+	cmd := "tsh login"
+	if t.ProxyAddr != "" {
+		cmd += " --proxy=" + t.ProxyAddr
+	}
+	if t.TeleportCluster != "" {
+		cmd += " " + t.TeleportCluster
+	}
+	return cmd
+}
+
+// TeleportLogin runs an interactive `tsh login` followed by `tsh kube login` for the context
+func TeleportLogin(info *TeleportContextInfo) error {
+	args := []string{"login"}
+	if info.ProxyAddr != "" {
+		args = append(args, "--proxy="+info.ProxyAddr)
+	}
+	if info.TeleportCluster != "" {
+		args = append(args, info.TeleportCluster)
+	}
+
+	loginCmd := exec.Command("tsh", args...)
+	loginCmd.Stdin = os.Stdin
+	loginCmd.Stdout = os.Stdout
+	loginCmd.Stderr = os.Stderr
+	if err := loginCmd.Run(); err != nil {
+		return fmt.Errorf("tsh login failed: %w", err)
+	}
+
+	if info.KubeCluster != "" {
+		kubeLoginCmd := exec.Command("tsh", "kube", "login", info.KubeCluster)
+		kubeLoginCmd.Stdout = os.Stdout
+		kubeLoginCmd.Stderr = os.Stderr
+		if err := kubeLoginCmd.Run(); err != nil {
+			return fmt.Errorf("tsh kube login failed: %w", err)
+		}
+	}
+
+	// tsh rewrites the kubeconfig
+	InvalidateKubeconfigCache()
+	return nil
+}
+
+// EnsureTeleportSessionTUI checks the Teleport session for a context and offers to re-login when it has expired
+func EnsureTeleportSessionTUI(kubeconfigPath, contextName string) error {
+	err := CheckTeleportSession(kubeconfigPath, contextName)
+	if err == nil || !errors.Is(err, ErrTeleportSessionExpired) {
+		return err
+	}
+
+	info, infoErr := GetTeleportContextInfo(kubeconfigPath, contextName)
+	if infoErr != nil {
+		return infoErr
+	}
+
+	items := []string{"Yes, run tsh login now", "No, skip"}
+	title := "🔐 Teleport Session Expired\n\n" +
+		fmt.Sprintf("Context '%s' is accessed through Teleport and your session has expired.\n\n", contextName) +
+		"Would you like to log in again?"
+
+	selected, selErr := SelectFromSlice(title, items, "No options available")
+	if selErr != nil || selected != items[0] {
+		return err
+	}
+
+	if err := TeleportLogin(info); err != nil {
+		return err
+	}
+
+	return CheckTeleportSession(kubeconfigPath, contextName)
+}
@@ -0,0 +1,128 @@
+//go:build tray
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"time"
+
+	"fyne.io/systray"
+
+	log "aproxymate/lib/logger"
+)
+
+// TraySupported reports whether this build includes the system tray
+const TraySupported = true
+
+// RunTray shows a system tray icon with the proxy summary and shortcuts for favorite proxies.
+// It must be called from the main goroutine and blocks for the life of the process; Quit
+// requests a GUI shutdown, after which the caller exits.
+func RunTray(g *GUI, guiURL string, openURL func(string) error) error {
+	systray.Run(func() { setupTray(g, guiURL, openURL) }, func() {})
+	return nil
+}
+
+// setupTray builds the tray menu and keeps it in sync with the proxy state
+func setupTray(g *GUI, guiURL string, openURL func(string) error) {
+	systray.SetTooltip("aproxymate")
+
+	openItem := systray.AddMenuItem("Open aproxymate", "Open the web GUI")
+	systray.AddSeparator()
+
+	favorites := g.Summary().Favorites
+	items := make(map[string]*systray.MenuItem, len(favorites))
+	for _, favorite := range favorites {
+		item := systray.AddMenuItemCheckbox(favorite.Name, "Connect or disconnect "+favorite.Name, favorite.Connected)
+		items[favorite.ID] = item
+
+		go func(id, name string, item *systray.MenuItem) {
+			for range item.ClickedCh {
+				if err := g.ToggleProxy(id); err != nil {
+					log.Warn("Tray toggle failed", "proxy_id", id, "error", err)
+					SendDesktopNotification("aproxymate: "+name, err.Error())
+				}
+			}
+		}(favorite.ID, favorite.Name, item)
+	}
+	if len(favorites) == 0 {
+		hint := systray.AddMenuItem("No favorites (set favorite: true in the config)", "")
+		hint.Disable()
+	}
+
+	systray.AddSeparator()
+	quitItem := systray.AddMenuItem("Quit", "Disconnect all proxies and quit")
+
+	go func() {
+		for {
+			select {
+			case <-openItem.ClickedCh:
+				if err := openURL(guiURL); err != nil {
+					log.Warn("Failed to open browser from tray", "url", guiURL, "error", err)
+				}
+			case <-quitItem.ClickedCh:
+				g.RequestShutdown("quit from tray")
+			}
+		}
+	}()
+
+	events, _ := g.manager.Subscribe()
+	refresh := func() {
+		summary := g.Summary()
+		systray.SetTitle(fmt.Sprintf("%d/%d", summary.Connected, summary.Total))
+		systray.SetTooltip(fmt.Sprintf("aproxymate %s: %d connected, %d failed", summary.Version, summary.Connected, summary.Failed))
+
+		switch {
+		case summary.Failed > 0:
+			systray.SetIcon(trayIcon(color.RGBA{R: 0xd9, G: 0x3f, B: 0x3f, A: 0xff}))
+		case summary.Connected > 0:
+			systray.SetIcon(trayIcon(color.RGBA{R: 0x2e, G: 0xa0, B: 0x43, A: 0xff}))
+		default:
+			systray.SetIcon(trayIcon(color.RGBA{R: 0x8a, G: 0x8a, B: 0x8a, A: 0xff}))
+		}
+
+		for _, favorite := range summary.Favorites {
+			if item, ok := items[favorite.ID]; ok {
+				if favorite.Connected {
+					item.Check()
+				} else {
+					item.Uncheck()
+				}
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			refresh()
+			select {
+			case <-events:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// trayIcon renders a filled circle as a PNG icon
+func trayIcon(fill color.Color) []byte {
+	const size = 22
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	center, radius := float64(size-1)/2, float64(size)/2-2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x)-center, float64(y)-center
+			if dx*dx+dy*dy <= radius*radius {
+				img.Set(x, y, fill)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
@@ -0,0 +1,13 @@
+//go:build !tray
+
+package lib
+
+import "errors"
+
+// TraySupported reports whether this build includes the system tray
+const TraySupported = false
+
+// RunTray is unavailable in builds without the "tray" build tag
+func RunTray(g *GUI, guiURL string, openURL func(string) error) error {
+	return errors.New("this build of aproxymate does not include system tray support; rebuild with: go build -tags tray")
+}
@@ -0,0 +1,438 @@
+package lib
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// UpdateRepository is the GitHub repository checked for new releases
+var UpdateRepository = "david-cik/aproxymate"
+
+// updateCheckInterval is how long a release lookup is cached between checks
+const updateCheckInterval = 24 * time.Hour
+
+// ReleaseAsset is a downloadable file attached to a release
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// ReleaseInfo describes a published aproxymate release
+type ReleaseInfo struct {
+	Version     string         `json:"tag_name"`
+	URL         string         `json:"html_url"`
+	Notes       string         `json:"body"`
+	PublishedAt time.Time      `json:"published_at"`
+	Assets      []ReleaseAsset `json:"assets"`
+}
+
+// UpdateStatus is the result of comparing the running version with the latest release
+type UpdateStatus struct {
+	Current   string `json:"current"`
+	Latest    string `json:"latest"`
+	Available bool   `json:"available"`
+	URL       string `json:"url,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+}
+
+// updateCache is the on-disk record of the last release lookup
+type updateCache struct {
+	CheckedAt time.Time   `json:"checkedAt"`
+	Release   ReleaseInfo `json:"release"`
+}
+
+// FetchLatestRelease looks up the latest published release on GitHub
+func FetchLatestRelease(ctx context.Context) (*ReleaseInfo, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", UpdateRepository)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "aproxymate/"+Version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for updates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to check for updates: GitHub returned %s", resp.Status)
+	}
+
+	var release ReleaseInfo
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("failed to parse release information: %w", err)
+	}
+	return &release, nil
+}
+
+// CheckForUpdate compares the running version with the latest release. Lookups are cached
+// for a day so that frequent CLI runs don't hit the GitHub API every time.
+func CheckForUpdate(ctx context.Context) (*UpdateStatus, error) {
+	release, err := cachedLatestRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpdateStatus{
+		Current:   Version,
+		Latest:    release.Version,
+		Available: IsNewerVersion(release.Version, Version),
+		URL:       release.URL,
+		Notes:     release.Notes,
+	}, nil
+}
+
+// cachedLatestRelease returns the cached release if it is recent, otherwise fetches and caches it
+func cachedLatestRelease(ctx context.Context) (*ReleaseInfo, error) {
+	cachePath := updateCachePath()
+	if cachePath != "" {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var cache updateCache
+			if json.Unmarshal(data, &cache) == nil && time.Since(cache.CheckedAt) < updateCheckInterval {
+				return &cache.Release, nil
+			}
+		}
+	}
+
+	release, err := FetchLatestRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if cachePath != "" {
+		data, _ := json.Marshal(updateCache{CheckedAt: time.Now(), Release: *release})
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			if err := os.WriteFile(cachePath, data, 0644); err != nil {
+				log.Debug("Failed to cache update check", "path", cachePath, "error", err)
+			}
+		}
+	}
+	return release, nil
+}
+
+// updateCachePath returns the file used to cache release lookups, or "" if there is no cache directory
+func updateCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "aproxymate", "update-check.json")
+}
+
+// IsNewerVersion reports whether latest is a newer semantic version than current.
+// Development builds never report updates since their version can't be compared.
+func IsNewerVersion(latest, current string) bool {
+	latestParts, latestPre, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	currentParts, currentPre, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+
+	for i := range latestParts {
+		if latestParts[i] != currentParts[i] {
+			return latestParts[i] > currentParts[i]
+		}
+	}
+	// A release is newer than a pre-release of the same version
+	return currentPre != "" && (latestPre == "" || comparePreRelease(latestPre, currentPre) > 0)
+}
+
+// comparePreRelease orders pre-release suffixes such as "rc9" and "rc10" or "beta.2" and
+// "beta.10". Identifiers are compared dot by dot; within an identifier, runs of digits are
+// compared as numbers and other runs as text, and a number sorts before text as in semver.
+func comparePreRelease(a, b string) int {
+	aIDs, bIDs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		if c := comparePreReleaseIdentifier(aIDs[i], bIDs[i]); c != 0 {
+			return c
+		}
+	}
+	// A longer suffix with the same leading identifiers is newer, e.g. "rc.1" after "rc"
+	return cmp.Compare(len(aIDs), len(bIDs))
+}
+
+// comparePreReleaseIdentifier compares one dot-separated pre-release identifier
+func comparePreReleaseIdentifier(a, b string) int {
+	for a != "" && b != "" {
+		aRun, aDigits := leadingRun(a)
+		bRun, bDigits := leadingRun(b)
+		a, b = a[len(aRun):], b[len(bRun):]
+
+		var c int
+		switch {
+		case aDigits && bDigits:
+			c = compareDigits(aRun, bRun)
+		case aDigits:
+			c = -1
+		case bDigits:
+			c = 1
+		default:
+			c = strings.Compare(aRun, bRun)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// leadingRun returns the leading run of digits or non-digits of s, and whether it is digits
+func leadingRun(s string) (string, bool) {
+	digits := s[0] >= '0' && s[0] <= '9'
+	end := 1
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9') == digits {
+		end++
+	}
+	return s[:end], digits
+}
+
+// compareDigits compares two runs of digits as numbers of any length
+func compareDigits(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if c := cmp.Compare(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// parseVersion splits "v1.2.3-rc1" into its numeric parts and pre-release suffix
+func parseVersion(version string) ([3]int, string, bool) {
+	var parts [3]int
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	version, _, _ = strings.Cut(version, "+")
+	version, pre, _ := strings.Cut(version, "-")
+
+	fields := strings.Split(version, ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return parts, "", false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return parts, "", false
+		}
+		parts[i] = n
+	}
+	return parts, pre, true
+}
+
+// FindReleaseAsset returns the release asset built for the given platform
+func FindReleaseAsset(release *ReleaseInfo, goos, goarch string) (*ReleaseAsset, error) {
+	for i, asset := range release.Assets {
+		name := strings.ToLower(asset.Name)
+		if assetForPlatform(name, goos, goarch) && !strings.Contains(name, "checksums") {
+			return &release.Assets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release %s has no binary for %s/%s", release.Version, goos, goarch)
+}
+
+// assetForPlatform reports whether an asset name such as "aproxymate_1.2.0_linux_arm64.tar.gz"
+// carries the whole "_<os>_<arch>" token, so that linux/arm doesn't pick the arm64 build
+func assetForPlatform(name, goos, goarch string) bool {
+	token := "_" + goos + "_" + goarch
+	for {
+		i := strings.Index(name, token)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(token):]
+		if name == "" || strings.ContainsRune("._-", rune(name[0])) {
+			return true
+		}
+	}
+}
+
+// ErrReleaseUnverifiable is returned when a release has no checksums file to verify its download against
+var ErrReleaseUnverifiable = errors.New("the release has no checksums file to verify the download against")
+
+// UpgradeBinary downloads the release binary for this platform and replaces the running executable.
+// The download must match the release's checksums unless skipVerify is set. It returns the path
+// of the replaced executable.
+func UpgradeBinary(ctx context.Context, release *ReleaseInfo, skipVerify bool) (string, error) {
+	asset, err := FindReleaseAsset(release, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate the running executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exePath); err == nil {
+		exePath = resolved
+	}
+
+	log.Debug("Downloading release asset", "asset", asset.Name, "url", asset.URL)
+	data, err := downloadReleaseFile(ctx, asset.URL)
+	if err != nil {
+		return "", err
+	}
+
+	if skipVerify {
+		log.Warn("Installing release without checksum verification", "version", release.Version, "asset", asset.Name)
+	} else if err := verifyReleaseChecksum(ctx, release, asset.Name, data); err != nil {
+		return "", err
+	}
+
+	binary, err := extractBinary(asset.Name, data)
+	if err != nil {
+		return "", err
+	}
+
+	// Write next to the executable so the final rename stays on one filesystem
+	tmpPath := exePath + ".new"
+	if err := os.WriteFile(tmpPath, binary, 0755); err != nil {
+		return "", fmt.Errorf("cannot write new binary (try running with sufficient permissions): %w", err)
+	}
+
+	// Windows can't replace a running executable, but it can rename it out of the way
+	oldPath := exePath + ".old"
+	os.Remove(oldPath)
+	if err := os.Rename(exePath, oldPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("cannot replace %s: %w", exePath, err)
+	}
+	if err := os.Rename(tmpPath, exePath); err != nil {
+		os.Rename(oldPath, exePath)
+		return "", fmt.Errorf("cannot replace %s: %w", exePath, err)
+	}
+	if runtime.GOOS != "windows" {
+		os.Remove(oldPath)
+	}
+
+	return exePath, nil
+}
+
+// downloadReleaseFile fetches a release file into memory
+func downloadReleaseFile(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "aproxymate/"+Version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: %s returned %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifyReleaseChecksum checks the asset against the release's checksums file. Releases without
+// one fail with ErrReleaseUnverifiable.
+func verifyReleaseChecksum(ctx context.Context, release *ReleaseInfo, assetName string, data []byte) error {
+	var checksumsURL string
+	for _, asset := range release.Assets {
+		if strings.Contains(strings.ToLower(asset.Name), "checksums") {
+			checksumsURL = asset.URL
+			break
+		}
+	}
+	if checksumsURL == "" {
+		return fmt.Errorf("cannot install %s: %w", release.Version, ErrReleaseUnverifiable)
+	}
+
+	checksums, err := downloadReleaseFile(ctx, checksumsURL)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == assetName {
+			if !strings.EqualFold(fields[0], actual) {
+				return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", assetName, fields[0], actual)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("checksums file has no entry for %s", assetName)
+}
+
+// extractBinary returns the aproxymate executable from a raw, .tar.gz or .zip release asset
+func extractBinary(assetName string, data []byte) ([]byte, error) {
+	name := strings.ToLower(assetName)
+
+	switch {
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive %s: %w", assetName, err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid archive %s: %w", assetName, err)
+			}
+			if header.Typeflag == tar.TypeReg && isBinaryName(header.Name) {
+				return io.ReadAll(tr)
+			}
+		}
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive %s: %w", assetName, err)
+		}
+		for _, file := range zr.File {
+			if !file.FileInfo().IsDir() && isBinaryName(file.Name) {
+				rc, err := file.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(rc)
+			}
+		}
+	default:
+		return data, nil
+	}
+
+	return nil, errors.New("release archive does not contain an aproxymate binary")
+}
+
+// isBinaryName reports whether an archive entry is the aproxymate executable
+func isBinaryName(path string) bool {
+	base := filepath.Base(path)
+	return base == "aproxymate" || base == "aproxymate.exe"
+}
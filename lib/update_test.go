@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestIsNewerVersion(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.2.0", "v1.1.9", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.1.0", "v1.2.0", false},
+		{"v1.2.0", "v1.2.0-rc1", true},
+		{"v1.2.0-rc1", "v1.2.0", false},
+		{"v1.2.0-rc10", "v1.2.0-rc9", true},
+		{"v1.2.0-rc9", "v1.2.0-rc10", false},
+		{"v1.2.0-beta.10", "v1.2.0-beta.2", true},
+		{"v1.2.0-rc1", "v1.2.0-beta5", true},
+		{"v1.2.0-rc.1", "v1.2.0-rc", true},
+		{"v1.2.0-rc02", "v1.2.0-rc2", false},
+		{"v1.2.0", "dev", false},
+	}
+	for _, tt := range tests {
+		if got := IsNewerVersion(tt.latest, tt.current); got != tt.want {
+			t.Errorf("IsNewerVersion(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestFindReleaseAsset(t *testing.T) {
+	release := &ReleaseInfo{
+		Version: "v1.2.0",
+		Assets: []ReleaseAsset{
+			{Name: "aproxymate_1.2.0_checksums.txt"},
+			{Name: "aproxymate_1.2.0_linux_arm64.tar.gz"},
+			{Name: "aproxymate_1.2.0_linux_arm.tar.gz"},
+			{Name: "aproxymate_1.2.0_linux_amd64.tar.gz"},
+			{Name: "aproxymate_1.2.0_windows_amd64.zip"},
+		},
+	}
+	tests := []struct {
+		goos, goarch string
+		want         string
+	}{
+		{"linux", "arm", "aproxymate_1.2.0_linux_arm.tar.gz"},
+		{"linux", "arm64", "aproxymate_1.2.0_linux_arm64.tar.gz"},
+		{"linux", "amd64", "aproxymate_1.2.0_linux_amd64.tar.gz"},
+		{"windows", "amd64", "aproxymate_1.2.0_windows_amd64.zip"},
+		{"darwin", "arm64", ""},
+	}
+	for _, tt := range tests {
+		asset, err := FindReleaseAsset(release, tt.goos, tt.goarch)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("FindReleaseAsset(%s/%s) = %s, want an error", tt.goos, tt.goarch, asset.Name)
+		case tt.want != "" && err != nil:
+			t.Errorf("FindReleaseAsset(%s/%s): %v", tt.goos, tt.goarch, err)
+		case tt.want != "" && asset.Name != tt.want:
+			t.Errorf("FindReleaseAsset(%s/%s) = %s, want %s", tt.goos, tt.goarch, asset.Name, tt.want)
+		}
+	}
+
+	// Without the arm build, linux/arm must not fall back to arm64
+	armless := &ReleaseInfo{Version: "v1.2.0", Assets: []ReleaseAsset{{Name: "aproxymate_1.2.0_linux_arm64.tar.gz"}}}
+	if asset, err := FindReleaseAsset(armless, "linux", "arm"); err == nil {
+		t.Errorf("FindReleaseAsset(linux/arm) = %s, want an error", asset.Name)
+	}
+}
+
+func TestVerifyReleaseChecksumWithoutChecksums(t *testing.T) {
+	release := &ReleaseInfo{Version: "v1.2.0", Assets: []ReleaseAsset{{Name: "aproxymate_1.2.0_linux_amd64.tar.gz"}}}
+	err := verifyReleaseChecksum(context.Background(), release, release.Assets[0].Name, []byte("binary"))
+	if !errors.Is(err, ErrReleaseUnverifiable) {
+		t.Errorf("verifyReleaseChecksum = %v, want %v", err, ErrReleaseUnverifiable)
+	}
+}
@@ -0,0 +1,319 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// usageRetentionDays is how many days of usage are kept in the stats file
+const usageRetentionDays = 90
+
+// usageSampleInterval is how often the usage of connected proxies is added to the stats file
+const usageSampleInterval = time.Minute
+
+// usageDateFormat is the local calendar day usage is recorded under
+const usageDateFormat = "2006-01-02"
+
+// UsageDay is a proxy's usage on one day
+type UsageDay struct {
+	Date             string `json:"date"`
+	Connects         int    `json:"connects"`
+	ConnectedSeconds int64  `json:"connectedSeconds"`
+	BytesIn          int64  `json:"bytesIn"`
+	BytesOut         int64  `json:"bytesOut"`
+	// Cluster is the Kubernetes context the proxy's relay pods ran in
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// UsageHistory holds the recorded days of each proxy by proxy name and date
+type UsageHistory map[string]map[string]UsageDay
+
+// ProxyUsage is a proxy's total usage over a period
+type ProxyUsage struct {
+	Name string `json:"name"`
+	// Configured is set for proxies in the current config; others have been renamed or removed
+	Configured       bool   `json:"configured"`
+	Connects         int    `json:"connects"`
+	ConnectedSeconds int64  `json:"connectedSeconds"`
+	BytesIn          int64  `json:"bytesIn"`
+	BytesOut         int64  `json:"bytesOut"`
+	LastUsed         string `json:"lastUsed,omitempty"`
+	// PodHours and Cost are filled in by CostConfig.EstimateCost
+	PodHours float64 `json:"podHours"`
+	Cost     float64 `json:"cost"`
+	// Days lists the days with usage, oldest first
+	Days []UsageDay `json:"days"`
+}
+
+// usageStatsPath returns the file recording proxy usage
+func usageStatsPath() string {
+	return filepath.Join(stateDir(), "usage-stats.json")
+}
+
+// usageKey is the name a proxy's usage is recorded under
+func usageKey(spec ProxySpec) string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+	return fmt.Sprintf("%s:%d", spec.RemoteHost, spec.LocalPort)
+}
+
+// LoadUsageHistory reads the recorded proxy usage. A missing file is an empty history.
+func LoadUsageHistory() (UsageHistory, error) {
+	path := usageStatsPath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return UsageHistory{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage stats %s: %w", path, err)
+	}
+
+	history := UsageHistory{}
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse usage stats %s: %w", path, err)
+	}
+	return history, nil
+}
+
+// add adds usage to a proxy's day
+func (h UsageHistory) add(name string, day UsageDay) {
+	if h[name] == nil {
+		h[name] = make(map[string]UsageDay)
+	}
+	current := h[name][day.Date]
+	current.Date = day.Date
+	if day.Cluster != "" {
+		current.Cluster = day.Cluster
+	}
+	current.Connects += day.Connects
+	current.ConnectedSeconds += day.ConnectedSeconds
+	current.BytesIn += day.BytesIn
+	current.BytesOut += day.BytesOut
+	h[name][day.Date] = current
+}
+
+// prune drops days before the given date
+func (h UsageHistory) prune(oldest string) {
+	for name, days := range h {
+		for date := range days {
+			if date < oldest {
+				delete(days, date)
+			}
+		}
+		if len(days) == 0 {
+			delete(h, name)
+		}
+	}
+}
+
+// Summarize totals the usage of the last days days (today included) per proxy. The configured
+// proxies are included without any usage too, so tunnels that are never used stand out.
+func (h UsageHistory) Summarize(configured []string, days int, now time.Time) []ProxyUsage {
+	oldest := now.AddDate(0, 0, -(days - 1)).Format(usageDateFormat)
+
+	usage := make(map[string]*ProxyUsage)
+	for _, name := range configured {
+		usage[name] = &ProxyUsage{Name: name, Configured: true, Days: []UsageDay{}}
+	}
+	for name, recorded := range h {
+		total, exists := usage[name]
+		if !exists {
+			total = &ProxyUsage{Name: name, Days: []UsageDay{}}
+		}
+		for _, date := range slices.Sorted(maps.Keys(recorded)) {
+			if date < oldest {
+				continue
+			}
+			day := recorded[date]
+			total.Connects += day.Connects
+			total.ConnectedSeconds += day.ConnectedSeconds
+			total.BytesIn += day.BytesIn
+			total.BytesOut += day.BytesOut
+			total.LastUsed = date
+			total.Days = append(total.Days, day)
+		}
+		if total.Configured || len(total.Days) > 0 {
+			usage[name] = total
+		}
+	}
+
+	summary := make([]ProxyUsage, 0, len(usage))
+	for _, name := range slices.Sorted(maps.Keys(usage)) {
+		summary = append(summary, *usage[name])
+	}
+	return summary
+}
+
+// usageRecorder collects usage in memory and adds it to the stats file on flush. The file is
+// re-read on every flush, so several aproxymate processes can record into it.
+type usageRecorder struct {
+	mu      sync.Mutex
+	pending UsageHistory
+}
+
+// addConnect counts a connect of the proxy
+func (r *usageRecorder) addConnect(spec ProxySpec, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending.add(usageKey(spec), UsageDay{Date: at.Format(usageDateFormat), Cluster: spec.KubernetesCluster, Connects: 1})
+}
+
+// addTraffic records the time between from and to, split by day, and the bytes moved meanwhile,
+// which are counted on the day of to
+func (r *usageRecorder) addTraffic(spec ProxySpec, from, to time.Time, bytesIn, bytesOut int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := usageKey(spec)
+	for from.Before(to) {
+		year, month, day := from.Date()
+		nextDay := time.Date(year, month, day+1, 0, 0, 0, 0, from.Location())
+		end := to
+		if nextDay.Before(to) {
+			end = nextDay
+		}
+		r.pending.add(name, UsageDay{Date: from.Format(usageDateFormat), Cluster: spec.KubernetesCluster, ConnectedSeconds: int64(end.Sub(from).Seconds())})
+		from = end
+	}
+	r.pending.add(name, UsageDay{Date: to.Format(usageDateFormat), Cluster: spec.KubernetesCluster, BytesIn: bytesIn, BytesOut: bytesOut})
+}
+
+// flush adds the collected usage to the stats file
+func (r *usageRecorder) flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) == 0 {
+		return nil
+	}
+
+	history, err := LoadUsageHistory()
+	if err != nil {
+		// Start over rather than stop recording because of a damaged file
+		log.Warn("Replacing unreadable usage stats", "error", err)
+		history = UsageHistory{}
+	}
+	for name, days := range r.pending {
+		for _, day := range days {
+			history.add(name, day)
+		}
+	}
+	history.prune(time.Now().AddDate(0, 0, -usageRetentionDays).Format(usageDateFormat))
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := usageStatsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create usage stats directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write usage stats: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write usage stats: %w", err)
+	}
+
+	r.pending = UsageHistory{}
+	return nil
+}
+
+// usageMeter remembers how much of a connected proxy's usage has been recorded
+type usageMeter struct {
+	mu       sync.Mutex
+	sampled  time.Time
+	bytesIn  int64
+	bytesOut int64
+}
+
+// RecordUsage starts recording the usage of this manager's proxies in the stats file shown by
+// `aproxymate stats`. The returned function records the remaining usage and stops.
+func (m *ProxyManager) RecordUsage() func() {
+	recorder := &usageRecorder{pending: UsageHistory{}}
+	m.mu.Lock()
+	m.usage = recorder
+	m.mu.Unlock()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(usageSampleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.mu.RLock()
+				proxies := slices.Collect(maps.Values(m.proxies))
+				m.mu.RUnlock()
+				for _, proxy := range proxies {
+					m.sampleUsage(proxy)
+				}
+				if err := recorder.flush(); err != nil {
+					log.Warn("Failed to record proxy usage", "error", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+
+			m.mu.Lock()
+			proxies := slices.Collect(maps.Values(m.proxies))
+			m.usage = nil
+			m.mu.Unlock()
+			for _, proxy := range proxies {
+				recordProxyUsage(recorder, proxy)
+			}
+			if err := recorder.flush(); err != nil {
+				log.Warn("Failed to record proxy usage", "error", err)
+			}
+		})
+	}
+}
+
+// sampleUsage records a proxy's connected time and traffic since the previous sample
+func (m *ProxyManager) sampleUsage(proxy *managedProxy) {
+	m.mu.RLock()
+	recorder := m.usage
+	m.mu.RUnlock()
+	if recorder != nil {
+		recordProxyUsage(recorder, proxy)
+	}
+}
+
+// recordProxyUsage adds a proxy's unrecorded usage to the recorder
+func recordProxyUsage(recorder *usageRecorder, proxy *managedProxy) {
+	stats := proxy.forwarder.Stats()
+	now := time.Now()
+
+	meter := &proxy.usage
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+	if meter.sampled.IsZero() {
+		meter.sampled = proxy.connectedAt
+	}
+	recorder.addTraffic(proxy.spec, meter.sampled, now, stats.BytesIn-meter.bytesIn, stats.BytesOut-meter.bytesOut)
+	meter.sampled = now
+	meter.bytesIn = stats.BytesIn
+	meter.bytesOut = stats.BytesOut
+}
@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultVaultDatabaseMount is the mount path of the database secrets engine when none is configured
+const DefaultVaultDatabaseMount = "database"
+
+// vaultRequestTimeout bounds every request to Vault
+const vaultRequestTimeout = 10 * time.Second
+
+// VaultConfig holds the connection settings for HashiCorp Vault. Empty fields fall back to
+// the VAULT_ADDR, VAULT_NAMESPACE and VAULT_TOKEN environment variables and ~/.vault-token,
+// the same sources the vault CLI uses.
+type VaultConfig struct {
+	Address   string `json:"address,omitempty" mapstructure:"address" yaml:"address,omitempty"`
+	Namespace string `json:"namespace,omitempty" mapstructure:"namespace" yaml:"namespace,omitempty"`
+}
+
+// VaultCredentialsConfig selects the database secrets engine role a proxy gets credentials from
+type VaultCredentialsConfig struct {
+	// Mount is the path the database secrets engine is mounted at (default "database")
+	Mount string `json:"mount,omitempty" mapstructure:"mount" yaml:"mount,omitempty"`
+	// Role is the role credentials are generated for; Vault is not used when empty
+	Role string `json:"role,omitempty" mapstructure:"role" yaml:"role,omitempty"`
+}
+
+// Enabled reports whether the proxy gets its credentials from Vault
+func (c VaultCredentialsConfig) Enabled() bool {
+	return c.Role != ""
+}
+
+// mount returns the configured mount path without surrounding slashes
+func (c VaultCredentialsConfig) mount() string {
+	if mount := strings.Trim(c.Mount, "/"); mount != "" {
+		return mount
+	}
+	return DefaultVaultDatabaseMount
+}
+
+// VaultCredentials are short-lived database credentials leased from Vault
+type VaultCredentials struct {
+	Username  string    `json:"username"`
+	Password  string    `json:"-"`
+	LeaseID   string    `json:"-"`
+	Renewable bool      `json:"renewable"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// vaultSecret mirrors the parts of a Vault secret response we use
+type vaultSecret struct {
+	LeaseID       string            `json:"lease_id"`
+	LeaseDuration int               `json:"lease_duration"`
+	Renewable     bool              `json:"renewable"`
+	Data          map[string]string `json:"data"`
+}
+
+// vaultClient sends authenticated requests to the Vault HTTP API
+type vaultClient struct {
+	address   string
+	namespace string
+	token     string
+	http      *http.Client
+}
+
+// newVaultClient resolves the Vault address and token from the config and the environment
+func newVaultClient(config VaultConfig) (*vaultClient, error) {
+	address := config.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("no Vault address configured; set 'vault.address' in the configuration or VAULT_ADDR")
+	}
+
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no Vault token found; run 'vault login' or set VAULT_TOKEN")
+	}
+
+	return &vaultClient{
+		address:   strings.TrimSuffix(address, "/"),
+		namespace: namespace,
+		token:     token,
+		http:      &http.Client{Timeout: vaultRequestTimeout},
+	}, nil
+}
+
+// do sends a request to the Vault API and decodes the response into out, if given
+func (c *vaultClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.address+"/v1/"+path, reader)
+	if err != nil {
+		return fmt.Errorf("invalid Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	req.Header.Set("X-Vault-Request", "true")
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach Vault at %s: %w", c.address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		message := strings.Join(failure.Errors, "; ")
+		if message == "" {
+			message = resp.Status
+		}
+		if resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("Vault denied access to %s (run 'vault login' if your token expired): %s", path, message)
+		}
+		return fmt.Errorf("Vault request to %s failed: %s", path, message)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("invalid response from Vault: %w", err)
+		}
+	}
+	return nil
+}
+
+// IssueVaultCredentials generates database credentials for the configured role
+func IssueVaultCredentials(ctx context.Context, config VaultConfig, creds VaultCredentialsConfig) (*VaultCredentials, error) {
+	client, err := newVaultClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret vaultSecret
+	if err := client.do(ctx, http.MethodGet, creds.mount()+"/creds/"+creds.Role, nil, &secret); err != nil {
+		return nil, err
+	}
+	if secret.Data["username"] == "" {
+		return nil, fmt.Errorf("Vault returned no username for role '%s' at '%s'", creds.Role, creds.mount())
+	}
+
+	now := time.Now()
+	return &VaultCredentials{
+		Username:  secret.Data["username"],
+		Password:  secret.Data["password"],
+		LeaseID:   secret.LeaseID,
+		Renewable: secret.Renewable,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(time.Duration(secret.LeaseDuration) * time.Second),
+	}, nil
+}
+
+// RenewVaultLease extends a credentials lease and returns its new expiry. Vault may grant
+// less than asked for when the lease approaches its maximum TTL.
+func RenewVaultLease(ctx context.Context, config VaultConfig, leaseID string) (time.Time, error) {
+	client, err := newVaultClient(config)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var secret vaultSecret
+	if err := client.do(ctx, http.MethodPut, "sys/leases/renew", map[string]string{"lease_id": leaseID}, &secret); err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second), nil
+}
+
+// RevokeVaultLease revokes a credentials lease so the database user is dropped right away
+func RevokeVaultLease(ctx context.Context, config VaultConfig, leaseID string) error {
+	if leaseID == "" {
+		return errors.New("no lease to revoke")
+	}
+	client, err := newVaultClient(config)
+	if err != nil {
+		return err
+	}
+	return client.do(ctx, http.MethodPut, "sys/leases/revoke", map[string]string{"lease_id": leaseID}, nil)
+}
@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Build information, set at build time with:
+//
+//	go build -ldflags "-X aproxymate/lib.Version=v1.2.3 -X aproxymate/lib.Commit=$(git rev-parse --short HEAD) -X aproxymate/lib.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// BuildInfo describes the running aproxymate binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// GetBuildInfo returns the version information embedded at build time
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
+// invalidLabelChars matches characters not allowed in Kubernetes label values
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// versionLabelValue returns the version as a valid Kubernetes label value
+func versionLabelValue() string {
+	value := invalidLabelChars.ReplaceAllString(Version, "_")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	// Label values must begin and end with an alphanumeric character
+	value = strings.Trim(value, "._-")
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
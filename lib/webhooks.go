@@ -0,0 +1,215 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	log "aproxymate/lib/logger"
+)
+
+// Webhook payload formats
+const (
+	WebhookFormatJSON  = "json"
+	WebhookFormatSlack = "slack"
+)
+
+// defaultWebhookEvents are delivered when a webhook does not list its events
+var defaultWebhookEvents = []ProxyEventType{
+	ProxyEventConnected,
+	ProxyEventDropped,
+	ProxyEventReconnectExhausted,
+	ProxyEventPodFailed,
+}
+
+// WebhookConfig describes an HTTP endpoint notified about proxy lifecycle events
+type WebhookConfig struct {
+	URL string `json:"url" mapstructure:"url" yaml:"url"`
+	// Format is "json" (default) for the raw event or "slack" for a Slack-compatible message
+	Format string `json:"format,omitempty" mapstructure:"format" yaml:"format,omitempty"`
+	// Events limits which event types are sent; empty sends connected, dropped, reconnect_exhausted and pod_failed
+	Events []string `json:"events,omitempty" mapstructure:"events" yaml:"events,omitempty"`
+}
+
+// Validate checks the webhook URL, format and event names
+func (w WebhookConfig) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q: must be an http or https URL", w.URL)
+	}
+
+	switch w.Format {
+	case "", WebhookFormatJSON, WebhookFormatSlack:
+	default:
+		return fmt.Errorf("invalid format %q: must be json or slack", w.Format)
+	}
+
+	for _, event := range w.Events {
+		if !isKnownProxyEvent(ProxyEventType(event)) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// wants reports whether the webhook should receive the event type
+func (w WebhookConfig) wants(eventType ProxyEventType) bool {
+	if len(w.Events) == 0 {
+		for _, event := range defaultWebhookEvents {
+			if event == eventType {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, event := range w.Events {
+		if ProxyEventType(event) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownProxyEvent reports whether the event type is emitted by the ProxyManager
+func isKnownProxyEvent(eventType ProxyEventType) bool {
+	switch eventType {
+	case ProxyEventConnected, ProxyEventDisconnected, ProxyEventDropped, ProxyEventConnectFailed,
+		ProxyEventPodFailed, ProxyEventReconnected, ProxyEventReconnectExhausted, ProxyEventStateChanged,
+		ProxyEventPodDeleted, ProxyEventCredentialsRotated:
+		return true
+	}
+	return false
+}
+
+// webhookPayload is the body sent to generic JSON webhooks
+type webhookPayload struct {
+	Source   string     `json:"source"`
+	Hostname string     `json:"hostname"`
+	User     string     `json:"user"`
+	Event    ProxyEvent `json:"event"`
+}
+
+// StartWebhookNotifier delivers ProxyManager events to the configured webhooks until the
+// returned stop function is called. Deliveries are sequential and failures are only logged.
+func StartWebhookNotifier(manager *ProxyManager, webhooks []WebhookConfig) func() {
+	if len(webhooks) == 0 {
+		return func() {}
+	}
+
+	events, unsubscribe := manager.Subscribe()
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	go func() {
+		for event := range events {
+			for _, webhook := range webhooks {
+				if !webhook.wants(event.Type) {
+					continue
+				}
+				if err := sendWebhook(client, webhook, event); err != nil {
+					log.Warn("Failed to deliver webhook", "url", redactURL(webhook.URL), "event", event.Type, "proxy_id", event.ProxyID, "error", err)
+				} else {
+					log.Debug("Delivered webhook", "url", redactURL(webhook.URL), "event", event.Type, "proxy_id", event.ProxyID)
+				}
+			}
+		}
+	}()
+
+	log.Debug("Webhook notifier started", "webhooks", len(webhooks))
+	return unsubscribe
+}
+
+// sendWebhook posts a single event to a webhook
+func sendWebhook(client *http.Client, webhook WebhookConfig, event ProxyEvent) error {
+	var body any
+	if webhook.Format == WebhookFormatSlack {
+		body = map[string]string{"text": describeProxyEvent(event)}
+	} else {
+		hostname, _ := os.Hostname()
+		body = webhookPayload{
+			Source:   "aproxymate",
+			Hostname: hostname,
+			User:     eventUser(event),
+			Event:    event,
+		}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(webhook.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// eventUser returns the logged-in user an event happened for, or the OS user
+func eventUser(event ProxyEvent) string {
+	if event.User != "" {
+		return event.User
+	}
+	return podLabelUser()
+}
+
+// describeProxyEvent renders an event as a short human-readable message
+func describeProxyEvent(event ProxyEvent) string {
+	name := event.ProxyName
+	if name == "" {
+		name = "proxy " + event.ProxyID
+	}
+
+	var text string
+	switch event.Type {
+	case ProxyEventConnected:
+		text = fmt.Sprintf(":large_green_circle: %s connected", name)
+	case ProxyEventDisconnected:
+		text = fmt.Sprintf(":white_circle: %s disconnected", name)
+	case ProxyEventDropped:
+		text = fmt.Sprintf(":red_circle: %s disconnected unexpectedly", name)
+	case ProxyEventReconnected:
+		text = fmt.Sprintf(":large_green_circle: %s reconnected", name)
+	case ProxyEventReconnectExhausted:
+		text = fmt.Sprintf(":red_circle: %s could not be reconnected", name)
+	case ProxyEventPodFailed:
+		text = fmt.Sprintf(":warning: Relay pod for %s failed", name)
+	case ProxyEventConnectFailed:
+		text = fmt.Sprintf(":warning: %s failed to connect", name)
+	case ProxyEventPodDeleted:
+		text = fmt.Sprintf(":wastebasket: Relay pod for %s deleted", name)
+	case ProxyEventStateChanged:
+		text = fmt.Sprintf(":information_source: %s is %s (was %s)", name, event.State, event.PreviousState)
+	case ProxyEventCredentialsRotated:
+		text = fmt.Sprintf(":key: New database credentials for %s", name)
+	default:
+		text = fmt.Sprintf("%s: %s", name, event.Type)
+	}
+
+	if event.Cluster != "" {
+		text += fmt.Sprintf(" (cluster %s, user %s)", event.Cluster, eventUser(event))
+	}
+	if event.Message != "" {
+		text += "\n" + event.Message
+	}
+	return text
+}
+
+// redactURL strips the path and query from a URL for logging, since webhook URLs often embed secrets
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid url)"
+	}
+	return u.Scheme + "://" + u.Host
+}